@@ -0,0 +1,95 @@
+package hefty
+
+import (
+	"context"
+
+	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+var (
+	_ HeftySqsAPI = (*SqsClientWrapper)(nil)
+	_ HeftySnsAPI = (*SnsClientWrapper)(nil)
+	_ SqsAPI      = (*sqs.Client)(nil)
+	_ SnsAPI      = (*sns.Client)(nil)
+	_ KinesisAPI  = (*kinesis.Client)(nil)
+	_ S3API       = (*s3.Client)(nil)
+)
+
+// HeftySqsAPI is the API of the Hefty SQS client wrapper for sending, receiving and deleting messages. Applications can
+// depend on it instead of *SqsClientWrapper to mock the wrapper in unit tests.
+type HeftySqsAPI interface {
+	SendHeftyMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	SendHeftyMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+	ReceiveHeftyMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteHeftyMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	ChangeHeftyMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+// HeftySnsAPI is the API of the Hefty SNS client wrapper for publishing messages. Applications can depend on it instead of
+// *SnsClientWrapper to mock the wrapper in unit tests.
+type HeftySnsAPI interface {
+	PublishHeftyMessage(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// SqsAPI is the part of the AWS SQS client used by the Hefty SQS client wrapper, so that fakes or instrumented clients can
+// be given to NewSqsClientWrapperFromAPI
+type SqsAPI interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+	GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error)
+	DeleteQueue(ctx context.Context, params *sqs.DeleteQueueInput, optFns ...func(*sqs.Options)) (*sqs.DeleteQueueOutput, error)
+	PurgeQueue(ctx context.Context, params *sqs.PurgeQueueInput, optFns ...func(*sqs.Options)) (*sqs.PurgeQueueOutput, error)
+}
+
+// SnsAPI is the part of the AWS SNS client used by the Hefty SNS client wrapper, so that fakes or instrumented clients can
+// be given to NewSnsClientWrapperFromAPI
+type SnsAPI interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// KinesisAPI is the part of the AWS Kinesis client used by the Hefty Kinesis client wrapper, so that fakes or instrumented
+// clients can be given to NewKinesisClientWrapperFromAPI
+type KinesisAPI interface {
+	PutRecord(ctx context.Context, params *kinesis.PutRecordInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordOutput, error)
+	PutRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error)
+	GetRecords(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error)
+}
+
+// S3API is the part of the AWS S3 client used to store, get and delete hefty messages. WithAutoCreateBucket,
+// WithBucketPosture and WithPresignedUrls also need the bucket configuration operations of *s3.Client.
+type S3API interface {
+	s3manager.UploadAPIClient
+	s3manager.DownloadAPIClient
+	s3.HeadBucketAPIClient
+	s3.HeadObjectAPIClient
+	s3.ListObjectsV2APIClient
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+	GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
+	PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error)
+	GetObjectRetention(ctx context.Context, params *s3.GetObjectRetentionInput, optFns ...func(*s3.Options)) (*s3.GetObjectRetentionOutput, error)
+	GetObjectLegalHold(ctx context.Context, params *s3.GetObjectLegalHoldInput, optFns ...func(*s3.Options)) (*s3.GetObjectLegalHoldOutput, error)
+}
+
+// clientRegion returns the region of an AWS SDK client that has its options, or an empty string
+func clientRegion(client any) string {
+	switch client := client.(type) {
+	case interface{ Options() sqs.Options }:
+		return client.Options().Region
+	case interface{ Options() sns.Options }:
+		return client.Options().Region
+	case interface{ Options() kinesis.Options }:
+		return client.Options().Region
+	case interface{ Options() s3.Options }:
+		return client.Options().Region
+	}
+
+	return ""
+}
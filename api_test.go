@@ -0,0 +1,116 @@
+package hefty
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSqsAPI records the bodies of sent messages
+type fakeSqsAPI struct {
+	SqsAPI
+	bodies []string
+}
+
+func (client *fakeSqsAPI) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	client.bodies = append(client.bodies, aws.ToString(params.MessageBody))
+	return &sqs.SendMessageOutput{MessageId: aws.String("id")}, nil
+}
+
+// fakeSnsAPI records the published messages
+type fakeSnsAPI struct {
+	SnsAPI
+	messages []string
+}
+
+func (client *fakeSnsAPI) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	client.messages = append(client.messages, aws.ToString(params.Message))
+	return &sns.PublishOutput{MessageId: aws.String("id")}, nil
+}
+
+// fakeS3API records the keys of stored objects
+type fakeS3API struct {
+	S3API
+	keys []string
+}
+
+func (client *fakeS3API) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if _, err := io.Copy(io.Discard, params.Body); err != nil {
+		return nil, err
+	}
+
+	client.keys = append(client.keys, aws.ToString(params.Key))
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestNewSqsClientWrapperFromAPI(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		expectErr bool
+	}{
+		{
+			name: "fake clients",
+			opts: []Option{WithSkipBucketCheck()},
+		},
+		{
+			name:      "presigned urls need an s3 client",
+			opts:      []Option{WithSkipBucketCheck(), WithPresignedUrls(time.Hour)},
+			expectErr: true,
+		},
+		{
+			name:      "automatic bucket creation needs an s3 client",
+			opts:      []Option{WithAutoCreateBucket(BucketDefaults{})},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sqsClient := &fakeSqsAPI{}
+			s3Client := &fakeS3API{}
+
+			wrapper, err := NewSqsClientWrapperFromAPI(sqsClient, s3Client, "bucket", test.opts...)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			_, err = wrapper.SendHeftyMessage(context.TODO(), &sqs.SendMessageInput{
+				QueueUrl:    aws.String("https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue"),
+				MessageBody: aws.String(strings.Repeat("a", 300*1024)),
+			})
+			assert.NoError(t, err)
+			assert.Len(t, s3Client.keys, 1)
+			assert.Len(t, sqsClient.bodies, 1)
+			assert.True(t, types.IsReferenceMsg(sqsClient.bodies[0]))
+		})
+	}
+}
+
+func TestNewSnsClientWrapperFromAPI(t *testing.T) {
+	snsClient := &fakeSnsAPI{}
+	s3Client := &fakeS3API{}
+
+	wrapper, err := NewSnsClientWrapperFromAPI(snsClient, s3Client, "bucket", WithSkipBucketCheck())
+	assert.NoError(t, err)
+
+	_, err = wrapper.PublishHeftyMessage(context.TODO(), &sns.PublishInput{
+		TopicArn: aws.String("arn:aws:sns:us-west-2:765908583888:MyTopic"),
+		Message:  aws.String(strings.Repeat("a", 300*1024)),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, s3Client.keys, 1)
+	assert.Len(t, snsClient.messages, 1)
+	assert.Contains(t, snsClient.messages[0], s3Client.keys[0])
+}
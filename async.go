@@ -0,0 +1,40 @@
+package hefty
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// SendResult is the result of SendHeftyMessageAsync
+type SendResult struct {
+	Output *sqs.SendMessageOutput
+	Err    error
+}
+
+// SendHeftyMessageAsync sends a message with SendHeftyMessage in the background and returns a channel that receives its
+// result, so that uploading a hefty message to AWS S3 overlaps with other work of the caller:
+//
+//	result := sqsHeftyClient.SendHeftyMessageAsync(ctx, params)
+//	// other work
+//	sent := <-result
+//	if sent.Err != nil {
+//		// the message was not sent
+//	}
+//
+// The channel receives exactly one result and is never closed. Cancelling `ctx` cancels the send. `params` must not be
+// changed until the result was received.
+func (wrapper *SqsClientWrapper) SendHeftyMessageAsync(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) <-chan SendResult {
+	return sendAsync(ctx, wrapper, params, optFns...)
+}
+
+func sendAsync(ctx context.Context, client producerClient, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) <-chan SendResult {
+	// buffered so that the send completes even when the result is never received
+	result := make(chan SendResult, 1)
+	go func() {
+		out, err := client.SendHeftyMessage(ctx, params, optFns...)
+		result <- SendResult{Output: out, Err: err}
+	}()
+
+	return result
+}
@@ -0,0 +1,20 @@
+package hefty
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendAsync(t *testing.T) {
+	client := &fakeProducerClient{}
+
+	result := sendAsync(context.Background(), client, &sqs.SendMessageInput{QueueUrl: aws.String("orders"), MessageBody: aws.String("order")})
+	sent := <-result
+	assert.NoError(t, sent.Err)
+	assert.Equal(t, "single", aws.ToString(sent.Output.MessageId))
+	assert.Equal(t, []string{"order"}, client.single)
+}
@@ -0,0 +1,105 @@
+package hefty
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go/middleware"
+)
+
+const attachedMiddlewareId = "HeftyAttached"
+
+// attachedKey marks the context of a call made by an attached client wrapper, so that a client wrapper whose own client
+// is attached calls AWS SQS or AWS SNS instead of itself
+type attachedKey struct{}
+
+// AttachToSqsClient returns an AWS SQS client option that makes the SendMessage, ReceiveMessage, DeleteMessage and
+// ChangeMessageVisibility calls of an ordinary client behave like SendHeftyMessage, ReceiveHeftyMessage,
+// DeleteHeftyMessage and ChangeHeftyMessageVisibility, so that hefty messages can be adopted without changing every call
+// site:
+//
+//	sqsClient := sqs.NewFromConfig(cfg, sqsHeftyClient.AttachToSqsClient())
+//
+// The calls are made with the clients of the wrapper, so options given to a single call of the attached client are
+// ignored. Batch calls are passed through unchanged, so hefty messages are not stored for messages sent with
+// SendMessageBatch and the receipt handles of hefty messages cannot be used with DeleteMessageBatch.
+func (wrapper *SqsClientWrapper) AttachToSqsClient() func(*sqs.Options) {
+	return func(opts *sqs.Options) {
+		opts.APIOptions = append(opts.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(attachedMiddlewareId, wrapper.handleAttached), middleware.Before)
+		})
+	}
+}
+
+// handleAttached makes a call of an attached AWS SQS client with the client wrapper
+func (wrapper *SqsClientWrapper) handleAttached(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	if ctx.Value(attachedKey{}) != nil {
+		return next.HandleInitialize(ctx, in)
+	}
+	ctx = context.WithValue(ctx, attachedKey{}, true)
+
+	switch params := in.Parameters.(type) {
+	case *sqs.SendMessageInput:
+		out, err := wrapper.SendHeftyMessage(ctx, params)
+		if err != nil {
+			return middleware.InitializeOutput{}, middleware.Metadata{}, err
+		}
+		return middleware.InitializeOutput{Result: out}, out.ResultMetadata, nil
+	case *sqs.ReceiveMessageInput:
+		out, err := wrapper.ReceiveHeftyMessage(ctx, params)
+		if err != nil {
+			return middleware.InitializeOutput{}, middleware.Metadata{}, err
+		}
+		return middleware.InitializeOutput{Result: out}, out.ResultMetadata, nil
+	case *sqs.DeleteMessageInput:
+		out, err := wrapper.DeleteHeftyMessage(ctx, params)
+		if out == nil {
+			return middleware.InitializeOutput{}, middleware.Metadata{}, err
+		}
+		// the reference message was deleted when the output is returned with a *PayloadDeleteError
+		return middleware.InitializeOutput{Result: out}, out.ResultMetadata, err
+	case *sqs.ChangeMessageVisibilityInput:
+		out, err := wrapper.ChangeHeftyMessageVisibility(ctx, params)
+		if err != nil {
+			return middleware.InitializeOutput{}, middleware.Metadata{}, err
+		}
+		return middleware.InitializeOutput{Result: out}, out.ResultMetadata, nil
+	}
+
+	return next.HandleInitialize(ctx, in)
+}
+
+// AttachToSnsClient returns an AWS SNS client option that makes the Publish calls of an ordinary client behave like
+// PublishHeftyMessage:
+//
+//	snsClient := sns.NewFromConfig(cfg, snsHeftyClient.AttachToSnsClient())
+//
+// The calls are made with the clients of the wrapper, so options given to a single call of the attached client are
+// ignored. PublishBatch calls are passed through unchanged.
+func (wrapper *SnsClientWrapper) AttachToSnsClient() func(*sns.Options) {
+	return func(opts *sns.Options) {
+		opts.APIOptions = append(opts.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(attachedMiddlewareId, wrapper.handleAttached), middleware.Before)
+		})
+	}
+}
+
+// handleAttached makes a call of an attached AWS SNS client with the client wrapper
+func (wrapper *SnsClientWrapper) handleAttached(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	if ctx.Value(attachedKey{}) != nil {
+		return next.HandleInitialize(ctx, in)
+	}
+
+	params, ok := in.Parameters.(*sns.PublishInput)
+	if !ok {
+		return next.HandleInitialize(ctx, in)
+	}
+
+	out, err := wrapper.PublishHeftyMessage(context.WithValue(ctx, attachedKey{}, true), params)
+	if err != nil {
+		return middleware.InitializeOutput{}, middleware.Metadata{}, err
+	}
+
+	return middleware.InitializeOutput{Result: out}, out.ResultMetadata, nil
+}
@@ -0,0 +1,90 @@
+package hefty
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSqsTransport serves the AWS SQS json protocol for a single queue
+type fakeSqsTransport struct {
+	bodies  []string
+	deleted []string
+}
+
+func (transport *fakeSqsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var params map[string]interface{}
+	_ = json.NewDecoder(req.Body).Decode(&params)
+
+	response := "{}"
+	switch strings.TrimPrefix(req.Header.Get("X-Amz-Target"), "AmazonSQS.") {
+	case "SendMessage":
+		transport.bodies = append(transport.bodies, params["MessageBody"].(string))
+		response = `{"MessageId":"id"}`
+	case "ReceiveMessage":
+		msgs := []map[string]string{}
+		for _, body := range transport.bodies {
+			msgs = append(msgs, map[string]string{"MessageId": "id", "ReceiptHandle": "handle", "Body": body})
+		}
+		encoded, _ := json.Marshal(map[string]interface{}{"Messages": msgs})
+		response = string(encoded)
+	case "DeleteMessage":
+		transport.deleted = append(transport.deleted, params["ReceiptHandle"].(string))
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/x-amz-json-1.0"}},
+		Body:       io.NopCloser(bytes.NewReader([]byte(response))),
+		Request:    req,
+	}, nil
+}
+
+func TestAttachToSqsClient(t *testing.T) {
+	transport := &fakeSqsTransport{}
+	sqsOptions := sqs.Options{
+		Region:           "us-west-2",
+		HTTPClient:       &http.Client{Transport: transport},
+		RetryMaxAttempts: 1,
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	}
+
+	store := &memoryStore{payloads: map[string][]byte{}}
+	wrapper := &SqsClientWrapper{
+		Client:         *sqs.New(sqsOptions),
+		storage:        &payloadStorage{payloadStore: store, payloadMaxSize: 1024},
+		alwaysSendToS3: true,
+	}
+	// the wrapper may use an attached client itself
+	wrapper.Client = *sqs.New(sqsOptions, wrapper.AttachToSqsClient())
+	client := sqs.New(sqsOptions, wrapper.AttachToSqsClient())
+	queueUrl := aws.String("https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue")
+
+	_, err := client.SendMessage(context.TODO(), &sqs.SendMessageInput{QueueUrl: queueUrl, MessageBody: aws.String("hefty message")})
+	assert.NoError(t, err)
+	assert.Len(t, transport.bodies, 1)
+	assert.True(t, types.IsReferenceMsg(transport.bodies[0]))
+	assert.Len(t, store.payloads, 1)
+
+	out, err := client.ReceiveMessage(context.TODO(), &sqs.ReceiveMessageInput{QueueUrl: queueUrl})
+	assert.NoError(t, err)
+	assert.Len(t, out.Messages, 1)
+	assert.Equal(t, "hefty message", aws.ToString(out.Messages[0].Body))
+	assert.NotEqual(t, "handle", aws.ToString(out.Messages[0].ReceiptHandle))
+
+	_, err = client.DeleteMessage(context.TODO(), &sqs.DeleteMessageInput{QueueUrl: queueUrl, ReceiptHandle: out.Messages[0].ReceiptHandle})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"handle"}, transport.deleted)
+	assert.Empty(t, store.payloads)
+}
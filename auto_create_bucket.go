@@ -0,0 +1,126 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// defaultExpirationDays is the default number of days after which hefty messages expire in an automatically created
+// bucket, which is the maximum retention period of AWS SQS
+const defaultExpirationDays = 14
+
+// BucketDefaults is the configuration of the buckets created by WithAutoCreateBucket
+type BucketDefaults struct {
+	// Region is the AWS region the bucket is created in. The region of the AWS S3 client is used when empty.
+	Region string
+	// Encryption is the default encryption algorithm of the bucket. AES256 is used when empty.
+	Encryption s3types.ServerSideEncryption
+	// KmsKeyId is the AWS KMS key the bucket encrypts with by default when Encryption is aws:kms or aws:kms:dsse.
+	KmsKeyId string
+	// ExpirationDays is the number of days after which hefty messages expire. 14 days is used when 0, and hefty messages
+	// do not expire when negative.
+	ExpirationDays int32
+}
+
+// bucketCreator is the part of the AWS S3 client used to create a bucket
+type bucketCreator interface {
+	CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error)
+	PutPublicAccessBlock(ctx context.Context, params *s3.PutPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.PutPublicAccessBlockOutput, error)
+	PutBucketEncryption(ctx context.Context, params *s3.PutBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.PutBucketEncryptionOutput, error)
+	PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error)
+}
+
+// create creates `bucket` in `region`, unless the region of the defaults is set, with Block Public Access enabled, the
+// default encryption of the defaults and a lifecycle configuration expiring hefty messages under `prefix`. A bucket that
+// was created concurrently by the same AWS account is configured as well.
+func (defaults *BucketDefaults) create(ctx context.Context, client bucketCreator, bucket, region, prefix string, optFns ...func(*s3.Options)) error {
+	if defaults.Region != "" {
+		region = defaults.Region
+	}
+
+	input := &s3.CreateBucketInput{Bucket: aws.String(bucket)}
+	// us-east-1 is the default location and cannot be given as location constraint
+	if region != "" && region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3types.CreateBucketConfiguration{
+			LocationConstraint: s3types.BucketLocationConstraint(region),
+		}
+	}
+	_, err := client.CreateBucket(ctx, input, optFns...)
+	if err != nil && !isApiErrorCode(err, "BucketAlreadyOwnedByYou") {
+		return fmt.Errorf("unable to create bucket %s. %v", bucket, err)
+	}
+
+	_, err = client.PutPublicAccessBlock(ctx, &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(bucket),
+		PublicAccessBlockConfiguration: &s3types.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	}, optFns...)
+	if err != nil {
+		return fmt.Errorf("unable to block public access of bucket %s. %v", bucket, err)
+	}
+
+	_, err = client.PutBucketEncryption(ctx, &s3.PutBucketEncryptionInput{
+		Bucket:                            aws.String(bucket),
+		ServerSideEncryptionConfiguration: defaults.encryptionConfiguration(),
+	}, optFns...)
+	if err != nil {
+		return fmt.Errorf("unable to put encryption configuration of bucket %s. %v", bucket, err)
+	}
+
+	if lifecycle := defaults.lifecycleConfiguration(prefix); lifecycle != nil {
+		_, err = client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+			Bucket:                 aws.String(bucket),
+			LifecycleConfiguration: lifecycle,
+		}, optFns...)
+		if err != nil {
+			return fmt.Errorf("unable to put lifecycle configuration of bucket %s. %v", bucket, err)
+		}
+	}
+
+	return nil
+}
+
+func (defaults *BucketDefaults) encryptionConfiguration() *s3types.ServerSideEncryptionConfiguration {
+	encryption := defaults.Encryption
+	if encryption == "" {
+		encryption = s3types.ServerSideEncryptionAes256
+	}
+
+	return &s3types.ServerSideEncryptionConfiguration{
+		Rules: []s3types.ServerSideEncryptionRule{{
+			ApplyServerSideEncryptionByDefault: &s3types.ServerSideEncryptionByDefault{
+				SSEAlgorithm:   encryption,
+				KMSMasterKeyID: optionalString(defaults.KmsKeyId),
+			},
+		}},
+	}
+}
+
+// lifecycleConfiguration returns the lifecycle configuration expiring hefty messages under `prefix`, or nil when hefty
+// messages do not expire
+func (defaults *BucketDefaults) lifecycleConfiguration(prefix string) *s3types.BucketLifecycleConfiguration {
+	days := defaults.ExpirationDays
+	if days < 0 {
+		return nil
+	}
+	if days == 0 {
+		days = defaultExpirationDays
+	}
+
+	rule, _ := PayloadLifecycle{
+		Id:                       "hefty-message-expiration",
+		Prefix:                   prefix,
+		ExpirationDays:           days,
+		AbortMultipartUploadDays: 1,
+	}.rule()
+
+	return &s3types.BucketLifecycleConfiguration{Rules: []s3types.LifecycleRule{rule}}
+}
@@ -0,0 +1,92 @@
+package hefty
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeBucketCreator struct {
+	createErr  error
+	create     *s3.CreateBucketInput
+	encryption *s3.PutBucketEncryptionInput
+	lifecycle  *s3.PutBucketLifecycleConfigurationInput
+	publicAcc  *s3.PutPublicAccessBlockInput
+}
+
+func (c *fakeBucketCreator) CreateBucket(_ context.Context, params *s3.CreateBucketInput, _ ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	c.create = params
+	return &s3.CreateBucketOutput{}, c.createErr
+}
+
+func (c *fakeBucketCreator) PutPublicAccessBlock(_ context.Context, params *s3.PutPublicAccessBlockInput, _ ...func(*s3.Options)) (*s3.PutPublicAccessBlockOutput, error) {
+	c.publicAcc = params
+	return &s3.PutPublicAccessBlockOutput{}, nil
+}
+
+func (c *fakeBucketCreator) PutBucketEncryption(_ context.Context, params *s3.PutBucketEncryptionInput, _ ...func(*s3.Options)) (*s3.PutBucketEncryptionOutput, error) {
+	c.encryption = params
+	return &s3.PutBucketEncryptionOutput{}, nil
+}
+
+func (c *fakeBucketCreator) PutBucketLifecycleConfiguration(_ context.Context, params *s3.PutBucketLifecycleConfigurationInput, _ ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	c.lifecycle = params
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+func TestBucketDefaultsCreate(t *testing.T) {
+	var tests = []struct {
+		desc          string
+		defaults      BucketDefaults
+		clientRegion  string
+		createErr     error
+		expLocation   s3types.BucketLocationConstraint
+		expEncryption s3types.ServerSideEncryption
+		expDays       int32 // 0 when no lifecycle configuration is expected
+		expErr        bool
+	}{
+		{desc: "defaults", clientRegion: "eu-west-1", expLocation: "eu-west-1", expEncryption: s3types.ServerSideEncryptionAes256, expDays: 14},
+		{desc: "us_east_1_has_no_location", clientRegion: "us-east-1", expEncryption: s3types.ServerSideEncryptionAes256, expDays: 14},
+		{desc: "region_overrides_client", defaults: BucketDefaults{Region: "us-west-2"}, clientRegion: "eu-west-1", expLocation: "us-west-2", expEncryption: s3types.ServerSideEncryptionAes256, expDays: 14},
+		{desc: "kms_and_expiration", defaults: BucketDefaults{Encryption: s3types.ServerSideEncryptionAwsKms, KmsKeyId: "key", ExpirationDays: 1}, clientRegion: "us-east-1", expEncryption: s3types.ServerSideEncryptionAwsKms, expDays: 1},
+		{desc: "no_expiration", defaults: BucketDefaults{ExpirationDays: -1}, clientRegion: "us-east-1", expEncryption: s3types.ServerSideEncryptionAes256},
+		{desc: "already_owned", clientRegion: "us-east-1", createErr: &smithy.GenericAPIError{Code: "BucketAlreadyOwnedByYou"}, expEncryption: s3types.ServerSideEncryptionAes256, expDays: 14},
+		{desc: "already_exists_in_other_account", clientRegion: "us-east-1", createErr: &smithy.GenericAPIError{Code: "BucketAlreadyExists"}, expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			client := &fakeBucketCreator{createErr: tt.createErr}
+			err := tt.defaults.create(context.TODO(), client, "bucket", tt.clientRegion, "prefix/")
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+
+			if tt.expLocation == "" {
+				assert.Nil(t, client.create.CreateBucketConfiguration)
+			} else {
+				assert.Equal(t, tt.expLocation, client.create.CreateBucketConfiguration.LocationConstraint)
+			}
+			assert.True(t, aws.ToBool(client.publicAcc.PublicAccessBlockConfiguration.BlockPublicPolicy))
+
+			defaults := client.encryption.ServerSideEncryptionConfiguration.Rules[0].ApplyServerSideEncryptionByDefault
+			assert.Equal(t, tt.expEncryption, defaults.SSEAlgorithm)
+			assert.Equal(t, tt.defaults.KmsKeyId, aws.ToString(defaults.KMSMasterKeyID))
+
+			if tt.expDays == 0 {
+				assert.Nil(t, client.lifecycle)
+				return
+			}
+			rule := client.lifecycle.LifecycleConfiguration.Rules[0]
+			assert.Equal(t, tt.expDays, aws.ToInt32(rule.Expiration.Days))
+			assert.Equal(t, &s3types.LifecycleRuleFilterMemberPrefix{Value: "prefix/"}, rule.Filter)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const (
+	defaultAutoscalingMessagesPerWorker = 10
+	defaultAutoscalingInterval          = 10 * time.Second
+)
+
+// AutoscalingConfig scales the concurrency of a Consumer with the backlog of its queues, so that an idle consumer only
+// holds a few messages and a spike is absorbed by more handlers
+type AutoscalingConfig struct {
+	// MinConcurrency and MaxConcurrency bound the concurrency. 1 and 10 are used when 0.
+	MinConcurrency int
+	MaxConcurrency int
+	// MessagesPerWorker is the backlog that adds a handler. The concurrency is the ApproximateNumberOfMessages of the
+	// queue divided by MessagesPerWorker. 10 is used when 0.
+	MessagesPerWorker int
+	// Interval is the time between two reads of the backlog. 10 seconds is used when 0.
+	Interval time.Duration
+}
+
+// withDefaults returns a copy of the configuration with the defaults of unset fields
+func (config *AutoscalingConfig) withDefaults() *AutoscalingConfig {
+	defaulted := *config
+	if defaulted.MinConcurrency <= 0 {
+		defaulted.MinConcurrency = 1
+	}
+	if defaulted.MaxConcurrency <= 0 {
+		defaulted.MaxConcurrency = defaultConsumerConcurrency
+	}
+	defaulted.MaxConcurrency = max(defaulted.MaxConcurrency, defaulted.MinConcurrency)
+	if defaulted.MessagesPerWorker <= 0 {
+		defaulted.MessagesPerWorker = defaultAutoscalingMessagesPerWorker
+	}
+	if defaulted.Interval <= 0 {
+		defaulted.Interval = defaultAutoscalingInterval
+	}
+
+	return &defaulted
+}
+
+// concurrency returns the concurrency for a backlog of `backlog` messages
+func (config *AutoscalingConfig) concurrency(backlog int) int {
+	workers := (backlog + config.MessagesPerWorker - 1) / config.MessagesPerWorker
+	return min(max(workers, config.MinConcurrency), config.MaxConcurrency)
+}
+
+// autoscale scales the concurrency of the consumer with the backlog of its queue until `ctx` is cancelled. The messages
+// prefetched beyond the concurrency, see MaxInFlight, stay the same.
+func (consumer *Consumer) autoscale(ctx context.Context) {
+	prefetched := consumer.config.MaxInFlight - consumer.config.Concurrency
+
+	ticker := time.NewTicker(consumer.config.Autoscaling.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			backlog, err := consumer.backlog(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					consumer.onError(ctx, nil, err)
+				}
+				continue
+			}
+
+			concurrency := consumer.config.Autoscaling.concurrency(backlog)
+			consumer.workers.setLimit(concurrency)
+			consumer.inFlight.setLimit(concurrency + max(prefetched, 0))
+		}
+	}
+}
+
+// backlog returns the approximate number of visible messages of the queues
+func (consumer *Consumer) backlog(ctx context.Context) (int, error) {
+	total := 0
+	for _, queue := range consumer.queues {
+		out, err := queue.client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       aws.String(queue.queueUrl),
+			AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameApproximateNumberOfMessages},
+		})
+		if err != nil {
+			return 0, fmt.Errorf("unable to get the backlog of %s. %v", queue.queueUrl, err)
+		}
+
+		backlog, err := strconv.Atoi(out.Attributes[string(sqstypes.QueueAttributeNameApproximateNumberOfMessages)])
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse the backlog of %s. %v", queue.queueUrl, err)
+		}
+		total += backlog
+	}
+
+	return total, nil
+}
@@ -0,0 +1,68 @@
+package hefty
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoscalingConcurrency(t *testing.T) {
+	config := (&AutoscalingConfig{MinConcurrency: 2, MaxConcurrency: 20}).withDefaults()
+
+	var tests = []struct {
+		backlog int
+		exp     int
+	}{
+		{backlog: 0, exp: 2},
+		{backlog: 15, exp: 2},
+		{backlog: 21, exp: 3},
+		{backlog: 100, exp: 10},
+		{backlog: 5000, exp: 20},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.exp, config.concurrency(tt.backlog), "backlog %d", tt.backlog)
+	}
+}
+
+func TestConsumerAutoscaling(t *testing.T) {
+	client := &fakeConsumerClient{backlog: "35"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler := func(ctx context.Context, msg sqstypes.Message) error { return nil }
+	consumer := startConsumer(ctx, consumedQueues(client, "queue", handler), ConsumerConfig{
+		Autoscaling: &AutoscalingConfig{MaxConcurrency: 8, Interval: time.Millisecond},
+	})
+	assert.Equal(t, 1, consumer.Concurrency())
+
+	assert.Eventually(t, func() bool { return consumer.Concurrency() == 4 }, time.Second, time.Millisecond)
+
+	client.mu.Lock()
+	client.backlog = "0"
+	client.mu.Unlock()
+	assert.Eventually(t, func() bool { return consumer.Concurrency() == 1 }, time.Second, time.Millisecond)
+
+	cancel()
+	consumer.Wait()
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(3)
+	assert.Equal(t, 3, l.acquire(context.Background(), 10))
+
+	// a lowered limit keeps what was acquired until it is released
+	l.setLimit(1)
+	l.release(2)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, 0, l.acquire(ctx, 1))
+
+	acquired := make(chan int)
+	go func() { acquired <- l.acquire(context.Background(), 5) }()
+	l.release(1)
+	assert.Equal(t, 1, <-acquired)
+}
@@ -0,0 +1,161 @@
+package awsv1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// call converts `params` to the input of the aws-sdk-go v1 operation `op`, calls it and converts its output to `Out`
+func call[Out, In, V1In, V1Out any](ctx context.Context, params *In, op func(context.Context, *V1In, ...request.Option) (*V1Out, error)) (*Out, error) {
+	input := new(V1In)
+	if params != nil {
+		convert(input, params)
+	}
+
+	output, err := op(ctx, input)
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+
+	out := new(Out)
+	if output != nil {
+		convert(out, output)
+	}
+
+	return out, nil
+}
+
+// convert copies the fields of the struct `src` points to into the fields with the same name of the struct `dst` points
+// to. The inputs, outputs and types of aws-sdk-go v1 and aws-sdk-go-v2 share their field names, and only differ in the
+// pointers, integer sizes and enum types of their fields. Like aws-sdk-go-v2, fields with a zero value that are not
+// pointers are not copied, so that they are not sent.
+func convert(dst, src any) {
+	convertValue(reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem())
+}
+
+func convertValue(dst, src reflect.Value) {
+	// e.g. the body of an object
+	if dst.Kind() == reflect.Interface {
+		if src.Kind() == reflect.Interface {
+			src = src.Elem()
+		}
+		if src.IsValid() && !(src.Kind() == reflect.Pointer && src.IsNil()) && src.Type().Implements(dst.Type()) {
+			dst.Set(src)
+		}
+		return
+	}
+
+	if src.Kind() == reflect.Pointer {
+		if src.IsNil() {
+			return
+		}
+		src = src.Elem()
+	} else if src.IsZero() {
+		return
+	}
+
+	if dst.Kind() == reflect.Pointer {
+		value := reflect.New(dst.Type().Elem())
+		convertValue(value.Elem(), src)
+		dst.Set(value)
+		return
+	}
+
+	if src.Type() == dst.Type() {
+		dst.Set(src)
+		return
+	}
+
+	switch dst.Kind() {
+	case reflect.String:
+		if src.Kind() == reflect.String {
+			dst.SetString(src.String())
+		}
+	case reflect.Bool:
+		if src.Kind() == reflect.Bool {
+			dst.SetBool(src.Bool())
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if src.CanInt() {
+			dst.SetInt(src.Int())
+		}
+	case reflect.Float32, reflect.Float64:
+		if src.CanFloat() {
+			dst.SetFloat(src.Float())
+		}
+	case reflect.Slice:
+		if src.Kind() != reflect.Slice {
+			return
+		}
+		slice := reflect.MakeSlice(dst.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			convertValue(slice.Index(i), src.Index(i))
+		}
+		dst.Set(slice)
+	case reflect.Map:
+		if src.Kind() != reflect.Map || src.Type().Key().Kind() != reflect.String || dst.Type().Key().Kind() != reflect.String {
+			return
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), src.Len())
+		iter := src.MapRange()
+		for iter.Next() {
+			value := reflect.New(dst.Type().Elem()).Elem()
+			convertValue(value, iter.Value())
+			m.SetMapIndex(reflect.ValueOf(iter.Key().String()).Convert(dst.Type().Key()), value)
+		}
+		dst.Set(m)
+	case reflect.Struct:
+		if src.Kind() != reflect.Struct {
+			return
+		}
+		for i := 0; i < dst.NumField(); i++ {
+			field := dst.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if srcField := src.FieldByName(field.Name); srcField.IsValid() {
+				convertValue(dst.Field(i), srcField)
+			}
+		}
+	}
+}
+
+// toV2Error converts an aws-sdk-go v1 error of a request that AWS responded to into the error aws-sdk-go-v2 returns, so
+// that the wrappers recognize missing objects, denied access and client errors
+func toV2Error(err error) error {
+	var reqErr awserr.RequestFailure
+	if !errors.As(err, &reqErr) {
+		return err
+	}
+
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: reqErr.StatusCode(), Header: http.Header{}}},
+			Err:      apiError(reqErr.Code(), reqErr.Message()),
+		},
+		RequestID: reqErr.RequestID(),
+	}
+}
+
+// apiError returns the typed error of aws-sdk-go-v2 for the AWS S3 error codes the wrappers check for
+func apiError(code, message string) error {
+	switch code {
+	case "NoSuchKey":
+		return &s3types.NoSuchKey{Message: &message}
+	case "NotFound":
+		return &s3types.NotFound{Message: &message}
+	case "NoSuchBucket":
+		return &s3types.NoSuchBucket{Message: &message}
+	}
+
+	return &smithy.GenericAPIError{Code: code, Message: message}
+}
@@ -0,0 +1,82 @@
+package awsv1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/aws-sdk-go/aws"
+	s3v1 "github.com/aws/aws-sdk-go/service/s3"
+	sqsv1 "github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertToV1(t *testing.T) {
+	input := &sqsv1.ReceiveMessageInput{}
+	convert(input, &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String("https://sqs.us-west-2.amazonaws.com/765908583888/queue"),
+		AttributeNames:        []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameAll},
+		MaxNumberOfMessages:   10,
+		MessageAttributeNames: []string{"All"},
+	})
+
+	// zero values are not sent
+	assert.Equal(t, &sqsv1.ReceiveMessageInput{
+		QueueUrl:              aws.String("https://sqs.us-west-2.amazonaws.com/765908583888/queue"),
+		AttributeNames:        aws.StringSlice([]string{"All"}),
+		MaxNumberOfMessages:   aws.Int64(10),
+		MessageAttributeNames: aws.StringSlice([]string{"All"}),
+	}, input)
+
+	sendInput := &sqsv1.SendMessageInput{}
+	convert(sendInput, &sqs.SendMessageInput{
+		MessageBody: aws.String("body"),
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+			"binary": {DataType: aws.String("Binary"), BinaryValue: []byte{0x00, 0xff}},
+		},
+	})
+	assert.Equal(t, map[string]*sqsv1.MessageAttributeValue{
+		"binary": {DataType: aws.String("Binary"), BinaryValue: []byte{0x00, 0xff}},
+	}, sendInput.MessageAttributes)
+
+	deleteInput := &s3v1.DeleteObjectsInput{}
+	convert(deleteInput, &s3.DeleteObjectsInput{
+		Bucket: aws.String("bucket"),
+		Delete: &s3types.Delete{Objects: []s3types.ObjectIdentifier{{Key: aws.String("a")}, {Key: aws.String("b"), VersionId: aws.String("v")}}, Quiet: aws.Bool(false)},
+	})
+	assert.Equal(t, &s3v1.Delete{
+		Objects: []*s3v1.ObjectIdentifier{{Key: aws.String("a")}, {Key: aws.String("b"), VersionId: aws.String("v")}},
+		Quiet:   aws.Bool(false),
+	}, deleteInput.Delete)
+}
+
+func TestConvertFromV1(t *testing.T) {
+	out := &sqs.ReceiveMessageOutput{}
+	convert(out, &sqsv1.ReceiveMessageOutput{Messages: []*sqsv1.Message{{
+		Body:              aws.String("body"),
+		ReceiptHandle:     aws.String("handle"),
+		Attributes:        aws.StringMap(map[string]string{"ApproximateReceiveCount": "1"}),
+		MessageAttributes: map[string]*sqsv1.MessageAttributeValue{"attr": {DataType: aws.String("String"), StringValue: aws.String("value")}},
+	}}})
+
+	assert.Equal(t, []sqstypes.Message{{
+		Body:              aws.String("body"),
+		ReceiptHandle:     aws.String("handle"),
+		Attributes:        map[string]string{"ApproximateReceiveCount": "1"},
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{"attr": {DataType: aws.String("String"), StringValue: aws.String("value")}},
+	}}, out.Messages)
+
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	listOut := &s3.ListObjectsV2Output{}
+	convert(listOut, &s3v1.ListObjectsV2Output{
+		Contents:    []*s3v1.Object{{Key: aws.String("key"), Size: aws.Int64(5), LastModified: &modified, StorageClass: aws.String("STANDARD")}},
+		IsTruncated: aws.Bool(false),
+		KeyCount:    aws.Int64(1),
+	})
+	assert.Equal(t, []s3types.Object{{Key: aws.String("key"), Size: aws.Int64(5), LastModified: &modified, StorageClass: s3types.ObjectStorageClassStandard}}, listOut.Contents)
+	assert.Equal(t, aws.Int32(1), listOut.KeyCount)
+	assert.Equal(t, aws.Bool(false), listOut.IsTruncated)
+}
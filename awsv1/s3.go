@@ -0,0 +1,129 @@
+package awsv1
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	s3v1 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	hefty "github.com/jo-parker/sqs-hefty"
+)
+
+var _ hefty.S3API = (*s3API)(nil)
+
+type s3API struct {
+	client s3iface.S3API
+}
+
+// NewS3API adapts an aws-sdk-go v1 AWS S3 client, so that it can be given to the wrappers as their AWS S3 client. Options
+// of aws-sdk-go-v2 given to the calls of the wrappers are ignored, so options like WithS3Endpoint, WithStorageRateLimiter
+// and WithCircuitBreaker that configure the AWS S3 client of the wrappers have no effect, and the v1 client must be
+// configured instead. Bodies of uploads that cannot seek are read into memory, as the v1 client needs to seek them.
+func NewS3API(client s3iface.S3API) hefty.S3API {
+	return &s3API{client: client}
+}
+
+// Options returns the region of the v1 client
+func (api *s3API) Options() s3.Options {
+	if client, ok := api.client.(*s3v1.S3); ok {
+		return s3.Options{Region: aws.StringValue(client.Config.Region)}
+	}
+
+	return s3.Options{}
+}
+
+func (api *s3API) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return call[s3.PutObjectOutput](ctx, params, func(ctx context.Context, input *s3v1.PutObjectInput, opts ...request.Option) (*s3v1.PutObjectOutput, error) {
+		body, err := readSeeker(params.Body)
+		if err != nil {
+			return nil, err
+		}
+		input.Body = body
+		return api.client.PutObjectWithContext(ctx, input, opts...)
+	})
+}
+
+func (api *s3API) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	return call[s3.UploadPartOutput](ctx, params, func(ctx context.Context, input *s3v1.UploadPartInput, opts ...request.Option) (*s3v1.UploadPartOutput, error) {
+		body, err := readSeeker(params.Body)
+		if err != nil {
+			return nil, err
+		}
+		input.Body = body
+		return api.client.UploadPartWithContext(ctx, input, opts...)
+	})
+}
+
+func (api *s3API) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return call[s3.CreateMultipartUploadOutput](ctx, params, api.client.CreateMultipartUploadWithContext)
+}
+
+func (api *s3API) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return call[s3.CompleteMultipartUploadOutput](ctx, params, api.client.CompleteMultipartUploadWithContext)
+}
+
+func (api *s3API) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return call[s3.AbortMultipartUploadOutput](ctx, params, api.client.AbortMultipartUploadWithContext)
+}
+
+func (api *s3API) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return call[s3.GetObjectOutput](ctx, params, api.client.GetObjectWithContext)
+}
+
+func (api *s3API) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return call[s3.HeadBucketOutput](ctx, params, api.client.HeadBucketWithContext)
+}
+
+func (api *s3API) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return call[s3.HeadObjectOutput](ctx, params, api.client.HeadObjectWithContext)
+}
+
+func (api *s3API) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return call[s3.ListObjectsV2Output](ctx, params, api.client.ListObjectsV2WithContext)
+}
+
+func (api *s3API) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return call[s3.DeleteObjectOutput](ctx, params, api.client.DeleteObjectWithContext)
+}
+
+func (api *s3API) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	return call[s3.DeleteObjectsOutput](ctx, params, api.client.DeleteObjectsWithContext)
+}
+
+func (api *s3API) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	return call[s3.GetObjectTaggingOutput](ctx, params, api.client.GetObjectTaggingWithContext)
+}
+
+func (api *s3API) PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	return call[s3.PutObjectTaggingOutput](ctx, params, api.client.PutObjectTaggingWithContext)
+}
+
+func (api *s3API) GetObjectRetention(ctx context.Context, params *s3.GetObjectRetentionInput, optFns ...func(*s3.Options)) (*s3.GetObjectRetentionOutput, error) {
+	return call[s3.GetObjectRetentionOutput](ctx, params, api.client.GetObjectRetentionWithContext)
+}
+
+func (api *s3API) GetObjectLegalHold(ctx context.Context, params *s3.GetObjectLegalHoldInput, optFns ...func(*s3.Options)) (*s3.GetObjectLegalHoldOutput, error) {
+	return call[s3.GetObjectLegalHoldOutput](ctx, params, api.client.GetObjectLegalHoldWithContext)
+}
+
+// readSeeker returns the body of an upload as an io.ReadSeeker, which the v1 client needs to sign and retry uploads
+func readSeeker(body io.Reader) (io.ReadSeeker, error) {
+	if body == nil {
+		return nil, nil
+	}
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		return seeker, nil
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read body of upload. %v", err)
+	}
+
+	return bytes.NewReader(data), nil
+}
@@ -0,0 +1,156 @@
+package awsv1
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	s3v1 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 is an aws-sdk-go v1 AWS S3 client keeping objects in memory
+type fakeS3 struct {
+	s3iface.S3API
+	objects  map[string][]byte
+	metadata map[string]map[string]*string
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}, metadata: map[string]map[string]*string{}}
+}
+
+func notFound(code string) error {
+	return awserr.NewRequestFailure(awserr.New(code, "not found", nil), http.StatusNotFound, "request-id")
+}
+
+func (client *fakeS3) PutObjectWithContext(ctx aws.Context, input *s3v1.PutObjectInput, opts ...request.Option) (*s3v1.PutObjectOutput, error) {
+	data, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	client.objects[aws.StringValue(input.Key)] = data
+	client.metadata[aws.StringValue(input.Key)] = input.Metadata
+	return &s3v1.PutObjectOutput{ETag: aws.String("etag")}, nil
+}
+
+func (client *fakeS3) GetObjectWithContext(ctx aws.Context, input *s3v1.GetObjectInput, opts ...request.Option) (*s3v1.GetObjectOutput, error) {
+	data, ok := client.objects[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, notFound("NoSuchKey")
+	}
+
+	out := &s3v1.GetObjectOutput{ContentLength: aws.Int64(int64(len(data)))}
+	if input.Range != nil {
+		var start, end int
+		if _, err := fmt.Sscanf(aws.StringValue(input.Range), "bytes=%d-%d", &start, &end); err != nil {
+			return nil, err
+		}
+		end = min(end, len(data)-1)
+		out.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		out.ContentLength = aws.Int64(int64(end - start + 1))
+		data = data[start : end+1]
+	}
+	out.Body = io.NopCloser(bytes.NewReader(data))
+
+	return out, nil
+}
+
+func (client *fakeS3) HeadObjectWithContext(ctx aws.Context, input *s3v1.HeadObjectInput, opts ...request.Option) (*s3v1.HeadObjectOutput, error) {
+	data, ok := client.objects[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, notFound("NotFound")
+	}
+
+	return &s3v1.HeadObjectOutput{ContentLength: aws.Int64(int64(len(data))), Metadata: client.metadata[aws.StringValue(input.Key)]}, nil
+}
+
+func (client *fakeS3) DeleteObjectWithContext(ctx aws.Context, input *s3v1.DeleteObjectInput, opts ...request.Option) (*s3v1.DeleteObjectOutput, error) {
+	delete(client.objects, aws.StringValue(input.Key))
+	return &s3v1.DeleteObjectOutput{}, nil
+}
+
+// unseekableReader hides the Seek method of its reader
+type unseekableReader struct {
+	io.Reader
+}
+
+func TestS3APIObjects(t *testing.T) {
+	client := newFakeS3()
+	api := NewS3API(client)
+
+	_, err := api.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("key"),
+		Body:     unseekableReader{strings.NewReader("hefty")},
+		Metadata: map[string]string{"source": "queue"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hefty"), client.objects["key"])
+
+	head, err := api.HeadObject(context.TODO(), &s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), aws.Int64Value(head.ContentLength))
+	assert.Equal(t, map[string]string{"source": "queue"}, head.Metadata)
+
+	get, err := api.GetObject(context.TODO(), &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key"), Range: aws.String("bytes=1-2")})
+	assert.Nil(t, err)
+	body, err := io.ReadAll(get.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "ef", string(body))
+	assert.Equal(t, "bytes 1-2/5", aws.StringValue(get.ContentRange))
+
+	_, err = api.DeleteObject(context.TODO(), &s3.DeleteObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")})
+	assert.Nil(t, err)
+	assert.Empty(t, client.objects)
+}
+
+func TestS3APIErrors(t *testing.T) {
+	api := NewS3API(newFakeS3())
+
+	// errors of v1 are returned like aws-sdk-go-v2 returns them
+	_, err := api.HeadObject(context.TODO(), &s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")})
+	var notFound *s3types.NotFound
+	assert.ErrorAs(t, err, &notFound)
+	var respErr *awshttp.ResponseError
+	assert.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusNotFound, respErr.HTTPStatusCode())
+	assert.Equal(t, "request-id", respErr.ServiceRequestID())
+
+	_, err = api.GetObject(context.TODO(), &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")})
+	var noSuchKey *s3types.NoSuchKey
+	assert.ErrorAs(t, err, &noSuchKey)
+
+	// errors of requests that were not sent are returned as they are
+	sendErr := errors.New("connection refused")
+	assert.Equal(t, sendErr, toV2Error(sendErr))
+}
+
+func TestReadSeeker(t *testing.T) {
+	reader := strings.NewReader("hefty")
+	seeker, err := readSeeker(reader)
+	assert.Nil(t, err)
+	assert.Same(t, reader, seeker)
+
+	seeker, err = readSeeker(unseekableReader{strings.NewReader("hefty")})
+	assert.Nil(t, err)
+	data, _ := io.ReadAll(seeker)
+	assert.Equal(t, "hefty", string(data))
+
+	seeker, err = readSeeker(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, seeker)
+}
@@ -0,0 +1,36 @@
+package awsv1
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go/aws"
+	snsv1 "github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	hefty "github.com/jo-parker/sqs-hefty"
+)
+
+var _ hefty.SnsAPI = (*snsAPI)(nil)
+
+type snsAPI struct {
+	client snsiface.SNSAPI
+}
+
+// NewSnsAPI adapts an aws-sdk-go v1 AWS SNS client, so that it can be given to hefty.NewSnsClientWrapperFromAPI. Options
+// of aws-sdk-go-v2 given to the calls of the wrapper are ignored.
+func NewSnsAPI(client snsiface.SNSAPI) hefty.SnsAPI {
+	return &snsAPI{client: client}
+}
+
+// Options returns the region of the v1 client, which is recorded in the reference messages of hefty messages
+func (api *snsAPI) Options() sns.Options {
+	if client, ok := api.client.(*snsv1.SNS); ok {
+		return sns.Options{Region: aws.StringValue(client.Config.Region)}
+	}
+
+	return sns.Options{}
+}
+
+func (api *snsAPI) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	return call[sns.PublishOutput](ctx, params, api.client.PublishWithContext)
+}
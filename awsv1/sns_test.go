@@ -0,0 +1,45 @@
+package awsv1
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	snsv1 "github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	hefty "github.com/jo-parker/sqs-hefty"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSns is an aws-sdk-go v1 AWS SNS client recording the published messages
+type fakeSns struct {
+	snsiface.SNSAPI
+	messages []string
+}
+
+func (client *fakeSns) PublishWithContext(ctx aws.Context, input *snsv1.PublishInput, opts ...request.Option) (*snsv1.PublishOutput, error) {
+	client.messages = append(client.messages, aws.StringValue(input.Message))
+	return &snsv1.PublishOutput{MessageId: aws.String("id")}, nil
+}
+
+func TestSnsAPI(t *testing.T) {
+	snsClient := &fakeSns{}
+	s3Client := newFakeS3()
+	wrapper, err := hefty.NewSnsClientWrapperFromAPI(NewSnsAPI(snsClient), NewS3API(s3Client), "bucket", hefty.WithSkipBucketCheck())
+	assert.Nil(t, err)
+
+	out, err := wrapper.PublishHeftyMessage(context.TODO(), &sns.PublishInput{
+		TopicArn: aws.String("arn:aws:sns:us-west-2:765908583888:topic"),
+		Message:  aws.String(strings.Repeat("hefty", hefty.MaxHeftyMessageLengthBytes/100)),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "id", aws.StringValue(out.MessageId))
+	assert.Len(t, snsClient.messages, 1)
+	assert.Len(t, s3Client.objects, 1)
+
+	// the published message references the hefty message
+	assert.Contains(t, snsClient.messages[0], `"s3_bucket":"bucket"`)
+}
@@ -0,0 +1,65 @@
+package awsv1
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go/aws"
+	sqsv1 "github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	hefty "github.com/jo-parker/sqs-hefty"
+)
+
+var _ hefty.SqsAPI = (*sqsAPI)(nil)
+
+type sqsAPI struct {
+	client sqsiface.SQSAPI
+}
+
+// NewSqsAPI adapts an aws-sdk-go v1 AWS SQS client, so that it can be given to hefty.NewSqsClientWrapperFromAPI. Options
+// of aws-sdk-go-v2 given to the calls of the wrapper are ignored, as the calls are made with the configuration of the v1
+// client.
+func NewSqsAPI(client sqsiface.SQSAPI) hefty.SqsAPI {
+	return &sqsAPI{client: client}
+}
+
+// Options returns the region of the v1 client, which is recorded in the reference messages of hefty messages
+func (api *sqsAPI) Options() sqs.Options {
+	if client, ok := api.client.(*sqsv1.SQS); ok {
+		return sqs.Options{Region: aws.StringValue(client.Config.Region)}
+	}
+
+	return sqs.Options{}
+}
+
+func (api *sqsAPI) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	return call[sqs.SendMessageOutput](ctx, params, api.client.SendMessageWithContext)
+}
+
+func (api *sqsAPI) SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	return call[sqs.SendMessageBatchOutput](ctx, params, api.client.SendMessageBatchWithContext)
+}
+
+func (api *sqsAPI) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	return call[sqs.ReceiveMessageOutput](ctx, params, api.client.ReceiveMessageWithContext)
+}
+
+func (api *sqsAPI) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	return call[sqs.DeleteMessageOutput](ctx, params, api.client.DeleteMessageWithContext)
+}
+
+func (api *sqsAPI) ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	return call[sqs.ChangeMessageVisibilityOutput](ctx, params, api.client.ChangeMessageVisibilityWithContext)
+}
+
+func (api *sqsAPI) GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+	return call[sqs.GetQueueAttributesOutput](ctx, params, api.client.GetQueueAttributesWithContext)
+}
+
+func (api *sqsAPI) DeleteQueue(ctx context.Context, params *sqs.DeleteQueueInput, optFns ...func(*sqs.Options)) (*sqs.DeleteQueueOutput, error) {
+	return call[sqs.DeleteQueueOutput](ctx, params, api.client.DeleteQueueWithContext)
+}
+
+func (api *sqsAPI) PurgeQueue(ctx context.Context, params *sqs.PurgeQueueInput, optFns ...func(*sqs.Options)) (*sqs.PurgeQueueOutput, error) {
+	return call[sqs.PurgeQueueOutput](ctx, params, api.client.PurgeQueueWithContext)
+}
@@ -0,0 +1,90 @@
+package awsv1
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	sqsv1 "github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	hefty "github.com/jo-parker/sqs-hefty"
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSqs is an aws-sdk-go v1 AWS SQS client keeping a single queue in memory
+type fakeSqs struct {
+	sqsiface.SQSAPI
+	messages map[string]*sqsv1.Message
+}
+
+func (client *fakeSqs) SendMessageWithContext(ctx aws.Context, input *sqsv1.SendMessageInput, opts ...request.Option) (*sqsv1.SendMessageOutput, error) {
+	id := strconv.Itoa(len(client.messages))
+	client.messages["handle-"+id] = &sqsv1.Message{
+		MessageId:         aws.String(id),
+		ReceiptHandle:     aws.String("handle-" + id),
+		Body:              input.MessageBody,
+		MessageAttributes: input.MessageAttributes,
+	}
+
+	return &sqsv1.SendMessageOutput{MessageId: aws.String(id)}, nil
+}
+
+func (client *fakeSqs) ReceiveMessageWithContext(ctx aws.Context, input *sqsv1.ReceiveMessageInput, opts ...request.Option) (*sqsv1.ReceiveMessageOutput, error) {
+	out := &sqsv1.ReceiveMessageOutput{}
+	for _, msg := range client.messages {
+		out.Messages = append(out.Messages, msg)
+	}
+
+	return out, nil
+}
+
+func (client *fakeSqs) DeleteMessageWithContext(ctx aws.Context, input *sqsv1.DeleteMessageInput, opts ...request.Option) (*sqsv1.DeleteMessageOutput, error) {
+	delete(client.messages, aws.StringValue(input.ReceiptHandle))
+	return &sqsv1.DeleteMessageOutput{}, nil
+}
+
+func TestSqsAPI(t *testing.T) {
+	sqsClient := &fakeSqs{messages: map[string]*sqsv1.Message{}}
+	s3Client := newFakeS3()
+	wrapper, err := hefty.NewSqsClientWrapperFromAPI(NewSqsAPI(sqsClient), NewS3API(s3Client), "bucket", hefty.WithSkipBucketCheck())
+	assert.Nil(t, err)
+
+	queueUrl := aws.String("https://sqs.us-west-2.amazonaws.com/765908583888/queue")
+	body := strings.Repeat("hefty", hefty.MaxHeftyMessageLengthBytes/100)
+	_, err = wrapper.SendHeftyMessage(context.TODO(), &sqs.SendMessageInput{
+		QueueUrl:    queueUrl,
+		MessageBody: aws.String(body),
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+			"attr": {DataType: aws.String("String"), StringValue: aws.String("value")},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, s3Client.objects, 1)
+	assert.True(t, types.IsReferenceMsg(aws.StringValue(sqsClient.messages["handle-0"].Body)))
+
+	out, err := wrapper.ReceiveHeftyMessage(context.TODO(), &sqs.ReceiveMessageInput{QueueUrl: queueUrl, MessageAttributeNames: []string{"All"}})
+	assert.Nil(t, err)
+	assert.Len(t, out.Messages, 1)
+	assert.Equal(t, body, aws.StringValue(out.Messages[0].Body))
+	assert.Equal(t, "value", aws.StringValue(out.Messages[0].MessageAttributes["attr"].StringValue))
+
+	_, err = wrapper.DeleteHeftyMessage(context.TODO(), &sqs.DeleteMessageInput{QueueUrl: queueUrl, ReceiptHandle: out.Messages[0].ReceiptHandle})
+	assert.Nil(t, err)
+	assert.Empty(t, sqsClient.messages)
+	assert.Empty(t, s3Client.objects)
+}
+
+func TestSqsAPIOptions(t *testing.T) {
+	sess, err := session.NewSession(aws.NewConfig().WithRegion("us-west-2"))
+	assert.Nil(t, err)
+
+	assert.Equal(t, "us-west-2", NewSqsAPI(sqsv1.New(sess)).(*sqsAPI).Options().Region)
+	assert.Equal(t, "", NewSqsAPI(&fakeSqs{}).(*sqsAPI).Options().Region)
+}
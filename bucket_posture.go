@@ -0,0 +1,146 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/jo-parker/sqs-hefty/internal/utils"
+)
+
+// BucketPosture is the security configuration the buckets hefty messages are stored in are expected to have. It is
+// verified when a client wrapper is created. Buckets given as access point arns are not verified, since the bucket
+// configuration cannot be read through an access point.
+type BucketPosture struct {
+	// Encryption is the default encryption algorithm the bucket must have, e.g. aws:kms. Not verified when empty.
+	Encryption s3types.ServerSideEncryption
+	// KmsKeyId is the AWS KMS key the bucket must encrypt with by default. Not verified when empty.
+	KmsKeyId string
+	// BlockPublicAccess requires all Block Public Access settings of the bucket to be enabled.
+	BlockPublicAccess bool
+	// ObjectOwnership is the object ownership the bucket must have, e.g. BucketOwnerEnforced. Not verified when empty.
+	ObjectOwnership s3types.ObjectOwnership
+}
+
+// bucketPostureClient is the part of the AWS S3 client used to verify the posture of a bucket
+type bucketPostureClient interface {
+	GetBucketEncryption(ctx context.Context, params *s3.GetBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error)
+	GetPublicAccessBlock(ctx context.Context, params *s3.GetPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.GetPublicAccessBlockOutput, error)
+	GetBucketOwnershipControls(ctx context.Context, params *s3.GetBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.GetBucketOwnershipControlsOutput, error)
+}
+
+// verify verifies that `bucket` has the posture
+func (posture *BucketPosture) verify(ctx context.Context, client bucketPostureClient, bucket string, optFns ...func(*s3.Options)) error {
+	if posture == nil || utils.IsAccessPointArn(bucket) {
+		return nil
+	}
+
+	if posture.Encryption != "" || posture.KmsKeyId != "" {
+		out, err := client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{Bucket: aws.String(bucket)}, optFns...)
+		if err != nil && !isApiErrorCode(err, "ServerSideEncryptionConfigurationNotFoundError") {
+			return fmt.Errorf("unable to get encryption configuration of bucket %s. %v", bucket, err)
+		}
+		if err = posture.verifyEncryption(bucket, out); err != nil {
+			return err
+		}
+	}
+
+	if posture.BlockPublicAccess {
+		out, err := client.GetPublicAccessBlock(ctx, &s3.GetPublicAccessBlockInput{Bucket: aws.String(bucket)}, optFns...)
+		if err != nil && !isApiErrorCode(err, "NoSuchPublicAccessBlockConfiguration") {
+			return fmt.Errorf("unable to get block public access configuration of bucket %s. %v", bucket, err)
+		}
+		if err = verifyBlockPublicAccess(bucket, out); err != nil {
+			return err
+		}
+	}
+
+	if posture.ObjectOwnership != "" {
+		out, err := client.GetBucketOwnershipControls(ctx, &s3.GetBucketOwnershipControlsInput{Bucket: aws.String(bucket)}, optFns...)
+		if err != nil && !isApiErrorCode(err, "OwnershipControlsNotFoundError") {
+			return fmt.Errorf("unable to get object ownership of bucket %s. %v", bucket, err)
+		}
+		if err = posture.verifyObjectOwnership(bucket, out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifyEncryption verifies the default encryption of a bucket, where a nil output is a bucket without default encryption
+func (posture *BucketPosture) verifyEncryption(bucket string, out *s3.GetBucketEncryptionOutput) error {
+	if out == nil || out.ServerSideEncryptionConfiguration == nil {
+		return fmt.Errorf("bucket %s has no default encryption; expected %s", bucket, posture.Encryption)
+	}
+
+	for _, rule := range out.ServerSideEncryptionConfiguration.Rules {
+		defaults := rule.ApplyServerSideEncryptionByDefault
+		if defaults == nil {
+			continue
+		}
+		if posture.Encryption != "" && defaults.SSEAlgorithm != posture.Encryption {
+			return fmt.Errorf("bucket %s encrypts with %s by default; expected %s", bucket, defaults.SSEAlgorithm, posture.Encryption)
+		}
+		if posture.KmsKeyId != "" && aws.ToString(defaults.KMSMasterKeyID) != posture.KmsKeyId {
+			return fmt.Errorf("bucket %s encrypts with kms key '%s' by default; expected %s", bucket, aws.ToString(defaults.KMSMasterKeyID), posture.KmsKeyId)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("bucket %s has no default encryption; expected %s", bucket, posture.Encryption)
+}
+
+// verifyBlockPublicAccess verifies that all Block Public Access settings of a bucket are enabled, where a nil output is a
+// bucket without Block Public Access configuration
+func verifyBlockPublicAccess(bucket string, out *s3.GetPublicAccessBlockOutput) error {
+	if out == nil || out.PublicAccessBlockConfiguration == nil {
+		return fmt.Errorf("bucket %s has no block public access configuration", bucket)
+	}
+
+	config := out.PublicAccessBlockConfiguration
+	var disabled []string
+	if !aws.ToBool(config.BlockPublicAcls) {
+		disabled = append(disabled, "BlockPublicAcls")
+	}
+	if !aws.ToBool(config.IgnorePublicAcls) {
+		disabled = append(disabled, "IgnorePublicAcls")
+	}
+	if !aws.ToBool(config.BlockPublicPolicy) {
+		disabled = append(disabled, "BlockPublicPolicy")
+	}
+	if !aws.ToBool(config.RestrictPublicBuckets) {
+		disabled = append(disabled, "RestrictPublicBuckets")
+	}
+	if len(disabled) > 0 {
+		return fmt.Errorf("bucket %s does not block public access; %s disabled", bucket, strings.Join(disabled, ", "))
+	}
+
+	return nil
+}
+
+// verifyObjectOwnership verifies the object ownership of a bucket, where a nil output is a bucket without ownership
+// controls
+func (posture *BucketPosture) verifyObjectOwnership(bucket string, out *s3.GetBucketOwnershipControlsOutput) error {
+	if out == nil || out.OwnershipControls == nil || len(out.OwnershipControls.Rules) == 0 {
+		return fmt.Errorf("bucket %s has no object ownership controls; expected %s", bucket, posture.ObjectOwnership)
+	}
+
+	if ownership := out.OwnershipControls.Rules[0].ObjectOwnership; ownership != posture.ObjectOwnership {
+		return fmt.Errorf("bucket %s has object ownership %s; expected %s", bucket, ownership, posture.ObjectOwnership)
+	}
+
+	return nil
+}
+
+// isApiErrorCode checks whether an AWS error has the error code `code`
+func isApiErrorCode(err error, code string) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == code
+}
@@ -0,0 +1,86 @@
+package hefty
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePostureClient struct {
+	encryption *s3types.ServerSideEncryptionByDefault
+	publicAcls bool
+	ownership  s3types.ObjectOwnership
+}
+
+func (c *fakePostureClient) GetBucketEncryption(context.Context, *s3.GetBucketEncryptionInput, ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error) {
+	if c.encryption == nil {
+		return nil, &smithy.GenericAPIError{Code: "ServerSideEncryptionConfigurationNotFoundError"}
+	}
+
+	return &s3.GetBucketEncryptionOutput{ServerSideEncryptionConfiguration: &s3types.ServerSideEncryptionConfiguration{
+		Rules: []s3types.ServerSideEncryptionRule{{ApplyServerSideEncryptionByDefault: c.encryption}},
+	}}, nil
+}
+
+func (c *fakePostureClient) GetPublicAccessBlock(context.Context, *s3.GetPublicAccessBlockInput, ...func(*s3.Options)) (*s3.GetPublicAccessBlockOutput, error) {
+	return &s3.GetPublicAccessBlockOutput{PublicAccessBlockConfiguration: &s3types.PublicAccessBlockConfiguration{
+		BlockPublicAcls:       aws.Bool(!c.publicAcls),
+		IgnorePublicAcls:      aws.Bool(true),
+		BlockPublicPolicy:     aws.Bool(true),
+		RestrictPublicBuckets: aws.Bool(true),
+	}}, nil
+}
+
+func (c *fakePostureClient) GetBucketOwnershipControls(context.Context, *s3.GetBucketOwnershipControlsInput, ...func(*s3.Options)) (*s3.GetBucketOwnershipControlsOutput, error) {
+	if c.ownership == "" {
+		return nil, &smithy.GenericAPIError{Code: "OwnershipControlsNotFoundError"}
+	}
+
+	return &s3.GetBucketOwnershipControlsOutput{OwnershipControls: &s3types.OwnershipControls{
+		Rules: []s3types.OwnershipControlsRule{{ObjectOwnership: c.ownership}},
+	}}, nil
+}
+
+func TestBucketPostureVerify(t *testing.T) {
+	kms := &s3types.ServerSideEncryptionByDefault{SSEAlgorithm: s3types.ServerSideEncryptionAwsKms, KMSMasterKeyID: aws.String("key")}
+	compliant := &fakePostureClient{encryption: kms, ownership: s3types.ObjectOwnershipBucketOwnerEnforced}
+	posture := &BucketPosture{
+		Encryption:        s3types.ServerSideEncryptionAwsKms,
+		KmsKeyId:          "key",
+		BlockPublicAccess: true,
+		ObjectOwnership:   s3types.ObjectOwnershipBucketOwnerEnforced,
+	}
+
+	var tests = []struct {
+		desc    string
+		posture *BucketPosture
+		client  *fakePostureClient
+		bucket  string
+		expErr  bool
+	}{
+		{desc: "no_posture", client: &fakePostureClient{}, bucket: "bucket"},
+		{desc: "compliant", posture: posture, client: compliant, bucket: "bucket"},
+		{desc: "access_point_not_verified", posture: posture, client: &fakePostureClient{}, bucket: "arn:aws:s3:us-west-2:765908583888:accesspoint/my-ap"},
+		{desc: "no_encryption", posture: posture, client: &fakePostureClient{ownership: s3types.ObjectOwnershipBucketOwnerEnforced}, bucket: "bucket", expErr: true},
+		{desc: "wrong_encryption", posture: posture, client: &fakePostureClient{encryption: &s3types.ServerSideEncryptionByDefault{SSEAlgorithm: s3types.ServerSideEncryptionAes256}, ownership: s3types.ObjectOwnershipBucketOwnerEnforced}, bucket: "bucket", expErr: true},
+		{desc: "public_acls", posture: posture, client: &fakePostureClient{encryption: kms, publicAcls: true, ownership: s3types.ObjectOwnershipBucketOwnerEnforced}, bucket: "bucket", expErr: true},
+		{desc: "no_ownership_controls", posture: posture, client: &fakePostureClient{encryption: kms}, bucket: "bucket", expErr: true},
+		{desc: "wrong_ownership", posture: posture, client: &fakePostureClient{encryption: kms, ownership: s3types.ObjectOwnershipObjectWriter}, bucket: "bucket", expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			err := tt.posture.verify(context.TODO(), tt.client, tt.bucket)
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package hefty
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// isChecksumAlgorithm checks whether `algorithm` is an AWS S3 checksum algorithm
+func isChecksumAlgorithm(algorithm s3types.ChecksumAlgorithm) bool {
+	for _, known := range algorithm.Values() {
+		if algorithm == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// singlePartUpload makes the uploader upload a payload of `size` bytes with a single PutObject call. AWS S3 only keeps a
+// checksum of the full object for single part uploads, which is required to validate the checksum on download.
+func singlePartUpload(size int) func(*s3manager.Uploader) {
+	return func(uploader *s3manager.Uploader) {
+		uploader.PartSize = max(uploader.PartSize, int64(size)+1)
+	}
+}
+
+// getWithChecksum gets a serialized hefty message from AWS S3 in a single GetObject call, which lets the AWS SDK validate
+// the payload against the checksum AWS S3 stored on upload
+func (storage *payloadStorage) getWithChecksum(ctx context.Context, refMsg *types.ReferenceMsg) ([]byte, error) {
+	out, err := storage.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:              aws.String(refMsg.S3Bucket),
+		Key:                 aws.String(refMsg.S3Key),
+		VersionId:           optionalString(refMsg.S3VersionId),
+		ChecksumMode:        s3types.ChecksumModeEnabled,
+		ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+	}, storage.s3OptFns...)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	// the checksum is validated once the body has been read completely; the buffer is allocated once, with room for
+	// the read that reports the end of the body
+	buf := bytes.NewBuffer(make([]byte, 0, max(aws.ToInt64(out.ContentLength), 0)+bytes.MinRead))
+	if _, err = buf.ReadFrom(out.Body); err != nil {
+		return nil, fmt.Errorf("checksum %s of hefty message could not be validated. %v", refMsg.S3ChecksumAlgorithm, err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,45 @@
+package hefty
+
+import (
+	"testing"
+
+	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithChecksum(t *testing.T) {
+	var tests = []struct {
+		desc      string
+		algorithm s3types.ChecksumAlgorithm
+		expErr    bool
+	}{
+		{desc: "crc32c", algorithm: s3types.ChecksumAlgorithmCrc32c},
+		{desc: "sha256", algorithm: s3types.ChecksumAlgorithmSha256},
+		{desc: "empty", algorithm: "", expErr: true},
+		{desc: "unknown", algorithm: "MD5", expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			opts := defaultOptions()
+			err := WithChecksum(tt.algorithm)(&opts)
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.algorithm, opts.checksumAlgorithm)
+		})
+	}
+}
+
+func TestSinglePartUpload(t *testing.T) {
+	uploader := &s3manager.Uploader{PartSize: s3manager.DefaultUploadPartSize}
+
+	singlePartUpload(1024)(uploader)
+	assert.Equal(t, s3manager.DefaultUploadPartSize, uploader.PartSize)
+
+	singlePartUpload(MaxHeftyMessageLengthBytes)(uploader)
+	assert.Greater(t, uploader.PartSize, int64(MaxHeftyMessageLengthBytes))
+}
@@ -0,0 +1,219 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+const (
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitOpenDuration     = 30 * time.Second
+	defaultCircuitQueueSize        = 100
+)
+
+// CircuitFallback is what happens to an AWS S3 request while the circuit of a CircuitBreaker is open
+type CircuitFallback int
+
+const (
+	// CircuitFailFast fails the request with a *CircuitOpenError without sending it. This is the default.
+	CircuitFailFast CircuitFallback = iota
+	// CircuitQueue queues the request until the circuit is closed again or its context is done. Requests fail with a
+	// *CircuitOpenError when the queue is full.
+	CircuitQueue
+)
+
+// CircuitState is the state of the circuit of a CircuitBreaker
+type CircuitState int
+
+const (
+	// CircuitClosed sends requests to AWS S3
+	CircuitClosed CircuitState = iota
+	// CircuitOpen does not send requests to AWS S3
+	CircuitOpen
+	// CircuitHalfOpen sends a single request to AWS S3 to find out whether it has recovered
+	CircuitHalfOpen
+)
+
+// CircuitBreakerConfig configures a CircuitBreaker
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed AWS S3 requests that opens the circuit. 5 is used when 0.
+	FailureThreshold int
+	// OpenDuration is how long the circuit stays open before a request is sent to find out whether AWS S3 has recovered.
+	// 30 seconds is used when 0.
+	OpenDuration time.Duration
+	// Fallback is what happens to requests while the circuit is open.
+	Fallback CircuitFallback
+	// QueueSize is the number of requests queued by CircuitQueue while the circuit is open. 100 is used when 0.
+	QueueSize int
+}
+
+// CircuitOpenError is returned for AWS S3 requests that are not sent because the circuit of a CircuitBreaker is open
+type CircuitOpenError struct {
+	// RetryAfter is how long the circuit stays open before AWS S3 is tried again
+	RetryAfter time.Duration
+}
+
+func (err *CircuitOpenError) Error() string {
+	return fmt.Sprintf("s3 circuit breaker is open; retry after %s", err.RetryAfter)
+}
+
+// CircuitBreaker stops sending requests to AWS S3 while it has an outage, so that sends and receives of hefty messages
+// fail or wait right away instead of going through all retries of the AWS SDK. Its circuit opens after a number of
+// consecutive requests failed with a server error or without a response, and closes again once a single request sent
+// after the open duration succeeds. Client errors like a missing object or denied access do not count as failures. A
+// circuit breaker can be given to multiple wrappers so that they share a single circuit.
+type CircuitBreaker struct {
+	config CircuitBreakerConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	queued   int
+	changed  chan struct{} // closed and replaced whenever the state changes
+}
+
+// NewCircuitBreaker creates a circuit breaker with a closed circuit
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = defaultCircuitFailureThreshold
+	}
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = defaultCircuitOpenDuration
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultCircuitQueueSize
+	}
+
+	return &CircuitBreaker{
+		config:  config,
+		now:     time.Now,
+		changed: make(chan struct{}),
+	}
+}
+
+// State returns the state of the circuit
+func (breaker *CircuitBreaker) State() CircuitState {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	return breaker.state
+}
+
+// setState changes the state of the circuit and wakes up the queued requests. The lock must be held.
+func (breaker *CircuitBreaker) setState(state CircuitState) {
+	breaker.state = state
+	close(breaker.changed)
+	breaker.changed = make(chan struct{})
+}
+
+// allow waits until a request can be sent according to the fallback and returns whether it is the request finding out
+// whether AWS S3 has recovered
+func (breaker *CircuitBreaker) allow(ctx context.Context) (bool, error) {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	for {
+		var retryAfter time.Duration
+		switch breaker.state {
+		case CircuitClosed:
+			return false, nil
+		case CircuitOpen:
+			if retryAfter = breaker.openedAt.Add(breaker.config.OpenDuration).Sub(breaker.now()); retryAfter <= 0 {
+				breaker.setState(CircuitHalfOpen)
+				return true, nil
+			}
+		}
+
+		if breaker.config.Fallback != CircuitQueue || breaker.queued >= breaker.config.QueueSize {
+			return false, &CircuitOpenError{RetryAfter: max(retryAfter, 0)}
+		}
+
+		if err := breaker.wait(ctx, retryAfter); err != nil {
+			return false, err
+		}
+	}
+}
+
+// wait queues a request until the state changes, `retryAfter` has passed when it is positive, or its context is done.
+// The lock must be held and is held again when wait returns.
+func (breaker *CircuitBreaker) wait(ctx context.Context, retryAfter time.Duration) error {
+	breaker.queued++
+	changed := breaker.changed
+	breaker.mu.Unlock()
+
+	var elapsed <-chan time.Time
+	if retryAfter > 0 {
+		timer := time.NewTimer(retryAfter)
+		defer timer.Stop()
+		elapsed = timer.C
+	}
+
+	var err error
+	select {
+	case <-changed:
+	case <-elapsed:
+	case <-ctx.Done():
+		err = fmt.Errorf("unable to send s3 request while circuit breaker is open. %v", ctx.Err())
+	}
+
+	breaker.mu.Lock()
+	breaker.queued--
+	return err
+}
+
+// record records the outcome of a request sent to AWS S3. A request that neither failed nor succeeded, e.g. because its
+// context was cancelled, is not counted.
+func (breaker *CircuitBreaker) record(probe, failed, succeeded bool) {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	switch {
+	case succeeded:
+		breaker.failures = 0
+		if breaker.state != CircuitClosed {
+			breaker.setState(CircuitClosed)
+		}
+	case failed && (probe || breaker.state == CircuitClosed):
+		if breaker.failures++; probe || breaker.failures >= breaker.config.FailureThreshold {
+			breaker.openedAt = breaker.now()
+			breaker.setState(CircuitOpen)
+		}
+	case probe && breaker.state == CircuitHalfOpen:
+		// another request finds out whether AWS S3 has recovered
+		breaker.setState(CircuitOpen)
+	}
+}
+
+// s3Option sends every attempt of the AWS S3 requests made with the options through the circuit breaker
+func (breaker *CircuitBreaker) s3Option() func(*s3.Options) {
+	return func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc("HeftyCircuitBreaker", breaker.handleDeserialize), middleware.After)
+		})
+	}
+}
+
+func (breaker *CircuitBreaker) handleDeserialize(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (middleware.DeserializeOutput, middleware.Metadata, error) {
+	probe, err := breaker.allow(ctx)
+	if err != nil {
+		return middleware.DeserializeOutput{}, middleware.Metadata{}, err
+	}
+
+	out, metadata, err := next.HandleDeserialize(ctx, in)
+
+	// requests fail when AWS S3 responds with a server error or does not respond at all
+	resp, _ := out.RawResponse.(*smithyhttp.Response)
+	failed := (err != nil && ctx.Err() == nil) || (resp != nil && resp.StatusCode >= http.StatusInternalServerError)
+	breaker.record(probe, failed, err == nil && !failed)
+
+	return out, metadata, err
+}
@@ -0,0 +1,127 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCircuitBreaker(config CircuitBreakerConfig) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	breaker := NewCircuitBreaker(config)
+	breaker.now = clock.Now
+	return breaker, clock
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker, clock := newTestCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, OpenDuration: time.Second})
+
+	// only consecutive failures open the circuit
+	breaker.record(false, true, false)
+	breaker.record(false, false, true)
+	breaker.record(false, true, false)
+	assert.Equal(t, CircuitClosed, breaker.State())
+	breaker.record(false, true, false)
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	_, err := breaker.allow(context.TODO())
+	assert.Equal(t, &CircuitOpenError{RetryAfter: time.Second}, err)
+
+	// a single request finds out whether AWS S3 has recovered once the circuit was open for the open duration
+	clock.now = clock.now.Add(time.Second)
+	probe, err := breaker.allow(context.TODO())
+	assert.Nil(t, err)
+	assert.True(t, probe)
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+	_, err = breaker.allow(context.TODO())
+	assert.Equal(t, &CircuitOpenError{}, err)
+
+	// a failed probe opens the circuit again
+	breaker.record(probe, true, false)
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	// a probe that neither failed nor succeeded lets the next request find out
+	clock.now = clock.now.Add(time.Second)
+	probe, _ = breaker.allow(context.TODO())
+	breaker.record(probe, false, false)
+	probe, err = breaker.allow(context.TODO())
+	assert.Nil(t, err)
+	assert.True(t, probe)
+
+	// a succeeded probe closes the circuit
+	breaker.record(probe, false, true)
+	assert.Equal(t, CircuitClosed, breaker.State())
+	probe, err = breaker.allow(context.TODO())
+	assert.Nil(t, err)
+	assert.False(t, probe)
+
+	opts := defaultOptions()
+	assert.NotNil(t, WithCircuitBreaker(nil)(&opts))
+}
+
+func TestCircuitBreakerQueue(t *testing.T) {
+	breaker, _ := newTestCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, OpenDuration: time.Hour, Fallback: CircuitQueue, QueueSize: 1})
+	breaker.record(false, true, false)
+
+	// queued requests are sent once the circuit is closed
+	allowed := make(chan error)
+	go func() {
+		_, err := breaker.allow(context.TODO())
+		allowed <- err
+	}()
+	assert.Eventually(t, func() bool {
+		breaker.mu.Lock()
+		defer breaker.mu.Unlock()
+		return breaker.queued == 1
+	}, time.Second, time.Millisecond)
+
+	// requests fail when the queue is full
+	_, err := breaker.allow(context.TODO())
+	var circuitOpenErr *CircuitOpenError
+	assert.ErrorAs(t, err, &circuitOpenErr)
+
+	breaker.record(false, false, true)
+	assert.Nil(t, <-allowed)
+
+	// queued requests wait until their context is done
+	breaker.record(false, true, false)
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	_, err = breaker.allow(ctx)
+	assert.ErrorContains(t, err, context.DeadlineExceeded.Error())
+	assert.Equal(t, 0, breaker.queued)
+}
+
+func TestCircuitBreakerS3Option(t *testing.T) {
+	httpClient := &stubHttpClient{status: http.StatusServiceUnavailable}
+	s3Client := s3.New(s3.Options{Region: "us-east-1", Credentials: aws.AnonymousCredentials{}, HTTPClient: httpClient, Retryer: aws.NopRetryer{}})
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2})
+
+	input := &s3.PutObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key"), Body: strings.NewReader("hefty")}
+	for i := 0; i < 2; i++ {
+		_, err := s3Client.PutObject(context.TODO(), input, breaker.s3Option())
+		assert.NotNil(t, err)
+	}
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	// requests are failed without being sent while the circuit is open
+	_, err := s3Client.PutObject(context.TODO(), input, breaker.s3Option())
+	backoffErr, ok := asBackoffError(err)
+	assert.True(t, ok)
+	assert.True(t, errors.As(backoffErr, new(*CircuitOpenError)))
+	assert.Equal(t, 2, httpClient.requests)
+
+	// client errors do not open the circuit
+	httpClient.status = http.StatusNotFound
+	breaker = NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1})
+	_, err = s3Client.PutObject(context.TODO(), input, breaker.s3Option())
+	assert.NotNil(t, err)
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
@@ -0,0 +1,201 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCleanupQueueSize   = 1000
+	defaultCleanupMaxAttempts = 5
+	defaultCleanupBackoff     = time.Second
+)
+
+// PayloadCleanup is a hefty message whose delete failed and is retried in the background
+type PayloadCleanup struct {
+	Bucket    string
+	Key       string
+	Backend   string
+	VersionId string
+	Attempts  int   // number of failed deletes, including the delete of DeleteHeftyMessage
+	Err       error // error of the last failed delete
+}
+
+// CleanupSpool persists payload cleanups that could not be completed in the background, e.g. in a separate AWS SQS queue,
+// so that they are not lost. Spooled cleanups can be retried with RetryPayloadCleanup.
+type CleanupSpool interface {
+	Spool(ctx context.Context, cleanup PayloadCleanup) error
+}
+
+// CleanupConfig configures the background retries of failed hefty message deletes, see WithPayloadCleanup
+type CleanupConfig struct {
+	// QueueSize is the number of cleanups that can be pending. 1000 is used when 0.
+	QueueSize int
+	// MaxAttempts is the number of deletes after which a cleanup is given up and spooled. 5 is used when 0.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, which is doubled for every further retry. 1 second is used when 0.
+	Backoff time.Duration
+	// Spool receives the cleanups that were given up, did not fit into the queue or were pending when the wrapper was
+	// closed. Such cleanups are dropped when nil, leaving the hefty messages to lifecycle rules.
+	Spool CleanupSpool
+	// OnResult is called with every cleanup that is completed, with a nil error, or given up, with the error of the last
+	// delete, e.g. to record metrics.
+	OnResult func(ctx context.Context, cleanup PayloadCleanup, err error)
+}
+
+// cleanupWorker retries failed deletes of hefty messages in a background goroutine
+type cleanupWorker struct {
+	config  CleanupConfig
+	delete  func(ctx context.Context, bucket, key, backend, versionId string) error
+	queue   chan PayloadCleanup
+	mu      sync.Mutex
+	closed  bool
+	backoff map[*time.Timer]PayloadCleanup // cleanups waiting for their backoff
+	done    chan struct{}
+}
+
+func newCleanupWorker(config CleanupConfig, delete func(ctx context.Context, bucket, key, backend, versionId string) error) *cleanupWorker {
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultCleanupQueueSize
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultCleanupMaxAttempts
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaultCleanupBackoff
+	}
+
+	worker := &cleanupWorker{
+		config:  config,
+		delete:  delete,
+		queue:   make(chan PayloadCleanup, config.QueueSize),
+		backoff: map[*time.Timer]PayloadCleanup{},
+		done:    make(chan struct{}),
+	}
+	go worker.run()
+
+	return worker
+}
+
+// enqueue schedules the retry of a failed delete. It returns false when the cleanup could neither be queued nor spooled,
+// in which case the caller should report the failed delete.
+func (worker *cleanupWorker) enqueue(ctx context.Context, cleanup PayloadCleanup) bool {
+	cleanup.Attempts++
+	if cleanup.Attempts >= worker.config.MaxAttempts {
+		return worker.giveUp(ctx, cleanup)
+	}
+
+	worker.mu.Lock()
+	defer worker.mu.Unlock()
+	if worker.closed {
+		return worker.spool(ctx, cleanup)
+	}
+
+	// wait for the backoff without blocking the worker
+	var timer *time.Timer
+	timer = time.AfterFunc(worker.config.Backoff<<(cleanup.Attempts-1), func() {
+		worker.mu.Lock()
+		defer worker.mu.Unlock()
+		if _, ok := worker.backoff[timer]; !ok {
+			return
+		}
+		delete(worker.backoff, timer)
+
+		select {
+		case worker.queue <- cleanup:
+		default:
+			worker.spool(context.Background(), cleanup)
+		}
+	})
+	worker.backoff[timer] = cleanup
+
+	return true
+}
+
+func (worker *cleanupWorker) run() {
+	defer close(worker.done)
+
+	for cleanup := range worker.queue {
+		ctx := context.Background()
+		err := worker.delete(ctx, cleanup.Bucket, cleanup.Key, cleanup.Backend, cleanup.VersionId)
+		if err == nil {
+			worker.report(ctx, cleanup, nil)
+			continue
+		}
+
+		cleanup.Err = err
+		worker.enqueue(ctx, cleanup)
+	}
+}
+
+// giveUp spools a cleanup that failed too often
+func (worker *cleanupWorker) giveUp(ctx context.Context, cleanup PayloadCleanup) bool {
+	worker.report(ctx, cleanup, cleanup.Err)
+	if worker.config.Spool == nil {
+		return false
+	}
+
+	return worker.spoolCleanup(ctx, cleanup)
+}
+
+// spool spools a cleanup that is still pending, or drops it without a spool
+func (worker *cleanupWorker) spool(ctx context.Context, cleanup PayloadCleanup) bool {
+	if worker.config.Spool == nil {
+		worker.report(ctx, cleanup, errors.Join(errors.New("payload cleanup dropped"), cleanup.Err))
+		return false
+	}
+
+	return worker.spoolCleanup(ctx, cleanup)
+}
+
+func (worker *cleanupWorker) spoolCleanup(ctx context.Context, cleanup PayloadCleanup) bool {
+	if err := worker.config.Spool.Spool(ctx, cleanup); err != nil {
+		worker.report(ctx, cleanup, errors.Join(err, cleanup.Err))
+		return false
+	}
+
+	return true
+}
+
+func (worker *cleanupWorker) report(ctx context.Context, cleanup PayloadCleanup, err error) {
+	if worker.config.OnResult != nil {
+		worker.config.OnResult(ctx, cleanup, err)
+	}
+}
+
+// close stops the worker once the queued cleanups have been retried once. Cleanups waiting for their backoff and cleanups
+// that fail their last retry are spooled.
+func (worker *cleanupWorker) close(ctx context.Context) {
+	worker.mu.Lock()
+	if worker.closed {
+		worker.mu.Unlock()
+		return
+	}
+	worker.closed = true
+	close(worker.queue)
+	for timer, cleanup := range worker.backoff {
+		timer.Stop()
+		worker.spool(ctx, cleanup)
+	}
+	worker.backoff = nil
+	worker.mu.Unlock()
+
+	<-worker.done
+}
+
+// RetryPayloadCleanup deletes the hefty message of a cleanup that was spooled, e.g. when consuming the AWS SQS queue the
+// spool sends cleanups to. The reference message of the hefty message was already deleted.
+func (wrapper *SqsClientWrapper) RetryPayloadCleanup(ctx context.Context, cleanup PayloadCleanup) error {
+	return wrapper.storage.deletePayload(ctx, cleanup.Bucket, cleanup.Key, cleanup.Backend, cleanup.VersionId)
+}
+
+// Close stops retrying failed deletes of hefty messages in the background when WithPayloadCleanup is used. Pending
+// cleanups are retried once more and spooled when they fail, and cleanups waiting for a retry are spooled. The wrapper
+// must not be used after it was closed.
+func (wrapper *SqsClientWrapper) Close(ctx context.Context) {
+	if wrapper.storage.cleanup != nil {
+		wrapper.storage.cleanup.close(ctx)
+	}
+}
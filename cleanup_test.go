@@ -0,0 +1,96 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memorySpool struct {
+	mu       sync.Mutex
+	cleanups []PayloadCleanup
+}
+
+func (spool *memorySpool) Spool(_ context.Context, cleanup PayloadCleanup) error {
+	spool.mu.Lock()
+	defer spool.mu.Unlock()
+	spool.cleanups = append(spool.cleanups, cleanup)
+	return nil
+}
+
+func TestCleanupWorker(t *testing.T) {
+	var tests = []struct {
+		desc          string
+		failedDeletes int
+		maxAttempts   int
+		expErr        bool
+		expAttempts   int
+		expSpooled    bool
+	}{
+		{desc: "completed_on_first_retry", failedDeletes: 1, maxAttempts: 5, expAttempts: 1},
+		{desc: "completed_after_retries", failedDeletes: 3, maxAttempts: 5, expAttempts: 3},
+		{desc: "given_up_and_spooled", failedDeletes: 10, maxAttempts: 3, expErr: true, expAttempts: 3, expSpooled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			deletes := 0
+			deleteFn := func(context.Context, string, string, string, string) error {
+				deletes++
+				if deletes <= tt.failedDeletes {
+					return errors.New("slow down")
+				}
+				return nil
+			}
+
+			results := make(chan error, 1)
+			spool := &memorySpool{}
+			var result PayloadCleanup
+			worker := newCleanupWorker(CleanupConfig{
+				MaxAttempts: tt.maxAttempts,
+				Backoff:     time.Millisecond,
+				Spool:       spool,
+				OnResult: func(_ context.Context, cleanup PayloadCleanup, err error) {
+					result = cleanup
+					results <- err
+				},
+			}, deleteFn)
+
+			// the first delete failed in DeleteHeftyMessage
+			deletes++
+			assert.True(t, worker.enqueue(context.TODO(), PayloadCleanup{Bucket: "bucket", Key: "key", Err: errors.New("slow down")}))
+
+			err := <-results
+			worker.close(context.TODO())
+			assert.Equal(t, tt.expErr, err != nil)
+			assert.Equal(t, tt.expAttempts, result.Attempts)
+			assert.Equal(t, "key", result.Key)
+			assert.Equal(t, tt.expSpooled, len(spool.cleanups) == 1)
+		})
+	}
+}
+
+func TestCleanupWorkerClose(t *testing.T) {
+	spool := &memorySpool{}
+	worker := newCleanupWorker(CleanupConfig{Backoff: time.Hour, Spool: spool}, func(context.Context, string, string, string, string) error {
+		return nil
+	})
+
+	// cleanups waiting for a retry are spooled on close
+	assert.True(t, worker.enqueue(context.TODO(), PayloadCleanup{Key: "key"}))
+	worker.close(context.TODO())
+	assert.Len(t, spool.cleanups, 1)
+
+	// cleanups are spooled after close
+	assert.True(t, worker.enqueue(context.TODO(), PayloadCleanup{Key: "other"}))
+	assert.Len(t, spool.cleanups, 2)
+
+	// cleanups are reported to the caller without spool
+	worker = newCleanupWorker(CleanupConfig{}, nil)
+	worker.close(context.TODO())
+	assert.False(t, worker.enqueue(context.TODO(), PayloadCleanup{Key: "key"}))
+}
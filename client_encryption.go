@@ -0,0 +1,164 @@
+package hefty
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// DataKeyProvider creates and decrypts the data keys used for client side encryption of hefty messages. A provider backed
+// by AWS KMS implements GenerateDataKey with kms.GenerateDataKey using the AES_256 key spec and DecryptDataKey with
+// kms.Decrypt, passing the encryption context to both calls:
+//
+//	func (p *kmsKeys) GenerateDataKey(ctx context.Context, encryptionContext map[string]string) ([]byte, []byte, string, error) {
+//		out, err := p.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+//			KeyId:             aws.String(p.keyId),
+//			KeySpec:           kmstypes.DataKeySpecAes256,
+//			EncryptionContext: encryptionContext,
+//		})
+//		if err != nil {
+//			return nil, nil, "", err
+//		}
+//		return out.Plaintext, out.CiphertextBlob, aws.ToString(out.KeyId), nil
+//	}
+//
+//	func (p *kmsKeys) DecryptDataKey(ctx context.Context, ciphertext []byte, keyId string, encryptionContext map[string]string) ([]byte, error) {
+//		out, err := p.client.Decrypt(ctx, &kms.DecryptInput{
+//			CiphertextBlob:    ciphertext,
+//			KeyId:             aws.String(keyId),
+//			EncryptionContext: encryptionContext,
+//		})
+//		if err != nil {
+//			return nil, err
+//		}
+//		return out.Plaintext, nil
+//	}
+type DataKeyProvider interface {
+	// GenerateDataKey returns a new 256 bit data key, the data key encrypted under the key identified by the returned key
+	// id, and that key id. The encryption context must be bound to the encrypted data key.
+	GenerateDataKey(ctx context.Context, encryptionContext map[string]string) (plaintext, ciphertext []byte, keyId string, err error)
+	// DecryptDataKey decrypts a data key returned by GenerateDataKey. It must fail when `encryptionContext` differs from
+	// the one the data key was generated with.
+	DecryptDataKey(ctx context.Context, ciphertext []byte, keyId string, encryptionContext map[string]string) ([]byte, error)
+}
+
+// clientSideEncryption holds the client side encryption settings of a client wrapper
+type clientSideEncryption struct {
+	keys     DataKeyProvider
+	channels map[string]struct{} // queue urls and topic arns, besides the queue received from, hefty messages may come from
+}
+
+// newEncryptionContext returns the encryption context binding an encrypted hefty message to the queue url or topic arn
+// it was sent to and to its message body
+func newEncryptionContext(channel, md5DigestMsgBody string) map[string]string {
+	return map[string]string{
+		EncryptionContextKeyChannel:    channel,
+		EncryptionContextKeyBodyDigest: md5DigestMsgBody,
+	}
+}
+
+// encrypt encrypts a serialized hefty message sent to `channel` with a new data key using AES-256-GCM and records the
+// encrypted data key and encryption context in the reference message. The encryption context is also used as additional
+// authenticated data so that it cannot be altered.
+func (encryption *clientSideEncryption) encrypt(ctx context.Context, channel string, refMsg *types.ReferenceMsg, serialized []byte) ([]byte, error) {
+	encryptionContext := newEncryptionContext(channel, refMsg.Md5DigestMsgBody)
+
+	dataKey, encryptedDataKey, keyId, err := encryption.keys.GenerateDataKey(ctx, encryptionContext)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate data key. %v", err)
+	}
+
+	aead, err := newAead(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("unable to create nonce. %v", err)
+	}
+
+	refMsg.EncryptedDataKey = encryptedDataKey
+	refMsg.KeyId = keyId
+	refMsg.EncryptionContext = encryptionContext
+
+	return aead.Seal(nonce, nonce, serialized, additionalData(encryptionContext)), nil
+}
+
+// decrypt decrypts a hefty message received from the queue `queueUrl`. The encryption context of the hefty message must
+// name that queue, or one of the accepted channels, and match the message body digest of the reference message.
+// Hefty messages that were not encrypted are returned as is.
+func (encryption *clientSideEncryption) decrypt(ctx context.Context, queueUrl string, refMsg *types.ReferenceMsg, payload []byte) ([]byte, error) {
+	if len(refMsg.EncryptedDataKey) == 0 {
+		return payload, nil
+	}
+	if encryption == nil {
+		return nil, errors.New("hefty message is encrypted but client side encryption is not configured")
+	}
+
+	// verify that the hefty message was sent to this channel
+	channel := refMsg.EncryptionContext[EncryptionContextKeyChannel]
+	if _, ok := encryption.channels[channel]; !ok && channel != queueUrl {
+		return nil, fmt.Errorf("hefty message was encrypted for channel %s and cannot be decrypted from %s", channel, queueUrl)
+	}
+	if refMsg.EncryptionContext[EncryptionContextKeyBodyDigest] != refMsg.Md5DigestMsgBody {
+		return nil, errors.New("encryption context of hefty message does not match the reference message")
+	}
+
+	dataKey, err := encryption.keys.DecryptDataKey(ctx, refMsg.EncryptedDataKey, refMsg.KeyId, refMsg.EncryptionContext)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt data key. %v", err)
+	}
+
+	aead, err := newAead(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < aead.NonceSize() {
+		return nil, errors.New("encrypted hefty message is too short")
+	}
+
+	nonce, ciphertext := payload[:aead.NonceSize()], payload[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData(refMsg.EncryptionContext))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt hefty message. %v", err)
+	}
+
+	return plaintext, nil
+}
+
+func newAead(dataKey []byte) (cipher.AEAD, error) {
+	if len(dataKey) != 32 {
+		return nil, fmt.Errorf("data key must be 256 bits but is %d bits", len(dataKey)*8)
+	}
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cipher. %v", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// additionalData returns the encryption context in a canonical form
+func additionalData(encryptionContext map[string]string) []byte {
+	keys := make([]string, 0, len(encryptionContext))
+	for key := range encryptionContext {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	for _, key := range keys {
+		builder.WriteString(fmt.Sprintf("%d:%s%d:%s", len(key), key, len(encryptionContext[key]), encryptionContext[key]))
+	}
+
+	return []byte(builder.String())
+}
@@ -0,0 +1,111 @@
+package hefty
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKeys "encrypts" data keys by prefixing the encryption context and key id so that decrypting with a different
+// encryption context fails like it does with AWS KMS
+type fakeKeys struct {
+	keyId string
+}
+
+func (keys *fakeKeys) GenerateDataKey(_ context.Context, encryptionContext map[string]string) ([]byte, []byte, string, error) {
+	dataKey := bytes.Repeat([]byte{7}, 32)
+	return dataKey, append(additionalData(encryptionContext), dataKey...), keys.keyId, nil
+}
+
+func (keys *fakeKeys) DecryptDataKey(_ context.Context, ciphertext []byte, keyId string, encryptionContext map[string]string) ([]byte, error) {
+	prefix := additionalData(encryptionContext)
+	if keyId != keys.keyId || !bytes.HasPrefix(ciphertext, prefix) {
+		return nil, errors.New("invalid ciphertext")
+	}
+	return ciphertext[len(prefix):], nil
+}
+
+func TestClientSideEncryption(t *testing.T) {
+	const (
+		queueUrl = "https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue"
+		topicArn = "arn:aws:sns:us-west-2:765908583888:MyTopic"
+	)
+
+	var tests = []struct {
+		desc     string
+		channel  string
+		receive  string
+		channels []string
+		tamper   func(refMsg *types.ReferenceMsg, payload []byte)
+		expErr   bool
+	}{
+		{desc: "same_queue", channel: queueUrl, receive: queueUrl},
+		{desc: "accepted_topic", channel: topicArn, receive: queueUrl, channels: []string{topicArn}},
+		{desc: "replayed_to_other_queue", channel: queueUrl, receive: queueUrl + "Other", expErr: true},
+		{desc: "topic_not_accepted", channel: topicArn, receive: queueUrl, expErr: true},
+		{desc: "altered_channel", channel: queueUrl, receive: queueUrl + "Other", tamper: func(refMsg *types.ReferenceMsg, _ []byte) {
+			refMsg.EncryptionContext[EncryptionContextKeyChannel] = queueUrl + "Other"
+		}, expErr: true},
+		{desc: "altered_body_digest", channel: queueUrl, receive: queueUrl, tamper: func(refMsg *types.ReferenceMsg, _ []byte) {
+			refMsg.Md5DigestMsgBody = "d41d8cd98f00b204e9800998ecf8427e"
+		}, expErr: true},
+		{desc: "altered_payload", channel: queueUrl, receive: queueUrl, tamper: func(_ *types.ReferenceMsg, payload []byte) {
+			payload[len(payload)-1] ^= 1
+		}, expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			encryption := &clientSideEncryption{keys: &fakeKeys{keyId: "key-1"}, channels: map[string]struct{}{}}
+			for _, channel := range tt.channels {
+				encryption.channels[channel] = struct{}{}
+			}
+
+			serialized := []byte("hefty message")
+			refMsg := &types.ReferenceMsg{Md5DigestMsgBody: "f6335cfd72eec3e93f84c1d0330c5f85"}
+			payload, err := encryption.encrypt(context.TODO(), tt.channel, refMsg, serialized)
+			assert.Nil(t, err)
+			assert.NotEqual(t, serialized, payload)
+			assert.Equal(t, "key-1", refMsg.KeyId)
+
+			// the reference message is sent as json
+			refMsg, err = types.ToReferenceMsg(toJson(t, refMsg))
+			assert.Nil(t, err)
+			if tt.tamper != nil {
+				tt.tamper(refMsg, payload)
+			}
+
+			decrypted, err := encryption.decrypt(context.TODO(), tt.receive, refMsg, payload)
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.True(t, reflect.DeepEqual(serialized, decrypted))
+		})
+	}
+}
+
+func TestClientSideEncryptionNotConfigured(t *testing.T) {
+	var encryption *clientSideEncryption
+
+	// unencrypted hefty messages are returned as is
+	payload, err := encryption.decrypt(context.TODO(), "queue", &types.ReferenceMsg{}, []byte("hefty message"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hefty message"), payload)
+
+	_, err = encryption.decrypt(context.TODO(), "queue", &types.ReferenceMsg{EncryptedDataKey: []byte("key")}, []byte("hefty message"))
+	assert.NotNil(t, err)
+}
+
+func toJson(t *testing.T, refMsg *types.ReferenceMsg) string {
+	jsonRefMsg, err := json.Marshal(refMsg)
+	assert.Nil(t, err)
+	return string(jsonRefMsg)
+}
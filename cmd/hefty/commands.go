@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jo-parker/sqs-hefty"
+)
+
+// list lists the hefty messages stored in a bucket as json lines
+func list(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags, wrapperFlags := newFlagSet("list", stderr)
+	input := &hefty.ListHeftyObjectsInput{}
+	flags.StringVar(&input.Target, "queue", "", "only list hefty messages sent to this queue url")
+	flags.StringVar(&input.Tenant, "tenant", "", "only list hefty messages of this tenant")
+	flags.DurationVar(&input.MinAge, "min-age", 0, "only list hefty messages stored at least this long ago, e.g. 24h")
+	flags.DurationVar(&input.MaxAge, "max-age", 0, "only list hefty messages stored at most this long ago")
+	flags.Int64Var(&input.MinSize, "min-size", 0, "only list hefty messages of at least this many bytes")
+	flags.Int64Var(&input.MaxSize, "max-size", 0, "only list hefty messages of at most this many bytes")
+	flags.IntVar(&input.Limit, "limit", 0, "maximum number of hefty messages listed")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if wrapperFlags.bucket == "" {
+		return errors.New("-bucket is required")
+	}
+
+	wrapper, err := wrapperFlags.newWrapper(ctx)
+	if err != nil {
+		return err
+	}
+
+	out, err := wrapper.ListHeftyObjects(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(stdout)
+	for _, object := range out.Objects {
+		if err = encoder.Encode(object); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// peekedMessage is a message printed by peek
+type peekedMessage struct {
+	MessageId         string                                    `json:"messageId"`
+	Body              string                                    `json:"body"`
+	MessageAttributes map[string]sqstypes.MessageAttributeValue `json:"messageAttributes,omitempty"`
+	Attributes        map[string]string                         `json:"attributes,omitempty"`
+	Bucket            string                                    `json:"bucket,omitempty"`
+	Key               string                                    `json:"key,omitempty"`
+	Error             string                                    `json:"error,omitempty"`
+}
+
+// peek prints the messages of a queue with their hefty messages resolved as json lines, or exports them to a directory
+func peek(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags, wrapperFlags := newFlagSet("peek", stderr)
+	queueUrl := flags.String("queue", "", "queue url to peek at")
+	maxMessages := flags.Int("max", 10, "maximum number of messages peeked at")
+	dir := flags.String("dir", "", "export the messages to this directory instead of printing them")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if *queueUrl == "" {
+		return errors.New("-queue is required")
+	}
+
+	wrapper, err := wrapperFlags.newWrapper(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *dir != "" {
+		out, err := wrapper.Export(ctx, &hefty.ExportInput{QueueUrl: *queueUrl, Dir: *dir, MaxMessages: *maxMessages})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(stdout, "exported %d messages to %s; %d could not be resolved\n", out.Exported, *dir, out.Failed)
+		return nil
+	}
+
+	inspected, err := wrapper.Inspect(ctx, *queueUrl, *maxMessages)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(stdout)
+	for _, msg := range inspected {
+		peeked := peekedMessage{
+			MessageId:         msg.MessageId,
+			Body:              aws.ToString(msg.Body),
+			MessageAttributes: msg.MessageAttributes,
+			Attributes:        msg.Attributes,
+			Bucket:            msg.Bucket,
+			Key:               msg.Key,
+		}
+		if msg.Err != nil {
+			peeked.Error = msg.Err.Error()
+		}
+
+		if err = encoder.Encode(peeked); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// get writes the original body of a hefty message to stdout or a file, or prints it with its message attributes as json
+func get(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags, wrapperFlags := newFlagSet("get", stderr)
+	input := &hefty.GetHeftyMessageInput{}
+	flags.StringVar(&input.Key, "key", "", "key of the hefty message in -bucket")
+	flags.StringVar(&input.VersionId, "version-id", "", "version id of the hefty message")
+	flags.StringVar(&input.QueueUrl, "queue", "", "queue url the message was sent to; needed for client side encryption")
+	ref := flags.String("ref", "", "reference message json, @file to read it from a file or - to read it from stdin")
+	outFile := flags.String("out", "", "write the body to this file instead of stdout")
+	asJson := flags.Bool("json", false, "print the body and message attributes as json")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+
+	var err error
+	input.ReferenceMessage, err = readReference(*ref)
+	if err != nil {
+		return err
+	}
+	input.Bucket = wrapperFlags.bucket
+	if input.ReferenceMessage == "" && (input.Bucket == "" || input.Key == "") {
+		return errors.New("either -ref or -bucket and -key are required")
+	}
+
+	wrapper, err := wrapperFlags.newWrapper(ctx)
+	if err != nil {
+		return err
+	}
+
+	out, err := wrapper.GetHeftyMessage(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	writer := stdout
+	if *outFile != "" {
+		file, err := os.Create(*outFile)
+		if err != nil {
+			return fmt.Errorf("unable to create %s. %v", *outFile, err)
+		}
+		defer file.Close()
+		writer = file
+	}
+
+	if *asJson {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "\t")
+		return encoder.Encode(struct {
+			Body              string                                    `json:"body"`
+			MessageAttributes map[string]sqstypes.MessageAttributeValue `json:"messageAttributes,omitempty"`
+		}{aws.ToString(out.Body), out.MessageAttributes})
+	}
+
+	_, err = io.WriteString(writer, aws.ToString(out.Body))
+	return err
+}
+
+// readReference reads the reference message given as json, as @file or as - for stdin
+func readReference(ref string) (string, error) {
+	switch {
+	case ref == "-":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("unable to read reference message from stdin. %v", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case strings.HasPrefix(ref, "@"):
+		data, err := os.ReadFile(ref[1:])
+		if err != nil {
+			return "", fmt.Errorf("unable to read reference message. %v", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	default:
+		return ref, nil
+	}
+}
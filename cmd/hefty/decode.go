@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jo-parker/sqs-hefty"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+)
+
+// gzipMagic are the first bytes of gzip compressed data
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decodedMessage is a hefty message printed by decode
+type decodedMessage struct {
+	Body              string                                    `json:"body"`
+	MessageAttributes map[string]messages.MessageAttributeValue `json:"messageAttributes,omitempty"`
+	Size              int                                       `json:"size"`
+}
+
+// decode prints a serialized hefty message read from a file, stdin or AWS S3 as json. It does not need the queue or the
+// reference message of the hefty message, so hefty messages can be examined even when their queue is gone.
+func decode(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("decode", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(stderr, "usage: hefty decode <file|s3://bucket/key|->")
+		return errUsage
+	}
+
+	serialized, err := readPayload(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	decoded, err := decodePayload(ctx, serialized)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(decoded)
+}
+
+// readPayload reads a serialized hefty message from a file, stdin given as - or AWS S3 given as s3://bucket/key
+func readPayload(ctx context.Context, source string) ([]byte, error) {
+	switch {
+	case source == "-":
+		return io.ReadAll(os.Stdin)
+	case strings.HasPrefix(source, "s3://"):
+		bucket, key, found := strings.Cut(strings.TrimPrefix(source, "s3://"), "/")
+		if !found || bucket == "" || key == "" {
+			return nil, fmt.Errorf("invalid s3 location %s; expected s3://bucket/key", source)
+		}
+
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load aws configuration. %v", err)
+		}
+
+		out, err := s3.NewFromConfig(cfg).GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get %s. %v", source, err)
+		}
+		defer out.Body.Close()
+
+		return io.ReadAll(out.Body)
+	default:
+		return os.ReadFile(source)
+	}
+}
+
+// decodePayload decodes a serialized hefty message. Hefty messages compressed with the built-in gzip transform are
+// decompressed first; other transforms and client side encryption cannot be reversed without the wrapper configuration.
+func decodePayload(ctx context.Context, serialized []byte) (*decodedMessage, error) {
+	if bytes.HasPrefix(serialized, gzipMagic) {
+		reader, err := hefty.Gzip().Reverse(ctx, bytes.NewReader(serialized))
+		if err != nil {
+			return nil, fmt.Errorf("unable to decompress hefty message. %v", err)
+		}
+
+		serialized, err = io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decompress hefty message. %v", err)
+		}
+	}
+
+	heftyMsg, err := messages.DeserializeHeftyMessage(serialized)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode hefty message; it may be encrypted or transformed. %v", err)
+	}
+
+	return &decodedMessage{
+		Body:              aws.ToString(heftyMsg.Body),
+		MessageAttributes: heftyMsg.MessageAttributes,
+		Size:              heftyMsg.Size,
+	}, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/jo-parker/sqs-hefty"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	heftyMsg := messages.NewHeftyMessage(aws.String("hefty message"), map[string]messages.MessageAttributeValue{
+		"attr": {DataType: aws.String("String"), StringValue: aws.String("value")},
+	}, 25)
+	serialized, _, _, err := heftyMsg.Serialize()
+	assert.Nil(t, err)
+
+	reader, err := hefty.Gzip().Apply(context.TODO(), bytes.NewReader(serialized))
+	assert.Nil(t, err)
+	compressed, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+	var tests = []struct {
+		desc    string
+		payload []byte
+		expErr  bool
+	}{
+		{desc: "serialized", payload: serialized},
+		{desc: "gzip", payload: compressed},
+		{desc: "garbage", payload: []byte("garbage"), expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			file := filepath.Join(dir, tt.desc)
+			assert.Nil(t, os.WriteFile(file, tt.payload, 0o644))
+
+			var stdout, stderr bytes.Buffer
+			err := run(context.TODO(), []string{"decode", file}, &stdout, &stderr)
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Contains(t, stdout.String(), `"body": "hefty message"`)
+			assert.Contains(t, stdout.String(), `"attr"`)
+		})
+	}
+}
+
+func TestReadPayloadInvalidS3Location(t *testing.T) {
+	_, err := readPayload(context.TODO(), "s3://bucket")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,124 @@
+// Command hefty lists, inspects and downloads the hefty messages stored by the hefty client wrappers, so that operators
+// do not have to decode the serialized hefty message format by hand, and redrives and purges queues together with their
+// hefty messages.
+//
+// AWS credentials and the region are read from the environment and shared configuration files, as with the AWS CLI.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/jo-parker/sqs-hefty"
+)
+
+const usage = `usage: hefty <command> [flags]
+
+commands:
+  list     list the hefty messages stored in a bucket
+  peek     peek at the messages of a queue with their hefty messages resolved
+  get      download a hefty message given by its key or reference message
+  decode   decode a stored hefty message read from a file, stdin or s3://bucket/key
+  redrive  move the messages of a dead-letter queue to a queue
+  purge    purge a queue and delete its hefty messages
+
+Run 'hefty <command> -h' for the flags of a command.
+`
+
+// errUsage is returned when the command line is invalid after the usage was printed
+var errUsage = errors.New("invalid command line")
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "hefty: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run runs the command of the command line `args`
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		return list(ctx, args[1:], stdout, stderr)
+	case "peek":
+		return peek(ctx, args[1:], stdout, stderr)
+	case "get":
+		return get(ctx, args[1:], stdout, stderr)
+	case "decode":
+		return decode(ctx, args[1:], stdout, stderr)
+	case "redrive":
+		return redrive(ctx, args[1:], stdout, stderr)
+	case "purge":
+		return purge(ctx, args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		fmt.Fprintf(stderr, "unknown command %s\n\n%s", args[0], usage)
+		return errUsage
+	}
+}
+
+// wrapperFlags are the flags used to create the client wrapper of every command
+type wrapperFlags struct {
+	bucket      string
+	keyPrefix   string
+	keyTemplate string
+}
+
+// newFlagSet creates the flag set of a command with the flags of the client wrapper
+func newFlagSet(name string, stderr io.Writer) (*flag.FlagSet, *wrapperFlags) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	wrapper := &wrapperFlags{}
+	flags.StringVar(&wrapper.bucket, "bucket", "", "bucket hefty messages are stored in")
+	flags.StringVar(&wrapper.keyPrefix, "key-prefix", "", "key prefix configured with WithKeyPrefix")
+	flags.StringVar(&wrapper.keyTemplate, "key-template", "", "key template configured with WithKeyTemplate")
+
+	return flags, wrapper
+}
+
+// parse parses the flags of a command
+func parse(flags *flag.FlagSet, args []string) error {
+	// the flag set reports invalid flags itself
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(flags.Output(), "unexpected arguments %v\n", flags.Args())
+		return errUsage
+	}
+
+	return nil
+}
+
+// newWrapper creates the client wrapper the commands use. The bucket is not checked, since hefty messages are read
+// from the bucket recorded in their reference message.
+func (flags *wrapperFlags) newWrapper(ctx context.Context) (*hefty.SqsClientWrapper, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load aws configuration. %v", err)
+	}
+
+	opts := []hefty.Option{hefty.WithSkipBucketCheck(), hefty.WithKeyPrefix(flags.keyPrefix)}
+	if flags.keyTemplate != "" {
+		opts = append(opts, hefty.WithKeyTemplate(flags.keyTemplate))
+	}
+
+	return hefty.NewSqsClientWrapper(sqs.NewFromConfig(cfg), s3.NewFromConfig(cfg), flags.bucket, opts...)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunUsage(t *testing.T) {
+	var tests = []struct {
+		desc      string
+		args      []string
+		expErr    bool
+		expStdout string
+		expStderr string
+	}{
+		{desc: "no_command", args: nil, expErr: true, expStderr: "usage: hefty"},
+		{desc: "help", args: []string{"help"}, expStdout: "usage: hefty"},
+		{desc: "unknown_command", args: []string{"frobnicate"}, expErr: true, expStderr: "unknown command frobnicate"},
+		{desc: "invalid_flag", args: []string{"list", "-nope"}, expErr: true, expStderr: "flag provided but not defined"},
+		{desc: "missing_bucket", args: []string{"list"}, expErr: true},
+		{desc: "missing_queue", args: []string{"peek"}, expErr: true},
+		{desc: "missing_location", args: []string{"get", "-bucket", "bucket"}, expErr: true},
+		{desc: "missing_redrive_queues", args: []string{"redrive", "-from", "dlq"}, expErr: true},
+		{desc: "missing_purge_queue", args: []string{"purge"}, expErr: true},
+		{desc: "purge_dry_run_keeping_payloads", args: []string{"purge", "-queue", "queue", "-dry-run", "-keep-payloads"}, expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := run(context.TODO(), tt.args, &stdout, &stderr)
+			assert.Equal(t, tt.expErr, err != nil)
+			assert.Contains(t, stdout.String(), tt.expStdout)
+			assert.Contains(t, stderr.String(), tt.expStderr)
+		})
+	}
+}
+
+func TestReadReference(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ref.json")
+	assert.Nil(t, os.WriteFile(file, []byte("{\"s3_key\":\"key\"}\n"), 0o644))
+
+	ref, err := readReference("@" + file)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"s3_key":"key"}`, ref)
+
+	ref, err = readReference(`{"s3_key":"key"}`)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"s3_key":"key"}`, ref)
+
+	_, err = readReference("@" + file + ".missing")
+	assert.NotNil(t, err)
+}
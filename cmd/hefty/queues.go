@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/jo-parker/sqs-hefty"
+)
+
+// affectedMessage is a message printed by a dry run
+type affectedMessage struct {
+	MessageId string `json:"messageId"`
+	Bucket    string `json:"bucket,omitempty"`
+	Key       string `json:"key,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// redrive moves the messages of a dead-letter queue to a queue, or prints the messages that would be moved
+func redrive(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags, wrapperFlags := newFlagSet("redrive", stderr)
+	from := flags.String("from", "", "dead-letter queue url the messages are moved from")
+	to := flags.String("to", "", "queue url the messages are moved to")
+	dryRun := flags.Bool("dry-run", false, "print the messages and hefty messages that would be moved without moving them")
+	maxMessages := flags.Int("max", 100, "maximum number of messages printed by a dry run")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		return errors.New("-from and -to are required")
+	}
+
+	wrapper, err := wrapperFlags.newWrapper(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		inspected, err := wrapper.Inspect(ctx, *from, *maxMessages)
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(stdout)
+		for _, msg := range inspected {
+			affected := affectedMessage{MessageId: msg.MessageId, Bucket: msg.Bucket, Key: msg.Key}
+			if msg.Err != nil {
+				affected.Error = msg.Err.Error()
+			}
+			if err = encoder.Encode(affected); err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(stderr, "dry run: %d messages would be moved from %s to %s\n", len(inspected), *from, *to)
+		return nil
+	}
+
+	out, err := wrapper.Redrive(ctx, *from, *to)
+	if out != nil {
+		fmt.Fprintf(stdout, "moved %d messages from %s to %s\n", out.Moved, *from, *to)
+	}
+
+	return err
+}
+
+// purge purges a queue and deletes its hefty messages, or prints the hefty messages that would be deleted
+func purge(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags, wrapperFlags := newFlagSet("purge", stderr)
+	queueUrl := flags.String("queue", "", "queue url to purge")
+	keepPayloads := flags.Bool("keep-payloads", false, "keep the hefty messages of the queue")
+	dryRun := flags.Bool("dry-run", false, "print the hefty messages that would be deleted without purging the queue")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if *queueUrl == "" {
+		return errors.New("-queue is required")
+	}
+	if *keepPayloads && *dryRun {
+		return errors.New("-dry-run cannot be used with -keep-payloads")
+	}
+
+	wrapper, err := wrapperFlags.newWrapper(ctx)
+	if err != nil {
+		return err
+	}
+
+	payloads := hefty.DeleteQueuePayloads
+	switch {
+	case *keepPayloads:
+		payloads = hefty.KeepQueuePayloads
+	case *dryRun:
+		payloads = hefty.DryRunQueuePayloads
+	}
+
+	out, err := wrapper.PurgeHeftyQueue(ctx, &sqs.PurgeQueueInput{QueueUrl: aws.String(*queueUrl)}, payloads)
+	if err != nil && out == nil {
+		return err
+	}
+
+	if *dryRun {
+		encoder := json.NewEncoder(stdout)
+		for _, object := range out.Objects {
+			if err = encoder.Encode(object); err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(stderr, "dry run: %s would be purged and %d hefty messages deleted\n", *queueUrl, len(out.Objects))
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s was purged but not all of its %d hefty messages could be deleted. %v", *queueUrl, len(out.Objects), err)
+	}
+
+	fmt.Fprintf(stdout, "purged %s and deleted %d hefty messages\n", *queueUrl, len(out.Objects))
+	return nil
+}
@@ -0,0 +1,461 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const (
+	defaultConsumerConcurrency       = 10
+	defaultConsumerVisibilityTimeout = 30
+	defaultConsumerReceiveBackoff    = time.Second
+	maxReceiveMessages               = 10
+	maxWaitTimeSeconds               = 20
+)
+
+// Handler processes a message received by a Consumer. The message is deleted together with its hefty message when nil
+// is returned, and received again after its visibility timeout otherwise. The message is a message as returned by
+// ReceiveHeftyMessage.
+type Handler func(ctx context.Context, msg sqstypes.Message) error
+
+// Middleware wraps a Handler, e.g. to log, measure, retry or deduplicate messages around the handler it calls as `next`
+type Middleware func(next Handler) Handler
+
+// Chain wraps `handler` with `middlewares`. The first middleware is the outermost and sees every message first.
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
+
+// LimitConcurrency limits the number of messages handled at the same time by the handlers it wraps to `limit`. The limit
+// is shared by every handler wrapped by the returned middleware, so a handler used by consumers of several queues, or
+// that calls the same downstream service, can be limited as a whole. Waiting messages keep their visibility extended.
+func LimitConcurrency(limit int) Middleware {
+	sem := make(chan struct{}, max(limit, 1))
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg sqstypes.Message) error {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			defer func() { <-sem }()
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// ConsumerConfig configures a Consumer
+type ConsumerConfig struct {
+	// Concurrency is the number of messages handled at the same time. 10 is used when 0, or the minimum concurrency
+	// with Autoscaling.
+	Concurrency int
+	// MaxInFlight is the number of messages received and not yet handled, including the messages being handled. It
+	// bounds the memory used by the bodies of received hefty messages. Messages beyond Concurrency wait for a free
+	// handler with their visibility timeout extended. Concurrency is used when 0.
+	MaxInFlight int
+	// Autoscaling scales Concurrency with the backlog of the queue when not nil.
+	Autoscaling *AutoscalingConfig
+	// VisibilityTimeout is the visibility timeout in seconds of received messages. It is extended by the same timeout
+	// every half timeout for as long as the message is handled. 30 seconds is used when 0.
+	VisibilityTimeout int32
+	// AttributeNames and MessageAttributeNames are the system attributes and message attributes received. All are
+	// received when nil.
+	AttributeNames        []sqstypes.QueueAttributeName
+	MessageAttributeNames []string
+	// Codec decodes message bodies for Consume. JSONCodec is used when nil.
+	Codec Codec
+	// Middleware wraps the handler of the consumer, see Chain.
+	Middleware []Middleware
+	// ReceiveBackoff is the delay before messages are received again after a receive failed. 1 second is used when 0.
+	ReceiveBackoff time.Duration
+	// OnError is called with every error that is not returned to a caller: failed receives, with a nil message, failed
+	// handlers, failed visibility extensions and failed deletes.
+	OnError func(ctx context.Context, msg *sqstypes.Message, err error)
+}
+
+// consumerClient is the part of the AWS SQS client wrapper used by a Consumer
+type consumerClient interface {
+	ReceiveHeftyMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteHeftyMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	ChangeHeftyMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+	GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error)
+	ResolveHeftyMessage(ctx context.Context, queueUrl string, msg *sqstypes.Message) error
+}
+
+// Consumer receives the messages of one or more queues with long polling and handles them concurrently, see
+// StartConsumer and StartMultiConsumer
+type Consumer struct {
+	queues   []*consumedQueue
+	config   ConsumerConfig
+	inFlight *limiter // limits the messages that are received or handled
+	workers  *limiter // limits the messages that are handled
+	handlers sync.WaitGroup
+	done     chan struct{}
+}
+
+// ConsumerQueue is a queue consumed by StartMultiConsumer
+type ConsumerQueue struct {
+	QueueUrl string
+	// Client receives, deletes and extends the messages of the queue, so that queues whose hefty messages are stored with
+	// a different bucket or options can be consumed together. The wrapper StartMultiConsumer is called on is used when nil.
+	Client *SqsClientWrapper
+	// Weight is the share of the concurrency the queue gets, relative to the other queues, while all of them have a
+	// backlog. 1 is used when 0.
+	Weight int
+	// Handler handles the messages of the queue instead of the handler of StartMultiConsumer when not nil.
+	Handler Handler
+}
+
+// consumedQueue is a queue consumed by a Consumer
+type consumedQueue struct {
+	client   consumerClient
+	queueUrl string
+	handler  Handler
+	batch    int // maximum number of messages received at once
+}
+
+type consumedQueueUrlKey struct{}
+
+// ConsumedQueueUrl returns the url of the queue a message passed to a Handler with `ctx` was received from
+func ConsumedQueueUrl(ctx context.Context) string {
+	queueUrl, _ := ctx.Value(consumedQueueUrlKey{}).(string)
+	return queueUrl
+}
+
+// StartConsumer starts consuming the queue `queueUrl` in the background. Messages are received with ReceiveHeftyMessage
+// and long polling, and handled by `handler` concurrently. The visibility timeout of a message is extended for as long as
+// it is handled, and the message is deleted with DeleteHeftyMessage once it was handled successfully.
+//
+// The consumer stops receiving messages when `ctx` is cancelled. Messages that are being handled are handled to the end,
+// with a context that is not cancelled, and Wait returns once they are.
+func (wrapper *SqsClientWrapper) StartConsumer(ctx context.Context, queueUrl string, handler Handler, config ConsumerConfig) *Consumer {
+	return startConsumer(ctx, []*consumedQueue{{client: wrapper, queueUrl: queueUrl, handler: handler, batch: maxReceiveMessages}}, config)
+}
+
+// StartMultiConsumer starts consuming several queues with one consumer, like StartConsumer, for services that own a
+// family of queues. Every queue is long polled on its own and the queues share the concurrency of the consumer.
+// Queues with a higher weight receive larger batches, so that they get a larger share of the concurrency while all
+// queues have a backlog; a queue without backlog leaves its share to the others. Handlers find the queue of a message
+// with ConsumedQueueUrl.
+func (wrapper *SqsClientWrapper) StartMultiConsumer(ctx context.Context, queues []ConsumerQueue, handler Handler, config ConsumerConfig) (*Consumer, error) {
+	consumed, err := wrapper.consumedQueues(queues, handler)
+	if err != nil {
+		return nil, err
+	}
+
+	return startConsumer(ctx, consumed, config), nil
+}
+
+// consumedQueues returns the queues consumed by a multi-queue consumer
+func (wrapper *SqsClientWrapper) consumedQueues(queues []ConsumerQueue, handler Handler) ([]*consumedQueue, error) {
+	if len(queues) == 0 {
+		return nil, errors.New("unable to start consumer without queues")
+	}
+
+	maxWeight := 1
+	for _, queue := range queues {
+		maxWeight = max(maxWeight, queue.Weight)
+	}
+
+	consumed := make([]*consumedQueue, 0, len(queues))
+	for _, queue := range queues {
+		if queue.QueueUrl == "" {
+			return nil, errors.New("unable to start consumer for a queue without url")
+		}
+
+		q := &consumedQueue{client: wrapper, queueUrl: queue.QueueUrl, handler: handler, batch: maxReceiveMessages}
+		if queue.Client != nil {
+			q.client = queue.Client
+		}
+		if queue.Handler != nil {
+			q.handler = queue.Handler
+		}
+		if q.handler == nil {
+			return nil, fmt.Errorf("unable to start consumer for %s without handler", queue.QueueUrl)
+		}
+		// the batch size is proportional to the weight, rounded up to receive at least one message
+		weight := max(queue.Weight, 1)
+		q.batch = (maxReceiveMessages*weight + maxWeight - 1) / maxWeight
+
+		consumed = append(consumed, q)
+	}
+
+	return consumed, nil
+}
+
+func startConsumer(ctx context.Context, queues []*consumedQueue, config ConsumerConfig) *Consumer {
+	if config.Autoscaling != nil {
+		config.Autoscaling = config.Autoscaling.withDefaults()
+		if config.Concurrency <= 0 {
+			config.Concurrency = config.Autoscaling.MinConcurrency
+		}
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaultConsumerConcurrency
+	}
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = config.Concurrency
+	}
+	if config.VisibilityTimeout <= 0 {
+		config.VisibilityTimeout = defaultConsumerVisibilityTimeout
+	}
+	if config.AttributeNames == nil {
+		config.AttributeNames = []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameAll}
+	}
+	if config.MessageAttributeNames == nil {
+		config.MessageAttributeNames = []string{"All"}
+	}
+	if config.ReceiveBackoff <= 0 {
+		config.ReceiveBackoff = defaultConsumerReceiveBackoff
+	}
+
+	for _, queue := range queues {
+		queue.handler = Chain(queue.handler, config.Middleware...)
+	}
+
+	consumer := &Consumer{
+		queues:   queues,
+		config:   config,
+		inFlight: newLimiter(config.MaxInFlight),
+		workers:  newLimiter(config.Concurrency),
+		done:     make(chan struct{}),
+	}
+	go consumer.run(ctx)
+	if config.Autoscaling != nil {
+		go consumer.autoscale(ctx)
+	}
+
+	return consumer
+}
+
+// Concurrency returns the number of messages currently handled at the same time at most, which changes with Autoscaling
+func (consumer *Consumer) Concurrency() int {
+	consumer.workers.mu.Lock()
+	defer consumer.workers.mu.Unlock()
+	return consumer.workers.limit
+}
+
+// Wait waits until the consumer stopped and all received messages were handled
+func (consumer *Consumer) Wait() {
+	<-consumer.done
+}
+
+// run receives the messages of every queue until `ctx` is cancelled
+func (consumer *Consumer) run(ctx context.Context) {
+	defer close(consumer.done)
+	defer consumer.handlers.Wait()
+
+	var receivers sync.WaitGroup
+	for _, queue := range consumer.queues {
+		receivers.Add(1)
+		go func(queue *consumedQueue) {
+			defer receivers.Done()
+			consumer.receive(ctx, queue)
+		}(queue)
+	}
+	receivers.Wait()
+}
+
+// receive receives the messages of a queue until `ctx` is cancelled
+func (consumer *Consumer) receive(ctx context.Context, queue *consumedQueue) {
+	for {
+		free := consumer.inFlight.acquire(ctx, queue.batch)
+		if free == 0 {
+			return
+		}
+
+		out, err := queue.client.ReceiveHeftyMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(queue.queueUrl),
+			MaxNumberOfMessages:   int32(free),
+			WaitTimeSeconds:       maxWaitTimeSeconds,
+			VisibilityTimeout:     consumer.config.VisibilityTimeout,
+			AttributeNames:        consumer.config.AttributeNames,
+			MessageAttributeNames: consumer.config.MessageAttributeNames,
+		})
+
+		var msgs []sqstypes.Message
+		var unresolved []string
+		if out != nil {
+			msgs = out.Messages
+			unresolved = UnresolvedMessages(out.ResultMetadata)
+		}
+		consumer.inFlight.release(free - len(msgs))
+
+		for _, msg := range msgs {
+			consumer.handlers.Add(1)
+			go func(msg sqstypes.Message) {
+				defer consumer.handlers.Done()
+				defer consumer.inFlight.release(1)
+				consumer.handle(ctx, queue, msg, slices.Contains(unresolved, aws.ToString(msg.MessageId)))
+			}(msg)
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			consumer.onError(ctx, nil, fmt.Errorf("unable to receive messages from %s. %v", queue.queueUrl, err))
+			select {
+			case <-time.After(consumer.config.ReceiveBackoff):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// handle waits for a free handler and handles a message while extending its visibility timeout, and deletes it when it
+// was handled successfully. A message still waiting when `ctx` is cancelled is released to the queue instead, so that
+// shutting down does not wait for messages that were not started and other consumers receive them right away. The hefty
+// message of an `unresolved` message, see WithReceiveMemoryBudget, is resolved only once a handler is free.
+func (consumer *Consumer) handle(ctx context.Context, queue *consumedQueue, msg sqstypes.Message, unresolved bool) {
+	stopping := ctx
+	ctx = context.WithValue(context.WithoutCancel(ctx), consumedQueueUrlKey{}, queue.queueUrl)
+
+	heartbeatCtx, stop := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		heartbeat(heartbeatCtx, queue.client, queue.queueUrl, aws.ToString(msg.ReceiptHandle), consumer.config.VisibilityTimeout, func(err error) {
+			consumer.onError(ctx, &msg, fmt.Errorf("unable to extend visibility timeout of message %s. %v", aws.ToString(msg.MessageId), err))
+		})
+	}()
+
+	if consumer.workers.acquire(stopping, 1) == 0 {
+		stop()
+		<-stopped
+		consumer.releaseMessage(ctx, queue, &msg)
+		return
+	}
+
+	var err error
+	if unresolved {
+		if err = queue.client.ResolveHeftyMessage(ctx, queue.queueUrl, &msg); err != nil {
+			err = fmt.Errorf("unable to resolve message %s. %v", aws.ToString(msg.MessageId), err)
+		}
+	}
+	if err == nil {
+		err = consumer.callHandler(ctx, queue.handler, msg)
+	}
+	consumer.workers.release(1)
+	stop()
+	<-stopped
+
+	if err != nil {
+		consumer.onError(ctx, &msg, err)
+		return
+	}
+
+	_, err = queue.client.DeleteHeftyMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(queue.queueUrl), ReceiptHandle: msg.ReceiptHandle})
+	if err != nil {
+		consumer.onError(ctx, &msg, fmt.Errorf("unable to delete message %s. %v", aws.ToString(msg.MessageId), err))
+	}
+}
+
+// releaseMessage makes a message that was not handled visible again
+func (consumer *Consumer) releaseMessage(ctx context.Context, queue *consumedQueue, msg *sqstypes.Message) {
+	_, err := queue.client.ChangeHeftyMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(queue.queueUrl),
+		ReceiptHandle:     msg.ReceiptHandle,
+		VisibilityTimeout: 0,
+	})
+	if err != nil {
+		consumer.onError(ctx, msg, fmt.Errorf("unable to release message %s. %v", aws.ToString(msg.MessageId), err))
+	}
+}
+
+// callHandler calls the handler, turning a panic into an error so that a single message cannot stop the consumer
+func (consumer *Consumer) callHandler(ctx context.Context, handler Handler, msg sqstypes.Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked. %v", r)
+		}
+	}()
+
+	return handler(ctx, msg)
+}
+
+func (consumer *Consumer) onError(ctx context.Context, msg *sqstypes.Message, err error) {
+	if consumer.config.OnError != nil {
+		consumer.config.OnError(ctx, msg, err)
+	}
+}
+
+// limiter limits the number of messages received or handled at the same time to a limit that can be changed
+type limiter struct {
+	mu      sync.Mutex
+	limit   int
+	used    int
+	changed chan struct{} // closed when the limit or the used count changed
+}
+
+func newLimiter(limit int) *limiter {
+	return &limiter{limit: limit, changed: make(chan struct{})}
+}
+
+// acquire waits until the limit is not reached and acquires up to `count`. It returns the acquired count, or 0 when `ctx`
+// was cancelled.
+func (l *limiter) acquire(ctx context.Context, count int) int {
+	for {
+		if ctx.Err() != nil {
+			return 0
+		}
+
+		l.mu.Lock()
+		if free := l.limit - l.used; free > 0 {
+			acquired := min(free, count)
+			l.used += acquired
+			l.mu.Unlock()
+			return acquired
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return 0
+		}
+	}
+}
+
+// release releases `count` acquired by acquire
+func (l *limiter) release(count int) {
+	if count == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.used -= count
+	l.notify()
+}
+
+// setLimit changes the limit. Counts already acquired beyond a lowered limit are kept until they are released.
+func (l *limiter) setLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.notify()
+}
+
+// notify wakes up waiting acquires; the caller holds the lock
+func (l *limiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
@@ -0,0 +1,320 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeConsumerClient serves a fixed number of messages and records deletes and visibility extensions
+type fakeConsumerClient struct {
+	mu         sync.Mutex
+	pending    int
+	received   int
+	maxBatch   int32
+	deleted    []string
+	extended   []string
+	receiveErr error
+	backlog    string
+	unresolved bool // received messages are unresolved and have the body "reference"
+	resolved   []string
+}
+
+func (client *fakeConsumerClient) ReceiveHeftyMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	client.mu.Lock()
+	if client.receiveErr != nil {
+		err := client.receiveErr
+		client.receiveErr = nil
+		client.mu.Unlock()
+		return nil, err
+	}
+	client.maxBatch = max(client.maxBatch, params.MaxNumberOfMessages)
+
+	out := &sqs.ReceiveMessageOutput{}
+	for ; client.pending > 0 && len(out.Messages) < int(params.MaxNumberOfMessages); client.pending-- {
+		client.received++
+		id := fmt.Sprintf("msg-%d", client.received)
+		out.Messages = append(out.Messages, sqstypes.Message{MessageId: aws.String(id), ReceiptHandle: aws.String(id), Body: aws.String(id)})
+		if client.unresolved {
+			out.Messages[len(out.Messages)-1].Body = aws.String("reference")
+			recordUnresolved(&out.ResultMetadata, aws.String(id))
+		}
+	}
+	client.mu.Unlock()
+
+	if len(out.Messages) == 0 {
+		// long polling an empty queue
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	return out, nil
+}
+
+func (client *fakeConsumerClient) DeleteHeftyMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.deleted = append(client.deleted, aws.ToString(params.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (client *fakeConsumerClient) ChangeHeftyMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.extended = append(client.extended, aws.ToString(params.ReceiptHandle))
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (client *fakeConsumerClient) GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return &sqs.GetQueueAttributesOutput{Attributes: map[string]string{"ApproximateNumberOfMessages": client.backlog}}, nil
+}
+
+func (client *fakeConsumerClient) ResolveHeftyMessage(ctx context.Context, queueUrl string, msg *sqstypes.Message) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.resolved = append(client.resolved, aws.ToString(msg.MessageId))
+	msg.Body = msg.MessageId
+	return nil
+}
+
+// consumedQueues returns the queue consumed by a single queue consumer
+func consumedQueues(client consumerClient, queueUrl string, handler Handler) []*consumedQueue {
+	return []*consumedQueue{{client: client, queueUrl: queueUrl, handler: handler, batch: maxReceiveMessages}}
+}
+
+func TestConsumer(t *testing.T) {
+	client := &fakeConsumerClient{pending: 25, receiveErr: errors.New("throttled")}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var mu sync.Mutex
+	var handled, failed, receiveErrs int
+	var active, maxActive int
+	handler := func(ctx context.Context, msg sqstypes.Message) error {
+		mu.Lock()
+		handled++
+		active++
+		maxActive = max(maxActive, active)
+		done := handled == 25
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+		if done {
+			cancel()
+		}
+		if aws.ToString(msg.MessageId) == "msg-3" {
+			return errors.New("failed")
+		}
+		if aws.ToString(msg.MessageId) == "msg-4" {
+			panic("panicked")
+		}
+		return nil
+	}
+	onError := func(ctx context.Context, msg *sqstypes.Message, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if msg == nil {
+			receiveErrs++
+		} else {
+			failed++
+		}
+	}
+
+	consumer := startConsumer(ctx, consumedQueues(client, "https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue", handler), ConsumerConfig{
+		Concurrency:    4,
+		ReceiveBackoff: time.Millisecond,
+		OnError:        onError,
+	})
+	consumer.Wait()
+
+	assert.Equal(t, 25, handled)
+	assert.Equal(t, 2, failed)
+	assert.Equal(t, 1, receiveErrs)
+	assert.LessOrEqual(t, maxActive, 4)
+	assert.LessOrEqual(t, client.maxBatch, int32(4))
+	assert.Len(t, client.deleted, 23)
+	assert.NotContains(t, client.deleted, "msg-3")
+	assert.NotContains(t, client.deleted, "msg-4")
+}
+
+func TestConsumerUnresolvedMessages(t *testing.T) {
+	client := &fakeConsumerClient{pending: 5, unresolved: true}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var mu sync.Mutex
+	var bodies []string
+	handler := func(ctx context.Context, msg sqstypes.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, aws.ToString(msg.Body))
+		if len(bodies) == 5 {
+			cancel()
+		}
+		return nil
+	}
+
+	consumer := startConsumer(ctx, consumedQueues(client, "https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue", handler), ConsumerConfig{Concurrency: 2})
+	consumer.Wait()
+
+	assert.Len(t, client.resolved, 5)
+	assert.NotContains(t, bodies, "reference")
+	assert.Len(t, client.deleted, 5)
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	middleware := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, msg sqstypes.Message) error {
+				calls = append(calls, name)
+				return next(ctx, msg)
+			}
+		}
+	}
+	handler := func(ctx context.Context, msg sqstypes.Message) error {
+		calls = append(calls, "handler")
+		return nil
+	}
+
+	err := Chain(handler, middleware("outer"), middleware("inner"))(context.Background(), sqstypes.Message{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outer", "inner", "handler"}, calls)
+}
+
+func TestConsumerMaxInFlight(t *testing.T) {
+	client := &fakeConsumerClient{pending: 6}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	started := make(chan struct{}, 6)
+	unblock := make(chan struct{})
+	handler := func(ctx context.Context, msg sqstypes.Message) error {
+		started <- struct{}{}
+		<-unblock
+		return nil
+	}
+
+	consumer := startConsumer(ctx, consumedQueues(client, "queue", handler), ConsumerConfig{Concurrency: 2, MaxInFlight: 5})
+
+	// two messages are handled and three wait for a free handler
+	<-started
+	<-started
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.received == 5
+	}, time.Second, time.Millisecond)
+
+	// shutting down releases the waiting messages and handles the started ones to the end
+	cancel()
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return len(client.extended) == 3
+	}, time.Second, time.Millisecond)
+	close(unblock)
+	consumer.Wait()
+
+	assert.Len(t, started, 0)
+	assert.Len(t, client.deleted, 2)
+	assert.Equal(t, 1, client.pending)
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	var active, maxActive int
+	handler := func(ctx context.Context, msg sqstypes.Message) error {
+		mu.Lock()
+		active++
+		maxActive = max(maxActive, active)
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return nil
+	}
+
+	// the limit is shared by both handlers
+	limit := LimitConcurrency(2)
+	handlers := []Handler{Chain(handler, limit), Chain(handler, limit)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(handler Handler) {
+			defer wg.Done()
+			assert.NoError(t, handler(context.Background(), sqstypes.Message{}))
+		}(handlers[i%2])
+	}
+	wg.Wait()
+
+	assert.Equal(t, 2, maxActive)
+}
+
+func TestMultiConsumer(t *testing.T) {
+	orders := &fakeConsumerClient{pending: 7}
+	refunds := &fakeConsumerClient{pending: 3}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var mu sync.Mutex
+	handled := map[string]int{}
+	handler := func(ctx context.Context, msg sqstypes.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled[ConsumedQueueUrl(ctx)]++
+		if handled["orders"]+handled["refunds"] == 10 {
+			cancel()
+		}
+		return nil
+	}
+
+	consumer := startConsumer(ctx, []*consumedQueue{
+		{client: orders, queueUrl: "orders", handler: handler, batch: 10},
+		{client: refunds, queueUrl: "refunds", handler: handler, batch: 5},
+	}, ConsumerConfig{Concurrency: 4})
+	consumer.Wait()
+
+	assert.Equal(t, map[string]int{"orders": 7, "refunds": 3}, handled)
+	assert.Len(t, orders.deleted, 7)
+	assert.Len(t, refunds.deleted, 3)
+	assert.LessOrEqual(t, refunds.maxBatch, int32(5))
+}
+
+func TestConsumedQueues(t *testing.T) {
+	wrapper := &SqsClientWrapper{}
+	other := &SqsClientWrapper{}
+	handler := func(ctx context.Context, msg sqstypes.Message) error { return nil }
+
+	queues, err := wrapper.consumedQueues([]ConsumerQueue{
+		{QueueUrl: "orders", Weight: 4},
+		{QueueUrl: "refunds", Weight: 1, Client: other},
+		{QueueUrl: "audit"},
+	}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{10, 3, 3}, []int{queues[0].batch, queues[1].batch, queues[2].batch})
+	assert.Same(t, wrapper, queues[0].client)
+	assert.Same(t, other, queues[1].client)
+
+	_, err = wrapper.consumedQueues(nil, handler)
+	assert.Error(t, err)
+	_, err = wrapper.consumedQueues([]ConsumerQueue{{QueueUrl: "orders"}}, nil)
+	assert.Error(t, err)
+}
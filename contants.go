@@ -1,6 +1,36 @@
 package hefty
 
 const (
-	MaxAwsMessageLengthBytes   = 262_144    // 256KB; used for both SQS and SNS
+	MaxAwsMessageLengthBytes   = 262_144    // 256KB; default used for both SQS and SNS, see the limits package for current limits
 	MaxHeftyMessageLengthBytes = 33_554_432 // 32MB
 )
+
+// S3 user metadata keys written on every hefty message uploaded to AWS S3
+const (
+	MetadataKeySource         = "hefty-source"          // queue url or topic arn the message was sent to
+	MetadataKeyFormatVersion  = "hefty-format-version"  // version of the serialized hefty message format
+	MetadataKeyBodySize       = "hefty-body-size"       // size in bytes of the original message body
+	MetadataKeyAttributeCount = "hefty-attribute-count" // number of message attributes in the original message
+)
+
+// KeySentTimestamp is both an S3 user metadata key and an S3 object tag key of hefty messages in AWS S3, holding a time
+// in RFC 3339 format. Tags and user metadata are separate in AWS S3, so they do not overwrite each other: the metadata
+// records when the hefty message was uploaded, and the tag when its reference message was sent.
+const KeySentTimestamp = "hefty-sent-timestamp"
+
+// S3 object tag keys written on hefty messages in AWS S3 after the reference message has been sent, along with
+// KeySentTimestamp
+const (
+	TagKeyMessageId = "hefty-message-id" // message id returned by AWS SQS or AWS SNS
+)
+
+// S3 object tag keys written on hefty messages when they are uploaded to AWS S3
+const (
+	TagKeyExpirationDays = "hefty-expiration-days" // days after upload the hefty message expires; see TaggedExpiration
+)
+
+// Encryption context keys bound to hefty messages encrypted with client side encryption
+const (
+	EncryptionContextKeyChannel    = "hefty-channel"             // queue url or topic arn the message was sent to
+	EncryptionContextKeyBodyDigest = "hefty-md5-digest-msg-body" // md5 digest of the message body
+)
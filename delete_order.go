@@ -0,0 +1,46 @@
+package hefty
+
+import (
+	"errors"
+	"fmt"
+
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// DeleteOrder is the order in which DeleteHeftyMessage deletes the hefty message and the reference message
+type DeleteOrder int
+
+const (
+	// DeletePayloadFirst deletes the hefty message before the reference message. A failed payload delete is reported but
+	// the reference message is still deleted. This is the default.
+	DeletePayloadFirst DeleteOrder = iota
+	// DeleteMessageFirst deletes the reference message before the hefty message. The hefty message is kept when the
+	// reference message could not be deleted, so that it can still be received when the message is redelivered.
+	DeleteMessageFirst
+)
+
+// PayloadDeleteError is returned by DeleteHeftyMessage together with the output of the reference message delete when the
+// reference message was deleted but its hefty message could not be. The hefty message is left behind in AWS S3 or the
+// payload store and should be cleaned up by a lifecycle rule.
+type PayloadDeleteError struct {
+	Bucket    string
+	Key       string
+	Backend   string
+	VersionId string
+	Err       error
+}
+
+func (err *PayloadDeleteError) Error() string {
+	return fmt.Sprintf("reference message was deleted but hefty message %s/%s was not. %v", err.Bucket, err.Key, err.Err)
+}
+
+func (err *PayloadDeleteError) Unwrap() error {
+	return err.Err
+}
+
+// isNoSuchKey checks whether an AWS S3 error was caused by a hefty message that no longer exists
+func isNoSuchKey(err error) bool {
+	var noSuchKey *s3types.NoSuchKey
+	var notFound *s3types.NotFound
+	return errors.As(err, &noSuchKey) || errors.As(err, &notFound) || isApiErrorCode(err, "NoSuchKey") || isApiErrorCode(err, "NoSuchVersion")
+}
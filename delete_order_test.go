@@ -0,0 +1,48 @@
+package hefty
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsNoSuchKey(t *testing.T) {
+	var tests = []struct {
+		desc         string
+		err          error
+		expNoSuchKey bool
+	}{
+		{desc: "not_api_error", err: errors.New("connection reset")},
+		{desc: "access_denied", err: &smithy.GenericAPIError{Code: "AccessDenied"}},
+		{desc: "no_such_key", err: fmt.Errorf("operation error. %w", &s3types.NoSuchKey{}), expNoSuchKey: true},
+		{desc: "not_found", err: &s3types.NotFound{}, expNoSuchKey: true},
+		{desc: "no_such_version", err: &smithy.GenericAPIError{Code: "NoSuchVersion"}, expNoSuchKey: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			assert.Equal(t, tt.expNoSuchKey, isNoSuchKey(tt.err))
+		})
+	}
+}
+
+func TestPayloadDeleteError(t *testing.T) {
+	cause := &smithy.GenericAPIError{Code: "SlowDown"}
+	err := errors.Join(errors.New("receipt handle is invalid"), &PayloadDeleteError{Bucket: "bucket", Key: "key", Err: cause})
+
+	var payloadErr *PayloadDeleteError
+	assert.True(t, errors.As(err, &payloadErr))
+	assert.Equal(t, "key", payloadErr.Key)
+	assert.True(t, isApiErrorCode(err, "SlowDown"))
+}
+
+func TestWithDeleteOrder(t *testing.T) {
+	opts := defaultOptions()
+	assert.Nil(t, WithDeleteOrder(DeleteMessageFirst)(&opts))
+	assert.Equal(t, DeleteMessageFirst, opts.deleteOrder)
+	assert.NotNil(t, WithDeleteOrder(DeleteOrder(5))(&opts))
+}
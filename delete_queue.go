@@ -0,0 +1,274 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// maxDeleteObjects is the maximum number of objects a single AWS S3 DeleteObjects request can delete
+const maxDeleteObjects = 1000
+
+// QueuePayloads is what DeleteHeftyQueue and PurgeHeftyQueue do with the hefty messages stored for the queue
+type QueuePayloads int
+
+const (
+	// KeepQueuePayloads keeps the hefty messages of the queue. This is the same as calling DeleteQueue or PurgeQueue.
+	KeepQueuePayloads QueuePayloads = iota
+	// DeleteQueuePayloads deletes the objects under the key prefixes of the hefty messages of the queue.
+	DeleteQueuePayloads
+	// DryRunQueuePayloads only lists the objects under the key prefixes of the hefty messages of the queue. Neither the
+	// queue nor any objects are changed.
+	DryRunQueuePayloads
+)
+
+// PayloadObject is an object stored under the key prefix of the hefty messages of a queue
+type PayloadObject struct {
+	Bucket       string
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// DeleteHeftyQueueOutput is the output of DeleteHeftyQueue
+type DeleteHeftyQueueOutput struct {
+	// DeleteQueueOutput is the output of the queue delete, or nil when the queue was not deleted.
+	DeleteQueueOutput *sqs.DeleteQueueOutput
+	// Objects are the objects that were deleted, or that would be deleted in a dry run.
+	Objects []PayloadObject
+}
+
+// payloadPrefixClient is the part of the AWS S3 client used to list and delete the hefty messages of a queue
+type payloadPrefixClient interface {
+	s3.ListObjectsV2APIClient
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+// DeleteHeftyQueue deletes an AWS SQS queue and, depending on `payloads`, the hefty messages stored for it in AWS S3, e.g.
+// when tearing down an ephemeral environment. The queue is deleted first so that no hefty messages are stored for it
+// while its key prefixes are cleaned up. The hefty messages are found by their key prefix, which is the key prefix of
+// the wrapper, the prefix selected for the queue by WithBucketSelector and every shard of WithShards, followed by the
+// queue name. Every object under these prefixes is deleted, including objects not stored by this library.
+//
+// The key template must start with a segment holding the queue name, and tenants cannot be used, since hefty messages
+// are not stored under a prefix of the queue otherwise. Hefty messages kept in a payload store are not deleted. In
+// buckets with versioning enabled, the deleted objects are replaced by delete markers.
+func (wrapper *SqsClientWrapper) DeleteHeftyQueue(ctx context.Context, params *sqs.DeleteQueueInput, payloads QueuePayloads, optFns ...func(*sqs.Options)) (*DeleteHeftyQueueOutput, error) {
+	optFns = wrapper.withOptFns(optFns)
+
+	if payloads == KeepQueuePayloads {
+		out, err := wrapper.sqsClient().DeleteQueue(ctx, params, optFns...)
+		if err != nil {
+			return nil, err
+		}
+
+		return &DeleteHeftyQueueOutput{DeleteQueueOutput: out}, nil
+	}
+
+	if params == nil {
+		return nil, errors.New("params is nil")
+	}
+
+	objects, err := wrapper.listQueuePayloads(ctx, aws.ToString(params.QueueUrl))
+	if err != nil {
+		return nil, err
+	}
+
+	output := &DeleteHeftyQueueOutput{Objects: objects}
+	if payloads == DryRunQueuePayloads {
+		return output, nil
+	}
+
+	output.DeleteQueueOutput, err = wrapper.sqsClient().DeleteQueue(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	// hefty messages sent while the queue was being deleted are listed again
+	output.Objects, err = wrapper.listQueuePayloads(ctx, aws.ToString(params.QueueUrl))
+	if err != nil {
+		return output, err
+	}
+
+	return output, wrapper.storage.deleteObjects(ctx, wrapper.storage.s3Client, output.Objects)
+}
+
+// PurgeHeftyQueueOutput is the output of PurgeHeftyQueue
+type PurgeHeftyQueueOutput struct {
+	// PurgeQueueOutput is the output of the queue purge, or nil when the queue was not purged.
+	PurgeQueueOutput *sqs.PurgeQueueOutput
+	// Objects are the objects that were deleted, or that would be deleted in a dry run.
+	Objects []PayloadObject
+}
+
+// PurgeHeftyQueue purges an AWS SQS queue and, depending on `payloads`, the hefty messages stored for it in AWS S3. The
+// hefty messages are listed before the queue is purged, and only the listed hefty messages are deleted, so that hefty
+// messages of messages sent after the purge are kept. Hefty messages are found by their key prefix as with
+// DeleteHeftyQueue, with the same restrictions.
+func (wrapper *SqsClientWrapper) PurgeHeftyQueue(ctx context.Context, params *sqs.PurgeQueueInput, payloads QueuePayloads, optFns ...func(*sqs.Options)) (*PurgeHeftyQueueOutput, error) {
+	optFns = wrapper.withOptFns(optFns)
+
+	if payloads == KeepQueuePayloads {
+		out, err := wrapper.sqsClient().PurgeQueue(ctx, params, optFns...)
+		if err != nil {
+			return nil, err
+		}
+
+		return &PurgeHeftyQueueOutput{PurgeQueueOutput: out}, nil
+	}
+
+	if params == nil {
+		return nil, errors.New("params is nil")
+	}
+
+	objects, err := wrapper.listQueuePayloads(ctx, aws.ToString(params.QueueUrl))
+	if err != nil {
+		return nil, err
+	}
+
+	output := &PurgeHeftyQueueOutput{Objects: objects}
+	if payloads == DryRunQueuePayloads {
+		return output, nil
+	}
+
+	output.PurgeQueueOutput, err = wrapper.sqsClient().PurgeQueue(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	return output, wrapper.storage.deleteObjects(ctx, wrapper.storage.s3Client, output.Objects)
+}
+
+// listQueuePayloads lists the objects under the key prefixes of the hefty messages of the queue `queueUrl`
+func (wrapper *SqsClientWrapper) listQueuePayloads(ctx context.Context, queueUrl string) ([]PayloadObject, error) {
+	if wrapper.tenants != nil {
+		return nil, errors.New("hefty messages of tenants are not stored under a prefix of the queue")
+	}
+
+	locations, err := wrapper.storage.queuePrefixes(queueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapper.storage.listPrefixes(ctx, wrapper.storage.s3Client, locations)
+}
+
+// queuePrefixes returns the buckets and key prefixes the hefty messages sent to the queue `queueUrl` are stored under
+func (storage *payloadStorage) queuePrefixes(queueUrl string) ([]Shard, error) {
+	const expectedTokenCount = 5
+
+	tokens := strings.Split(queueUrl, "/")
+	if len(tokens) != expectedTokenCount {
+		return nil, fmt.Errorf("expected %d tokens when splitting queueUrl by '/' but received %d", expectedTokenCount, len(tokens))
+	}
+
+	prefix, err := storage.keys.namePrefix(tokens[4])
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.prefixLocations(queueUrl, prefix), nil
+}
+
+// prefixLocations returns the buckets and key prefixes the hefty messages with the key prefix `prefix` sent to the queue
+// url or topic arn `target` are stored under, after the bucket selector and the shards were applied. The bucket selector
+// is not applied when `target` is empty.
+func (storage *payloadStorage) prefixLocations(target, prefix string) []Shard {
+	base := Shard{Bucket: storage.bucket, Prefix: prefix}
+	if storage.bucketSelector != nil && target != "" {
+		bucket, selected := storage.bucketSelector(target)
+		if bucket != "" {
+			base.Bucket = bucket
+		}
+		base.Prefix = selected + base.Prefix
+	}
+
+	if len(storage.shards) == 0 {
+		return []Shard{base}
+	}
+
+	seen := map[Shard]bool{}
+	locations := make([]Shard, 0, len(storage.shards))
+	for _, shard := range storage.shards {
+		location := Shard{Bucket: base.Bucket, Prefix: shard.Prefix + base.Prefix}
+		if shard.Bucket != "" {
+			location.Bucket = shard.Bucket
+		}
+		if !seen[location] {
+			seen[location] = true
+			locations = append(locations, location)
+		}
+	}
+
+	return locations
+}
+
+// listPrefixes lists the objects under the key prefixes of `locations`
+func (storage *payloadStorage) listPrefixes(ctx context.Context, client s3.ListObjectsV2APIClient, locations []Shard) ([]PayloadObject, error) {
+	var objects []PayloadObject
+	for _, location := range locations {
+		paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+			Bucket:              aws.String(location.Bucket),
+			Prefix:              aws.String(location.Prefix),
+			ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx, storage.s3OptFns...)
+			if err != nil {
+				return nil, fmt.Errorf("unable to list hefty messages in %s/%s. %v", location.Bucket, location.Prefix, err)
+			}
+
+			for _, object := range page.Contents {
+				objects = append(objects, PayloadObject{
+					Bucket:       location.Bucket,
+					Key:          aws.ToString(object.Key),
+					Size:         aws.ToInt64(object.Size),
+					LastModified: aws.ToTime(object.LastModified),
+				})
+			}
+		}
+	}
+
+	return objects, nil
+}
+
+// deleteObjects deletes `objects` in batches of up to 1000 objects per bucket
+func (storage *payloadStorage) deleteObjects(ctx context.Context, client payloadPrefixClient, objects []PayloadObject) error {
+	var errs []error
+	for start := 0; start < len(objects); {
+		// a batch holds consecutive objects of the same bucket
+		bucket := objects[start].Bucket
+		end := start
+		for end < len(objects) && end-start < maxDeleteObjects && objects[end].Bucket == bucket {
+			end++
+		}
+
+		identifiers := make([]s3types.ObjectIdentifier, 0, end-start)
+		for _, object := range objects[start:end] {
+			identifiers = append(identifiers, s3types.ObjectIdentifier{Key: aws.String(object.Key)})
+		}
+		start = end
+
+		out, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket:              aws.String(bucket),
+			Delete:              &s3types.Delete{Objects: identifiers, Quiet: aws.Bool(true)},
+			ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+		}, storage.s3OptFns...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to delete hefty messages in %s. %v", bucket, err))
+			continue
+		}
+		for _, deleteErr := range out.Errors {
+			errs = append(errs, fmt.Errorf("unable to delete hefty message %s/%s. %s", bucket, aws.ToString(deleteErr.Key), aws.ToString(deleteErr.Message)))
+		}
+	}
+
+	return errors.Join(errs...)
+}
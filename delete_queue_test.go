@@ -0,0 +1,122 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePayloadPrefixClient holds objects by bucket and key and lists them two at a time
+type fakePayloadPrefixClient struct {
+	objects       map[string]map[string]bool
+	deleteBatches int
+}
+
+func (c *fakePayloadPrefixClient) ListObjectsV2(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	var keys []string
+	for key := range c.objects[aws.ToString(params.Bucket)] {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) && key > aws.ToString(params.ContinuationToken) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	out := &s3.ListObjectsV2Output{}
+	for i, key := range keys {
+		if i == 2 {
+			out.IsTruncated = aws.Bool(true)
+			out.NextContinuationToken = aws.String(keys[1])
+			break
+		}
+		out.Contents = append(out.Contents, s3types.Object{Key: aws.String(key), Size: aws.Int64(1)})
+	}
+
+	return out, nil
+}
+
+func (c *fakePayloadPrefixClient) DeleteObjects(_ context.Context, params *s3.DeleteObjectsInput, _ ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	c.deleteBatches++
+	out := &s3.DeleteObjectsOutput{}
+	for _, object := range params.Delete.Objects {
+		if strings.HasSuffix(aws.ToString(object.Key), "locked") {
+			out.Errors = append(out.Errors, s3types.Error{Key: object.Key, Message: aws.String("access denied")})
+			continue
+		}
+		delete(c.objects[aws.ToString(params.Bucket)], aws.ToString(object.Key))
+	}
+
+	return out, nil
+}
+
+func TestPayloadStorageQueuePrefixes(t *testing.T) {
+	const queueUrl = "https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue"
+
+	var tests = []struct {
+		desc     string
+		storage  payloadStorage
+		queueUrl string
+		expected []Shard
+		expErr   bool
+	}{
+		{desc: "default", storage: payloadStorage{bucket: "bucket"}, queueUrl: queueUrl, expected: []Shard{{Bucket: "bucket", Prefix: "MyQueue/"}}},
+		{desc: "key_prefix", storage: payloadStorage{bucket: "bucket", keys: keyGenerator{prefix: "hefty/"}}, queueUrl: queueUrl, expected: []Shard{{Bucket: "bucket", Prefix: "hefty/MyQueue/"}}},
+		{
+			desc: "bucket_selector",
+			storage: payloadStorage{bucket: "bucket", bucketSelector: func(string) (string, string) {
+				return "selected", "env/"
+			}},
+			queueUrl: queueUrl,
+			expected: []Shard{{Bucket: "selected", Prefix: "env/MyQueue/"}},
+		},
+		{
+			desc:     "shards",
+			storage:  payloadStorage{bucket: "bucket", shards: []Shard{{Prefix: "a/"}, {Bucket: "other", Prefix: "b/"}, {Prefix: "a/"}}},
+			queueUrl: queueUrl,
+			expected: []Shard{{Bucket: "bucket", Prefix: "a/MyQueue/"}, {Bucket: "other", Prefix: "b/MyQueue/"}},
+		},
+		{desc: "invalid_queue_url", storage: payloadStorage{bucket: "bucket"}, queueUrl: "MyQueue", expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			locations, err := tt.storage.queuePrefixes(tt.queueUrl)
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, locations)
+		})
+	}
+}
+
+func TestPayloadStorageListAndDeletePrefixes(t *testing.T) {
+	client := &fakePayloadPrefixClient{objects: map[string]map[string]bool{
+		"bucket": {"MyQueue/1": true, "MyQueue/2": true, "MyQueue/3": true, "MyQueueB/1": true, "Other/1": true},
+		"other":  {"MyQueue/1": true, "MyQueue/locked": true},
+	}}
+	storage := &payloadStorage{}
+	locations := []Shard{{Bucket: "bucket", Prefix: "MyQueue/"}, {Bucket: "other", Prefix: "MyQueue/"}}
+
+	objects, err := storage.listPrefixes(context.TODO(), client, locations)
+	assert.Nil(t, err)
+	var listed []string
+	for _, object := range objects {
+		listed = append(listed, fmt.Sprintf("%s/%s", object.Bucket, object.Key))
+	}
+	assert.Equal(t, []string{"bucket/MyQueue/1", "bucket/MyQueue/2", "bucket/MyQueue/3", "other/MyQueue/1", "other/MyQueue/locked"}, listed)
+
+	err = storage.deleteObjects(context.TODO(), client, objects)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "other/MyQueue/locked")
+	assert.Equal(t, 2, client.deleteBatches)
+	assert.Equal(t, map[string]bool{"MyQueueB/1": true, "Other/1": true}, client.objects["bucket"])
+	assert.Equal(t, map[string]bool{"MyQueue/locked": true}, client.objects["other"])
+}
@@ -0,0 +1,99 @@
+package hefty
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// DigestAlgorithm is the algorithm of the digests of hefty messages recorded in reference messages
+type DigestAlgorithm string
+
+const (
+	// DigestMd5 is the default and can be verified by receivers of any version
+	DigestMd5 DigestAlgorithm = messages.DigestMd5
+	// DigestSha256 can be used in FIPS only builds where md5 is not available
+	DigestSha256 DigestAlgorithm = messages.DigestSha256
+)
+
+// messageDigests returns the digests of the message body and message attributes of a serialized hefty message using
+// `algorithm`. The digest of the message attributes is empty when there are no attributes.
+func messageDigests(algorithm string, serialized []byte, heftyMsg *messages.HeftyMessage) (bodyDigest, attrDigest string, err error) {
+	bodyOffset, msgAttrOffset := heftyMsg.Offsets()
+	bodyDigest, err = messages.Digest(algorithm, serialized[bodyOffset:msgAttrOffset])
+	if err != nil {
+		return "", "", fmt.Errorf("unable to create digest of message body. %v", err)
+	}
+
+	if len(heftyMsg.MessageAttributes) > 0 {
+		attrDigest, err = messages.Digest(algorithm, serialized[msgAttrOffset:])
+		if err != nil {
+			return "", "", fmt.Errorf("unable to create digest of message attributes. %v", err)
+		}
+	}
+
+	return bodyDigest, attrDigest, nil
+}
+
+// sqsMd5Digests returns the md5 digests of a message body and message attributes for use in AWS SQS outputs, calculated
+// the way AWS SQS calculates them. A digest is nil when there are no message attributes or md5 is not available.
+func sqsMd5Digests(body *string, msgAttributes map[string]messages.MessageAttributeValue) (md5Body, md5Attr *string) {
+	if digest, err := messages.Md5OfMessageBody(aws.ToString(body)); err == nil {
+		md5Body = aws.String(digest)
+	}
+	if digest, err := messages.Md5OfMessageAttributes(msgAttributes); err == nil && digest != "" {
+		md5Attr = aws.String(digest)
+	}
+
+	return md5Body, md5Attr
+}
+
+// IntegrityError is returned when the digests of a hefty message do not match the digests recorded in its reference
+// message, e.g. because the hefty message was modified or corrupted after it was stored
+type IntegrityError struct {
+	Bucket             string
+	Key                string
+	Backend            string
+	DigestAlgorithm    DigestAlgorithm
+	ExpectedBodyDigest string
+	BodyDigest         string
+	ExpectedAttrDigest string
+	AttrDigest         string
+}
+
+func (err *IntegrityError) Error() string {
+	return fmt.Sprintf("digests of hefty message %s/%s do not match the reference message; expected body digest '%s' and attribute digest '%s' but got '%s' and '%s'",
+		err.Bucket, err.Key, err.ExpectedBodyDigest, err.ExpectedAttrDigest, err.BodyDigest, err.AttrDigest)
+}
+
+// newIntegrityError creates the integrity error of a serialized hefty message that does not match its reference message
+func newIntegrityError(refMsg *types.ReferenceMsg, serialized []byte, heftyMsg *messages.HeftyMessage) error {
+	bodyDigest, attrDigest, err := messageDigests(refMsg.DigestAlgorithm, serialized, heftyMsg)
+	if err != nil {
+		return err
+	}
+
+	return digestMismatch(refMsg, bodyDigest, attrDigest)
+}
+
+// digestMismatch creates the integrity error of a hefty message whose digests `bodyDigest` and `attrDigest` do not match
+// its reference message
+func digestMismatch(refMsg *types.ReferenceMsg, bodyDigest, attrDigest string) *IntegrityError {
+	algorithm := DigestAlgorithm(refMsg.DigestAlgorithm)
+	if algorithm == "" {
+		algorithm = DigestMd5
+	}
+
+	return &IntegrityError{
+		Bucket:             refMsg.S3Bucket,
+		Key:                refMsg.S3Key,
+		Backend:            refMsg.Backend,
+		DigestAlgorithm:    algorithm,
+		ExpectedBodyDigest: refMsg.Md5DigestMsgBody,
+		BodyDigest:         bodyDigest,
+		ExpectedAttrDigest: refMsg.Md5DigestMsgAttr,
+		AttrDigest:         attrDigest,
+	}
+}
@@ -0,0 +1,21 @@
+package hefty
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSqsMd5Digests(t *testing.T) {
+	md5Body, md5Attr := sqsMd5Digests(aws.String("hello"), nil)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", aws.ToString(md5Body))
+	assert.Nil(t, md5Attr)
+
+	md5Body, md5Attr = sqsMd5Digests(aws.String("hello"), map[string]messages.MessageAttributeValue{
+		"Test01": {DataType: aws.String("String"), StringValue: aws.String("01234")},
+	})
+	assert.NotNil(t, md5Body)
+	assert.Len(t, aws.ToString(md5Attr), 32)
+}
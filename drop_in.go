@@ -0,0 +1,80 @@
+package hefty
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// DropInSqsClient is a Hefty SQS client wrapper whose SendMessage, ReceiveMessage, DeleteMessage and
+// ChangeMessageVisibility methods are SendHeftyMessage, ReceiveHeftyMessage, DeleteHeftyMessage and
+// ChangeHeftyMessageVisibility, so that code depending on an interface of these AWS SQS SDK methods works unchanged after
+// swapping the constructor. Raw returns the AWS SQS client for calls that must not store or resolve hefty messages. Code
+// that depends on *sqs.Client itself can use AttachToSqsClient instead.
+type DropInSqsClient struct {
+	*SqsClientWrapper
+}
+
+// NewDropInSqsClient creates a DropInSqsClient like NewSqsClientWrapper creates a Hefty SQS client wrapper
+func NewDropInSqsClient(sqsClient *sqs.Client, s3Client *s3.Client, bucketName string, opts ...Option) (*DropInSqsClient, error) {
+	wrapper, err := NewSqsClientWrapper(sqsClient, s3Client, bucketName, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DropInSqsClient{SqsClientWrapper: wrapper}, nil
+}
+
+// SendMessage sends a message with SendHeftyMessage
+func (client *DropInSqsClient) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	return client.SendHeftyMessage(ctx, params, optFns...)
+}
+
+// ReceiveMessage receives messages with ReceiveHeftyMessage
+func (client *DropInSqsClient) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	return client.ReceiveHeftyMessage(ctx, params, optFns...)
+}
+
+// DeleteMessage deletes a message with DeleteHeftyMessage
+func (client *DropInSqsClient) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	return client.DeleteHeftyMessage(ctx, params, optFns...)
+}
+
+// ChangeMessageVisibility changes the visibility timeout of a message with ChangeHeftyMessageVisibility
+func (client *DropInSqsClient) ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	return client.ChangeHeftyMessageVisibility(ctx, params, optFns...)
+}
+
+// Raw returns the AWS SQS client of the wrapper, whose calls neither store nor resolve hefty messages
+func (client *DropInSqsClient) Raw() *sqs.Client {
+	return &client.SqsClientWrapper.Client
+}
+
+// DropInSnsClient is a Hefty SNS client wrapper whose Publish method is PublishHeftyMessage, so that code depending on an
+// interface of the AWS SNS SDK method works unchanged after swapping the constructor. Raw returns the AWS SNS client for
+// calls that must not store hefty messages. Code that depends on *sns.Client itself can use AttachToSnsClient instead.
+type DropInSnsClient struct {
+	*SnsClientWrapper
+}
+
+// NewDropInSnsClient creates a DropInSnsClient like NewSnsClientWrapper creates a Hefty SNS client wrapper
+func NewDropInSnsClient(snsClient *sns.Client, s3Client *s3.Client, bucketName string, opts ...Option) (*DropInSnsClient, error) {
+	wrapper, err := NewSnsClientWrapper(snsClient, s3Client, bucketName, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DropInSnsClient{SnsClientWrapper: wrapper}, nil
+}
+
+// Publish publishes a message with PublishHeftyMessage
+func (client *DropInSnsClient) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	return client.PublishHeftyMessage(ctx, params, optFns...)
+}
+
+// Raw returns the AWS SNS client of the wrapper, whose calls do not store hefty messages
+func (client *DropInSnsClient) Raw() *sns.Client {
+	return &client.SnsClientWrapper.Client
+}
@@ -0,0 +1,58 @@
+package hefty
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// sqsMessageAPI is the kind of dependency code using the AWS SQS SDK declares
+type sqsMessageAPI interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+func TestDropInSqsClient(t *testing.T) {
+	transport := &fakeSqsTransport{}
+	store := &memoryStore{payloads: map[string][]byte{}}
+	client := &DropInSqsClient{SqsClientWrapper: &SqsClientWrapper{
+		Client: *sqs.New(sqs.Options{
+			Region:           "us-west-2",
+			HTTPClient:       &http.Client{Transport: transport},
+			RetryMaxAttempts: 1,
+			Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+				return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+			}),
+		}),
+		storage:        &payloadStorage{payloadStore: store, payloadMaxSize: 1024},
+		alwaysSendToS3: true,
+	}}
+	queueUrl := aws.String("https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue")
+
+	var api sqsMessageAPI = client
+	_, err := api.SendMessage(context.TODO(), &sqs.SendMessageInput{QueueUrl: queueUrl, MessageBody: aws.String("hefty message")})
+	assert.NoError(t, err)
+	assert.True(t, types.IsReferenceMsg(transport.bodies[0]))
+	assert.Len(t, store.payloads, 1)
+
+	out, err := api.ReceiveMessage(context.TODO(), &sqs.ReceiveMessageInput{QueueUrl: queueUrl})
+	assert.NoError(t, err)
+	assert.Equal(t, "hefty message", aws.ToString(out.Messages[0].Body))
+
+	_, err = api.DeleteMessage(context.TODO(), &sqs.DeleteMessageInput{QueueUrl: queueUrl, ReceiptHandle: out.Messages[0].ReceiptHandle})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"handle"}, transport.deleted)
+	assert.Empty(t, store.payloads)
+
+	// the raw client sends messages as they are
+	_, err = client.Raw().SendMessage(context.TODO(), &sqs.SendMessageInput{QueueUrl: queueUrl, MessageBody: aws.String("raw message")})
+	assert.NoError(t, err)
+	assert.Equal(t, "raw message", transport.bodies[1])
+	assert.Empty(t, store.payloads)
+}
@@ -0,0 +1,26 @@
+package hefty
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/smithy-go"
+)
+
+// serverSideEncryption holds the server side encryption settings applied to every hefty message uploaded to AWS S3
+type serverSideEncryption struct {
+	algorithm        string
+	kmsKeyId         string
+	bucketKeyEnabled bool
+}
+
+// isKmsError checks whether an AWS S3 error was caused by the AWS KMS key used to encrypt or decrypt a hefty message
+// being missing, disabled or not usable by the caller
+func isKmsError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return strings.HasPrefix(apiErr.ErrorCode(), "KMS.") || strings.Contains(strings.ToLower(apiErr.ErrorMessage()), "kms")
+}
@@ -0,0 +1,31 @@
+package hefty
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsKmsError(t *testing.T) {
+	var tests = []struct {
+		desc   string
+		err    error
+		expKms bool
+	}{
+		{desc: "not_api_error", err: errors.New("connection reset")},
+		{desc: "other_api_error", err: &smithy.GenericAPIError{Code: "NoSuchBucket", Message: "The specified bucket does not exist"}},
+		{desc: "kms_not_found", err: &smithy.GenericAPIError{Code: "KMS.NotFoundException", Message: "Invalid keyId"}, expKms: true},
+		{desc: "kms_access_denied", err: fmt.Errorf("operation error. %w", &smithy.GenericAPIError{Code: "AccessDenied", Message: "User is not authorized to perform: kms:GenerateDataKey"}), expKms: true},
+		{desc: "kms_disabled", err: &smithy.GenericAPIError{Code: "KMS.DisabledException", Message: "key is disabled"}, expKms: true},
+		{desc: "kms_in_message", err: &smithy.GenericAPIError{Code: "AccessDenied", Message: "The ciphertext refers to a customer master key that does not exist (Service: AWSKMS)"}, expKms: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			assert.Equal(t, tt.expKms, isKmsError(tt.err))
+		})
+	}
+}
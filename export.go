@@ -0,0 +1,217 @@
+package hefty
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const (
+	// exportMetadataFile is the name of the file holding the metadata of an exported message
+	exportMetadataFile = "message.json"
+	// exportBodyFile is the name of the file holding the original body of an exported message
+	exportBodyFile = "body"
+)
+
+// ExportInput is the queue Export exports and the directory the messages are written to
+type ExportInput struct {
+	// QueueUrl is the queue that is exported.
+	QueueUrl string
+	// Dir is the directory the messages are written to. Each message is written to a directory named after its message
+	// id, holding the original message body in `body` and its metadata in `message.json`.
+	Dir string
+	// MaxMessages is the maximum number of messages exported. It must be set when the queue is not drained.
+	MaxMessages int
+	// Drain deletes the messages and their hefty messages once they were written. Messages whose hefty message cannot be
+	// resolved are exported but not deleted. Without Drain, the messages are peeked at as with Inspect.
+	Drain bool
+}
+
+// ExportOutput is the output of Export
+type ExportOutput struct {
+	// Exported is the number of messages written.
+	Exported int
+	// Failed is the number of messages written whose hefty message could not be resolved.
+	Failed int
+}
+
+// ExportedMessage is the metadata of an exported message
+type ExportedMessage struct {
+	MessageId         string                       `json:"messageId"`
+	QueueUrl          string                       `json:"queueUrl"`
+	Attributes        map[string]string            `json:"attributes,omitempty"`
+	MessageAttributes map[string]ExportedAttribute `json:"messageAttributes,omitempty"`
+	Bucket            string                       `json:"bucket,omitempty"`
+	Key               string                       `json:"key,omitempty"`
+	Backend           string                       `json:"backend,omitempty"`
+	VersionId         string                       `json:"versionId,omitempty"`
+	// Error is why the hefty message could not be resolved, in which case the body is that of the reference message.
+	Error string `json:"error,omitempty"`
+}
+
+// ExportedAttribute is a message attribute of an exported message
+type ExportedAttribute struct {
+	DataType    string  `json:"dataType"`
+	StringValue *string `json:"stringValue,omitempty"`
+	BinaryValue []byte  `json:"binaryValue,omitempty"`
+}
+
+// Export writes the messages of a queue with their hefty messages resolved to a directory, e.g. for incident forensics
+// and offline analysis. The messages are either peeked at, so nothing is consumed or deleted, or drained. The directory
+// can be imported into a queue again with Import.
+func (wrapper *SqsClientWrapper) Export(ctx context.Context, input *ExportInput, optFns ...func(*sqs.Options)) (*ExportOutput, error) {
+	if err := os.MkdirAll(input.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create export directory %s. %v", input.Dir, err)
+	}
+
+	output := &ExportOutput{}
+	if !input.Drain {
+		if input.MaxMessages <= 0 {
+			return nil, errors.New("the maximum number of messages must be set when the queue is not drained")
+		}
+
+		inspected, err := wrapper.Inspect(ctx, input.QueueUrl, input.MaxMessages, optFns...)
+		for _, msg := range inspected {
+			if writeErr := output.write(input, msg); writeErr != nil {
+				return output, writeErr
+			}
+		}
+
+		return output, err
+	}
+
+	optFns = wrapper.withOptFns(optFns)
+	exported := map[string]bool{}
+	for input.MaxMessages <= 0 || output.Exported < input.MaxMessages {
+		maxMessages := 10
+		if input.MaxMessages > 0 {
+			maxMessages = min(input.MaxMessages-output.Exported, maxMessages)
+		}
+
+		out, err := wrapper.sqsClient().ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(input.QueueUrl),
+			MaxNumberOfMessages:   int32(maxMessages),
+			WaitTimeSeconds:       1,
+			AttributeNames:        []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameAll},
+			MessageAttributeNames: []string{"All"},
+		}, optFns...)
+		if err != nil {
+			return output, fmt.Errorf("unable to receive messages from %s. %v", input.QueueUrl, err)
+		}
+		if len(out.Messages) == 0 {
+			break
+		}
+
+		for _, received := range out.Messages {
+			// messages that could not be resolved are not deleted and are received again
+			msg := wrapper.inspectMessage(ctx, input.QueueUrl, received)
+			if exported[msg.MessageId] {
+				continue
+			}
+			exported[msg.MessageId] = true
+
+			if err = output.write(input, msg); err != nil {
+				return output, err
+			}
+			if msg.Err != nil {
+				continue
+			}
+
+			if err = wrapper.deleteExported(ctx, input.QueueUrl, received, msg, optFns); err != nil {
+				return output, err
+			}
+		}
+	}
+
+	return output, nil
+}
+
+// deleteExported deletes a drained message and its hefty message
+func (wrapper *SqsClientWrapper) deleteExported(ctx context.Context, queueUrl string, received sqstypes.Message, msg InspectedMessage, optFns []func(*sqs.Options)) error {
+	receiptHandle := received.ReceiptHandle
+	if msg.Key != "" {
+		// the receipt handle is only given to DeleteHeftyMessage, so it is not limited to the length AWS SQS accepts
+		receiptHandle = aws.String(heftyReceiptHandle{
+			receiptHandle: aws.ToString(received.ReceiptHandle),
+			bucket:        msg.Bucket,
+			key:           msg.Key,
+			backend:       msg.Backend,
+			versionId:     msg.VersionId,
+			counted:       msg.Counted,
+		}.encode(wrapper.receiptHandleKey))
+	}
+
+	_, err := wrapper.DeleteHeftyMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(queueUrl), ReceiptHandle: receiptHandle}, optFns...)
+	if err != nil {
+		return fmt.Errorf("message %s was exported but could not be deleted. %v", msg.MessageId, err)
+	}
+
+	return nil
+}
+
+// write writes an inspected message to the export directory
+func (output *ExportOutput) write(input *ExportInput, msg InspectedMessage) error {
+	// message ids are generated by AWS SQS, but are not trusted to be a single path segment
+	if msg.MessageId == "" || filepath.Base(msg.MessageId) != msg.MessageId || msg.MessageId == "." || msg.MessageId == ".." {
+		return fmt.Errorf("invalid message id '%s'", msg.MessageId)
+	}
+
+	dir := filepath.Join(input.Dir, msg.MessageId)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("unable to create directory of message %s. %v", msg.MessageId, err)
+	}
+
+	metadata, err := json.MarshalIndent(newExportedMessage(input.QueueUrl, msg), "", "\t")
+	if err != nil {
+		return fmt.Errorf("unable to marshal metadata of message %s. %v", msg.MessageId, err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, exportMetadataFile), metadata, 0o644); err != nil {
+		return fmt.Errorf("unable to write metadata of message %s. %v", msg.MessageId, err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, exportBodyFile), []byte(aws.ToString(msg.Body)), 0o644); err != nil {
+		return fmt.Errorf("unable to write body of message %s. %v", msg.MessageId, err)
+	}
+
+	output.Exported++
+	if msg.Err != nil {
+		output.Failed++
+	}
+
+	return nil
+}
+
+// newExportedMessage creates the metadata of an exported message
+func newExportedMessage(queueUrl string, msg InspectedMessage) ExportedMessage {
+	exported := ExportedMessage{
+		MessageId:  msg.MessageId,
+		QueueUrl:   queueUrl,
+		Attributes: msg.Attributes,
+		Bucket:     msg.Bucket,
+		Key:        msg.Key,
+		Backend:    msg.Backend,
+		VersionId:  msg.VersionId,
+	}
+	if msg.Err != nil {
+		exported.Error = msg.Err.Error()
+	}
+
+	if len(msg.MessageAttributes) > 0 {
+		exported.MessageAttributes = make(map[string]ExportedAttribute, len(msg.MessageAttributes))
+		for name, value := range msg.MessageAttributes {
+			exported.MessageAttributes[name] = ExportedAttribute{
+				DataType:    aws.ToString(value.DataType),
+				StringValue: value.StringValue,
+				BinaryValue: value.BinaryValue,
+			}
+		}
+	}
+
+	return exported
+}
@@ -0,0 +1,61 @@
+package hefty
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportOutputWrite(t *testing.T) {
+	input := &ExportInput{QueueUrl: "https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue", Dir: t.TempDir()}
+	output := &ExportOutput{}
+
+	err := output.write(input, InspectedMessage{
+		MessageId:  "message-id",
+		Body:       aws.String("hefty message"),
+		Attributes: map[string]string{"ApproximateReceiveCount": "3"},
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+			"attr": {DataType: aws.String("Binary"), BinaryValue: []byte{1, 2}},
+		},
+		Bucket: "bucket",
+		Key:    "MyQueue/id",
+	})
+	assert.Nil(t, err)
+
+	err = output.write(input, InspectedMessage{MessageId: "failed-id", Body: aws.String("reference message"), Err: errors.New("access denied")})
+	assert.Nil(t, err)
+	assert.Equal(t, &ExportOutput{Exported: 2, Failed: 1}, output)
+
+	body, err := os.ReadFile(filepath.Join(input.Dir, "message-id", exportBodyFile))
+	assert.Nil(t, err)
+	assert.Equal(t, "hefty message", string(body))
+
+	metadata, err := os.ReadFile(filepath.Join(input.Dir, "message-id", exportMetadataFile))
+	assert.Nil(t, err)
+	var exported ExportedMessage
+	assert.Nil(t, json.Unmarshal(metadata, &exported))
+	assert.Equal(t, ExportedMessage{
+		MessageId:         "message-id",
+		QueueUrl:          input.QueueUrl,
+		Attributes:        map[string]string{"ApproximateReceiveCount": "3"},
+		MessageAttributes: map[string]ExportedAttribute{"attr": {DataType: "Binary", BinaryValue: []byte{1, 2}}},
+		Bucket:            "bucket",
+		Key:               "MyQueue/id",
+	}, exported)
+
+	metadata, err = os.ReadFile(filepath.Join(input.Dir, "failed-id", exportMetadataFile))
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(metadata, &exported))
+	assert.Equal(t, "access denied", exported.Error)
+
+	// message ids must be a single path segment
+	for _, messageId := range []string{"", "..", "../escape", "a/b"} {
+		assert.NotNil(t, output.write(input, InspectedMessage{MessageId: messageId}))
+	}
+}
@@ -0,0 +1,227 @@
+package hefty
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const (
+	// extendedClientPointerClass is the class name the Java extended client libraries write in front of the location of a
+	// payload stored in AWS S3
+	extendedClientPointerClass = "software.amazon.payloadoffloading.PayloadS3Pointer"
+	// extendedClientSizeAttribute is the message attribute holding the size of a payload stored by the Java extended client
+	// libraries
+	extendedClientSizeAttribute = "ExtendedPayloadSize"
+	// legacyExtendedClientSizeAttribute is the size attribute written by earlier versions of the Java extended client
+	legacyExtendedClientSizeAttribute = "SQSLargePayloadSize"
+)
+
+// extendedClientPointer is the location of a payload stored in AWS S3 by the Java extended client libraries
+type extendedClientPointer struct {
+	Bucket string `json:"s3BucketName"`
+	Key    string `json:"s3Key"`
+}
+
+// MigrateExtendedClientInput is the queue MigrateExtendedClientQueue migrates and the queue the messages are moved to
+type MigrateExtendedClientInput struct {
+	// SourceQueueUrl is the queue holding messages sent by the Java extended client libraries.
+	SourceQueueUrl string
+	// TargetQueueUrl is the queue the messages are moved to, which is consumed with this library.
+	TargetQueueUrl string
+	// DeletePayloads deletes the payloads stored by the Java extended client libraries once their message was moved.
+	DeletePayloads bool
+}
+
+// MigrateExtendedClientOutput is the output of MigrateExtendedClientQueue
+type MigrateExtendedClientOutput struct {
+	// Converted is the number of messages whose payload stored by the Java extended client libraries was sent with
+	// SendHeftyMessage.
+	Converted int
+	// Moved is the number of other messages, which were moved as they are.
+	Moved int
+}
+
+// MigrateExtendedClientQueue moves the messages of a queue written by the Java extended client libraries to a queue
+// consumed with this library, so that consumers do not have to read both formats. Messages whose payload is stored in
+// AWS S3 by the Java extended client libraries are downloaded and sent with SendHeftyMessage; all other messages,
+// including reference messages of this library, are moved as they are, as with Redrive. Each message is sent to the target
+// queue before it is deleted from the source queue, and the migration stops at the first message that cannot be moved.
+//
+// Payloads of the Java extended client libraries are only deleted with DeletePayloads, and only after their message was
+// moved. Use ListExtendedClientObjects to find payloads left behind once all queues are migrated.
+func (wrapper *SqsClientWrapper) MigrateExtendedClientQueue(ctx context.Context, input *MigrateExtendedClientInput, optFns ...func(*sqs.Options)) (*MigrateExtendedClientOutput, error) {
+	if input.SourceQueueUrl == input.TargetQueueUrl {
+		return nil, errors.New("messages cannot be migrated to the queue they are received from")
+	}
+
+	optFns = wrapper.withOptFns(optFns)
+	output := &MigrateExtendedClientOutput{}
+	for {
+		out, err := wrapper.sqsClient().ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(input.SourceQueueUrl),
+			MaxNumberOfMessages:   10,
+			VisibilityTimeout:     redriveVisibilityTimeout,
+			WaitTimeSeconds:       1,
+			AttributeNames:        []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameAll},
+			MessageAttributeNames: []string{"All"},
+		}, optFns...)
+		if err != nil {
+			return output, fmt.Errorf("unable to receive messages from %s. %v", input.SourceQueueUrl, err)
+		}
+		if len(out.Messages) == 0 {
+			return output, nil
+		}
+
+		for i := range out.Messages {
+			msg := &out.Messages[i]
+			pointer, ok := parseExtendedClientPointer(aws.ToString(msg.Body))
+			if !ok {
+				if err = wrapper.redriveMessage(ctx, msg, input.SourceQueueUrl, input.TargetQueueUrl, optFns); err != nil {
+					return output, err
+				}
+				output.Moved++
+				continue
+			}
+
+			if err = wrapper.convertExtendedClientMessage(ctx, msg, pointer, input, optFns); err != nil {
+				return output, err
+			}
+			output.Converted++
+		}
+	}
+}
+
+// convertExtendedClientMessage sends the payload of a message of the Java extended client libraries with
+// SendHeftyMessage and deletes the message from the source queue
+func (wrapper *SqsClientWrapper) convertExtendedClientMessage(ctx context.Context, msg *sqstypes.Message, pointer extendedClientPointer, input *MigrateExtendedClientInput, optFns []func(*sqs.Options)) error {
+	body, err := wrapper.storage.getExtendedClientPayload(ctx, pointer)
+	if err != nil {
+		return fmt.Errorf("unable to get payload of message %s. %v", aws.ToString(msg.MessageId), err)
+	}
+
+	params := redriveInput(msg, input.TargetQueueUrl)
+	params.MessageBody = aws.String(body)
+	params.MessageAttributes = withoutExtendedClientAttributes(msg.MessageAttributes)
+
+	_, err = wrapper.SendHeftyMessage(ctx, params, optFns...)
+	if err != nil {
+		return fmt.Errorf("unable to send message %s to %s. %v", aws.ToString(msg.MessageId), input.TargetQueueUrl, err)
+	}
+
+	_, err = wrapper.sqsClient().DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(input.SourceQueueUrl), ReceiptHandle: msg.ReceiptHandle}, optFns...)
+	if err != nil {
+		return fmt.Errorf("message %s was sent to %s but could not be deleted from %s. %v", aws.ToString(msg.MessageId), input.TargetQueueUrl, input.SourceQueueUrl, err)
+	}
+
+	if input.DeletePayloads {
+		_, err = wrapper.storage.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket:              aws.String(pointer.Bucket),
+			Key:                 aws.String(pointer.Key),
+			ExpectedBucketOwner: optionalString(wrapper.storage.ownership.expectedBucketOwner),
+		}, wrapper.storage.s3OptFns...)
+		if err != nil {
+			return fmt.Errorf("message %s was migrated but its payload %s/%s could not be deleted. %v", aws.ToString(msg.MessageId), pointer.Bucket, pointer.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// getExtendedClientPayload downloads a payload stored by the Java extended client libraries, which is the message body
+// as is
+func (storage *payloadStorage) getExtendedClientPayload(ctx context.Context, pointer extendedClientPointer) (string, error) {
+	out, err := storage.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:              aws.String(pointer.Bucket),
+		Key:                 aws.String(pointer.Key),
+		ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+	}, storage.s3OptFns...)
+	if err != nil {
+		return "", err
+	}
+	defer out.Body.Close()
+
+	body, err := io.ReadAll(out.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(body), nil
+}
+
+// ListExtendedClientObjects lists the objects under `prefix` in `bucket` that were not stored by this library, e.g. the
+// payloads of the Java extended client libraries left behind after a migration. Objects stored by this library are
+// recognized by their object metadata.
+func (wrapper *SqsClientWrapper) ListExtendedClientObjects(ctx context.Context, bucket, prefix string) ([]PayloadObject, error) {
+	return wrapper.storage.listForeignObjects(ctx, wrapper.storage.s3Client, bucket, prefix)
+}
+
+// listForeignObjects lists the objects under `prefix` in `bucket` without the metadata written by newObjectMetadata
+func (storage *payloadStorage) listForeignObjects(ctx context.Context, client heftyObjectsClient, bucket, prefix string) ([]PayloadObject, error) {
+	objects, err := storage.listPrefixes(ctx, client, []Shard{{Bucket: bucket, Prefix: prefix}})
+	if err != nil {
+		return nil, err
+	}
+
+	var foreign []PayloadObject
+	for _, object := range objects {
+		out, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:              aws.String(object.Bucket),
+			Key:                 aws.String(object.Key),
+			ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+		}, storage.s3OptFns...)
+		if isNoSuchKey(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to get metadata of object %s/%s. %v", object.Bucket, object.Key, err)
+		}
+
+		if _, ok := out.Metadata[MetadataKeyFormatVersion]; !ok {
+			foreign = append(foreign, object)
+		}
+	}
+
+	return foreign, nil
+}
+
+// parseExtendedClientPointer parses the body of a message whose payload was stored in AWS S3 by the Java extended client
+// libraries, e.g. ["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket","s3Key":"key"}]
+func parseExtendedClientPointer(body string) (extendedClientPointer, bool) {
+	var tokens []json.RawMessage
+	if err := json.Unmarshal([]byte(body), &tokens); err != nil || len(tokens) != 2 {
+		return extendedClientPointer{}, false
+	}
+
+	var class string
+	if err := json.Unmarshal(tokens[0], &class); err != nil || class != extendedClientPointerClass {
+		return extendedClientPointer{}, false
+	}
+
+	var pointer extendedClientPointer
+	if err := json.Unmarshal(tokens[1], &pointer); err != nil || pointer.Bucket == "" || pointer.Key == "" {
+		return extendedClientPointer{}, false
+	}
+
+	return pointer, true
+}
+
+// withoutExtendedClientAttributes returns the message attributes without those added by the Java extended client
+// libraries
+func withoutExtendedClientAttributes(msgAttributes map[string]sqstypes.MessageAttributeValue) map[string]sqstypes.MessageAttributeValue {
+	filtered := make(map[string]sqstypes.MessageAttributeValue, len(msgAttributes))
+	for name, value := range msgAttributes {
+		if name != extendedClientSizeAttribute && name != legacyExtendedClientSizeAttribute {
+			filtered[name] = value
+		}
+	}
+
+	return filtered
+}
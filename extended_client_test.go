@@ -0,0 +1,59 @@
+package hefty
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExtendedClientPointer(t *testing.T) {
+	var tests = []struct {
+		desc       string
+		body       string
+		expPointer extendedClientPointer
+		expOk      bool
+	}{
+		{desc: "pointer", body: `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket","s3Key":"key"}]`, expPointer: extendedClientPointer{Bucket: "bucket", Key: "key"}, expOk: true},
+		{desc: "plain", body: "message"},
+		{desc: "json_array", body: `["a","b"]`},
+		{desc: "other_class", body: `["com.example.Pointer",{"s3BucketName":"bucket","s3Key":"key"}]`},
+		{desc: "missing_key", body: `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			pointer, ok := parseExtendedClientPointer(tt.body)
+			assert.Equal(t, tt.expOk, ok)
+			assert.Equal(t, tt.expPointer, pointer)
+		})
+	}
+}
+
+func TestWithoutExtendedClientAttributes(t *testing.T) {
+	filtered := withoutExtendedClientAttributes(map[string]sqstypes.MessageAttributeValue{
+		"ExtendedPayloadSize": {DataType: aws.String("Number"), StringValue: aws.String("300000")},
+		"SQSLargePayloadSize": {DataType: aws.String("Number"), StringValue: aws.String("300000")},
+		"attr":                {DataType: aws.String("String"), StringValue: aws.String("value")},
+	})
+	assert.Len(t, filtered, 1)
+	assert.Contains(t, filtered, "attr")
+}
+
+func TestPayloadStorageListForeignObjects(t *testing.T) {
+	client := &fakeHeftyObjectsClient{
+		fakePayloadPrefixClient: &fakePayloadPrefixClient{objects: map[string]map[string]bool{
+			"bucket": {"hefty": true, "java-1": true, "java-2": true},
+		}},
+		metadata: map[string]map[string]string{"bucket/hefty": {MetadataKeyFormatVersion: "1"}},
+	}
+	storage := &payloadStorage{}
+
+	objects, err := storage.listForeignObjects(context.TODO(), client, "bucket", "")
+	assert.Nil(t, err)
+	assert.Len(t, objects, 2)
+	assert.Equal(t, "java-1", objects[0].Key)
+	assert.Equal(t, "java-2", objects[1].Key)
+}
@@ -0,0 +1,55 @@
+package hefty
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// visibilityClient is the part of the AWS SQS client wrapper used by a heartbeat
+type visibilityClient interface {
+	ChangeHeftyMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+// Heartbeat extends the visibility timeout of a message by `visibilityTimeout` seconds every half timeout until `ctx` is
+// cancelled, so that a message is not received again while it is still being handled. `receiptHandle` may be the receipt
+// handle of a hefty message returned by ReceiveHeftyMessage or of a plain message. Heartbeat blocks, so it is usually run
+// in its own goroutine for as long as the message is handled:
+//
+//	heartbeatCtx, stop := context.WithCancel(ctx)
+//	go sqsHeftyClient.Heartbeat(heartbeatCtx, queueUrl, *msg.ReceiptHandle, 30, nil)
+//	defer stop()
+//
+// A failed extension is passed to `onError`, when not nil, and the heartbeat carries on, since the next extension may
+// still succeed before the visibility timeout expires.
+func (wrapper *SqsClientWrapper) Heartbeat(ctx context.Context, queueUrl, receiptHandle string, visibilityTimeout int32, onError func(err error)) {
+	heartbeat(ctx, wrapper, queueUrl, receiptHandle, visibilityTimeout, onError)
+}
+
+func heartbeat(ctx context.Context, client visibilityClient, queueUrl, receiptHandle string, visibilityTimeout int32, onError func(err error)) {
+	if visibilityTimeout <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(visibilityTimeout) * time.Second / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := client.ChangeHeftyMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          aws.String(queueUrl),
+				ReceiptHandle:     aws.String(receiptHandle),
+				VisibilityTimeout: visibilityTimeout,
+			})
+			// an extension cancelled by stopping the heartbeat did not fail
+			if err != nil && ctx.Err() == nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
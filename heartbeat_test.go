@@ -0,0 +1,19 @@
+package hefty
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeat(t *testing.T) {
+	client := &fakeConsumerClient{}
+	ctx, cancel := context.WithTimeout(context.Background(), 1200*time.Millisecond)
+	defer cancel()
+
+	heartbeat(ctx, client, "queue", "handle", 1, nil)
+
+	assert.Equal(t, []string{"handle", "handle"}, client.extended)
+}
@@ -0,0 +1,473 @@
+package heftytest
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/uuid"
+	"github.com/jo-parker/sqs-hefty"
+)
+
+const maxListKeys = 1000
+
+var _ hefty.S3API = (*S3)(nil)
+
+// S3 is an in-memory AWS S3 with the operations of hefty.S3API. Buckets are not versioned and do not have Object Lock
+// enabled.
+type S3 struct {
+	mu      sync.Mutex
+	buckets map[string]map[string]*object
+	uploads map[string]*multipartUpload
+}
+
+// object is an object of a bucket of the S3 fake
+type object struct {
+	body         []byte
+	metadata     map[string]string
+	tags         map[string]string
+	storageClass s3types.StorageClass
+	lastModified time.Time
+	etag         string
+}
+
+// multipartUpload is a multipart upload of the S3 fake that has not been completed
+type multipartUpload struct {
+	bucket   string
+	key      string
+	metadata map[string]string
+	tags     map[string]string
+	parts    map[int32][]byte
+}
+
+// NewS3 creates an in-memory AWS S3 with the empty buckets `buckets`
+func NewS3(buckets ...string) *S3 {
+	fake := &S3{buckets: map[string]map[string]*object{}, uploads: map[string]*multipartUpload{}}
+	for _, bucket := range buckets {
+		fake.buckets[bucket] = map[string]*object{}
+	}
+
+	return fake
+}
+
+// Keys returns the sorted keys of the objects in `bucket`, e.g. to check that a hefty message was stored or deleted
+func (fake *S3) Keys(bucket string) []string {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	keys := make([]string, 0, len(fake.buckets[bucket]))
+	for key := range fake.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// IncompleteUploads returns the number of multipart uploads that were neither completed nor aborted
+func (fake *S3) IncompleteUploads() int {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return len(fake.uploads)
+}
+
+func (fake *S3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	var body []byte
+	if params.Body != nil {
+		var err error
+		if body, err = io.ReadAll(params.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	tags, err := parseTagging(params.Tagging)
+	if err != nil {
+		return nil, err
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	obj, err := fake.put(params.Bucket, params.Key, body, params.Metadata, tags, params.StorageClass)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3.PutObjectOutput{ETag: aws.String(obj.etag)}, nil
+}
+
+// put stores an object
+func (fake *S3) put(bucket, key *string, body []byte, metadata, tags map[string]string, storageClass s3types.StorageClass) (*object, error) {
+	objects, err := fake.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if storageClass == "" {
+		storageClass = s3types.StorageClassStandard
+	}
+
+	sum := md5.Sum(body)
+	obj := &object{
+		body:         body,
+		metadata:     metadata,
+		tags:         tags,
+		storageClass: storageClass,
+		lastModified: time.Now(),
+		etag:         fmt.Sprintf("\"%s\"", hex.EncodeToString(sum[:])),
+	}
+	objects[aws.ToString(key)] = obj
+
+	return obj, nil
+}
+
+func (fake *S3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	obj, err := fake.object(params.Bucket, params.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(len(obj.body))
+	start, end := int64(0), size-1
+	if params.Range != nil {
+		if _, err = fmt.Sscanf(aws.ToString(params.Range), "bytes=%d-%d", &start, &end); err != nil {
+			return nil, fmt.Errorf("unable to parse range %s. %v", aws.ToString(params.Range), err)
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	body := obj.body[min(start, size) : end+1]
+	out := &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: aws.Int64(int64(len(body))),
+		ETag:          aws.String(obj.etag),
+		LastModified:  aws.Time(obj.lastModified),
+		Metadata:      obj.metadata,
+		StorageClass:  obj.storageClass,
+		TagCount:      aws.Int32(int32(len(obj.tags))),
+	}
+	if params.Range != nil {
+		out.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	}
+
+	return out, nil
+}
+
+func (fake *S3) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if _, ok := fake.buckets[aws.ToString(params.Bucket)]; !ok {
+		return nil, &s3types.NotFound{Message: aws.String(fmt.Sprintf("bucket %s does not exist", aws.ToString(params.Bucket)))}
+	}
+
+	return &s3.HeadBucketOutput{BucketRegion: aws.String(Region)}, nil
+}
+
+func (fake *S3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	obj, err := fake.object(params.Bucket, params.Key)
+	if err != nil {
+		return nil, &s3types.NotFound{Message: aws.String(err.Error())}
+	}
+
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(obj.body))),
+		ETag:          aws.String(obj.etag),
+		LastModified:  aws.Time(obj.lastModified),
+		Metadata:      obj.metadata,
+		StorageClass:  obj.storageClass,
+	}, nil
+}
+
+func (fake *S3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	objects, err := fake.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	maxKeys := int(aws.ToInt32(params.MaxKeys))
+	if maxKeys <= 0 || maxKeys > maxListKeys {
+		maxKeys = maxListKeys
+	}
+
+	// the continuation token is the last key of the previous page
+	after := aws.ToString(params.StartAfter)
+	if params.ContinuationToken != nil {
+		after = *params.ContinuationToken
+	}
+
+	var keys []string
+	for key := range objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	out := &s3.ListObjectsV2Output{
+		Name:              params.Bucket,
+		Prefix:            params.Prefix,
+		ContinuationToken: params.ContinuationToken,
+		MaxKeys:           aws.Int32(int32(maxKeys)),
+		IsTruncated:       aws.Bool(len(keys) > maxKeys),
+	}
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		out.NextContinuationToken = aws.String(keys[maxKeys-1])
+	}
+
+	for _, key := range keys {
+		obj := objects[key]
+		out.Contents = append(out.Contents, s3types.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(int64(len(obj.body))),
+			ETag:         aws.String(obj.etag),
+			LastModified: aws.Time(obj.lastModified),
+			StorageClass: s3types.ObjectStorageClass(obj.storageClass),
+		})
+	}
+	out.KeyCount = aws.Int32(int32(len(out.Contents)))
+
+	return out, nil
+}
+
+func (fake *S3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	objects, err := fake.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	// like AWS S3, deleting an object that does not exist succeeds
+	delete(objects, aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (fake *S3) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	objects, err := fake.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &s3.DeleteObjectsOutput{}
+	if params.Delete == nil {
+		return out, nil
+	}
+
+	for _, id := range params.Delete.Objects {
+		delete(objects, aws.ToString(id.Key))
+		out.Deleted = append(out.Deleted, s3types.DeletedObject{Key: id.Key})
+	}
+
+	return out, nil
+}
+
+func (fake *S3) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	obj, err := fake.object(params.Bucket, params.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &s3.GetObjectTaggingOutput{TagSet: []s3types.Tag{}}
+	for key, value := range obj.tags {
+		out.TagSet = append(out.TagSet, s3types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	sort.Slice(out.TagSet, func(i, j int) bool { return *out.TagSet[i].Key < *out.TagSet[j].Key })
+
+	return out, nil
+}
+
+func (fake *S3) PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	obj, err := fake.object(params.Bucket, params.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	obj.tags = map[string]string{}
+	if params.Tagging != nil {
+		for _, tag := range params.Tagging.TagSet {
+			obj.tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+	}
+
+	return &s3.PutObjectTaggingOutput{}, nil
+}
+
+func (fake *S3) GetObjectRetention(ctx context.Context, params *s3.GetObjectRetentionInput, optFns ...func(*s3.Options)) (*s3.GetObjectRetentionOutput, error) {
+	return nil, &smithy.GenericAPIError{Code: "ObjectLockConfigurationNotFoundError", Message: "Object Lock configuration does not exist for this bucket"}
+}
+
+func (fake *S3) GetObjectLegalHold(ctx context.Context, params *s3.GetObjectLegalHoldInput, optFns ...func(*s3.Options)) (*s3.GetObjectLegalHoldOutput, error) {
+	return nil, &smithy.GenericAPIError{Code: "ObjectLockConfigurationNotFoundError", Message: "Object Lock configuration does not exist for this bucket"}
+}
+
+func (fake *S3) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	tags, err := parseTagging(params.Tagging)
+	if err != nil {
+		return nil, err
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if _, err = fake.bucket(params.Bucket); err != nil {
+		return nil, err
+	}
+
+	uploadId := uuid.NewString()
+	fake.uploads[uploadId] = &multipartUpload{
+		bucket:   aws.ToString(params.Bucket),
+		key:      aws.ToString(params.Key),
+		metadata: params.Metadata,
+		tags:     tags,
+		parts:    map[int32][]byte{},
+	}
+
+	return &s3.CreateMultipartUploadOutput{Bucket: params.Bucket, Key: params.Key, UploadId: aws.String(uploadId)}, nil
+}
+
+func (fake *S3) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	upload, err := fake.upload(params.UploadId)
+	if err != nil {
+		return nil, err
+	}
+
+	upload.parts[aws.ToInt32(params.PartNumber)] = body
+	sum := md5.Sum(body)
+
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("\"%s\"", hex.EncodeToString(sum[:])))}, nil
+}
+
+func (fake *S3) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	upload, err := fake.upload(params.UploadId)
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := make([]int32, 0, len(upload.parts))
+	for number := range upload.parts {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	var body []byte
+	for _, number := range numbers {
+		body = append(body, upload.parts[number]...)
+	}
+
+	obj, err := fake.put(&upload.bucket, &upload.key, body, upload.metadata, upload.tags, "")
+	if err != nil {
+		return nil, err
+	}
+	delete(fake.uploads, aws.ToString(params.UploadId))
+
+	return &s3.CompleteMultipartUploadOutput{Bucket: params.Bucket, Key: params.Key, ETag: aws.String(obj.etag)}, nil
+}
+
+func (fake *S3) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if _, err := fake.upload(params.UploadId); err != nil {
+		return nil, err
+	}
+
+	delete(fake.uploads, aws.ToString(params.UploadId))
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+// bucket returns the objects of `bucket`
+func (fake *S3) bucket(bucket *string) (map[string]*object, error) {
+	objects, ok := fake.buckets[aws.ToString(bucket)]
+	if !ok {
+		return nil, &s3types.NoSuchBucket{Message: aws.String(fmt.Sprintf("bucket %s does not exist", aws.ToString(bucket)))}
+	}
+
+	return objects, nil
+}
+
+// object returns the object stored under `key` in `bucket`
+func (fake *S3) object(bucket, key *string) (*object, error) {
+	objects, err := fake.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, ok := objects[aws.ToString(key)]
+	if !ok {
+		return nil, &s3types.NoSuchKey{Message: aws.String(fmt.Sprintf("key %s does not exist", aws.ToString(key)))}
+	}
+
+	return obj, nil
+}
+
+// upload returns the multipart upload `uploadId`
+func (fake *S3) upload(uploadId *string) (*multipartUpload, error) {
+	upload, ok := fake.uploads[aws.ToString(uploadId)]
+	if !ok {
+		return nil, &s3types.NoSuchUpload{Message: aws.String(fmt.Sprintf("upload %s does not exist", aws.ToString(uploadId)))}
+	}
+
+	return upload, nil
+}
+
+// parseTagging parses the url encoded tags of an upload
+func parseTagging(tagging *string) (map[string]string, error) {
+	values, err := url.ParseQuery(aws.ToString(tagging))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse tagging. %v", err)
+	}
+
+	tags := make(map[string]string, len(values))
+	for key := range values {
+		tags[key] = values.Get(key)
+	}
+
+	return tags, nil
+}
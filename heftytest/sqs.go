@@ -0,0 +1,468 @@
+// Package heftytest provides in-memory fakes of AWS SQS, AWS S3 and a payload store, so that code sending and receiving
+// hefty messages can be unit tested without AWS or LocalStack:
+//
+//	sqsFake := heftytest.NewSQS()
+//	s3Fake := heftytest.NewS3(heftytest.Bucket)
+//	queueUrl := sqsFake.CreateQueue("MyQueue", 0)
+//	sqsHeftyClient, err := hefty.NewSqsClientWrapperFromAPI(sqsFake, s3Fake, heftytest.Bucket)
+//
+// The fakes are safe for concurrent use.
+package heftytest
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/uuid"
+	"github.com/jo-parker/sqs-hefty"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/limits"
+)
+
+const (
+	Region    = "us-east-1"    // region of the queue urls and arns of the fakes
+	AccountId = "000000000000" // account of the queue urls and arns of the fakes
+	Bucket    = "hefty-test"   // name of a bucket for tests that need only one
+
+	defaultVisibilityTimeout = 30 * time.Second
+	defaultRetentionPeriod   = 4 * 24 * time.Hour
+	maxReceiveMessages       = 10
+)
+
+var _ hefty.SqsAPI = (*SQS)(nil)
+
+// SQS is an in-memory AWS SQS with the operations of hefty.SqsAPI. Received messages are invisible for the visibility
+// timeout of their queue or receive call and can only be deleted or changed with the receipt handle of their latest
+// receive. Receive calls return immediately, i.e. WaitTimeSeconds is ignored, and messages are received in the order
+// they were sent.
+type SQS struct {
+	// Now returns the current time of the fake, e.g. to expire visibility timeouts without waiting. time.Now is used when
+	// nil.
+	Now func() time.Time
+
+	mu     sync.Mutex
+	queues map[string]*queue
+}
+
+// queue is a queue of the SQS fake
+type queue struct {
+	name              string
+	visibilityTimeout time.Duration
+	messages          []*message
+}
+
+// message is a message of a queue of the SQS fake
+type message struct {
+	id                string
+	body              string
+	attributes        map[string]sqstypes.MessageAttributeValue
+	groupId           *string
+	sent              time.Time
+	firstReceived     time.Time
+	receiveCount      int
+	receiptHandle     string
+	visibleAt         time.Time
+	md5OfBody         string
+	md5OfMsgAttribute string
+}
+
+// NewSQS creates an in-memory AWS SQS without queues
+func NewSQS() *SQS {
+	return &SQS{queues: map[string]*queue{}}
+}
+
+// CreateQueue creates a queue named `name` and returns its url. Received messages are invisible for
+// `visibilityTimeout`; 30 seconds are used when 0. A queue that already exists is kept.
+func (fake *SQS) CreateQueue(name string, visibilityTimeout time.Duration) string {
+	if visibilityTimeout <= 0 {
+		visibilityTimeout = defaultVisibilityTimeout
+	}
+
+	queueUrl := fmt.Sprintf("https://sqs.%s.amazonaws.com/%s/%s", Region, AccountId, name)
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if _, ok := fake.queues[queueUrl]; !ok {
+		fake.queues[queueUrl] = &queue{name: name, visibilityTimeout: visibilityTimeout}
+	}
+
+	return queueUrl
+}
+
+// Bodies returns the bodies of the messages in the queue at `queueUrl` as they were sent, whether visible or not, e.g. to
+// check that a reference message was sent instead of a hefty message
+func (fake *SQS) Bodies(queueUrl string) []string {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	q, ok := fake.queues[queueUrl]
+	if !ok {
+		return nil
+	}
+
+	bodies := make([]string, 0, len(q.messages))
+	for _, msg := range q.messages {
+		bodies = append(bodies, msg.body)
+	}
+
+	return bodies
+}
+
+func (fake *SQS) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	q, err := fake.queue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := fake.send(q, params.MessageBody, params.MessageAttributes, params.MessageGroupId, params.DelaySeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqs.SendMessageOutput{
+		MessageId:              aws.String(msg.id),
+		MD5OfMessageBody:       aws.String(msg.md5OfBody),
+		MD5OfMessageAttributes: optionalString(msg.md5OfMsgAttribute),
+	}, nil
+}
+
+func (fake *SQS) SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	q, err := fake.queue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(params.Entries) == 0 {
+		return nil, &sqstypes.EmptyBatchRequest{Message: aws.String("no entries")}
+	}
+	if len(params.Entries) > maxReceiveMessages {
+		return nil, &sqstypes.TooManyEntriesInBatchRequest{Message: aws.String("more than 10 entries")}
+	}
+
+	out := &sqs.SendMessageBatchOutput{Successful: []sqstypes.SendMessageBatchResultEntry{}, Failed: []sqstypes.BatchResultErrorEntry{}}
+	for _, entry := range params.Entries {
+		msg, err := fake.send(q, entry.MessageBody, entry.MessageAttributes, entry.MessageGroupId, entry.DelaySeconds)
+		if err != nil {
+			out.Failed = append(out.Failed, sqstypes.BatchResultErrorEntry{
+				Id:          entry.Id,
+				Code:        aws.String("InvalidMessageContents"),
+				Message:     aws.String(err.Error()),
+				SenderFault: true,
+			})
+			continue
+		}
+
+		out.Successful = append(out.Successful, sqstypes.SendMessageBatchResultEntry{
+			Id:                     entry.Id,
+			MessageId:              aws.String(msg.id),
+			MD5OfMessageBody:       aws.String(msg.md5OfBody),
+			MD5OfMessageAttributes: optionalString(msg.md5OfMsgAttribute),
+		})
+	}
+
+	return out, nil
+}
+
+// send adds a message to a queue
+func (fake *SQS) send(q *queue, body *string, attributes map[string]sqstypes.MessageAttributeValue, groupId *string, delaySeconds int32) (*message, error) {
+	if aws.ToString(body) == "" {
+		return nil, &sqstypes.InvalidMessageContents{Message: aws.String("message body is empty")}
+	}
+
+	msgAttributes := messages.MapFromSqsMessageAttributeValues(attributes)
+	size, err := messages.MessageSize(body, msgAttributes)
+	if err != nil {
+		return nil, err
+	}
+	if size > limits.Default(limits.SQS) {
+		return nil, &sqstypes.InvalidMessageContents{Message: aws.String(fmt.Sprintf("message of %d bytes is too long", size))}
+	}
+
+	md5OfBody, err := messages.Md5OfMessageBody(*body)
+	if err != nil {
+		return nil, err
+	}
+
+	var md5OfMsgAttributes string
+	if len(attributes) > 0 {
+		if md5OfMsgAttributes, err = messages.Md5OfMessageAttributes(msgAttributes); err != nil {
+			return nil, err
+		}
+	}
+
+	now := fake.now()
+	msg := &message{
+		id:                uuid.NewString(),
+		body:              *body,
+		attributes:        attributes,
+		groupId:           groupId,
+		sent:              now,
+		visibleAt:         now.Add(time.Duration(delaySeconds) * time.Second),
+		md5OfBody:         md5OfBody,
+		md5OfMsgAttribute: md5OfMsgAttributes,
+	}
+	q.messages = append(q.messages, msg)
+
+	return msg, nil
+}
+
+func (fake *SQS) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	q, err := fake.queue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	maxMessages := int(params.MaxNumberOfMessages)
+	if maxMessages <= 0 {
+		maxMessages = 1
+	}
+	if maxMessages > maxReceiveMessages {
+		return nil, &sqstypes.OverLimit{Message: aws.String("MaxNumberOfMessages must be between 1 and 10")}
+	}
+
+	visibilityTimeout := q.visibilityTimeout
+	if params.VisibilityTimeout > 0 {
+		visibilityTimeout = time.Duration(params.VisibilityTimeout) * time.Second
+	}
+
+	now := fake.now()
+	out := &sqs.ReceiveMessageOutput{}
+	for _, msg := range q.messages {
+		if len(out.Messages) == maxMessages {
+			break
+		}
+		if msg.visibleAt.After(now) {
+			continue
+		}
+
+		msg.receiveCount++
+		if msg.firstReceived.IsZero() {
+			msg.firstReceived = now
+		}
+		msg.receiptHandle = newReceiptHandle()
+		msg.visibleAt = now.Add(visibilityTimeout)
+
+		out.Messages = append(out.Messages, sqstypes.Message{
+			MessageId:              aws.String(msg.id),
+			ReceiptHandle:          aws.String(msg.receiptHandle),
+			Body:                   aws.String(msg.body),
+			MD5OfBody:              aws.String(msg.md5OfBody),
+			MD5OfMessageAttributes: optionalString(msg.md5OfMsgAttribute),
+			MessageAttributes:      selectMessageAttributes(msg.attributes, params.MessageAttributeNames),
+			Attributes:             msg.systemAttributes(params.AttributeNames),
+		})
+	}
+
+	return out, nil
+}
+
+// systemAttributes returns the system attributes of a message that were requested
+func (msg *message) systemAttributes(names []sqstypes.QueueAttributeName) map[string]string {
+	if len(names) == 0 {
+		return nil
+	}
+
+	all := map[string]string{
+		string(sqstypes.MessageSystemAttributeNameSentTimestamp):                    strconv.FormatInt(msg.sent.UnixMilli(), 10),
+		string(sqstypes.MessageSystemAttributeNameApproximateReceiveCount):          strconv.Itoa(msg.receiveCount),
+		string(sqstypes.MessageSystemAttributeNameApproximateFirstReceiveTimestamp): strconv.FormatInt(msg.firstReceived.UnixMilli(), 10),
+	}
+	if msg.groupId != nil {
+		all[string(sqstypes.MessageSystemAttributeNameMessageGroupId)] = *msg.groupId
+	}
+
+	attributes := map[string]string{}
+	for _, name := range names {
+		if name == sqstypes.QueueAttributeNameAll {
+			return all
+		}
+		if value, ok := all[string(name)]; ok {
+			attributes[string(name)] = value
+		}
+	}
+
+	return attributes
+}
+
+// selectMessageAttributes returns the message attributes whose names were requested. Like AWS SQS, "All" and ".*"
+// request every message attribute and a name ending in ".*" requests the message attributes with its prefix.
+func selectMessageAttributes(attributes map[string]sqstypes.MessageAttributeValue, names []string) map[string]sqstypes.MessageAttributeValue {
+	if len(attributes) == 0 || len(names) == 0 {
+		return nil
+	}
+
+	selected := map[string]sqstypes.MessageAttributeValue{}
+	for name, value := range attributes {
+		for _, requested := range names {
+			if requested == "All" || requested == ".*" || requested == name ||
+				(strings.HasSuffix(requested, ".*") && strings.HasPrefix(name, strings.TrimSuffix(requested, "*"))) {
+				selected[name] = value
+				break
+			}
+		}
+	}
+
+	return selected
+}
+
+func (fake *SQS) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	q, err := fake.queue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, msg := range q.messages {
+		if msg.receiptHandle != "" && msg.receiptHandle == aws.ToString(params.ReceiptHandle) {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			return &sqs.DeleteMessageOutput{}, nil
+		}
+	}
+
+	return nil, &sqstypes.ReceiptHandleIsInvalid{Message: aws.String(fmt.Sprintf("receipt handle %s is invalid", aws.ToString(params.ReceiptHandle)))}
+}
+
+func (fake *SQS) ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	q, err := fake.queue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	now := fake.now()
+	for _, msg := range q.messages {
+		if msg.receiptHandle == "" || msg.receiptHandle != aws.ToString(params.ReceiptHandle) {
+			continue
+		}
+		if !msg.visibleAt.After(now) {
+			return nil, &sqstypes.MessageNotInflight{Message: aws.String(fmt.Sprintf("message %s is not in flight", msg.id))}
+		}
+
+		msg.visibleAt = now.Add(time.Duration(params.VisibilityTimeout) * time.Second)
+		return &sqs.ChangeMessageVisibilityOutput{}, nil
+	}
+
+	return nil, &sqstypes.ReceiptHandleIsInvalid{Message: aws.String(fmt.Sprintf("receipt handle %s is invalid", aws.ToString(params.ReceiptHandle)))}
+}
+
+func (fake *SQS) GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	q, err := fake.queue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	now := fake.now()
+	var visible, notVisible int
+	for _, msg := range q.messages {
+		if msg.visibleAt.After(now) {
+			notVisible++
+		} else {
+			visible++
+		}
+	}
+
+	all := map[string]string{
+		string(sqstypes.QueueAttributeNameQueueArn):                              fmt.Sprintf("arn:aws:sqs:%s:%s:%s", Region, AccountId, q.name),
+		string(sqstypes.QueueAttributeNameVisibilityTimeout):                     strconv.Itoa(int(q.visibilityTimeout.Seconds())),
+		string(sqstypes.QueueAttributeNameMessageRetentionPeriod):                strconv.Itoa(int(defaultRetentionPeriod.Seconds())),
+		string(sqstypes.QueueAttributeNameApproximateNumberOfMessages):           strconv.Itoa(visible),
+		string(sqstypes.QueueAttributeNameApproximateNumberOfMessagesNotVisible): strconv.Itoa(notVisible),
+	}
+
+	attributes := map[string]string{}
+	for _, name := range params.AttributeNames {
+		if name == sqstypes.QueueAttributeNameAll {
+			attributes = all
+			break
+		}
+		if value, ok := all[string(name)]; ok {
+			attributes[string(name)] = value
+		}
+	}
+
+	return &sqs.GetQueueAttributesOutput{Attributes: attributes}, nil
+}
+
+func (fake *SQS) DeleteQueue(ctx context.Context, params *sqs.DeleteQueueInput, optFns ...func(*sqs.Options)) (*sqs.DeleteQueueOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if _, err := fake.queue(params.QueueUrl); err != nil {
+		return nil, err
+	}
+
+	delete(fake.queues, aws.ToString(params.QueueUrl))
+	return &sqs.DeleteQueueOutput{}, nil
+}
+
+func (fake *SQS) PurgeQueue(ctx context.Context, params *sqs.PurgeQueueInput, optFns ...func(*sqs.Options)) (*sqs.PurgeQueueOutput, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	q, err := fake.queue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	q.messages = nil
+	return &sqs.PurgeQueueOutput{}, nil
+}
+
+// queue returns the queue at `queueUrl`
+func (fake *SQS) queue(queueUrl *string) (*queue, error) {
+	q, ok := fake.queues[aws.ToString(queueUrl)]
+	if !ok {
+		return nil, &sqstypes.QueueDoesNotExist{Message: aws.String(fmt.Sprintf("queue %s does not exist", aws.ToString(queueUrl)))}
+	}
+
+	return q, nil
+}
+
+// newReceiptHandle returns a random receipt handle that is base64 encoded like those of AWS SQS
+func newReceiptHandle() string {
+	id := uuid.New()
+	return base64.StdEncoding.EncodeToString(id[:])
+}
+
+// now returns the current time of the fake
+func (fake *SQS) now() time.Time {
+	if fake.Now != nil {
+		return fake.Now()
+	}
+
+	return time.Now()
+}
+
+// optionalString returns nil for an empty string
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
@@ -0,0 +1,429 @@
+package heftytest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jo-parker/sqs-hefty"
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQSVisibility(t *testing.T) {
+	now := time.Now()
+	fake := NewSQS()
+	fake.Now = func() time.Time { return now }
+	queueUrl := fake.CreateQueue("MyQueue", 10*time.Second)
+	ctx := context.TODO()
+
+	_, err := fake.SendMessage(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(queueUrl), MessageBody: aws.String("message")})
+	assert.NoError(t, err)
+
+	first, err := fake.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueUrl)})
+	assert.NoError(t, err)
+	assert.Len(t, first.Messages, 1)
+
+	// invisible until the visibility timeout expires
+	out, err := fake.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueUrl)})
+	assert.NoError(t, err)
+	assert.Len(t, out.Messages, 0)
+
+	now = now.Add(11 * time.Second)
+	second, err := fake.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueUrl), AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameAll}})
+	assert.NoError(t, err)
+	assert.Len(t, second.Messages, 1)
+	assert.Equal(t, "2", second.Messages[0].Attributes["ApproximateReceiveCount"])
+
+	// the receipt handle of an earlier receive is invalid
+	_, err = fake.DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(queueUrl), ReceiptHandle: first.Messages[0].ReceiptHandle})
+	var invalid *sqstypes.ReceiptHandleIsInvalid
+	assert.ErrorAs(t, err, &invalid)
+
+	// extending the visibility timeout keeps the message invisible
+	_, err = fake.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{QueueUrl: aws.String(queueUrl), ReceiptHandle: second.Messages[0].ReceiptHandle, VisibilityTimeout: 60})
+	assert.NoError(t, err)
+	now = now.Add(30 * time.Second)
+	out, err = fake.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueUrl)})
+	assert.NoError(t, err)
+	assert.Len(t, out.Messages, 0)
+
+	_, err = fake.DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(queueUrl), ReceiptHandle: second.Messages[0].ReceiptHandle})
+	assert.NoError(t, err)
+	assert.Empty(t, fake.Bodies(queueUrl))
+}
+
+func TestHeftyRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		store   bool
+		expKeys int
+	}{
+		{name: "small message", size: 1024},
+		{name: "hefty message", size: 300 * 1024, expKeys: 1},
+		{name: "multipart hefty message", size: 6 * 1024 * 1024, expKeys: 1},
+		{name: "hefty message in payload store", size: 300 * 1024, store: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sqsFake := NewSQS()
+			s3Fake := NewS3(Bucket)
+			store := NewPayloadStore()
+			queueUrl := sqsFake.CreateQueue("MyQueue", 0)
+			ctx := context.TODO()
+
+			var opts []hefty.Option
+			if test.store {
+				opts = append(opts, hefty.WithPayloadStore(store, 1024*1024))
+			}
+			wrapper, err := hefty.NewSqsClientWrapperFromAPI(sqsFake, s3Fake, Bucket, opts...)
+			assert.NoError(t, err)
+
+			body := strings.Repeat("a", test.size)
+			_, err = wrapper.SendHeftyMessage(ctx, &sqs.SendMessageInput{
+				QueueUrl:          aws.String(queueUrl),
+				MessageBody:       aws.String(body),
+				MessageAttributes: map[string]sqstypes.MessageAttributeValue{"attr": {DataType: aws.String("String"), StringValue: aws.String("value")}},
+			})
+			assert.NoError(t, err)
+			assert.Len(t, s3Fake.Keys(Bucket), test.expKeys)
+			if test.size > 1024 {
+				assert.True(t, types.IsReferenceMsg(sqsFake.Bodies(queueUrl)[0]))
+			}
+			if test.store {
+				assert.Len(t, store.Keys(), 1)
+			}
+
+			out, err := wrapper.ReceiveHeftyMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueUrl), MessageAttributeNames: []string{"All"}})
+			assert.NoError(t, err)
+			assert.Len(t, out.Messages, 1)
+			assert.Equal(t, body, aws.ToString(out.Messages[0].Body))
+			assert.Equal(t, "value", aws.ToString(out.Messages[0].MessageAttributes["attr"].StringValue))
+
+			_, err = wrapper.DeleteHeftyMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(queueUrl), ReceiptHandle: out.Messages[0].ReceiptHandle})
+			assert.NoError(t, err)
+			assert.Empty(t, sqsFake.Bodies(queueUrl))
+			assert.Empty(t, s3Fake.Keys(Bucket))
+			assert.Empty(t, store.Keys())
+		})
+	}
+}
+
+func TestSpooling(t *testing.T) {
+	sqsFake := NewSQS()
+	s3Fake := NewS3(Bucket)
+	queueUrl := sqsFake.CreateQueue("MyQueue", 0)
+	ctx := context.TODO()
+
+	wrapper, err := hefty.NewSqsClientWrapperFromAPI(sqsFake, s3Fake, Bucket, hefty.WithSpooling(1024*1024, t.TempDir()))
+	assert.NoError(t, err)
+
+	body := strings.Repeat("a", 6*1024*1024)
+	_, err = wrapper.SendHeftyMessage(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(queueUrl), MessageBody: aws.String(body)})
+	assert.NoError(t, err)
+
+	out, err := wrapper.ReceiveHeftyMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueUrl)})
+	assert.NoError(t, err)
+	assert.Len(t, out.Messages, 1)
+	assert.Equal(t, []string{aws.ToString(out.Messages[0].MessageId)}, hefty.UnresolvedMessages(out.ResultMetadata))
+
+	spooled, err := wrapper.OpenHeftyMessage(ctx, queueUrl, &out.Messages[0])
+	assert.NoError(t, err)
+	spooledBody, err := io.ReadAll(spooled)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(spooledBody))
+	assert.NoError(t, spooled.Close())
+
+	_, err = wrapper.DeleteHeftyMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(queueUrl), ReceiptHandle: out.Messages[0].ReceiptHandle})
+	assert.NoError(t, err)
+	assert.Empty(t, s3Fake.Keys(Bucket))
+}
+
+func TestSendHeftyMessageStream(t *testing.T) {
+	sqsFake := NewSQS()
+	s3Fake := NewS3(Bucket)
+	queueUrl := sqsFake.CreateQueue("MyQueue", 0)
+	ctx := context.TODO()
+
+	wrapper, err := hefty.NewSqsClientWrapperFromAPI(sqsFake, s3Fake, Bucket, hefty.WithDigestAlgorithm(hefty.DigestSha256))
+	assert.NoError(t, err)
+
+	body := strings.Repeat("a", 12*1024*1024)
+	attributes := map[string]sqstypes.MessageAttributeValue{"attr": {DataType: aws.String("String"), StringValue: aws.String("value")}}
+	_, err = wrapper.SendHeftyMessageStream(ctx, queueUrl, strings.NewReader(body), int64(len(body)), attributes)
+	assert.NoError(t, err)
+	assert.Len(t, s3Fake.Keys(Bucket), 1)
+
+	out, err := wrapper.ReceiveHeftyMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueUrl), MessageAttributeNames: []string{"All"}})
+	assert.NoError(t, err)
+	assert.Len(t, out.Messages, 1)
+	assert.Equal(t, body, aws.ToString(out.Messages[0].Body))
+	assert.Equal(t, "value", aws.ToString(out.Messages[0].MessageAttributes["attr"].StringValue))
+
+	// a body with fewer bytes than its size is not sent
+	_, err = wrapper.SendHeftyMessageStream(ctx, queueUrl, strings.NewReader("hefty"), 1024, nil)
+	assert.Error(t, err)
+	assert.Len(t, sqsFake.Bodies(queueUrl), 1)
+	assert.Len(t, s3Fake.Keys(Bucket), 1)
+}
+
+func TestStreamHeftyMessage(t *testing.T) {
+	sqsFake := NewSQS()
+	s3Fake := NewS3(Bucket)
+	queueUrl := sqsFake.CreateQueue("MyQueue", 0)
+	ctx := context.TODO()
+
+	wrapper, err := hefty.NewSqsClientWrapperFromAPI(sqsFake, s3Fake, Bucket)
+	assert.NoError(t, err)
+
+	body := strings.Repeat("a", 300*1024)
+	_, err = wrapper.SendHeftyMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:          aws.String(queueUrl),
+		MessageBody:       aws.String(body),
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{"attr": {DataType: aws.String("String"), StringValue: aws.String("value")}},
+	})
+	assert.NoError(t, err)
+
+	out, err := wrapper.ReceiveHeftyMessageLazy(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueUrl)})
+	assert.NoError(t, err)
+	assert.Len(t, out.Messages, 1)
+
+	reader, err := wrapper.StreamHeftyMessage(ctx, queueUrl, &out.Messages[0].Message)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(body)), reader.Size)
+	assert.Equal(t, "value", aws.ToString(reader.MessageAttributes["attr"].StringValue))
+	streamed, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(streamed))
+	assert.NoError(t, reader.Close())
+
+	// a corrupted body fails once it has been read
+	key := out.Messages[0].Payload.Key
+	obj, err := s3Fake.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(Bucket), Key: aws.String(key)})
+	assert.NoError(t, err)
+	serialized, _ := io.ReadAll(obj.Body)
+	serialized[10] = 'b'
+	_, err = s3Fake.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String(Bucket), Key: aws.String(key), Body: bytes.NewReader(serialized)})
+	assert.NoError(t, err)
+
+	reader, err = out.Messages[0].Payload.Stream(ctx)
+	assert.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	var integrityErr *hefty.IntegrityError
+	assert.ErrorAs(t, err, &integrityErr)
+	assert.NoError(t, reader.Close())
+}
+
+func TestInjectedUploaderAndDownloader(t *testing.T) {
+	sqsFake := NewSQS()
+	s3Fake := NewS3(Bucket)
+	injected := NewS3(Bucket)
+	queueUrl := sqsFake.CreateQueue("MyQueue", 0)
+	ctx := context.TODO()
+
+	// the injected uploader and downloader use their own AWS S3 client
+	wrapper, err := hefty.NewSqsClientWrapperFromAPI(sqsFake, s3Fake, Bucket,
+		hefty.WithUploader(manager.NewUploader(injected)),
+		hefty.WithDownloader(manager.NewDownloader(injected)))
+	assert.NoError(t, err)
+
+	body := strings.Repeat("a", 300*1024)
+	_, err = wrapper.SendHeftyMessage(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(queueUrl), MessageBody: aws.String(body)})
+	assert.NoError(t, err)
+	assert.Empty(t, s3Fake.Keys(Bucket))
+	assert.Len(t, injected.Keys(Bucket), 1)
+
+	out, err := wrapper.ReceiveHeftyMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueUrl)})
+	assert.NoError(t, err)
+	assert.Len(t, out.Messages, 1)
+	assert.Equal(t, body, aws.ToString(out.Messages[0].Body))
+}
+
+// rangeCountingS3 counts the GetObject calls of the fake
+type rangeCountingS3 struct {
+	*S3
+	gets atomic.Int32
+}
+
+func (fake *rangeCountingS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	fake.gets.Add(1)
+	return fake.S3.GetObject(ctx, params, optFns...)
+}
+
+func TestDownloadConcurrency(t *testing.T) {
+	sqsFake := NewSQS()
+	s3Fake := &rangeCountingS3{S3: NewS3(Bucket)}
+	queueUrl := sqsFake.CreateQueue("MyQueue", 0)
+	ctx := context.TODO()
+
+	wrapper, err := hefty.NewSqsClientWrapperFromAPI(sqsFake, s3Fake, Bucket, hefty.WithDownloadConcurrency(256*1024, 4))
+	assert.NoError(t, err)
+
+	body := strings.Repeat("abcdefgh", 256*1024)
+	_, err = wrapper.SendHeftyMessage(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(queueUrl), MessageBody: aws.String(body)})
+	assert.NoError(t, err)
+
+	out, err := wrapper.ReceiveHeftyMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueUrl)})
+	assert.NoError(t, err)
+	assert.Len(t, out.Messages, 1)
+	assert.Equal(t, body, aws.ToString(out.Messages[0].Body))
+	assert.Equal(t, int32(9), s3Fake.gets.Load(), "2MB in ranges of 256KB")
+}
+
+// failingReader fails after `remaining` bytes
+type failingReader struct {
+	remaining int
+}
+
+func (reader *failingReader) Read(p []byte) (int, error) {
+	if reader.remaining <= 0 {
+		return 0, errors.New("connection reset")
+	}
+
+	n := min(len(p), reader.remaining)
+	for i := range p[:n] {
+		p[i] = 'a'
+	}
+	reader.remaining -= n
+	return n, nil
+}
+
+func TestFailedMultipartUploadIsAborted(t *testing.T) {
+	var tests = []struct {
+		desc              string
+		leavePartsOnError bool
+		incompleteUploads int
+	}{
+		{desc: "default_uploader_aborts", incompleteUploads: 0},
+		{desc: "caller_uploader_leaves_parts", leavePartsOnError: true, incompleteUploads: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			sqsFake := NewSQS()
+			s3Fake := NewS3(Bucket)
+			queueUrl := sqsFake.CreateQueue("MyQueue", 0)
+			ctx := context.TODO()
+
+			// the LeavePartsOnError setting of the uploader of the caller is kept
+			uploader := manager.NewUploader(s3Fake, func(uploader *manager.Uploader) {
+				uploader.LeavePartsOnError = tt.leavePartsOnError
+			})
+			wrapper, err := hefty.NewSqsClientWrapperFromAPI(sqsFake, s3Fake, Bucket, hefty.WithUploader(uploader))
+			assert.NoError(t, err)
+
+			// the body fails at 90%
+			size := 20 * 1024 * 1024
+			_, err = wrapper.SendHeftyMessageStream(ctx, queueUrl, &failingReader{remaining: size * 9 / 10}, int64(size), nil)
+			assert.Error(t, err)
+			assert.Empty(t, s3Fake.Keys(Bucket))
+			assert.Equal(t, tt.incompleteUploads, s3Fake.IncompleteUploads())
+			assert.Empty(t, sqsFake.Bodies(queueUrl))
+		})
+	}
+}
+
+// concurrencyTrackingS3 records the highest number of concurrent PutObject calls of the fake
+type concurrencyTrackingS3 struct {
+	*S3
+	mu      sync.Mutex
+	current int
+	highest int
+}
+
+func (fake *concurrencyTrackingS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	fake.mu.Lock()
+	fake.current++
+	fake.highest = max(fake.highest, fake.current)
+	fake.mu.Unlock()
+	defer func() {
+		fake.mu.Lock()
+		fake.current--
+		fake.mu.Unlock()
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	return fake.S3.PutObject(ctx, params, optFns...)
+}
+
+func TestSharedTransferLimiter(t *testing.T) {
+	sqsFake := NewSQS()
+	s3Fake := &concurrencyTrackingS3{S3: NewS3(Bucket)}
+	queueUrl := sqsFake.CreateQueue("MyQueue", 0)
+	limiter := hefty.NewTransferLimiter(2)
+
+	// both wrappers share the limit
+	var wrappers []*hefty.SqsClientWrapper
+	for i := 0; i < 2; i++ {
+		wrapper, err := hefty.NewSqsClientWrapperFromAPI(sqsFake, s3Fake, Bucket, hefty.WithTransferLimiter(limiter))
+		assert.NoError(t, err)
+		wrappers = append(wrappers, wrapper)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(wrapper *hefty.SqsClientWrapper) {
+			defer wg.Done()
+			_, err := wrapper.SendHeftyMessage(context.TODO(), &sqs.SendMessageInput{QueueUrl: aws.String(queueUrl), MessageBody: aws.String(strings.Repeat("a", 300*1024))})
+			assert.NoError(t, err)
+		}(wrappers[i%2])
+	}
+	wg.Wait()
+
+	assert.Len(t, s3Fake.Keys(Bucket), 10)
+	assert.Equal(t, 2, s3Fake.highest)
+	assert.Equal(t, 0, limiter.InFlight())
+}
+
+func TestDeleteHeftyMessageOfTenant(t *testing.T) {
+	sqsFake := NewSQS()
+	s3Fake := NewS3(Bucket)
+	queueUrl := sqsFake.CreateQueue("MyQueue", 0)
+	ctx := context.TODO()
+
+	// the tenant is taken from a message attribute, so it cannot be extracted for a delete
+	extractor := func(params *sqs.SendMessageInput) string {
+		return aws.ToString(params.MessageAttributes["tenant"].StringValue)
+	}
+	wrapper, err := hefty.NewSqsClientWrapperFromAPI(sqsFake, s3Fake, Bucket, hefty.AlwaysSendToS3(), hefty.WithTenantExtractor(extractor))
+	assert.NoError(t, err)
+
+	_, err = wrapper.SendHeftyMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:          aws.String(queueUrl),
+		MessageBody:       aws.String("hefty message"),
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{"tenant": {DataType: aws.String("String"), StringValue: aws.String("acme")}},
+	})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(s3Fake.Keys(Bucket)[0], "acme/"))
+
+	out, err := wrapper.ReceiveHeftyMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueUrl)})
+	assert.NoError(t, err)
+	assert.Len(t, out.Messages, 1)
+	input := &sqs.DeleteMessageInput{QueueUrl: aws.String(queueUrl), ReceiptHandle: out.Messages[0].ReceiptHandle}
+
+	// deletes without the tenant of the hefty message are refused
+	_, err = wrapper.DeleteHeftyMessage(ctx, input)
+	assert.Error(t, err)
+	_, err = wrapper.DeleteHeftyMessage(hefty.ContextWithTenant(ctx, "other"), input)
+	assert.Error(t, err)
+	assert.Len(t, s3Fake.Keys(Bucket), 1)
+
+	_, err = wrapper.DeleteHeftyMessage(hefty.ContextWithTenant(ctx, "acme"), input)
+	assert.NoError(t, err)
+	assert.Empty(t, s3Fake.Keys(Bucket))
+	assert.Empty(t, sqsFake.Bodies(queueUrl))
+}
@@ -0,0 +1,72 @@
+package heftytest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/jo-parker/sqs-hefty"
+)
+
+// StoreBackend is the name of the backend of PayloadStore recorded in reference messages
+const StoreBackend = "memory"
+
+var _ hefty.PayloadStore = (*PayloadStore)(nil)
+
+// PayloadStore is an in-memory hefty.PayloadStore for tests of code that uses WithPayloadStore
+type PayloadStore struct {
+	mu       sync.Mutex
+	payloads map[string][]byte
+}
+
+// NewPayloadStore creates an empty in-memory payload store
+func NewPayloadStore() *PayloadStore {
+	return &PayloadStore{payloads: map[string][]byte{}}
+}
+
+func (store *PayloadStore) Backend() string {
+	return StoreBackend
+}
+
+func (store *PayloadStore) Put(_ context.Context, key string, payload []byte) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.payloads[key] = append([]byte(nil), payload...)
+	return nil
+}
+
+func (store *PayloadStore) Get(_ context.Context, key string) ([]byte, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	payload, ok := store.payloads[key]
+	if !ok {
+		return nil, fmt.Errorf("hefty message %s does not exist", key)
+	}
+
+	return payload, nil
+}
+
+func (store *PayloadStore) Delete(_ context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.payloads, key)
+	return nil
+}
+
+// Keys returns the sorted keys of the stored hefty messages
+func (store *PayloadStore) Keys() []string {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	keys := make([]string, 0, len(store.payloads))
+	for key := range store.payloads {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,135 @@
+package hefty
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// ImportInput is the directory Import reads and the queue the messages are sent to
+type ImportInput struct {
+	// Dir is a directory written by Export.
+	Dir string
+	// QueueUrl is the queue the messages are sent to, which can be in another account or region than the exported queue.
+	QueueUrl string
+}
+
+// ImportOutput is the output of Import
+type ImportOutput struct {
+	// Imported is the number of messages sent.
+	Imported int
+	// Skipped is the number of messages not sent since their hefty message could not be resolved when they were exported.
+	Skipped int
+}
+
+// importedMessage is a message read from an export directory
+type importedMessage struct {
+	ExportedMessage
+	body string
+}
+
+// Import sends the messages of a directory written by Export to a queue with SendHeftyMessage, e.g. to migrate a queue
+// between accounts or regions. Large messages are stored as new hefty messages by the wrapper, so the hefty messages of
+// the exported queue are not needed. Messages are sent in the order they were originally sent. Messages sent to a FIFO
+// queue keep their message group id and are deduplicated by their original message id.
+//
+// Messages whose hefty message could not be resolved when they were exported are skipped. The import stops at the first
+// message that cannot be sent; the directory is not changed, so messages imported before are sent again when the
+// import is repeated, unless they are deduplicated by a FIFO queue.
+func (wrapper *SqsClientWrapper) Import(ctx context.Context, input *ImportInput, optFns ...func(*sqs.Options)) (*ImportOutput, error) {
+	msgs, err := readExport(input.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &ImportOutput{}
+	for _, msg := range msgs {
+		if msg.Error != "" {
+			output.Skipped++
+			continue
+		}
+
+		_, err = wrapper.SendHeftyMessage(ctx, redriveInput(msg.sqsMessage(), input.QueueUrl), optFns...)
+		if err != nil {
+			return output, fmt.Errorf("unable to send message %s to %s. %v", msg.MessageId, input.QueueUrl, err)
+		}
+		output.Imported++
+	}
+
+	return output, nil
+}
+
+// readExport reads the messages of an export directory sorted by the time they were originally sent
+func readExport(dir string) ([]importedMessage, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read export directory %s. %v", dir, err)
+	}
+
+	var msgs []importedMessage
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		metadata, err := os.ReadFile(filepath.Join(dir, entry.Name(), exportMetadataFile))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read metadata of message %s. %v", entry.Name(), err)
+		}
+
+		var msg importedMessage
+		if err = json.Unmarshal(metadata, &msg.ExportedMessage); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal metadata of message %s. %v", entry.Name(), err)
+		}
+
+		body, err := os.ReadFile(filepath.Join(dir, entry.Name(), exportBodyFile))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read body of message %s. %v", entry.Name(), err)
+		}
+		msg.body = string(body)
+
+		msgs = append(msgs, msg)
+	}
+
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].sentTimestamp() < msgs[j].sentTimestamp()
+	})
+
+	return msgs, nil
+}
+
+// sentTimestamp returns the epoch time in milliseconds the message was originally sent, or 0 when it is unknown
+func (msg importedMessage) sentTimestamp() int64 {
+	timestamp, _ := strconv.ParseInt(msg.Attributes[string(sqstypes.MessageSystemAttributeNameSentTimestamp)], 10, 64)
+	return timestamp
+}
+
+// sqsMessage returns the message as if it was received from the exported queue
+func (msg importedMessage) sqsMessage() *sqstypes.Message {
+	var msgAttributes map[string]sqstypes.MessageAttributeValue
+	if len(msg.MessageAttributes) > 0 {
+		msgAttributes = make(map[string]sqstypes.MessageAttributeValue, len(msg.MessageAttributes))
+		for name, value := range msg.MessageAttributes {
+			msgAttributes[name] = sqstypes.MessageAttributeValue{
+				DataType:    aws.String(value.DataType),
+				StringValue: value.StringValue,
+				BinaryValue: value.BinaryValue,
+			}
+		}
+	}
+
+	return &sqstypes.Message{
+		MessageId:         aws.String(msg.MessageId),
+		Body:              aws.String(msg.body),
+		Attributes:        msg.Attributes,
+		MessageAttributes: msgAttributes,
+	}
+}
@@ -0,0 +1,43 @@
+package hefty
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadExport(t *testing.T) {
+	input := &ExportInput{QueueUrl: "https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue.fifo", Dir: t.TempDir()}
+	output := &ExportOutput{}
+
+	exported := []InspectedMessage{
+		{MessageId: "second", Body: aws.String("second message"), Attributes: map[string]string{"SentTimestamp": "1700000002000", "MessageGroupId": "group"}},
+		{MessageId: "first", Body: aws.String("first message"), Attributes: map[string]string{"SentTimestamp": "1700000001000", "MessageGroupId": "group"},
+			MessageAttributes: map[string]sqstypes.MessageAttributeValue{"attr": {DataType: aws.String("String"), StringValue: aws.String("value")}}},
+		{MessageId: "failed", Body: aws.String("reference message"), Attributes: map[string]string{"SentTimestamp": "1700000003000"}, Err: errors.New("access denied")},
+	}
+	for _, msg := range exported {
+		assert.Nil(t, output.write(input, msg))
+	}
+
+	msgs, err := readExport(input.Dir)
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 3)
+	assert.Equal(t, "first", msgs[0].MessageId)
+	assert.Equal(t, "second", msgs[1].MessageId)
+	assert.Equal(t, "failed", msgs[2].MessageId)
+	assert.Equal(t, "access denied", msgs[2].Error)
+
+	params := redriveInput(msgs[0].sqsMessage(), input.QueueUrl)
+	assert.Equal(t, "first message", aws.ToString(params.MessageBody))
+	assert.Equal(t, "value", aws.ToString(params.MessageAttributes["attr"].StringValue))
+	assert.Equal(t, "String", aws.ToString(params.MessageAttributes["attr"].DataType))
+	assert.Equal(t, "group", aws.ToString(params.MessageGroupId))
+	assert.Equal(t, "first", aws.ToString(params.MessageDeduplicationId))
+
+	_, err = readExport(t.TempDir() + "/missing")
+	assert.NotNil(t, err)
+}
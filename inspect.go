@@ -0,0 +1,122 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// inspectVisibilityTimeout is the visibility timeout in seconds of messages while they are inspected. Messages are made
+// visible again as soon as the inspection is done.
+const inspectVisibilityTimeout = 30
+
+// InspectedMessage is a message of a queue with its hefty message resolved
+type InspectedMessage struct {
+	MessageId string
+	// Body and MessageAttributes are those of the original message, or of the reference message when Err is set.
+	Body              *string
+	MessageAttributes map[string]sqstypes.MessageAttributeValue
+	// Attributes are the system attributes of the message, e.g. ApproximateReceiveCount and SentTimestamp.
+	Attributes map[string]string
+	// Bucket, Key, Backend and VersionId are the location of the hefty message, or empty when the message was not stored.
+	Bucket    string
+	Key       string
+	Backend   string
+	VersionId string
+	// Counted is set when the reference to the hefty message is counted; see WithReferenceCounter.
+	Counted bool
+	// Err is why the message could not be resolved.
+	Err error
+}
+
+// Inspect peeks at up to `maxMessages` messages of a queue, usually a dead-letter queue, and resolves their hefty messages,
+// so that it can be seen what actually failed. Nothing is consumed or deleted: hefty messages are only read, and the
+// messages are made visible again once they were inspected. Messages that cannot be resolved are returned with Err set.
+//
+// Receiving a message increases its receive count, so messages of a queue with a redrive policy of its own can be moved
+// to its dead-letter queue by an inspection. Messages of a FIFO queue can only be inspected one message group at a time.
+func (wrapper *SqsClientWrapper) Inspect(ctx context.Context, queueUrl string, maxMessages int, optFns ...func(*sqs.Options)) ([]InspectedMessage, error) {
+	optFns = wrapper.withOptFns(optFns)
+
+	var inspected []InspectedMessage
+	var receiptHandles []*string
+	defer func() {
+		// make the inspected messages visible again; this is best effort since they become visible after the timeout anyway
+		for _, receiptHandle := range receiptHandles {
+			_, _ = wrapper.sqsClient().ChangeMessageVisibility(context.WithoutCancel(ctx), &sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          aws.String(queueUrl),
+				ReceiptHandle:     receiptHandle,
+				VisibilityTimeout: 0,
+			}, optFns...)
+		}
+	}()
+
+	for len(inspected) < maxMessages {
+		out, err := wrapper.sqsClient().ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(queueUrl),
+			MaxNumberOfMessages:   int32(min(maxMessages-len(inspected), 10)),
+			VisibilityTimeout:     inspectVisibilityTimeout,
+			AttributeNames:        []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameAll},
+			MessageAttributeNames: []string{"All"},
+		}, optFns...)
+		if err != nil {
+			return inspected, fmt.Errorf("unable to receive messages from %s. %v", queueUrl, err)
+		}
+		if len(out.Messages) == 0 {
+			break
+		}
+
+		for _, msg := range out.Messages {
+			receiptHandles = append(receiptHandles, msg.ReceiptHandle)
+			inspected = append(inspected, wrapper.inspectMessage(ctx, queueUrl, msg))
+		}
+	}
+
+	return inspected, nil
+}
+
+// inspectMessage resolves the hefty message of a message received from `queueUrl`
+func (wrapper *SqsClientWrapper) inspectMessage(ctx context.Context, queueUrl string, msg sqstypes.Message) InspectedMessage {
+	inspected := InspectedMessage{
+		MessageId:         aws.ToString(msg.MessageId),
+		Body:              msg.Body,
+		MessageAttributes: msg.MessageAttributes,
+		Attributes:        msg.Attributes,
+	}
+
+	switch body := aws.ToString(msg.Body); {
+	case types.IsInlineMsg(body):
+		decompressed, err := decompressInline(ctx, wrapper.offload, wrapper.storage.transforms, body)
+		if err != nil {
+			inspected.Err = err
+			return inspected
+		}
+		inspected.Body = aws.String(decompressed)
+	case types.IsReferenceMsg(body):
+		refMsg, err := types.ToReferenceMsg(body)
+		if err != nil {
+			inspected.Err = fmt.Errorf("unable to unmarshal reference message. %v", err)
+			return inspected
+		}
+		inspected.Bucket = refMsg.S3Bucket
+		inspected.Key = refMsg.S3Key
+		inspected.Backend = refMsg.Backend
+		inspected.VersionId = refMsg.S3VersionId
+		inspected.Counted = refMsg.Counted
+
+		heftyMsg, err := wrapper.storage.getHeftyMessage(ctx, queueUrl, refMsg)
+		if err != nil {
+			inspected.Err = err
+			return inspected
+		}
+		inspected.Body = heftyMsg.Body
+		inspected.MessageAttributes = messages.MapToSqsMessageAttributeValues(heftyMsg.MessageAttributes)
+	}
+
+	return inspected
+}
@@ -0,0 +1,66 @@
+package hefty
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSqsClientWrapperInspectMessage(t *testing.T) {
+	store := &memoryStore{payloads: map[string][]byte{}}
+	wrapper := &SqsClientWrapper{storage: &payloadStorage{payloadStore: store, payloadMaxSize: 1024}}
+
+	heftyMsg := messages.NewHeftyMessage(aws.String("hefty message"), map[string]messages.MessageAttributeValue{
+		"attr": {DataType: aws.String("String"), StringValue: aws.String("value")},
+	}, 13)
+	serialized, _, _, err := heftyMsg.Serialize()
+	assert.Nil(t, err)
+	bodyDigest, attrDigest, err := messageDigests("", serialized, heftyMsg)
+	assert.Nil(t, err)
+
+	refMsg := types.NewReferenceMsg("", "", "queue/id", bodyDigest, attrDigest)
+	err = wrapper.storage.put(context.TODO(), "queue", "", refMsg, serialized, nil, nil)
+	assert.Nil(t, err)
+	jsonRefMsg, err := json.Marshal(refMsg)
+	assert.Nil(t, err)
+
+	missingRefMsg := types.NewReferenceMsg("", "", "queue/missing", bodyDigest, "")
+	missingRefMsg.Backend = "memory"
+	missing, err := json.Marshal(missingRefMsg)
+	assert.Nil(t, err)
+
+	var tests = []struct {
+		desc     string
+		body     string
+		expBody  string
+		expKey   string
+		expAttrs bool
+		expErr   bool
+	}{
+		{desc: "plain", body: "plain message", expBody: "plain message"},
+		{desc: "reference", body: string(jsonRefMsg), expBody: "hefty message", expKey: "queue/id", expAttrs: true},
+		{desc: "missing_hefty_message", body: string(missing), expBody: string(missing), expKey: "queue/missing", expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			inspected := wrapper.inspectMessage(context.TODO(), "queue", sqstypes.Message{
+				MessageId:  aws.String("message-id"),
+				Body:       aws.String(tt.body),
+				Attributes: map[string]string{"ApproximateReceiveCount": "3"},
+			})
+			assert.Equal(t, "message-id", inspected.MessageId)
+			assert.Equal(t, tt.expBody, aws.ToString(inspected.Body))
+			assert.Equal(t, tt.expKey, inspected.Key)
+			assert.Equal(t, "3", inspected.Attributes["ApproximateReceiveCount"])
+			assert.Equal(t, tt.expAttrs, inspected.MessageAttributes["attr"].StringValue != nil)
+			assert.Equal(t, tt.expErr, inspected.Err != nil)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	minArchiveAccessDays     = 90  // minimum days of no access before the Archive Access tier allowed by AWS S3
+	minDeepArchiveAccessDays = 180 // minimum days of no access before the Deep Archive Access tier allowed by AWS S3
+	maxArchiveDays           = 730
+)
+
+// IntelligentTieringArchive describes the AWS S3 Intelligent-Tiering archive access tiers of hefty messages that are
+// kept long-term, e.g. for audits. Note that hefty messages in an archive access tier must be restored before they can
+// be received.
+type IntelligentTieringArchive struct {
+	Id                    string // id of the Intelligent-Tiering configuration of the bucket
+	Prefix                string // key prefix of the hefty messages the configuration applies to
+	ArchiveAccessDays     int32  // days of no access before moving to the Archive Access tier; 0 disables the tier
+	DeepArchiveAccessDays int32  // days of no access before moving to the Deep Archive Access tier; 0 disables the tier
+}
+
+// ConfigureIntelligentTiering creates or replaces the Intelligent-Tiering configuration `archive.Id` of `bucket` so that
+// hefty messages under `archive.Prefix` move to the configured archive access tiers. Hefty messages must be uploaded with
+// the INTELLIGENT_TIERING storage class and the prefix, which the options returned by archive.Options take care of.
+func ConfigureIntelligentTiering(ctx context.Context, s3Client *s3.Client, bucket string, archive IntelligentTieringArchive, optFns ...func(*s3.Options)) error {
+	config, err := archive.configuration()
+	if err != nil {
+		return err
+	}
+
+	_, err = s3Client.PutBucketIntelligentTieringConfiguration(ctx, &s3.PutBucketIntelligentTieringConfigurationInput{
+		Bucket:                          aws.String(bucket),
+		Id:                              config.Id,
+		IntelligentTieringConfiguration: config,
+	}, optFns...)
+	if err != nil {
+		return fmt.Errorf("unable to put intelligent tiering configuration %s on bucket %s. %v", archive.Id, bucket, err)
+	}
+
+	return nil
+}
+
+// Options returns the options that upload hefty messages with the INTELLIGENT_TIERING storage class under the prefix of
+// the archive configuration. Other key prefix and storage class options should not be used together with them.
+func (archive IntelligentTieringArchive) Options() []Option {
+	return []Option{
+		WithStorageClass(s3types.StorageClassIntelligentTiering),
+		WithKeyPrefix(archive.Prefix),
+	}
+}
+
+func (archive IntelligentTieringArchive) configuration() (*s3types.IntelligentTieringConfiguration, error) {
+	if archive.Id == "" {
+		return nil, errors.New("intelligent tiering configuration id must not be empty")
+	}
+
+	var tierings []s3types.Tiering
+	if archive.ArchiveAccessDays != 0 {
+		if archive.ArchiveAccessDays < minArchiveAccessDays || archive.ArchiveAccessDays > maxArchiveDays {
+			return nil, fmt.Errorf("archive access days of %d must be between %d and %d", archive.ArchiveAccessDays, minArchiveAccessDays, maxArchiveDays)
+		}
+		tierings = append(tierings, s3types.Tiering{
+			AccessTier: s3types.IntelligentTieringAccessTierArchiveAccess,
+			Days:       aws.Int32(archive.ArchiveAccessDays),
+		})
+	}
+	if archive.DeepArchiveAccessDays != 0 {
+		if archive.DeepArchiveAccessDays < minDeepArchiveAccessDays || archive.DeepArchiveAccessDays > maxArchiveDays {
+			return nil, fmt.Errorf("deep archive access days of %d must be between %d and %d", archive.DeepArchiveAccessDays, minDeepArchiveAccessDays, maxArchiveDays)
+		}
+		if archive.ArchiveAccessDays != 0 && archive.DeepArchiveAccessDays <= archive.ArchiveAccessDays {
+			return nil, errors.New("deep archive access days must be greater than archive access days")
+		}
+		tierings = append(tierings, s3types.Tiering{
+			AccessTier: s3types.IntelligentTieringAccessTierDeepArchiveAccess,
+			Days:       aws.Int32(archive.DeepArchiveAccessDays),
+		})
+	}
+	if len(tierings) == 0 {
+		return nil, errors.New("at least one archive access tier must be enabled")
+	}
+
+	config := &s3types.IntelligentTieringConfiguration{
+		Id:       aws.String(archive.Id),
+		Status:   s3types.IntelligentTieringStatusEnabled,
+		Tierings: tierings,
+	}
+	if archive.Prefix != "" {
+		config.Filter = &s3types.IntelligentTieringFilter{Prefix: aws.String(archive.Prefix)}
+	}
+
+	return config, nil
+}
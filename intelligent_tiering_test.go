@@ -0,0 +1,36 @@
+package hefty
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntelligentTieringArchiveConfiguration(t *testing.T) {
+	var tests = []struct {
+		desc        string
+		archive     IntelligentTieringArchive
+		expTierings int
+		expErr      bool
+	}{
+		{desc: "archive_and_deep_archive", archive: IntelligentTieringArchive{Id: "hefty", Prefix: "hefty/", ArchiveAccessDays: 90, DeepArchiveAccessDays: 180}, expTierings: 2},
+		{desc: "deep_archive_only", archive: IntelligentTieringArchive{Id: "hefty", DeepArchiveAccessDays: 365}, expTierings: 1},
+		{desc: "missing_id", archive: IntelligentTieringArchive{ArchiveAccessDays: 90}, expErr: true},
+		{desc: "no_tiers", archive: IntelligentTieringArchive{Id: "hefty"}, expErr: true},
+		{desc: "archive_below_minimum", archive: IntelligentTieringArchive{Id: "hefty", ArchiveAccessDays: 30}, expErr: true},
+		{desc: "deep_archive_before_archive", archive: IntelligentTieringArchive{Id: "hefty", ArchiveAccessDays: 200, DeepArchiveAccessDays: 180}, expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			config, err := tt.archive.configuration()
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Len(t, config.Tierings, tt.expTierings)
+			assert.Equal(t, tt.archive.Prefix != "", config.Filter != nil)
+		})
+	}
+}
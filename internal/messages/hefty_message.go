@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
 )
 
 // HeftyMessage is an AWS SQS or AWS SNS message that is over 256KB and needs to be stored in AWS S3
@@ -15,6 +17,9 @@ type HeftyMessage struct {
 	Size              int
 }
 
+// FormatVersion is the version of the serialized hefty message format
+const FormatVersion = 1
+
 const (
 	lengthSize                    = 4
 	transportTypeSize             = 1
@@ -39,9 +44,8 @@ func NewHeftyMessage(body *string, msgAttributes map[string]MessageAttributeValu
 |---once----|-----------------------------------------zero or more------------------------------------------|
 */
 func (msg *HeftyMessage) Serialize() (serialized []byte, bodyOffset int, msgAttrOffset int, err error) {
-	// create a buffer
-	b := make([]byte, 0, msg.Size+lengthSize+(len(msg.MessageAttributes)*(numLengthSizesPerMsgAttr*lengthSize+transportTypeSize)))
-	buf := bytes.NewBuffer(b)
+	// create a buffer of the serialized size, so the body is copied once
+	buf := bytes.NewBuffer(make([]byte, 0, msg.serializedSize()))
 
 	// write body
 	err = writeNext(buf, msg.Body)
@@ -122,47 +126,48 @@ func (msg *HeftyMessage) Serialize() (serialized []byte, bodyOffset int, msgAttr
 	return
 }
 
+// serializedSize returns the number of bytes of the serialized hefty message
+func (msg *HeftyMessage) serializedSize() int {
+	size := lengthSize + len(*msg.Body)
+	for k, v := range msg.MessageAttributes {
+		size += numLengthSizesPerMsgAttr*lengthSize + transportTypeSize + len(k) + len(aws.ToString(v.DataType)) + len(aws.ToString(v.StringValue)) + len(v.BinaryValue)
+	}
+
+	return size
+}
+
+// Offsets returns the offsets of the message body and message attributes within the serialized hefty message
+func (msg *HeftyMessage) Offsets() (bodyOffset int, msgAttrOffset int) {
+	return lengthSize, lengthSize + len(*msg.Body)
+}
+
 func writeNext(buf *bytes.Buffer, data any) error {
 	var err error
 
 	switch v := data.(type) {
 	case *string:
-		err = binary.Write(buf, binary.BigEndian, int32(len(*v)))
-		if err != nil {
-			return err
-		}
+		writeLength(buf, len(*v))
 		_, err = buf.WriteString(*v)
-		if err != nil {
-			return err
-		}
 	case []byte:
-		err = binary.Write(buf, binary.BigEndian, int32(len(v)))
-		if err != nil {
-			return err
-		}
+		writeLength(buf, len(v))
 		_, err = buf.Write(v)
-		if err != nil {
-			return err
-		}
 	case string:
-		err = binary.Write(buf, binary.BigEndian, int32(len(v)))
-		if err != nil {
-			return err
-		}
+		writeLength(buf, len(v))
 		_, err = buf.WriteString(v)
-		if err != nil {
-			return err
-		}
 	case byte:
 		err = buf.WriteByte(v)
-		if err != nil {
-			return err
-		}
 	default:
 		return fmt.Errorf("unknown type to serialize")
 	}
 
-	return nil
+	return err
+}
+
+// writeLength writes a big endian length prefix
+func writeLength(buf *bytes.Buffer, length int) {
+	var prefix [lengthSize]byte
+	binary.BigEndian.PutUint32(prefix[:], uint32(length))
+	buf.Write(prefix[:])
 }
 
 /*
@@ -171,19 +176,40 @@ func writeNext(buf *bytes.Buffer, data any) error {
 |---once----|-----------------------------------------zero or more------------------------------------------|
 */
 func DeserializeHeftyMessage(in []byte) (*HeftyMessage, error) {
-	reader := bytes.NewReader(in)
+	// read body; it is copied once from the serialized hefty message
+	if len(in) < lengthSize {
+		return nil, fmt.Errorf("unable to read body during deserialization")
+	}
+	msgAttrOffset := lengthSize + int(binary.BigEndian.Uint32(in))
+	if msgAttrOffset < lengthSize || msgAttrOffset > len(in) {
+		return nil, fmt.Errorf("unable to read body during deserialization")
+	}
+	body := string(in[lengthSize:msgAttrOffset])
 
-	var data []byte
-	var ok bool
+	// read message attributes
+	msgAttr, err := deserializeMessageAttributes(bytes.NewReader(in[msgAttrOffset:]))
+	if err != nil {
+		return nil, err
+	}
 
-	// read body
-	var body string
-	if data, ok = readNext(reader); ok {
-		body = string(data)
-	} else {
-		return nil, fmt.Errorf("unable to read body during deserialization")
+	msgSize, err := MessageSize(&body, msgAttr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to calculate message size during deserialization. %v", err)
 	}
 
+	return NewHeftyMessage(&body, msgAttr, msgSize), nil
+}
+
+// DeserializeMessageAttributes deserializes the message attributes that follow the body of a serialized hefty message, so
+// that the message attributes of a hefty message can be read without its body
+func DeserializeMessageAttributes(in []byte) (map[string]MessageAttributeValue, error) {
+	return deserializeMessageAttributes(bytes.NewReader(in))
+}
+
+func deserializeMessageAttributes(reader *bytes.Reader) (map[string]MessageAttributeValue, error) {
+	var data []byte
+	var ok bool
+
 	// create message attributes
 	var msgAttr map[string]MessageAttributeValue
 	if reader.Len() > 0 {
@@ -233,12 +259,7 @@ func DeserializeHeftyMessage(in []byte) (*HeftyMessage, error) {
 		}
 	}
 
-	msgSize, err := MessageSize(&body, msgAttr)
-	if err != nil {
-		return nil, fmt.Errorf("unable to calculate message size during deserialization. %v", err)
-	}
-
-	return NewHeftyMessage(&body, msgAttr, msgSize), nil
+	return msgAttr, nil
 }
 
 func readNext(reader *bytes.Reader) ([]byte, bool) {
@@ -31,6 +31,7 @@ func TestHeftyMessageSerializeAndDeserialize(t *testing.T) {
 		t.Fatalf("error when trying to serialize. %v", err)
 	}
 	assert.Len(t, serialized, heftyMsg.Size+lengthSize+(len(heftyMsg.MessageAttributes)*(numLengthSizesPerMsgAttr*lengthSize+transportTypeSize)))
+	assert.Equal(t, len(serialized), cap(serialized), "buffer is allocated once")
 	assert.Equal(t, "098f6bcd4621d373cade4e832627b4f6", Md5Digest(serialized[bodyOffset:msgAttrOffset]))
 	if len(heftyMsg.MessageAttributes) > 0 {
 		assert.Equal(t, "ae83a9fd2e99604a8073446145c4c523", Md5Digest(serialized[msgAttrOffset:]))
@@ -42,4 +43,35 @@ func TestHeftyMessageSerializeAndDeserialize(t *testing.T) {
 	}
 
 	assert.Equal(t, heftyMsg, dMsg)
+
+	dAttributes, err := DeserializeMessageAttributes(serialized[msgAttrOffset:])
+	assert.Nil(t, err)
+	assert.Equal(t, attributes, dAttributes)
+
+	// test offsets and digest verification
+	dBodyOffset, dMsgAttrOffset := dMsg.Offsets()
+	assert.Equal(t, bodyOffset, dBodyOffset)
+	assert.Equal(t, msgAttrOffset, dMsgAttrOffset)
+	assert.True(t, VerifyMd5Digests(serialized, dMsg, "098f6bcd4621d373cade4e832627b4f6", "ae83a9fd2e99604a8073446145c4c523"))
+	assert.False(t, VerifyMd5Digests(serialized, dMsg, "098f6bcd4621d373cade4e832627b4f6", ""))
+	assert.False(t, VerifyMd5Digests(serialized[:msgAttrOffset-1], dMsg, "098f6bcd4621d373cade4e832627b4f6", "ae83a9fd2e99604a8073446145c4c523"))
+}
+
+func TestDeserializeHeftyMessageMalformed(t *testing.T) {
+	tests := []struct {
+		desc string
+		in   []byte
+	}{
+		{desc: "empty", in: []byte{}},
+		{desc: "truncated length", in: []byte{0, 0}},
+		{desc: "truncated body", in: []byte{0, 0, 0, 5, 'a'}},
+		{desc: "truncated attributes", in: []byte{0, 0, 0, 1, 'a', 0, 0, 0, 4, 't'}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := DeserializeHeftyMessage(tt.in)
+			assert.NotNil(t, err)
+		})
+	}
 }
@@ -0,0 +1,68 @@
+package messages
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Md5OfMessageBody returns the md5 digest of a message body the way AWS SQS calculates MD5OfMessageBody
+func Md5OfMessageBody(body string) (string, error) {
+	return DigestString(DigestMd5, body)
+}
+
+// Md5OfMessageAttributes returns the md5 digest of message attributes the way AWS SQS calculates MD5OfMessageAttributes,
+// or an empty string when there are no message attributes. Each attribute is encoded in order of its name as the length
+// prefixed name, the length prefixed data type, a transport type byte and the length prefixed value.
+// See https://docs.aws.amazon.com/AWSSimpleQueueService/latest/SQSDeveloperGuide/sqs-message-metadata.html#sqs-attributes-md5-message-digest-calculation
+func Md5OfMessageAttributes(msgAttr map[string]MessageAttributeValue) (digest string, err error) {
+	if len(msgAttr) == 0 {
+		return "", nil
+	}
+
+	names := make([]string, 0, len(msgAttr))
+	for name := range msgAttr {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		value := msgAttr[name]
+		dataType := aws.ToString(value.DataType)
+
+		writeLengthPrefixed(&buf, []byte(name))
+		writeLengthPrefixed(&buf, []byte(dataType))
+		switch {
+		case strings.HasPrefix(dataType, "String") || strings.HasPrefix(dataType, "Number"):
+			buf.WriteByte(stringTransportType)
+			writeLengthPrefixed(&buf, []byte(aws.ToString(value.StringValue)))
+		case strings.HasPrefix(dataType, "Binary"):
+			buf.WriteByte(binaryTransportType)
+			writeLengthPrefixed(&buf, value.BinaryValue)
+		default:
+			return "", fmt.Errorf(ErrUnexpectedDataType, dataType)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("md5 is not available. %v", r)
+		}
+	}()
+	hash := md5.Sum(buf.Bytes())
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func writeLengthPrefixed(buf *bytes.Buffer, data []byte) {
+	var length [lengthSize]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	buf.Write(length[:])
+	buf.Write(data)
+}
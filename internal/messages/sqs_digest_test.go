@@ -0,0 +1,49 @@
+package messages
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMd5OfMessageAttributes(t *testing.T) {
+	msgAttr := map[string]MessageAttributeValue{
+		"Test01": {DataType: aws.String("String"), StringValue: aws.String("01234")},
+		"Test02": {DataType: aws.String("Binary"), BinaryValue: []byte{0, 1, 2, 3, 4}},
+		"Num":    {DataType: aws.String("Number"), StringValue: aws.String("42")},
+	}
+
+	var tests = []struct {
+		desc      string
+		msgAttr   map[string]MessageAttributeValue
+		expDigest string
+		expErr    bool
+	}{
+		{desc: "no_attributes", expDigest: ""},
+		{desc: "sorted_by_name", msgAttr: msgAttr, expDigest: "05b9146a83097b712e7cfbcac7356acc"},
+		{desc: "invalid_datatype", msgAttr: map[string]MessageAttributeValue{"Test01": {DataType: aws.String("blah")}}, expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			digest, err := Md5OfMessageAttributes(tt.msgAttr)
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expDigest, digest)
+		})
+	}
+
+	// the attribute digest of a serialized hefty message matches the aws algorithm
+	heftyMsg := NewHeftyMessage(aws.String("hello"), msgAttr, 0)
+	serialized, _, msgAttrOffset, err := heftyMsg.Serialize()
+	assert.Nil(t, err)
+	assert.Equal(t, "05b9146a83097b712e7cfbcac7356acc", Md5Digest(serialized[msgAttrOffset:]))
+
+	digest, err := Md5OfMessageBody("hello")
+	assert.Nil(t, err)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", digest)
+}
@@ -2,8 +2,11 @@ package messages
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -13,6 +16,12 @@ const (
 	ErrUnexpectedDataType = "encountered unexpected data type for message attribute: %s"
 )
 
+// digest algorithms of hefty messages
+const (
+	DigestMd5    = "md5"
+	DigestSha256 = "sha256"
+)
+
 func MessageSize(msg *string, msgAttr map[string]MessageAttributeValue) (int, error) {
 	var size int
 	if msg != nil {
@@ -39,3 +48,101 @@ func Md5Digest(buf []byte) string {
 	hash := md5.Sum(buf)
 	return hex.EncodeToString(hash[:])
 }
+
+// Digest returns the hex encoded digest of `buf` using `algorithm`, where an empty algorithm is md5. An error is returned
+// instead of panicking when md5 is not available, e.g. in FIPS only builds.
+func Digest(algorithm string, buf []byte) (digest string, err error) {
+	switch algorithm {
+	case "", DigestMd5:
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("md5 is not available. %v", r)
+			}
+		}()
+		return Md5Digest(buf), nil
+	case DigestSha256:
+		hash := sha256.Sum256(buf)
+		return hex.EncodeToString(hash[:]), nil
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm %s", algorithm)
+	}
+}
+
+// DigestReader returns the hex encoded digest of the bytes read from `r` using `algorithm` like Digest, without holding
+// them in memory
+func DigestReader(algorithm string, r io.Reader) (string, error) {
+	h, err := NewDigestHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DigestString returns the hex encoded digest of `s` using `algorithm` like Digest, without copying `s` to a byte slice
+// of the same size
+func DigestString(algorithm string, s string) (string, error) {
+	h, err := NewDigestHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	var chunk [32 * 1024]byte
+	for len(s) > 0 {
+		n := copy(chunk[:], s)
+		h.Write(chunk[:n])
+		s = s[n:]
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NewDigestHash returns the hash of `algorithm` like Digest, for digests of bytes written as they are streamed
+func NewDigestHash(algorithm string) (h hash.Hash, err error) {
+	switch algorithm {
+	case "", DigestMd5:
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("md5 is not available. %v", r)
+			}
+		}()
+		return md5.New(), nil
+	case DigestSha256:
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported digest algorithm %s", algorithm)
+	}
+}
+
+// VerifyMd5Digests determines if the md5 digests of the message body and message attributes of a serialized hefty message
+// match the expected digests. The digest of the message attributes is expected to be empty when there are no attributes.
+func VerifyMd5Digests(serialized []byte, msg *HeftyMessage, md5Body, md5Attr string) bool {
+	ok, err := VerifyDigests(DigestMd5, serialized, msg, md5Body, md5Attr)
+	return ok && err == nil
+}
+
+// VerifyDigests determines if the digests of the message body and message attributes of a serialized hefty message
+// match the expected digests using `algorithm`. The digest of the message attributes is expected to be empty when there
+// are no attributes.
+func VerifyDigests(algorithm string, serialized []byte, msg *HeftyMessage, bodyDigest, attrDigest string) (bool, error) {
+	bodyOffset, msgAttrOffset := msg.Offsets()
+	if msgAttrOffset > len(serialized) {
+		return false, nil
+	}
+
+	digest, err := Digest(algorithm, serialized[bodyOffset:msgAttrOffset])
+	if err != nil || digest != bodyDigest {
+		return false, err
+	}
+
+	if len(msg.MessageAttributes) == 0 {
+		return attrDigest == "", nil
+	}
+
+	digest, err = Digest(algorithm, serialized[msgAttrOffset:])
+	return digest == attrDigest, err
+}
@@ -2,6 +2,7 @@ package messages
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -102,3 +103,56 @@ func TestMessageSize(t *testing.T) {
 		})
 	}
 }
+
+func TestDigest(t *testing.T) {
+	var tests = []struct {
+		desc      string
+		algorithm string
+		expDigest string
+		expErr    bool
+	}{
+		{desc: "default", expDigest: "5d41402abc4b2a76b9719d911017c592"},
+		{desc: "md5", algorithm: DigestMd5, expDigest: "5d41402abc4b2a76b9719d911017c592"},
+		{desc: "sha256", algorithm: DigestSha256, expDigest: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{desc: "unsupported", algorithm: "crc32", expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			digest, err := Digest(tt.algorithm, []byte("hello"))
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expDigest, digest)
+
+			digest, err = DigestReader(tt.algorithm, strings.NewReader("hello"))
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expDigest, digest)
+
+			digest, err = DigestString(tt.algorithm, "hello")
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expDigest, digest)
+		})
+	}
+}
+
+func TestVerifyDigests(t *testing.T) {
+	msg := NewHeftyMessage(aws.String("hello"), map[string]MessageAttributeValue{
+		"Test01": {DataType: aws.String("String"), StringValue: aws.String("01234")},
+	}, 20)
+	serialized, bodyOffset, msgAttrOffset, err := msg.Serialize()
+	assert.Nil(t, err)
+
+	bodyDigest, _ := Digest(DigestSha256, serialized[bodyOffset:msgAttrOffset])
+	attrDigest, _ := Digest(DigestSha256, serialized[msgAttrOffset:])
+
+	ok, err := VerifyDigests(DigestSha256, serialized, msg, bodyDigest, attrDigest)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = VerifyDigests(DigestMd5, serialized, msg, bodyDigest, attrDigest)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
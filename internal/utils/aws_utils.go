@@ -11,11 +11,27 @@ import (
 	"github.com/aws/smithy-go"
 )
 
-// bucketExists checks whether a bucket exists in the current account.
-func BucketExists(s3Client *s3.Client, bucketName string) (bool, error) {
-	_, err := s3Client.HeadBucket(context.TODO(), &s3.HeadBucketInput{
-		Bucket: aws.String(bucketName),
-	})
+// BucketClient is the part of the AWS S3 client used to check whether a bucket exists
+type BucketClient interface {
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// bucketExists checks whether a bucket exists in the current account. `bucketName` can also be the arn of an access point
+// or multi-region access point.
+func BucketExists(s3Client BucketClient, bucketName string, optFns ...func(*s3.Options)) (bool, error) {
+	var err error
+	if IsMultiRegionAccessPointArn(bucketName) {
+		// multi-region access points do not support HeadBucket
+		_, err = s3Client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
+			Bucket:  aws.String(bucketName),
+			MaxKeys: aws.Int32(1),
+		}, optFns...)
+	} else {
+		_, err = s3Client.HeadBucket(context.TODO(), &s3.HeadBucketInput{
+			Bucket: aws.String(bucketName),
+		}, optFns...)
+	}
 
 	if err != nil {
 		var apiError smithy.APIError
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// IsAccessPointArn checks whether `bucket` is the arn of an AWS S3 access point or multi-region access point
+func IsAccessPointArn(bucket string) bool {
+	parsed, err := arn.Parse(bucket)
+	if err != nil {
+		return false
+	}
+
+	return parsed.Service == "s3" && strings.HasPrefix(parsed.Resource, "accesspoint/")
+}
+
+// IsMultiRegionAccessPointArn checks whether `bucket` is the arn of an AWS S3 multi-region access point. Multi-region
+// access point arns have no region and their alias ends with ".mrap".
+func IsMultiRegionAccessPointArn(bucket string) bool {
+	if !IsAccessPointArn(bucket) {
+		return false
+	}
+
+	parsed, _ := arn.Parse(bucket)
+	return parsed.Region == "" && strings.HasSuffix(parsed.Resource, ".mrap")
+}
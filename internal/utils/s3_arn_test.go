@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessPointArns(t *testing.T) {
+	var tests = []struct {
+		desc    string
+		bucket  string
+		expAp   bool
+		expMrap bool
+	}{
+		{desc: "bucket_name", bucket: "my-bucket"},
+		{desc: "access_point_alias", bucket: "my-ap-hrzrlukc5m36ft7okagglf3gmwluquse1b-s3alias"},
+		{desc: "access_point_arn", bucket: "arn:aws:s3:us-west-2:765908583888:accesspoint/my-ap", expAp: true},
+		{desc: "multi_region_access_point_arn", bucket: "arn:aws:s3::765908583888:accesspoint/mfzwi23gnjvgw.mrap", expAp: true, expMrap: true},
+		{desc: "other_arn", bucket: "arn:aws:sqs:us-west-2:765908583888:queue"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			assert.Equal(t, tt.expAp, IsAccessPointArn(tt.bucket))
+			assert.Equal(t, tt.expMrap, IsMultiRegionAccessPointArn(tt.bucket))
+		})
+	}
+}
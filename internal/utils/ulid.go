@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID creates a Universally Unique Lexicographically Sortable Identifier (https://github.com/ulid/spec) for the
+// given time. ULIDs sort by time when compared as strings.
+func NewULID(t time.Time) (string, error) {
+	var id [16]byte
+
+	// 48 bit timestamp in milliseconds followed by 80 bits of randomness
+	binary.BigEndian.PutUint64(id[:8], uint64(t.UnixMilli())<<16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", err
+	}
+
+	// encode 128 bits as 26 characters of 5 bits each; the first character only holds 3 bits
+	var encoded [26]byte
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	for i := 25; i >= 0; i-- {
+		encoded[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(encoded[:]), nil
+}
@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewULID(t *testing.T) {
+	// timestamp from the ulid spec
+	id, err := NewULID(time.UnixMilli(1469918176385))
+	assert.Nil(t, err)
+	assert.Len(t, id, 26)
+	assert.Equal(t, "01ARYZ6S41", id[:10])
+
+	// ulids sort by time
+	earlier, _ := NewULID(time.UnixMilli(1469918176385))
+	later, _ := NewULID(time.UnixMilli(1469918176386))
+	assert.Less(t, earlier, later)
+}
@@ -0,0 +1,55 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+)
+
+var _ DataKeyProvider = (*KeyRing)(nil)
+
+// KeyRing is a DataKeyProvider that supports key rotation. New data keys are generated with the current key, while data
+// keys of hefty messages still in flight are decrypted with the key whose id is recorded in their reference message,
+// which can be the current key or a previous key. The key ids must be the ids returned by the GenerateDataKey method of
+// the providers, e.g. the key arn for AWS KMS.
+type KeyRing struct {
+	current   string
+	providers map[string]DataKeyProvider
+}
+
+// NewKeyRing creates a key ring whose current key is `keyId`, provided by `provider`
+func NewKeyRing(keyId string, provider DataKeyProvider) *KeyRing {
+	return &KeyRing{
+		current:   keyId,
+		providers: map[string]DataKeyProvider{keyId: provider},
+	}
+}
+
+// WithPreviousKey adds a previous key which is only used to decrypt data keys and returns the key ring
+func (ring *KeyRing) WithPreviousKey(keyId string, provider DataKeyProvider) *KeyRing {
+	if keyId != ring.current {
+		ring.providers[keyId] = provider
+	}
+
+	return ring
+}
+
+func (ring *KeyRing) GenerateDataKey(ctx context.Context, encryptionContext map[string]string) ([]byte, []byte, string, error) {
+	plaintext, ciphertext, keyId, err := ring.providers[ring.current].GenerateDataKey(ctx, encryptionContext)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if keyId != ring.current {
+		return nil, nil, "", fmt.Errorf("current key %s returned data key for key %s", ring.current, keyId)
+	}
+
+	return plaintext, ciphertext, keyId, nil
+}
+
+func (ring *KeyRing) DecryptDataKey(ctx context.Context, ciphertext []byte, keyId string, encryptionContext map[string]string) ([]byte, error) {
+	provider, ok := ring.providers[keyId]
+	if !ok {
+		return nil, fmt.Errorf("key %s is not in the key ring", keyId)
+	}
+
+	return provider.DecryptDataKey(ctx, ciphertext, keyId, encryptionContext)
+}
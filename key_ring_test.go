@@ -0,0 +1,42 @@
+package hefty
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyRingRotation(t *testing.T) {
+	const queueUrl = "https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue"
+	oldKey, newKey := &fakeKeys{keyId: "key-1"}, &fakeKeys{keyId: "key-2"}
+	serialized := []byte("hefty message")
+
+	// message in flight encrypted before the rotation
+	before := &clientSideEncryption{keys: NewKeyRing("key-1", oldKey)}
+	inFlightRefMsg := &types.ReferenceMsg{Md5DigestMsgBody: "f6335cfd72eec3e93f84c1d0330c5f85"}
+	inFlight, err := before.encrypt(context.TODO(), queueUrl, inFlightRefMsg, serialized)
+	assert.Nil(t, err)
+
+	// new messages use the current key while the previous key still decrypts messages in flight
+	after := &clientSideEncryption{keys: NewKeyRing("key-2", newKey).WithPreviousKey("key-1", oldKey)}
+	refMsg := &types.ReferenceMsg{Md5DigestMsgBody: "f6335cfd72eec3e93f84c1d0330c5f85"}
+	payload, err := after.encrypt(context.TODO(), queueUrl, refMsg, serialized)
+	assert.Nil(t, err)
+	assert.Equal(t, "key-2", refMsg.KeyId)
+
+	for _, tt := range []struct {
+		refMsg  *types.ReferenceMsg
+		payload []byte
+	}{{inFlightRefMsg, inFlight}, {refMsg, payload}} {
+		decrypted, err := after.decrypt(context.TODO(), queueUrl, tt.refMsg, tt.payload)
+		assert.Nil(t, err)
+		assert.Equal(t, serialized, decrypted)
+	}
+
+	// keys that were removed from the key ring can no longer decrypt
+	removed := &clientSideEncryption{keys: NewKeyRing("key-2", newKey)}
+	_, err = removed.decrypt(context.TODO(), queueUrl, inFlightRefMsg, inFlight)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,137 @@
+package hefty
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jo-parker/sqs-hefty/internal/utils"
+)
+
+// KeyTemplateData holds the values available to a key template set with the WithKeyTemplate option
+type KeyTemplateData struct {
+	Name           string // name of the queue or topic the message is sent to
+	Date           string // UTC date the message is sent in YYYY-MM-DD format
+	MessageGroupId string // message group id of messages sent to FIFO queues and topics; empty otherwise
+	UUID           string // random UUID
+	ID             string // identifier which makes the key unique; a UUID unless an id generator or content addressable keys are configured
+}
+
+// IdGenerator creates the unique identifier used in the key of a hefty message
+type IdGenerator func() (string, error)
+
+// UUIDs is the default IdGenerator, which creates random UUIDs
+func UUIDs() (string, error) {
+	return uuid.New().String(), nil
+}
+
+// ULIDs is an IdGenerator which creates ULIDs (https://github.com/ulid/spec). Since ULIDs start with a timestamp, keys
+// created with ULIDs are listed in the order their hefty messages were stored.
+func ULIDs() (string, error) {
+	return utils.NewULID(time.Now())
+}
+
+// keyGenerator creates the keys of hefty messages from the configured key prefix, key template and id generator
+type keyGenerator struct {
+	prefix   string
+	template *template.Template
+	newId    IdGenerator
+}
+
+// newKey creates the key of a hefty message. When no key template is configured, the key is `defaultDir/id`. A non-empty
+// `contentDigest` is used as the id so that identical hefty messages have the same key.
+func (gen keyGenerator) newKey(defaultDir, name string, messageGroupId *string, contentDigest string) (string, error) {
+	data, err := gen.newKeyTemplateData(name, messageGroupId)
+	if err != nil {
+		return "", err
+	}
+	if contentDigest != "" {
+		data.ID = contentDigest
+	}
+
+	key := fmt.Sprintf("%s/%s", defaultDir, data.ID)
+
+	if gen.template != nil {
+		var builder strings.Builder
+		err := gen.template.Execute(&builder, data)
+		if err != nil {
+			return "", fmt.Errorf("unable to execute key template. %v", err)
+		}
+		key = builder.String()
+	}
+
+	key = gen.prefix + key
+
+	// the receipt handle of a hefty message uses '|' as a delimiter
+	if key == "" || strings.Contains(key, "|") {
+		return "", fmt.Errorf("invalid key '%s'; keys must not be empty or contain '|'", key)
+	}
+
+	return key, nil
+}
+
+// staticPrefix returns the part of the keys of hefty messages sent to the queue or topic `name` that is the same for all
+// of them, where `defaultDir` is the first segment of keys created without a key template
+func (gen keyGenerator) staticPrefix(defaultDir, name string) (string, error) {
+	// the prefix ends where the first value that differs between hefty messages is used
+	const marker = "\x00"
+	key := fmt.Sprintf("%s/%s", defaultDir, marker)
+	if gen.template != nil {
+		var builder strings.Builder
+		err := gen.template.Execute(&builder, KeyTemplateData{Name: name, Date: marker, MessageGroupId: marker, UUID: marker, ID: marker})
+		if err != nil {
+			return "", fmt.Errorf("unable to execute key template. %v", err)
+		}
+		key = builder.String()
+	}
+
+	prefix, _, _ := strings.Cut(gen.prefix+key, marker)
+	return prefix, nil
+}
+
+// namePrefix returns the key prefix all hefty messages sent to the queue `name` are stored under. It fails when the key
+// template does not store hefty messages under a prefix ending with a segment holding the name.
+func (gen keyGenerator) namePrefix(name string) (string, error) {
+	prefix, err := gen.staticPrefix(name, name)
+	if err != nil {
+		return "", err
+	}
+	if name == "" || !strings.HasSuffix("/"+prefix, "/"+name+"/") {
+		return "", fmt.Errorf("hefty messages of %s are not stored under a prefix of their own; the key template must start with a segment holding the name", name)
+	}
+
+	return prefix, nil
+}
+
+func (gen keyGenerator) newKeyTemplateData(name string, messageGroupId *string) (KeyTemplateData, error) {
+	data := KeyTemplateData{
+		Name: name,
+		Date: time.Now().UTC().Format(time.DateOnly),
+		UUID: uuid.New().String(),
+	}
+	if messageGroupId != nil {
+		data.MessageGroupId = *messageGroupId
+	}
+
+	data.ID = data.UUID
+	if gen.newId != nil {
+		id, err := gen.newId()
+		if err != nil {
+			return KeyTemplateData{}, fmt.Errorf("unable to generate id for key. %v", err)
+		}
+		data.ID = id
+	}
+
+	return data, nil
+}
+
+func parseKeyTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, errors.New("key template must not be empty")
+	}
+
+	return template.New("key").Option("missingkey=error").Parse(text)
+}
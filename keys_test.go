@@ -0,0 +1,111 @@
+package hefty
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyGenerator(t *testing.T) {
+	newId := func() (string, error) {
+		return "8d3a4b5c", nil
+	}
+
+	var tests = []struct {
+		desc          string
+		prefix        string
+		template      string
+		contentDigest string
+		expKey        string
+		expErr        bool
+	}{
+		{desc: "default", expKey: "dir/8d3a4b5c"},
+		{desc: "prefix", prefix: "hefty/", expKey: "hefty/dir/8d3a4b5c"},
+		{desc: "template", template: "{{.Name}}/{{.MessageGroupId}}/{{.ID}}", expKey: "MyQueue/group/8d3a4b5c"},
+		{desc: "prefix_and_template", prefix: "hefty/", template: "{{.Name}}-{{.ID}}", expKey: "hefty/MyQueue-8d3a4b5c"},
+		{desc: "content_digest", contentDigest: "5d41402a", expKey: "dir/5d41402a"},
+		{desc: "template_content_digest", template: "{{.Name}}/{{.ID}}", contentDigest: "5d41402a", expKey: "MyQueue/5d41402a"},
+		{desc: "template_unknown_field", template: "{{.Foo}}", expErr: true},
+		{desc: "template_with_delimiter", template: "{{.Name}}|{{.UUID}}", expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			gen := keyGenerator{prefix: tt.prefix, newId: newId}
+			if tt.template != "" {
+				tmpl, err := parseKeyTemplate(tt.template)
+				assert.Nil(t, err)
+				gen.template = tmpl
+			}
+
+			key, err := gen.newKey("dir", "MyQueue", aws.String("group"), tt.contentDigest)
+			assert.Equal(t, tt.expErr, err != nil, "expected error")
+			assert.Equal(t, tt.expKey, key, "expected key")
+		})
+	}
+}
+
+func TestKeyGeneratorNamePrefix(t *testing.T) {
+	var tests = []struct {
+		desc      string
+		prefix    string
+		template  string
+		expPrefix string
+		expErr    bool
+	}{
+		{desc: "default", expPrefix: "MyQueue/"},
+		{desc: "prefix", prefix: "hefty/", expPrefix: "hefty/MyQueue/"},
+		{desc: "template", template: "{{.Name}}/{{.Date}}/{{.ID}}", expPrefix: "MyQueue/"},
+		{desc: "template_with_static_segment", template: "queues/{{.Name}}/{{.ID}}", expPrefix: "queues/MyQueue/"},
+		{desc: "template_without_name", template: "{{.Date}}/{{.ID}}", expErr: true},
+		{desc: "template_name_after_date", template: "{{.Date}}/{{.Name}}/{{.ID}}", expErr: true},
+		{desc: "template_name_not_a_segment", template: "{{.Name}}-{{.ID}}", expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			gen := keyGenerator{prefix: tt.prefix}
+			if tt.template != "" {
+				tmpl, err := parseKeyTemplate(tt.template)
+				assert.Nil(t, err)
+				gen.template = tmpl
+			}
+
+			prefix, err := gen.namePrefix("MyQueue")
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expPrefix, prefix)
+		})
+	}
+}
+
+func TestKeyGeneratorStaticPrefix(t *testing.T) {
+	var tests = []struct {
+		desc      string
+		template  string
+		expPrefix string
+	}{
+		{desc: "default", expPrefix: "765908583888/"},
+		{desc: "template", template: "{{.Name}}/{{.Date}}/{{.ID}}", expPrefix: "MyTopic/"},
+		{desc: "template_without_name", template: "{{.Date}}/{{.ID}}", expPrefix: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			gen := keyGenerator{}
+			if tt.template != "" {
+				tmpl, err := parseKeyTemplate(tt.template)
+				assert.Nil(t, err)
+				gen.template = tmpl
+			}
+
+			prefix, err := gen.staticPrefix("765908583888", "MyTopic")
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expPrefix, prefix)
+		})
+	}
+}
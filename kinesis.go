@@ -0,0 +1,292 @@
+package hefty
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	kinesistypes "github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/limits"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+type KinesisClientWrapper struct {
+	kinesis.Client
+	storage        *payloadStorage
+	alwaysSendToS3 bool
+	offload        OffloadPolicy
+	api            KinesisAPI // client given to NewKinesisClientWrapperFromAPI that is not a *kinesis.Client
+}
+
+// NewKinesisClientWrapper creates a Hefty Kinesis client wrapper using an existing AWS Kinesis client and AWS S3 client.
+// The wrapper saves records whose data and partition key exceed the 1MB record limit of AWS Kinesis to AWS S3 in the
+// bucket `bucketName`, and puts a reference message in the stream instead. The hefty messages are stored in the same
+// format as those of the AWS SQS and AWS SNS client wrappers.
+func NewKinesisClientWrapper(kinesisClient *kinesis.Client, s3Client *s3.Client, bucketName string, opts ...Option) (*KinesisClientWrapper, error) {
+	return NewKinesisClientWrapperFromAPI(kinesisClient, s3Client, bucketName, opts...)
+}
+
+// NewKinesisClientWrapperFromAPI creates a Hefty Kinesis client wrapper like NewKinesisClientWrapper from clients that only
+// need the operations the wrapper uses, e.g. fakes or instrumented clients. The embedded kinesis.Client of the wrapper is
+// only set when `kinesisClient` is a *kinesis.Client, so the methods of the wrapper must be used otherwise.
+func NewKinesisClientWrapperFromAPI(kinesisClient KinesisAPI, s3Client S3API, bucketName string, opts ...Option) (*KinesisClientWrapper, error) {
+	// process available options
+	wrapperOptions := defaultOptions()
+	for _, opt := range opts {
+		err := opt(&wrapperOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	storage, err := newPayloadStorage(s3Client, bucketName, &wrapperOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapper := &KinesisClientWrapper{
+		storage:        storage,
+		alwaysSendToS3: wrapperOptions.alwaysSendToS3,
+		offload:        wrapperOptions.offload,
+	}
+	if client, ok := kinesisClient.(*kinesis.Client); ok {
+		wrapper.Client = *client
+	} else {
+		wrapper.api = kinesisClient
+	}
+
+	return wrapper, nil
+}
+
+// kinesisClient returns the AWS Kinesis client of the wrapper
+func (wrapper *KinesisClientWrapper) kinesisClient() KinesisAPI {
+	if wrapper.api != nil {
+		return wrapper.api
+	}
+
+	return &wrapper.Client
+}
+
+// PutHeftyRecord puts a record in a stream. When the data and partition key of the record exceed the record limit of AWS
+// Kinesis, the data is saved in AWS S3 as a hefty message and the record is put with a reference message as its data
+// instead. The data of `params` is restored once the record was put.
+//
+// Note that this function's signature matches that of the AWS Kinesis SDK's PutRecord method.
+func (wrapper *KinesisClientWrapper) PutHeftyRecord(ctx context.Context, params *kinesis.PutRecordInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordOutput, error) {
+	// input validation; if invalid input let AWS SDK handle it
+	if params == nil || len(params.Data) == 0 || !wrapper.offloads(params.Data, params.PartitionKey) {
+		return wrapper.kinesisClient().PutRecord(ctx, params, optFns...)
+	}
+
+	streamName := kinesisStreamName(params.StreamName, params.StreamARN)
+	refMsg, data, err := wrapper.putHeftyRecordData(ctx, streamName, params.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	// replace overwritten data with original data
+	origData := params.Data
+	params.Data = data
+	defer func() {
+		params.Data = origData
+	}()
+
+	out, err := wrapper.kinesisClient().PutRecord(ctx, params, optFns...)
+	if err != nil {
+		wrapper.storage.cleanupOrphan(ctx, refMsg, err)
+		return out, err
+	}
+
+	return out, nil
+}
+
+// PutHeftyRecords puts records in a stream like PutHeftyRecord does for a single record. The hefty messages of records
+// that AWS Kinesis did not accept are deleted, so that the caller can put the records again from `params`, whose data is
+// restored once the records were put.
+//
+// Note that this function's signature matches that of the AWS Kinesis SDK's PutRecords method.
+func (wrapper *KinesisClientWrapper) PutHeftyRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+	if params == nil {
+		return wrapper.kinesisClient().PutRecords(ctx, params, optFns...)
+	}
+
+	streamName := kinesisStreamName(params.StreamName, params.StreamARN)
+
+	// replace overwritten data with original data
+	refMsgs := map[int]*types.ReferenceMsg{}
+	origData := make([][]byte, len(params.Records))
+	defer func() {
+		for i := range refMsgs {
+			params.Records[i].Data = origData[i]
+		}
+	}()
+
+	for i, record := range params.Records {
+		if len(record.Data) == 0 || !wrapper.offloads(record.Data, record.PartitionKey) {
+			continue
+		}
+
+		refMsg, data, err := wrapper.putHeftyRecordData(ctx, streamName, record.Data)
+		if err != nil {
+			for _, stored := range refMsgs {
+				_ = wrapper.storage.deleteOrphan(ctx, stored, err)
+			}
+			return nil, fmt.Errorf("unable to put record %d. %v", i, err)
+		}
+
+		refMsgs[i] = refMsg
+		origData[i] = record.Data
+		params.Records[i].Data = data
+	}
+
+	out, err := wrapper.kinesisClient().PutRecords(ctx, params, optFns...)
+	if err != nil {
+		for _, refMsg := range refMsgs {
+			wrapper.storage.cleanupOrphan(ctx, refMsg, err)
+		}
+		return out, err
+	}
+
+	// records that failed are known not to have been put
+	for i, result := range out.Records {
+		refMsg, ok := refMsgs[i]
+		if !ok || result.ErrorCode == nil {
+			continue
+		}
+
+		recordErr := fmt.Errorf("record %d failed with %s. %s", i, aws.ToString(result.ErrorCode), aws.ToString(result.ErrorMessage))
+		_ = wrapper.storage.deleteOrphan(ctx, refMsg, recordErr)
+	}
+
+	return out, nil
+}
+
+// GetHeftyRecords gets records from a shard and replaces the reference messages of hefty records with their data. The
+// records are not returned when a hefty message cannot be resolved, so that they can be got again with the same shard
+// iterator.
+//
+// Note that this function's signature matches that of the AWS Kinesis SDK's GetRecords method.
+func (wrapper *KinesisClientWrapper) GetHeftyRecords(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+	out, err := wrapper.kinesisClient().GetRecords(ctx, params, optFns...)
+	if err != nil || out == nil {
+		return out, err
+	}
+
+	streamName := kinesisStreamName(nil, params.StreamARN)
+	if err = wrapper.ResolveHeftyRecords(ctx, streamName, out.Records); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// ResolveHeftyRecords replaces the reference messages of hefty records of the stream `streamName` with their data, e.g.
+// for records delivered to an AWS Lambda function or a Kinesis Client Library consumer. Records that are not hefty
+// records are left as they are. The stream name is only needed for hefty messages encrypted with client side encryption.
+func (wrapper *KinesisClientWrapper) ResolveHeftyRecords(ctx context.Context, streamName string, records []kinesistypes.Record) error {
+	var errs []error
+	for i := range records {
+		data, err := wrapper.ResolveHeftyRecord(ctx, streamName, records[i].Data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to resolve record %s. %v", aws.ToString(records[i].SequenceNumber), err))
+			continue
+		}
+
+		records[i].Data = data
+	}
+
+	return errors.Join(errs...)
+}
+
+// ResolveHeftyRecord returns the data of the hefty record whose data is `data`, or `data` itself when it is not a
+// reference message
+func (wrapper *KinesisClientWrapper) ResolveHeftyRecord(ctx context.Context, streamName string, data []byte) ([]byte, error) {
+	if !types.IsReferenceMsg(string(data)) {
+		return data, nil
+	}
+
+	refMsg, err := types.ToReferenceMsg(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal reference message. %v", err)
+	}
+
+	heftyMsg, err := wrapper.storage.getHeftyMessage(ctx, streamName, refMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(aws.ToString(heftyMsg.Body)), nil
+}
+
+// offloads reports whether the record with `data` and `partitionKey` is stored as a hefty message. AWS Kinesis counts
+// the partition key towards the record limit.
+func (wrapper *KinesisClientWrapper) offloads(data []byte, partitionKey *string) bool {
+	size := len(data) + len(aws.ToString(partitionKey))
+	return !wrapper.offload.inline(wrapper.alwaysSendToS3, wrapper.offload.threshold(limits.MaxMessageLength(limits.Kinesis)), size)
+}
+
+// putHeftyRecordData stores the data of a record of the stream `streamName` as a hefty message and returns its reference
+// message and the record data replacing it
+func (wrapper *KinesisClientWrapper) putHeftyRecordData(ctx context.Context, streamName string, data []byte) (*types.ReferenceMsg, []byte, error) {
+	if len(data) > MaxHeftyMessageLengthBytes {
+		return nil, nil, fmt.Errorf("record size of %d bytes greater than allowed message size of %d bytes", len(data), MaxHeftyMessageLengthBytes)
+	}
+
+	// create and serialize hefty message
+	heftyMsg := messages.NewHeftyMessage(aws.String(string(data)), nil, len(data))
+	serialized, _, _, err := heftyMsg.Serialize()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to serialize record. %v", err)
+	}
+
+	// create digests
+	msgBodyHash, msgAttrHash, err := messageDigests(wrapper.storage.digestAlgorithm, serialized, heftyMsg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// create reference message; S3Key: streamName/id unless a key prefix or template is configured
+	key, err := wrapper.storage.keys.newKey(streamName, streamName, nil, wrapper.storage.contentDigest(serialized))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create reference message from stream name. %v", err)
+	}
+	refMsg := types.NewReferenceMsg(clientRegion(wrapper.kinesisClient()), wrapper.storage.bucket, key, msgBodyHash, msgAttrHash)
+	refMsg.DigestAlgorithm = wrapper.storage.digestAlgorithm
+	refMsg.Size = int64(len(serialized))
+
+	// tag hefty message with its expiration
+	tags, err := payloadTtlTags(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// put hefty message in payload store or upload it to s3
+	err = wrapper.storage.put(ctx, streamName, "", refMsg, serialized, newObjectMetadata(streamName, len(data), heftyMsg), tags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jsonRefMsg, err := json.Marshal(refMsg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to marshal json message. %v", err)
+	}
+
+	return refMsg, jsonRefMsg, nil
+}
+
+// kinesisStreamName returns the stream name, or the name of the stream of `streamARN` when the name is not given.
+// Example streamARN: arn:aws:kinesis:us-west-2:765908583888:stream/MyStream
+func kinesisStreamName(streamName, streamARN *string) string {
+	if aws.ToString(streamName) != "" {
+		return aws.ToString(streamName)
+	}
+
+	arn := aws.ToString(streamARN)
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
@@ -0,0 +1,187 @@
+package hefty
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	kinesistypes "github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/jo-parker/sqs-hefty/limits"
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKinesisAPI keeps the records put in a single shard and fails the records whose partition key is "fail"
+type fakeKinesisAPI struct {
+	KinesisAPI
+	records []kinesistypes.Record
+	err     error
+}
+
+func (client *fakeKinesisAPI) put(data []byte, partitionKey *string) *string {
+	sequenceNumber := aws.String(strconv.Itoa(len(client.records)))
+	client.records = append(client.records, kinesistypes.Record{Data: bytes.Clone(data), PartitionKey: partitionKey, SequenceNumber: sequenceNumber})
+	return sequenceNumber
+}
+
+func (client *fakeKinesisAPI) PutRecord(ctx context.Context, params *kinesis.PutRecordInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordOutput, error) {
+	if client.err != nil {
+		return nil, client.err
+	}
+
+	return &kinesis.PutRecordOutput{SequenceNumber: client.put(params.Data, params.PartitionKey), ShardId: aws.String("shardId-000000000000")}, nil
+}
+
+func (client *fakeKinesisAPI) PutRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+	if client.err != nil {
+		return nil, client.err
+	}
+
+	out := &kinesis.PutRecordsOutput{FailedRecordCount: aws.Int32(0)}
+	for _, record := range params.Records {
+		if aws.ToString(record.PartitionKey) == "fail" {
+			out.Records = append(out.Records, kinesistypes.PutRecordsResultEntry{ErrorCode: aws.String("ProvisionedThroughputExceededException"), ErrorMessage: aws.String("slow down")})
+			*out.FailedRecordCount++
+			continue
+		}
+
+		out.Records = append(out.Records, kinesistypes.PutRecordsResultEntry{SequenceNumber: client.put(record.Data, record.PartitionKey), ShardId: aws.String("shardId-000000000000")})
+	}
+
+	return out, nil
+}
+
+func (client *fakeKinesisAPI) GetRecords(ctx context.Context, params *kinesis.GetRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.GetRecordsOutput, error) {
+	records := make([]kinesistypes.Record, len(client.records))
+	for i, record := range client.records {
+		records[i] = record
+		records[i].Data = bytes.Clone(record.Data)
+	}
+
+	return &kinesis.GetRecordsOutput{Records: records, NextShardIterator: aws.String("next")}, nil
+}
+
+func newTestKinesisWrapper(t *testing.T, store PayloadStore) (*KinesisClientWrapper, *fakeKinesisAPI) {
+	kinesisClient := &fakeKinesisAPI{}
+	wrapper, err := NewKinesisClientWrapperFromAPI(kinesisClient, &fakeS3API{}, "bucket", WithSkipBucketCheck(), WithPayloadStore(store, MaxHeftyMessageLengthBytes))
+	assert.Nil(t, err)
+
+	return wrapper, kinesisClient
+}
+
+func TestPutHeftyRecord(t *testing.T) {
+	store := &memoryStore{payloads: map[string][]byte{}}
+	wrapper, kinesisClient := newTestKinesisWrapper(t, store)
+	limit := limits.MaxMessageLength(limits.Kinesis)
+
+	tests := []struct {
+		name         string
+		data         []byte
+		partitionKey string
+		expHefty     bool
+	}{
+		{name: "small record", data: []byte("small record"), partitionKey: "key"},
+		{name: "record at limit", data: bytes.Repeat([]byte{0xff}, limit-3), partitionKey: "key"},
+		{name: "partition key counts towards limit", data: bytes.Repeat([]byte{0xff}, limit-3), partitionKey: "keys", expHefty: true},
+		{name: "binary record over limit", data: bytes.Repeat([]byte{0x00, 0xff}, limit), partitionKey: "key", expHefty: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params := &kinesis.PutRecordInput{StreamName: aws.String("MyStream"), PartitionKey: aws.String(test.partitionKey), Data: test.data}
+			out, err := wrapper.PutHeftyRecord(context.TODO(), params)
+			assert.Nil(t, err)
+			assert.NotNil(t, out.SequenceNumber)
+
+			// the data of the input is restored
+			assert.Equal(t, test.data, params.Data)
+
+			put := kinesisClient.records[len(kinesisClient.records)-1]
+			assert.Equal(t, test.expHefty, types.IsReferenceMsg(string(put.Data)))
+			assert.LessOrEqual(t, len(put.Data), limit)
+
+			data, err := wrapper.ResolveHeftyRecord(context.TODO(), "MyStream", put.Data)
+			assert.Nil(t, err)
+			assert.Equal(t, test.data, data)
+		})
+	}
+
+	assert.Len(t, store.payloads, 2)
+}
+
+func TestPutHeftyRecordError(t *testing.T) {
+	store := &memoryStore{payloads: map[string][]byte{}}
+	wrapper, kinesisClient := newTestKinesisWrapper(t, store)
+	kinesisClient.err = errors.New("put failed")
+
+	_, err := wrapper.PutHeftyRecord(context.TODO(), &kinesis.PutRecordInput{
+		StreamARN:    aws.String("arn:aws:kinesis:us-west-2:765908583888:stream/MyStream"),
+		PartitionKey: aws.String("key"),
+		Data:         bytes.Repeat([]byte("a"), 2*limits.MaxMessageLength(limits.Kinesis)),
+	})
+	assert.ErrorContains(t, err, "put failed")
+
+	// the hefty message is kept since the record may have been put
+	assert.Len(t, store.payloads, 1)
+	for key := range store.payloads {
+		assert.Contains(t, key, "MyStream/")
+	}
+}
+
+func TestPutHeftyRecords(t *testing.T) {
+	store := &memoryStore{payloads: map[string][]byte{}}
+	wrapper, kinesisClient := newTestKinesisWrapper(t, store)
+	hefty := bytes.Repeat([]byte("a"), 2*limits.MaxMessageLength(limits.Kinesis))
+
+	params := &kinesis.PutRecordsInput{StreamName: aws.String("MyStream"), Records: []kinesistypes.PutRecordsRequestEntry{
+		{PartitionKey: aws.String("key"), Data: []byte("small record")},
+		{PartitionKey: aws.String("key"), Data: hefty},
+		{PartitionKey: aws.String("fail"), Data: hefty},
+	}}
+	out, err := wrapper.PutHeftyRecords(context.TODO(), params)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), aws.ToInt32(out.FailedRecordCount))
+
+	// the data of the input is restored so that failed records can be put again
+	assert.Equal(t, []byte("small record"), params.Records[0].Data)
+	assert.Equal(t, hefty, params.Records[1].Data)
+	assert.Equal(t, hefty, params.Records[2].Data)
+
+	// the hefty message of the failed record is deleted
+	assert.Len(t, kinesisClient.records, 2)
+	assert.Len(t, store.payloads, 1)
+
+	got, err := wrapper.GetHeftyRecords(context.TODO(), &kinesis.GetRecordsInput{ShardIterator: aws.String("iterator")})
+	assert.Nil(t, err)
+	assert.Len(t, got.Records, 2)
+	assert.Equal(t, []byte("small record"), got.Records[0].Data)
+	assert.Equal(t, hefty, got.Records[1].Data)
+}
+
+func TestGetHeftyRecordsMissingPayload(t *testing.T) {
+	store := &memoryStore{payloads: map[string][]byte{}}
+	wrapper, kinesisClient := newTestKinesisWrapper(t, store)
+
+	_, err := wrapper.PutHeftyRecord(context.TODO(), &kinesis.PutRecordInput{
+		StreamName:   aws.String("MyStream"),
+		PartitionKey: aws.String("key"),
+		Data:         bytes.Repeat([]byte("a"), 2*limits.MaxMessageLength(limits.Kinesis)),
+	})
+	assert.Nil(t, err)
+	clear(store.payloads)
+
+	// no records are returned so that they can be got again
+	got, err := wrapper.GetHeftyRecords(context.TODO(), &kinesis.GetRecordsInput{ShardIterator: aws.String("iterator")})
+	assert.ErrorContains(t, err, "unable to resolve record "+aws.ToString(kinesisClient.records[0].SequenceNumber))
+	assert.Nil(t, got)
+}
+
+func TestKinesisStreamName(t *testing.T) {
+	assert.Equal(t, "MyStream", kinesisStreamName(aws.String("MyStream"), nil))
+	assert.Equal(t, "MyStream", kinesisStreamName(nil, aws.String("arn:aws:kinesis:us-west-2:765908583888:stream/MyStream")))
+	assert.Equal(t, "", kinesisStreamName(nil, nil))
+}
@@ -0,0 +1,348 @@
+package hefty
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+const defaultLambdaConcurrency = 10
+
+// snsEnvelopePrefix and snsEnvelopeSuffix enclose the reference message published by PublishHeftyMessage
+const (
+	snsEnvelopePrefix = `{"default":"`
+	snsEnvelopeSuffix = `"}`
+)
+
+// SQSEvent is the event of an AWS Lambda function with an AWS SQS event source. It has the json of events.SQSEvent of
+// github.com/aws/aws-lambda-go, so that a function can take it as its input without this module depending on it.
+type SQSEvent struct {
+	Records []SQSMessage `json:"Records"`
+}
+
+// SQSMessage is a record of an SQSEvent
+type SQSMessage struct {
+	MessageId              string                         `json:"messageId"`
+	ReceiptHandle          string                         `json:"receiptHandle"`
+	Body                   string                         `json:"body"`
+	Md5OfBody              string                         `json:"md5OfBody"`
+	Md5OfMessageAttributes string                         `json:"md5OfMessageAttributes"`
+	Attributes             map[string]string              `json:"attributes"`
+	MessageAttributes      map[string]SQSMessageAttribute `json:"messageAttributes"`
+	EventSourceARN         string                         `json:"eventSourceARN"`
+	EventSource            string                         `json:"eventSource"`
+	AWSRegion              string                         `json:"awsRegion"`
+}
+
+// SQSMessageAttribute is a message attribute of an SQSMessage
+type SQSMessageAttribute struct {
+	StringValue      *string  `json:"stringValue,omitempty"`
+	BinaryValue      []byte   `json:"binaryValue,omitempty"`
+	StringListValues []string `json:"stringListValues"`
+	BinaryListValues [][]byte `json:"binaryListValues"`
+	DataType         string   `json:"dataType"`
+}
+
+// SQSEventResponse is the response of an AWS Lambda function that reports batch item failures. It has the json of
+// events.SQSEventResponse of github.com/aws/aws-lambda-go.
+type SQSEventResponse struct {
+	BatchItemFailures []SQSBatchItemFailure `json:"batchItemFailures"`
+}
+
+// SQSBatchItemFailure is a record of an SQSEvent that failed and is received again
+type SQSBatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// SQSEventConfig configures HandleSQSEvent
+type SQSEventConfig struct {
+	// Concurrency is the number of records resolved and handled at the same time. 10 is used when 0. Records of FIFO
+	// queues are always handled one at a time and in order.
+	Concurrency int
+	// DeletePayloads deletes the hefty messages of the records that were handled successfully. AWS Lambda deletes the
+	// records themselves.
+	DeletePayloads bool
+}
+
+// HandleSQSEvent resolves the hefty messages of the records of an AWS Lambda SQS event concurrently, calls `handler`
+// with every record and its original body and message attributes, and returns the records that failed as batch item
+// failures. The event source mapping must have ReportBatchItemFailures enabled, otherwise a single failure makes the
+// whole batch be received again.
+//
+// A record whose hefty message cannot be resolved fails without calling `handler`. For FIFO queues the records after
+// the first failure are not handled and fail as well, so that the order of messages is kept.
+func (wrapper *SqsClientWrapper) HandleSQSEvent(ctx context.Context, event *SQSEvent, handler func(ctx context.Context, msg SQSMessage) error, config SQSEventConfig) SQSEventResponse {
+	response := SQSEventResponse{BatchItemFailures: []SQSBatchItemFailure{}}
+	if event == nil || len(event.Records) == 0 {
+		return response
+	}
+
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaultLambdaConcurrency
+	}
+
+	failed := make([]bool, len(event.Records))
+	if strings.HasSuffix(event.Records[0].EventSourceARN, ".fifo") {
+		for i, record := range event.Records {
+			if i > 0 && failed[i-1] {
+				failed[i] = true
+				continue
+			}
+			failed[i] = wrapper.handleSQSRecord(ctx, record, handler, config) != nil
+		}
+	} else {
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, config.Concurrency)
+		for i, record := range event.Records {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, record SQSMessage) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				failed[i] = wrapper.handleSQSRecord(ctx, record, handler, config) != nil
+			}(i, record)
+		}
+		wg.Wait()
+	}
+
+	for i, record := range event.Records {
+		if failed[i] {
+			response.BatchItemFailures = append(response.BatchItemFailures, SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+		}
+	}
+
+	return response
+}
+
+// handleSQSRecord resolves the hefty message of a record, handles the record and deletes its hefty message
+func (wrapper *SqsClientWrapper) handleSQSRecord(ctx context.Context, record SQSMessage, handler func(ctx context.Context, msg SQSMessage) error, config SQSEventConfig) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked. %v", r)
+		}
+	}()
+
+	refMsg, err := wrapper.resolveSQSRecord(ctx, &record)
+	if err != nil {
+		return err
+	}
+
+	if err = handler(ctx, record); err != nil {
+		return err
+	}
+
+	if refMsg != nil && config.DeletePayloads {
+		// the record was handled, so a hefty message that could not be deleted is left to its lifecycle rule
+		_ = wrapper.storage.delete(ctx, refMsg.S3Bucket, refMsg.S3Key, refMsg.Backend, refMsg.S3VersionId, refMsg.Counted)
+	}
+
+	return nil
+}
+
+// resolveSQSRecord replaces the body and message attributes of a record with those of its hefty message, or its
+// compressed inline body with the original body. It returns the reference message of a hefty message.
+func (wrapper *SqsClientWrapper) resolveSQSRecord(ctx context.Context, record *SQSMessage) (*types.ReferenceMsg, error) {
+	if types.IsInlineMsg(record.Body) {
+		body, err := decompressInline(ctx, wrapper.offload, wrapper.storage.transforms, record.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		record.Body = body
+		return nil, nil
+	}
+
+	if !types.IsReferenceMsg(record.Body) {
+		return nil, nil
+	}
+
+	refMsg, err := types.ToReferenceMsg(record.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal reference message. %v", err)
+	}
+
+	heftyMsg, err := wrapper.storage.getHeftyMessage(ctx, queueUrlFromArn(record.EventSourceARN), refMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	record.Body = aws.ToString(heftyMsg.Body)
+	record.MessageAttributes = toSQSMessageAttributes(heftyMsg.MessageAttributes)
+
+	return refMsg, nil
+}
+
+// toSQSMessageAttributes converts the message attributes of a hefty message to those of an SQSMessage
+func toSQSMessageAttributes(attributes map[string]messages.MessageAttributeValue) map[string]SQSMessageAttribute {
+	if attributes == nil {
+		return nil
+	}
+
+	converted := make(map[string]SQSMessageAttribute, len(attributes))
+	for name, value := range attributes {
+		converted[name] = SQSMessageAttribute{
+			DataType:    aws.ToString(value.DataType),
+			StringValue: value.StringValue,
+			BinaryValue: value.BinaryValue,
+		}
+	}
+
+	return converted
+}
+
+// queueUrlFromArn returns the url of a queue given by its arn, e.g. arn:aws:sqs:us-west-2:765908583888:MyQueue is
+// https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue. An empty string is returned for an invalid arn.
+func queueUrlFromArn(arn string) string {
+	tokens := strings.Split(arn, ":")
+	if len(tokens) != 6 || tokens[2] != "sqs" {
+		return ""
+	}
+
+	return fmt.Sprintf("https://sqs.%s.amazonaws.com/%s/%s", tokens[3], tokens[4], tokens[5])
+}
+
+// SNSEvent is the event of an AWS Lambda function subscribed to an AWS SNS topic. It has the json of events.SNSEvent of
+// github.com/aws/aws-lambda-go.
+type SNSEvent struct {
+	Records []SNSEventRecord `json:"Records"`
+}
+
+// SNSEventRecord is a record of an SNSEvent
+type SNSEventRecord struct {
+	EventVersion         string    `json:"EventVersion"`
+	EventSubscriptionArn string    `json:"EventSubscriptionArn"`
+	EventSource          string    `json:"EventSource"`
+	SNS                  SNSEntity `json:"Sns"`
+}
+
+// SNSEntity is the notification of an SNSEventRecord. Message attributes are objects with a Type and a Value.
+type SNSEntity struct {
+	Signature         string                 `json:"Signature"`
+	MessageID         string                 `json:"MessageId"`
+	Type              string                 `json:"Type"`
+	TopicArn          string                 `json:"TopicArn"`
+	MessageAttributes map[string]interface{} `json:"MessageAttributes"`
+	SignatureVersion  string                 `json:"SignatureVersion"`
+	Timestamp         string                 `json:"Timestamp"`
+	SigningCertURL    string                 `json:"SigningCertUrl"`
+	Message           string                 `json:"Message"`
+	UnsubscribeURL    string                 `json:"UnsubscribeUrl"`
+	Subject           string                 `json:"Subject"`
+}
+
+// HandleSNSEvent resolves the hefty messages of the records of an AWS Lambda SNS event and calls `handler` with every
+// record and its original message and message attributes, so that functions subscribed to a topic do not need raw
+// message delivery or their own AWS S3 code. The errors of records that could not be resolved or handled are returned
+// joined, which makes AWS Lambda retry the asynchronous invocation.
+func (wrapper *SnsClientWrapper) HandleSNSEvent(ctx context.Context, event *SNSEvent, handler func(ctx context.Context, record SNSEventRecord) error) error {
+	if event == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, record := range event.Records {
+		if err := wrapper.resolveSNSRecord(ctx, &record); err != nil {
+			errs = append(errs, fmt.Errorf("unable to resolve message %s. %v", record.SNS.MessageID, err))
+			continue
+		}
+
+		if err := handler(ctx, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// resolveSNSRecord replaces the message and message attributes of a record with those of its hefty message, or its
+// compressed inline message with the original message
+func (wrapper *SnsClientWrapper) resolveSNSRecord(ctx context.Context, record *SNSEventRecord) error {
+	return wrapper.resolveSNSMessage(ctx, record.SNS.TopicArn, &record.SNS.Message, &record.SNS.MessageAttributes)
+}
+
+// resolveSNSMessage replaces a message published to the topic `topicArn` and its message attributes with those of its
+// hefty message, or a compressed inline message with the original message
+func (wrapper *SnsClientWrapper) resolveSNSMessage(ctx context.Context, topicArn string, message *string, attributes *map[string]interface{}) error {
+	if types.IsInlineMsg(*message) {
+		decompressed, err := decompressInline(ctx, wrapper.offload, wrapper.storage.transforms, *message)
+		if err != nil {
+			return err
+		}
+
+		*message = decompressed
+		return nil
+	}
+
+	jsonRefMsg := unwrapSNSEnvelope(*message)
+	if !types.IsReferenceMsg(jsonRefMsg) {
+		return nil
+	}
+
+	refMsg, err := types.ToReferenceMsg(jsonRefMsg)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal reference message. %v", err)
+	}
+
+	heftyMsg, err := wrapper.storage.getHeftyMessage(ctx, topicArn, refMsg)
+	if err != nil {
+		return err
+	}
+
+	// the body of the hefty message is the published message wrapped in json
+	var snsMsg types.SQSMessage
+	if err = json.Unmarshal([]byte(aws.ToString(heftyMsg.Body)), &snsMsg); err != nil {
+		return fmt.Errorf("unable to unmarshal published message. %v", err)
+	}
+
+	*message = snsMsg.Message
+	*attributes = toSNSMessageAttributes(heftyMsg.MessageAttributes)
+
+	return nil
+}
+
+// unwrapSNSEnvelope returns the reference message in the envelope published by PublishHeftyMessage, or `message` as is
+// when it is not an envelope of a reference message
+func unwrapSNSEnvelope(message string) string {
+	var envelope types.SNSMessage
+	if err := json.Unmarshal([]byte(message), &envelope); err == nil && types.IsReferenceMsg(envelope.Message) {
+		return envelope.Message
+	}
+
+	// the reference message is published unescaped, which leaves the envelope invalid json
+	if strings.HasPrefix(message, snsEnvelopePrefix) && strings.HasSuffix(message, snsEnvelopeSuffix) {
+		if jsonRefMsg := message[len(snsEnvelopePrefix) : len(message)-len(snsEnvelopeSuffix)]; types.IsReferenceMsg(jsonRefMsg) {
+			return jsonRefMsg
+		}
+	}
+
+	return message
+}
+
+// toSNSMessageAttributes converts the message attributes of a hefty message to those of an SNSEntity, whose binary values
+// are base64 encoded
+func toSNSMessageAttributes(attributes map[string]messages.MessageAttributeValue) map[string]interface{} {
+	if attributes == nil {
+		return nil
+	}
+
+	converted := make(map[string]interface{}, len(attributes))
+	for name, value := range attributes {
+		dataType := aws.ToString(value.DataType)
+		if strings.HasPrefix(dataType, "Binary") {
+			converted[name] = map[string]interface{}{"Type": dataType, "Value": base64.StdEncoding.EncodeToString(value.BinaryValue)}
+			continue
+		}
+
+		converted[name] = map[string]interface{}{"Type": dataType, "Value": aws.ToString(value.StringValue)}
+	}
+
+	return converted
+}
@@ -0,0 +1,189 @@
+package hefty
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// storedReferenceMessage stores a hefty message in `storage` like SendHeftyMessage and returns its reference message as
+// json
+func storedReferenceMessage(t *testing.T, storage *payloadStorage, key, body string) string {
+	heftyMsg := messages.NewHeftyMessage(aws.String(body), map[string]messages.MessageAttributeValue{
+		"attr": {DataType: aws.String("String"), StringValue: aws.String("value")},
+	}, len(body))
+	serialized, _, _, err := heftyMsg.Serialize()
+	assert.Nil(t, err)
+	bodyDigest, attrDigest, err := messageDigests("", serialized, heftyMsg)
+	assert.Nil(t, err)
+
+	refMsg := types.NewReferenceMsg("", "", key, bodyDigest, attrDigest)
+	err = storage.put(context.TODO(), "queue", "", refMsg, serialized, nil, nil)
+	assert.Nil(t, err)
+	jsonRefMsg, err := json.Marshal(refMsg)
+	assert.Nil(t, err)
+
+	return string(jsonRefMsg)
+}
+
+// newPublishingWrapper creates an AWS SNS client wrapper publishing every message as a hefty message in `store`
+func newPublishingWrapper(t *testing.T, store PayloadStore) (*SnsClientWrapper, *fakeSnsAPI) {
+	snsClient := &fakeSnsAPI{}
+	wrapper, err := NewSnsClientWrapperFromAPI(snsClient, &fakeS3API{}, "bucket", WithSkipBucketCheck(), AlwaysSendToS3(), WithPayloadStore(store, 1024))
+	assert.Nil(t, err)
+
+	return wrapper, snsClient
+}
+
+// publishedMessage publishes `body` with the message attribute "attr" to the topic `topicArn` with PublishHeftyMessage and
+// returns the message delivered to subscribers
+func publishedMessage(t *testing.T, wrapper *SnsClientWrapper, snsClient *fakeSnsAPI, topicArn, body string) string {
+	_, err := wrapper.PublishHeftyMessage(context.TODO(), &sns.PublishInput{
+		TopicArn: aws.String(topicArn),
+		Message:  aws.String(body),
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{
+			"attr": {DataType: aws.String("String"), StringValue: aws.String("value")},
+		},
+	})
+	assert.Nil(t, err)
+
+	return snsClient.messages[len(snsClient.messages)-1]
+}
+
+func TestHandleSQSEvent(t *testing.T) {
+	store := &memoryStore{payloads: map[string][]byte{}}
+	wrapper := &SqsClientWrapper{storage: &payloadStorage{payloadStore: store, payloadMaxSize: 1024}}
+	arn := "arn:aws:sqs:us-west-2:765908583888:MyQueue"
+
+	event := &SQSEvent{Records: []SQSMessage{
+		{MessageId: "plain", Body: "plain message", EventSourceARN: arn},
+		{MessageId: "hefty", Body: storedReferenceMessage(t, wrapper.storage, "MyQueue/hefty", "hefty message"), EventSourceARN: arn},
+		{MessageId: "failing", Body: storedReferenceMessage(t, wrapper.storage, "MyQueue/failing", "failing message"), EventSourceARN: arn},
+	}}
+	missingRefMsg := types.NewReferenceMsg("", "", "MyQueue/missing", "", "")
+	missingRefMsg.Backend = "memory"
+	missing, err := json.Marshal(missingRefMsg)
+	assert.Nil(t, err)
+	event.Records = append(event.Records, SQSMessage{MessageId: "missing", Body: string(missing), EventSourceARN: arn})
+
+	// records are handled one at a time since the memory store is not safe for concurrent use
+	handled := make(chan SQSMessage, len(event.Records))
+	response := wrapper.HandleSQSEvent(context.TODO(), event, func(ctx context.Context, msg SQSMessage) error {
+		handled <- msg
+		if msg.Body == "failing message" {
+			return errors.New("failed")
+		}
+		return nil
+	}, SQSEventConfig{DeletePayloads: true, Concurrency: 1})
+	close(handled)
+
+	assert.ElementsMatch(t, []SQSBatchItemFailure{{ItemIdentifier: "failing"}, {ItemIdentifier: "missing"}}, response.BatchItemFailures)
+
+	bodies := map[string]SQSMessage{}
+	for msg := range handled {
+		bodies[msg.MessageId] = msg
+	}
+	assert.Len(t, bodies, 3)
+	assert.Equal(t, "hefty message", bodies["hefty"].Body)
+	assert.Equal(t, "value", aws.ToString(bodies["hefty"].MessageAttributes["attr"].StringValue))
+
+	// only the hefty message of the handled record is deleted
+	assert.NotContains(t, store.payloads, "MyQueue/hefty")
+	assert.Contains(t, store.payloads, "MyQueue/failing")
+}
+
+func TestHandleSQSEventFifo(t *testing.T) {
+	wrapper := &SqsClientWrapper{storage: &payloadStorage{}}
+	arn := "arn:aws:sqs:us-west-2:765908583888:MyQueue.fifo"
+	event := &SQSEvent{Records: []SQSMessage{
+		{MessageId: "1", Body: "ok", EventSourceARN: arn},
+		{MessageId: "2", Body: "fail", EventSourceARN: arn},
+		{MessageId: "3", Body: "ok", EventSourceARN: arn},
+	}}
+
+	var handled []string
+	response := wrapper.HandleSQSEvent(context.TODO(), event, func(ctx context.Context, msg SQSMessage) error {
+		handled = append(handled, msg.MessageId)
+		if msg.Body == "fail" {
+			return errors.New("failed")
+		}
+		return nil
+	}, SQSEventConfig{})
+
+	assert.Equal(t, []string{"1", "2"}, handled)
+	assert.Equal(t, []SQSBatchItemFailure{{ItemIdentifier: "2"}, {ItemIdentifier: "3"}}, response.BatchItemFailures)
+}
+
+func TestQueueUrlFromArn(t *testing.T) {
+	assert.Equal(t, "https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue", queueUrlFromArn("arn:aws:sqs:us-west-2:765908583888:MyQueue"))
+	assert.Equal(t, "", queueUrlFromArn("arn:aws:sns:us-west-2:765908583888:MyTopic"))
+	assert.Equal(t, "", queueUrlFromArn("MyQueue"))
+}
+
+func TestHandleSNSEvent(t *testing.T) {
+	store := &memoryStore{payloads: map[string][]byte{}}
+	wrapper, snsClient := newPublishingWrapper(t, store)
+	topicArn := "arn:aws:sns:us-west-2:765908583888:MyTopic"
+
+	// the hefty message is published with PublishHeftyMessage
+	event := &SNSEvent{Records: []SNSEventRecord{
+		{SNS: SNSEntity{MessageID: "plain", TopicArn: topicArn, Message: "plain message"}},
+		{SNS: SNSEntity{MessageID: "hefty", TopicArn: topicArn, Message: publishedMessage(t, wrapper, snsClient, topicArn, "hefty message")}},
+	}}
+	assert.Len(t, store.payloads, 1)
+
+	var handled []SNSEventRecord
+	err := wrapper.HandleSNSEvent(context.TODO(), event, func(ctx context.Context, record SNSEventRecord) error {
+		handled = append(handled, record)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, handled, 2)
+	assert.Equal(t, "plain message", handled[0].SNS.Message)
+	assert.Equal(t, "hefty message", handled[1].SNS.Message)
+	assert.Equal(t, map[string]interface{}{"attr": map[string]interface{}{"Type": "String", "Value": "value"}}, handled[1].SNS.MessageAttributes)
+
+	// the failing record does not stop the other records
+	handled = nil
+	err = wrapper.HandleSNSEvent(context.TODO(), event, func(ctx context.Context, record SNSEventRecord) error {
+		handled = append(handled, record)
+		if record.SNS.MessageID == "plain" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	assert.ErrorContains(t, err, "failed")
+	assert.Len(t, handled, 2)
+}
+
+func TestUnwrapSNSEnvelope(t *testing.T) {
+	jsonRefMsg := `{"identifier":"d3131a62e0224688b77a506fd333dac4","s3_key":"MyTopic/hefty"}`
+	escaped, err := json.Marshal(types.SNSMessage{Message: jsonRefMsg})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name     string
+		message  string
+		expected string
+	}{
+		{name: "published envelope", message: `{"default":"` + jsonRefMsg + `"}`, expected: jsonRefMsg},
+		{name: "json envelope", message: string(escaped), expected: jsonRefMsg},
+		{name: "reference message", message: jsonRefMsg, expected: jsonRefMsg},
+		{name: "envelope of other message", message: `{"default":"plain message"}`, expected: `{"default":"plain message"}`},
+		{name: "plain message", message: "plain message", expected: "plain message"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, unwrapSNSEnvelope(test.message))
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// ReceiveHeftyMessageLazyOutput is the output of ReceiveHeftyMessageLazy
+type ReceiveHeftyMessageLazyOutput struct {
+	Messages       []LazyMessage
+	ResultMetadata middleware.Metadata
+}
+
+// LazyMessage is a message received by ReceiveHeftyMessageLazy. The body of a hefty message is its reference message
+// until it is fetched with its PayloadHandle. The receipt handle is the one DeleteHeftyMessage expects.
+type LazyMessage struct {
+	sqs_types.Message
+	// Payload is nil for messages that are not hefty messages
+	Payload *PayloadHandle
+}
+
+// PayloadHandle describes the hefty message of a message received by ReceiveHeftyMessageLazy without downloading it
+type PayloadHandle struct {
+	// Bucket and Key locate the hefty message in AWS S3 or in the payload store named by Backend
+	Bucket    string
+	Key       string
+	VersionId string
+	Backend   string
+	// Size is the number of bytes of the serialized hefty message, or 0 when it was sent by a version that did not record it
+	Size int64
+
+	wrapper  *SqsClientWrapper
+	queueUrl string
+	refMsg   *types.ReferenceMsg
+	msg      sqs_types.Message
+}
+
+// Fetch downloads the hefty message and returns a copy of the received message with its body and message attributes.
+// The hefty message is downloaded again on every call.
+func (handle *PayloadHandle) Fetch(ctx context.Context) (*sqs_types.Message, error) {
+	msg := handle.msg
+	if err := handle.wrapper.resolveMessage(ctx, &middleware.Metadata{}, handle.queueUrl, &msg, handle.refMsg); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+// ReceiveHeftyMessageLazy receives messages like ReceiveHeftyMessage without downloading their hefty messages. Each
+// hefty message is described by the PayloadHandle of its message and is downloaded by its Fetch method, so that
+// messages can be filtered or routed on their system attributes, message id or size before paying for the download.
+// Message attributes are stored with the hefty message, so they are only available once it is fetched.
+func (wrapper *SqsClientWrapper) ReceiveHeftyMessageLazy(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*ReceiveHeftyMessageLazyOutput, error) {
+	out, err := wrapper.sqsClient().ReceiveMessage(ctx, params, wrapper.withOptFns(optFns)...)
+	if err != nil || out == nil {
+		return nil, err
+	}
+
+	lazyOut := &ReceiveHeftyMessageLazyOutput{Messages: make([]LazyMessage, len(out.Messages)), ResultMetadata: out.ResultMetadata}
+	for i := range out.Messages {
+		msg := &lazyOut.Messages[i]
+		msg.Message = out.Messages[i]
+
+		if types.IsInlineMsg(aws.ToString(msg.Body)) {
+			wrapper.decompressMessage(ctx, &lazyOut.ResultMetadata, &msg.Message)
+			continue
+		}
+
+		if !types.IsReferenceMsg(aws.ToString(msg.Body)) {
+			continue
+		}
+
+		refMsg, err := types.ToReferenceMsg(*msg.Body)
+		if err != nil {
+			addErrorToSqsMessage(&msg.Message, nil, fmt.Errorf("unable to unmarshal reference message. %v", err))
+			continue
+		}
+
+		// modify receipt handle to contain s3 bucket and key info
+		receiptHandle, err := wrapper.encodeReceiptHandle(ctx, heftyReceiptHandle{
+			receiptHandle: *msg.ReceiptHandle,
+			bucket:        refMsg.S3Bucket,
+			key:           refMsg.S3Key,
+			backend:       refMsg.Backend,
+			versionId:     refMsg.S3VersionId,
+			counted:       refMsg.Counted,
+		})
+		if err != nil {
+			// the message must not be deleted without its hefty message, which cannot be done without the receipt handle
+			addErrorToSqsMessage(&msg.Message, refMsg, err)
+			msg.Message.ReceiptHandle = nil
+			continue
+		}
+		msg.ReceiptHandle = &receiptHandle
+
+		msg.Payload = &PayloadHandle{
+			Bucket:    refMsg.S3Bucket,
+			Key:       refMsg.S3Key,
+			VersionId: refMsg.S3VersionId,
+			Backend:   refMsg.Backend,
+			Size:      refMsg.Size,
+			wrapper:   wrapper,
+			queueUrl:  aws.ToString(params.QueueUrl),
+			refMsg:    refMsg,
+			msg:       msg.Message,
+		}
+	}
+
+	return lazyOut, nil
+}
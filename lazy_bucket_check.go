@@ -0,0 +1,42 @@
+package hefty
+
+import (
+	"context"
+	"sync"
+)
+
+// lazyBucketCheck validates buckets on the first AWS S3 operation on them instead of when the client wrapper is created.
+// Buckets are only validated again when their validation failed.
+type lazyBucketCheck struct {
+	validate  func(ctx context.Context, bucket string) error
+	mu        sync.Mutex
+	validated map[string]struct{}
+}
+
+func newLazyBucketCheck(validate func(ctx context.Context, bucket string) error) *lazyBucketCheck {
+	return &lazyBucketCheck{
+		validate:  validate,
+		validated: map[string]struct{}{},
+	}
+}
+
+// ensure validates `bucket` unless it was already validated. Nothing is validated when buckets are not checked lazily.
+func (check *lazyBucketCheck) ensure(ctx context.Context, bucket string) error {
+	if check == nil {
+		return nil
+	}
+
+	// concurrent first operations on a bucket wait for a single validation
+	check.mu.Lock()
+	defer check.mu.Unlock()
+
+	if _, ok := check.validated[bucket]; ok {
+		return nil
+	}
+	if err := check.validate(ctx, bucket); err != nil {
+		return err
+	}
+
+	check.validated[bucket] = struct{}{}
+	return nil
+}
@@ -0,0 +1,33 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLazyBucketCheck(t *testing.T) {
+	calls := map[string]int{}
+	check := newLazyBucketCheck(func(_ context.Context, bucket string) error {
+		calls[bucket]++
+		if bucket == "missing" {
+			return errors.New("bucket missing does not exist or is not accessible")
+		}
+		return nil
+	})
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, check.ensure(context.TODO(), "bucket"))
+		assert.NotNil(t, check.ensure(context.TODO(), "missing"))
+	}
+
+	// successful validations are cached while failed validations are retried
+	assert.Equal(t, 1, calls["bucket"])
+	assert.Equal(t, 3, calls["missing"])
+
+	// nothing is validated when buckets are not checked lazily
+	var disabled *lazyBucketCheck
+	assert.Nil(t, disabled.ensure(context.TODO(), "missing"))
+}
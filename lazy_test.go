@@ -0,0 +1,46 @@
+package hefty
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiveHeftyMessageLazy(t *testing.T) {
+	queueUrl := "https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue"
+	store := &memoryStore{payloads: map[string][]byte{}}
+	storage := &payloadStorage{payloadStore: store, payloadMaxSize: 1024}
+	client := &fakeReceiveAPI{messages: []sqs_types.Message{
+		{MessageId: aws.String("hefty"), ReceiptHandle: aws.String("cmVjZWlwdA=="), Body: aws.String(withSize(t, storedReferenceMessage(t, storage, "MyQueue/hefty", "hefty message"), 100))},
+		{MessageId: aws.String("plain"), ReceiptHandle: aws.String("cmVjZWlwdA=="), Body: aws.String("plain message")},
+	}}
+	wrapper := &SqsClientWrapper{storage: storage, api: client}
+
+	out, err := wrapper.ReceiveHeftyMessageLazy(context.TODO(), &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueUrl)})
+	assert.NoError(t, err)
+	assert.Len(t, out.Messages, 2)
+
+	hefty := out.Messages[0]
+	assert.True(t, types.IsReferenceMsg(aws.ToString(hefty.Body)))
+	assert.NotEqual(t, "cmVjZWlwdA==", aws.ToString(hefty.ReceiptHandle))
+	assert.Equal(t, "MyQueue/hefty", hefty.Payload.Key)
+	assert.Equal(t, "memory", hefty.Payload.Backend)
+	assert.Equal(t, int64(100), hefty.Payload.Size)
+
+	fetched, err := hefty.Payload.Fetch(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, "hefty message", aws.ToString(fetched.Body))
+	assert.Equal(t, "value", aws.ToString(fetched.MessageAttributes["attr"].StringValue))
+	assert.Equal(t, hefty.ReceiptHandle, fetched.ReceiptHandle)
+	assert.True(t, types.IsReferenceMsg(aws.ToString(hefty.Body)))
+
+	plain := out.Messages[1]
+	assert.Nil(t, plain.Payload)
+	assert.Equal(t, "plain message", aws.ToString(plain.Body))
+	assert.Equal(t, "cmVjZWlwdA==", aws.ToString(plain.ReceiptHandle))
+}
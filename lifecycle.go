@@ -0,0 +1,163 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// PayloadLifecycle describes an AWS S3 lifecycle rule for the hefty messages under a key prefix. It bounds the number of
+// hefty messages that are left behind in AWS S3 when their reference messages expire or are deleted without
+// DeleteHeftyMessage, e.g. when a queue is purged.
+type PayloadLifecycle struct {
+	Id                       string                         // id of the lifecycle rule
+	Prefix                   string                         // key prefix of the hefty messages the rule applies to
+	ExpirationDays           int32                          // days after upload hefty messages expire; 0 disables expiration
+	AbortMultipartUploadDays int32                          // days after which incomplete multipart uploads are aborted; 0 disables aborting
+	TransitionDays           int32                          // days after upload hefty messages transition to TransitionStorageClass; 0 disables the transition
+	TransitionStorageClass   s3types.TransitionStorageClass // storage class hefty messages transition to
+	Tags                     map[string]string              // tags the hefty messages the rule applies to must have
+}
+
+// maxTaggedExpirationDays is the maximum number of days of the lifecycle rules installed by ConfigureTaggedExpiration
+const maxTaggedExpirationDays = 365
+
+// TaggedExpiration returns the lifecycle rule expiring the hefty messages under `prefix` that are tagged to expire after
+// `days` days, see WithExpiryFromQueueRetention
+func TaggedExpiration(prefix string, days int32) PayloadLifecycle {
+	return PayloadLifecycle{
+		Id:             fmt.Sprintf("hefty-expiration-%d-days", days),
+		Prefix:         prefix,
+		ExpirationDays: days,
+		Tags:           expirationTags(days),
+	}
+}
+
+// lifecycleClient is the part of the AWS S3 client used to manage the lifecycle configuration of a bucket
+type lifecycleClient interface {
+	GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error)
+}
+
+// ConfigureLifecycle installs the lifecycle rule `lifecycle.Id` on `bucket`, or updates it when the bucket already has a
+// rule with that id. The other lifecycle rules of the bucket are kept. Note that hefty messages whose reference messages
+// are still in a queue must not expire, so the expiration should be longer than the message retention period of the
+// queues the hefty messages are sent to.
+func ConfigureLifecycle(ctx context.Context, s3Client *s3.Client, bucket string, lifecycle PayloadLifecycle, optFns ...func(*s3.Options)) error {
+	return configureLifecycle(ctx, s3Client, bucket, []PayloadLifecycle{lifecycle}, optFns...)
+}
+
+// ConfigureTaggedExpiration installs or updates the lifecycle rules returned by TaggedExpiration for 1 to `maxDays` days
+// on `bucket`, so that the hefty messages under `prefix` expire after the number of days they are tagged with. The other
+// lifecycle rules of the bucket are kept.
+func ConfigureTaggedExpiration(ctx context.Context, s3Client *s3.Client, bucket, prefix string, maxDays int32, optFns ...func(*s3.Options)) error {
+	if maxDays < 1 || maxDays > maxTaggedExpirationDays {
+		return fmt.Errorf("max days of %d must be between 1 and %d", maxDays, maxTaggedExpirationDays)
+	}
+
+	lifecycles := make([]PayloadLifecycle, 0, maxDays)
+	for days := int32(1); days <= maxDays; days++ {
+		lifecycles = append(lifecycles, TaggedExpiration(prefix, days))
+	}
+
+	return configureLifecycle(ctx, s3Client, bucket, lifecycles, optFns...)
+}
+
+// configureLifecycle puts the rules of `lifecycles` on `bucket`, replacing existing rules with the same ids
+func configureLifecycle(ctx context.Context, client lifecycleClient, bucket string, lifecycles []PayloadLifecycle, optFns ...func(*s3.Options)) error {
+	rules := make([]s3types.LifecycleRule, 0, len(lifecycles))
+	ids := map[string]struct{}{}
+	for _, lifecycle := range lifecycles {
+		rule, err := lifecycle.rule()
+		if err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+		ids[lifecycle.Id] = struct{}{}
+	}
+
+	out, err := client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(bucket)}, optFns...)
+	if err != nil && !isApiErrorCode(err, "NoSuchLifecycleConfiguration") {
+		return fmt.Errorf("unable to get lifecycle configuration of bucket %s. %v", bucket, err)
+	}
+
+	// replace the rules with the same ids and keep all other rules
+	if out != nil {
+		for _, existing := range out.Rules {
+			if _, ok := ids[aws.ToString(existing.ID)]; !ok {
+				rules = append(rules, existing)
+			}
+		}
+	}
+
+	_, err = client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(bucket),
+		LifecycleConfiguration: &s3types.BucketLifecycleConfiguration{Rules: rules},
+	}, optFns...)
+	if err != nil {
+		return fmt.Errorf("unable to put lifecycle configuration of bucket %s. %v", bucket, err)
+	}
+
+	return nil
+}
+
+func (lifecycle PayloadLifecycle) rule() (s3types.LifecycleRule, error) {
+	if lifecycle.Id == "" {
+		return s3types.LifecycleRule{}, errors.New("lifecycle rule id must not be empty")
+	}
+	if lifecycle.ExpirationDays < 0 || lifecycle.AbortMultipartUploadDays < 0 || lifecycle.TransitionDays < 0 {
+		return s3types.LifecycleRule{}, errors.New("lifecycle rule days must not be negative")
+	}
+	if lifecycle.ExpirationDays == 0 && lifecycle.AbortMultipartUploadDays == 0 && lifecycle.TransitionDays == 0 {
+		return s3types.LifecycleRule{}, errors.New("at least one lifecycle action must be enabled")
+	}
+
+	rule := s3types.LifecycleRule{
+		ID:     aws.String(lifecycle.Id),
+		Status: s3types.ExpirationStatusEnabled,
+		Filter: &s3types.LifecycleRuleFilterMemberPrefix{Value: lifecycle.Prefix},
+	}
+	if len(lifecycle.Tags) > 0 {
+		rule.Filter = &s3types.LifecycleRuleFilterMemberAnd{Value: s3types.LifecycleRuleAndOperator{
+			Prefix: aws.String(lifecycle.Prefix),
+			Tags:   tagSetOf(lifecycle.Tags),
+		}}
+	}
+	if lifecycle.ExpirationDays != 0 {
+		rule.Expiration = &s3types.LifecycleExpiration{Days: aws.Int32(lifecycle.ExpirationDays)}
+	}
+	if lifecycle.AbortMultipartUploadDays != 0 {
+		rule.AbortIncompleteMultipartUpload = &s3types.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int32(lifecycle.AbortMultipartUploadDays),
+		}
+	}
+	if lifecycle.TransitionDays != 0 {
+		if !isTransitionStorageClass(lifecycle.TransitionStorageClass) {
+			return s3types.LifecycleRule{}, fmt.Errorf("transition storage class %s is not supported", lifecycle.TransitionStorageClass)
+		}
+		if lifecycle.ExpirationDays != 0 && lifecycle.TransitionDays >= lifecycle.ExpirationDays {
+			return s3types.LifecycleRule{}, errors.New("transition days must be less than expiration days")
+		}
+		rule.Transitions = []s3types.Transition{{
+			Days:         aws.Int32(lifecycle.TransitionDays),
+			StorageClass: lifecycle.TransitionStorageClass,
+		}}
+	}
+
+	return rule, nil
+}
+
+// isTransitionStorageClass checks whether `class` is a storage class AWS S3 lifecycle rules can transition objects to
+func isTransitionStorageClass(class s3types.TransitionStorageClass) bool {
+	for _, known := range class.Values() {
+		if class == known {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,89 @@
+package hefty
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeLifecycleClient struct {
+	rules []s3types.LifecycleRule
+}
+
+func (c *fakeLifecycleClient) GetBucketLifecycleConfiguration(context.Context, *s3.GetBucketLifecycleConfigurationInput, ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	if c.rules == nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchLifecycleConfiguration"}
+	}
+	return &s3.GetBucketLifecycleConfigurationOutput{Rules: c.rules}, nil
+}
+
+func (c *fakeLifecycleClient) PutBucketLifecycleConfiguration(_ context.Context, params *s3.PutBucketLifecycleConfigurationInput, _ ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	c.rules = params.LifecycleConfiguration.Rules
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+func TestPayloadLifecycleRule(t *testing.T) {
+	var tests = []struct {
+		desc      string
+		lifecycle PayloadLifecycle
+		expErr    bool
+	}{
+		{desc: "expiration", lifecycle: PayloadLifecycle{Id: "hefty", Prefix: "hefty/", ExpirationDays: 14}},
+		{desc: "all_actions", lifecycle: PayloadLifecycle{Id: "hefty", ExpirationDays: 90, AbortMultipartUploadDays: 1, TransitionDays: 30, TransitionStorageClass: s3types.TransitionStorageClassStandardIa}},
+		{desc: "missing_id", lifecycle: PayloadLifecycle{ExpirationDays: 14}, expErr: true},
+		{desc: "no_actions", lifecycle: PayloadLifecycle{Id: "hefty"}, expErr: true},
+		{desc: "negative_days", lifecycle: PayloadLifecycle{Id: "hefty", ExpirationDays: -1}, expErr: true},
+		{desc: "unknown_storage_class", lifecycle: PayloadLifecycle{Id: "hefty", TransitionDays: 30, TransitionStorageClass: "FOO"}, expErr: true},
+		{desc: "transition_after_expiration", lifecycle: PayloadLifecycle{Id: "hefty", ExpirationDays: 14, TransitionDays: 30, TransitionStorageClass: s3types.TransitionStorageClassGlacier}, expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			rule, err := tt.lifecycle.rule()
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.lifecycle.Id, aws.ToString(rule.ID))
+			assert.Equal(t, &s3types.LifecycleRuleFilterMemberPrefix{Value: tt.lifecycle.Prefix}, rule.Filter)
+			assert.Equal(t, tt.lifecycle.ExpirationDays != 0, rule.Expiration != nil)
+			assert.Equal(t, tt.lifecycle.AbortMultipartUploadDays != 0, rule.AbortIncompleteMultipartUpload != nil)
+			assert.Equal(t, tt.lifecycle.TransitionDays != 0, len(rule.Transitions) == 1)
+		})
+	}
+}
+
+func TestConfigureLifecycle(t *testing.T) {
+	client := &fakeLifecycleClient{}
+
+	// rule is installed on a bucket without lifecycle configuration
+	err := configureLifecycle(context.TODO(), client, "bucket", []PayloadLifecycle{{Id: "hefty", ExpirationDays: 14}})
+	assert.Nil(t, err)
+	assert.Len(t, client.rules, 1)
+
+	// rule is updated and other rules are kept
+	client.rules = append(client.rules, s3types.LifecycleRule{ID: aws.String("other"), Status: s3types.ExpirationStatusEnabled})
+	err = configureLifecycle(context.TODO(), client, "bucket", []PayloadLifecycle{{Id: "hefty", ExpirationDays: 7}})
+	assert.Nil(t, err)
+	assert.Len(t, client.rules, 2)
+	assert.Equal(t, "hefty", aws.ToString(client.rules[0].ID))
+	assert.Equal(t, int32(7), aws.ToInt32(client.rules[0].Expiration.Days))
+	assert.Equal(t, "other", aws.ToString(client.rules[1].ID))
+}
+
+func TestTaggedExpiration(t *testing.T) {
+	rule, err := TaggedExpiration("hefty/", 5).rule()
+	assert.Nil(t, err)
+	assert.Equal(t, "hefty-expiration-5-days", aws.ToString(rule.ID))
+	assert.Equal(t, int32(5), aws.ToInt32(rule.Expiration.Days))
+	assert.Equal(t, &s3types.LifecycleRuleFilterMemberAnd{Value: s3types.LifecycleRuleAndOperator{
+		Prefix: aws.String("hefty/"),
+		Tags:   []s3types.Tag{{Key: aws.String(TagKeyExpirationDays), Value: aws.String("5")}},
+	}}, rule.Filter)
+}
@@ -0,0 +1,65 @@
+// Package limits is a registry of the AWS message size limits used by the hefty client wrappers to decide if a message
+// needs to be stored as a hefty message. Limits can be overridden at runtime so that a change to an AWS limit does not
+// require a change to the client wrappers.
+package limits
+
+import "sync"
+
+// Service is an AWS service that messages are sent through
+type Service string
+
+const (
+	SQS         Service = "sqs"
+	SNS         Service = "sns"
+	EventBridge Service = "eventbridge"
+	LambdaAsync Service = "lambda-async" // asynchronous invocation payloads
+	Kinesis     Service = "kinesis"
+)
+
+var defaults = map[Service]int{
+	SQS:         262_144,   // 256KB
+	SNS:         262_144,   // 256KB
+	EventBridge: 262_144,   // 256KB
+	LambdaAsync: 262_144,   // 256KB
+	Kinesis:     1_048_576, // 1MB
+}
+
+var (
+	mu        sync.RWMutex
+	overrides = map[Service]int{}
+)
+
+// MaxMessageLength returns the maximum message size in bytes of `service`, including any override. A service that is
+// unknown and has no override returns 0.
+func MaxMessageLength(service Service) int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if limit, ok := overrides[service]; ok {
+		return limit
+	}
+
+	return defaults[service]
+}
+
+// Default returns the maximum message size in bytes of `service` as documented by AWS, ignoring overrides.
+func Default(service Service) int {
+	return defaults[service]
+}
+
+// Override replaces the maximum message size of `service` with `maxBytes`. This can be used for services not known to
+// this package, or when AWS changes a limit before this package is updated.
+func Override(service Service, maxBytes int) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	overrides[service] = maxBytes
+}
+
+// Reset removes an override so that the maximum message size of `service` is the default again.
+func Reset(service Service) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	delete(overrides, service)
+}
@@ -0,0 +1,23 @@
+package limits
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxMessageLength(t *testing.T) {
+	assert.Equal(t, 262_144, MaxMessageLength(SQS))
+	assert.Equal(t, 1_048_576, MaxMessageLength(Kinesis))
+	assert.Equal(t, 0, MaxMessageLength("unknown"))
+
+	// test override
+	Override(SQS, 1_048_576)
+	assert.Equal(t, 1_048_576, MaxMessageLength(SQS))
+	assert.Equal(t, 262_144, Default(SQS))
+	assert.Equal(t, 262_144, MaxMessageLength(SNS))
+
+	// test reset
+	Reset(SQS)
+	assert.Equal(t, 262_144, MaxMessageLength(SQS))
+}
@@ -0,0 +1,195 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ListHeftyObjectsInput selects the hefty messages listed by ListHeftyObjects. Zero values do not filter.
+type ListHeftyObjectsInput struct {
+	// Target is the AWS SQS queue url or AWS SNS topic arn whose hefty messages are listed. All hefty messages under the
+	// key prefix of the wrapper are listed when empty.
+	Target string
+	// Tenant is the tenant whose hefty messages are listed when WithTenants is used.
+	Tenant string
+	// MinAge and MaxAge select hefty messages by the time since they were stored.
+	MinAge time.Duration
+	MaxAge time.Duration
+	// MinSize and MaxSize select hefty messages by the size in bytes of the stored object.
+	MinSize int64
+	MaxSize int64
+	// Limit is the maximum number of hefty messages listed.
+	Limit int
+}
+
+// HeftyObject is a hefty message stored in AWS S3 described by its object metadata. The metadata fields are empty for
+// hefty messages stored without metadata.
+type HeftyObject struct {
+	Bucket       string
+	Key          string
+	Size         int64 // size in bytes of the stored object
+	LastModified time.Time
+	StorageClass string
+
+	Source         string // queue url or topic arn the message was sent to
+	FormatVersion  int
+	BodySize       int // size in bytes of the original message body
+	AttributeCount int
+	SentTimestamp  time.Time
+}
+
+// ListHeftyObjectsOutput is the output of ListHeftyObjects
+type ListHeftyObjectsOutput struct {
+	Objects []HeftyObject
+}
+
+// heftyObjectsClient is the part of the AWS S3 client used to list hefty messages
+type heftyObjectsClient interface {
+	s3.ListObjectsV2APIClient
+	s3.HeadObjectAPIClient
+}
+
+// ListHeftyObjects lists the hefty messages stored in AWS S3 for operational dashboards and cleanup decisions. Only the
+// object metadata of each hefty message is read; hefty messages are not downloaded. Hefty messages of a queue are found
+// by the part of their key that is the same for all hefty messages of the queue, and are then matched by the source in
+// their metadata. Hefty messages kept in a payload store are not listed.
+func (wrapper *SqsClientWrapper) ListHeftyObjects(ctx context.Context, input *ListHeftyObjectsInput) (*ListHeftyObjectsOutput, error) {
+	prefix := wrapper.storage.keys.prefix
+	if input.Target != "" {
+		tokens := strings.Split(input.Target, "/")
+		if len(tokens) != 5 {
+			return nil, fmt.Errorf("expected %d tokens when splitting queueUrl by '/' but received %d", 5, len(tokens))
+		}
+
+		var err error
+		prefix, err = wrapper.storage.keys.staticPrefix(tokens[4], tokens[4])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	objects, err := wrapper.storage.listHeftyObjects(ctx, wrapper.storage.s3Client, input, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListHeftyObjectsOutput{Objects: objects}, nil
+}
+
+// ListHeftyObjects lists the hefty messages stored in AWS S3 for operational dashboards and cleanup decisions. Only the
+// object metadata of each hefty message is read; hefty messages are not downloaded. Hefty messages of a topic are found
+// by the part of their key that is the same for all hefty messages of the topic, and are then matched by the source in
+// their metadata. Hefty messages kept in a payload store are not listed.
+func (wrapper *SnsClientWrapper) ListHeftyObjects(ctx context.Context, input *ListHeftyObjectsInput) (*ListHeftyObjectsOutput, error) {
+	prefix := wrapper.storage.keys.prefix
+	if input.Target != "" {
+		tokens := strings.Split(input.Target, ":")
+		if len(tokens) != 6 {
+			return nil, fmt.Errorf("expected %d tokens when splitting topicArn by ':' but received %d", 6, len(tokens))
+		}
+
+		var err error
+		prefix, err = wrapper.storage.keys.staticPrefix(tokens[4], tokens[5])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	objects, err := wrapper.storage.listHeftyObjects(ctx, wrapper.storage.s3Client, input, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListHeftyObjectsOutput{Objects: objects}, nil
+}
+
+// listHeftyObjects lists the hefty messages under the key prefix `prefix` selected by `input`
+func (storage *payloadStorage) listHeftyObjects(ctx context.Context, client heftyObjectsClient, input *ListHeftyObjectsInput, prefix string) ([]HeftyObject, error) {
+	if input.Tenant != "" {
+		if err := validateTenant(input.Tenant); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	var objects []HeftyObject
+	for _, location := range storage.prefixLocations(input.Target, prefix) {
+		if input.Tenant != "" {
+			location.Prefix = input.Tenant + "/" + location.Prefix
+		}
+
+		paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+			Bucket:              aws.String(location.Bucket),
+			Prefix:              aws.String(location.Prefix),
+			ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx, storage.s3OptFns...)
+			if err != nil {
+				return nil, fmt.Errorf("unable to list hefty messages in %s/%s. %v", location.Bucket, location.Prefix, err)
+			}
+
+			for _, listed := range page.Contents {
+				object := HeftyObject{
+					Bucket:       location.Bucket,
+					Key:          aws.ToString(listed.Key),
+					Size:         aws.ToInt64(listed.Size),
+					LastModified: aws.ToTime(listed.LastModified),
+					StorageClass: string(listed.StorageClass),
+				}
+				if !input.matches(now, object) {
+					continue
+				}
+
+				out, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+					Bucket:              aws.String(object.Bucket),
+					Key:                 aws.String(object.Key),
+					ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+				}, storage.s3OptFns...)
+				if isNoSuchKey(err) {
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("unable to get metadata of hefty message %s/%s. %v", object.Bucket, object.Key, err)
+				}
+
+				object.decodeMetadata(out.Metadata)
+				if input.Target != "" && object.Source != input.Target {
+					continue
+				}
+
+				objects = append(objects, object)
+				if input.Limit > 0 && len(objects) == input.Limit {
+					return objects, nil
+				}
+			}
+		}
+	}
+
+	return objects, nil
+}
+
+// matches checks whether a listed hefty message is selected by its age and size
+func (input *ListHeftyObjectsInput) matches(now time.Time, object HeftyObject) bool {
+	age := now.Sub(object.LastModified)
+	return (input.MinAge == 0 || age >= input.MinAge) &&
+		(input.MaxAge == 0 || age <= input.MaxAge) &&
+		(input.MinSize == 0 || object.Size >= input.MinSize) &&
+		(input.MaxSize == 0 || object.Size <= input.MaxSize)
+}
+
+// decodeMetadata sets the fields of a hefty message that are read from the metadata written by newObjectMetadata.
+// Metadata that cannot be parsed is ignored.
+func (object *HeftyObject) decodeMetadata(metadata map[string]string) {
+	object.Source = metadata[MetadataKeySource]
+	object.FormatVersion, _ = strconv.Atoi(metadata[MetadataKeyFormatVersion])
+	object.BodySize, _ = strconv.Atoi(metadata[MetadataKeyBodySize])
+	object.AttributeCount, _ = strconv.Atoi(metadata[MetadataKeyAttributeCount])
+	object.SentTimestamp, _ = time.Parse(time.RFC3339, metadata[KeySentTimestamp])
+}
@@ -0,0 +1,107 @@
+package hefty
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeHeftyObjectsClient struct {
+	*fakePayloadPrefixClient
+	metadata map[string]map[string]string
+	heads    int
+}
+
+func (c *fakeHeftyObjectsClient) HeadObject(_ context.Context, params *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	c.heads++
+	return &s3.HeadObjectOutput{Metadata: c.metadata[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)]}, nil
+}
+
+func TestPayloadStorageListHeftyObjects(t *testing.T) {
+	const queueUrl = "https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue"
+	client := &fakeHeftyObjectsClient{
+		fakePayloadPrefixClient: &fakePayloadPrefixClient{objects: map[string]map[string]bool{
+			"bucket": {"MyQueue/1": true, "MyQueue/2": true, "Other/1": true, "tenant/MyQueue/1": true},
+		}},
+		metadata: map[string]map[string]string{
+			"bucket/MyQueue/1": {
+				MetadataKeySource:         queueUrl,
+				MetadataKeyFormatVersion:  "1",
+				MetadataKeyBodySize:       "300000",
+				MetadataKeyAttributeCount: "2",
+				KeySentTimestamp:          "2024-03-01T10:00:00Z",
+			},
+			"bucket/MyQueue/2":        {MetadataKeySource: "https://sqs.us-west-2.amazonaws.com/765908583888/MyQueueCopy"},
+			"bucket/Other/1":          {MetadataKeySource: "https://sqs.us-west-2.amazonaws.com/765908583888/Other"},
+			"bucket/tenant/MyQueue/1": {MetadataKeySource: queueUrl},
+		},
+	}
+	storage := &payloadStorage{bucket: "bucket"}
+
+	var tests = []struct {
+		desc     string
+		input    ListHeftyObjectsInput
+		prefix   string
+		expected []string
+	}{
+		{desc: "all", input: ListHeftyObjectsInput{}, expected: []string{"MyQueue/1", "MyQueue/2", "Other/1", "tenant/MyQueue/1"}},
+		{desc: "target", input: ListHeftyObjectsInput{Target: queueUrl}, prefix: "MyQueue/", expected: []string{"MyQueue/1"}},
+		{desc: "tenant", input: ListHeftyObjectsInput{Target: queueUrl, Tenant: "tenant"}, prefix: "MyQueue/", expected: []string{"tenant/MyQueue/1"}},
+		{desc: "limit", input: ListHeftyObjectsInput{Limit: 1}, expected: []string{"MyQueue/1"}},
+		{desc: "size", input: ListHeftyObjectsInput{MinSize: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			objects, err := storage.listHeftyObjects(context.TODO(), client, &tt.input, tt.prefix)
+			assert.Nil(t, err)
+
+			var keys []string
+			for _, object := range objects {
+				keys = append(keys, object.Key)
+			}
+			assert.Equal(t, tt.expected, keys)
+		})
+	}
+
+	objects, err := storage.listHeftyObjects(context.TODO(), client, &ListHeftyObjectsInput{Target: queueUrl}, "MyQueue/")
+	assert.Nil(t, err)
+	assert.Equal(t, HeftyObject{
+		Bucket:         "bucket",
+		Key:            "MyQueue/1",
+		Size:           1,
+		Source:         queueUrl,
+		FormatVersion:  1,
+		BodySize:       300000,
+		AttributeCount: 2,
+		SentTimestamp:  time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+	}, objects[0])
+}
+
+func TestListHeftyObjectsInputMatches(t *testing.T) {
+	now := time.Now()
+	object := HeftyObject{Size: 100, LastModified: now.Add(-time.Hour)}
+
+	var tests = []struct {
+		desc     string
+		input    ListHeftyObjectsInput
+		expected bool
+	}{
+		{desc: "no_filter", input: ListHeftyObjectsInput{}, expected: true},
+		{desc: "min_age", input: ListHeftyObjectsInput{MinAge: 2 * time.Hour}, expected: false},
+		{desc: "max_age", input: ListHeftyObjectsInput{MaxAge: 2 * time.Hour}, expected: true},
+		{desc: "max_age_exceeded", input: ListHeftyObjectsInput{MaxAge: time.Minute}, expected: false},
+		{desc: "min_size", input: ListHeftyObjectsInput{MinSize: 100}, expected: true},
+		{desc: "max_size_exceeded", input: ListHeftyObjectsInput{MaxSize: 99}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.input.matches(now, object))
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package hefty
+
+import (
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Md5Digests are the md5 digests of the message body and message attributes of a message
+type Md5Digests struct {
+	Body       *string
+	Attributes *string
+}
+
+// keys of the md5 digests recorded in the result metadata of AWS SQS outputs
+type sqsMd5DigestsKey struct{}
+type heftyMd5DigestsKey struct{}
+
+// SqsMd5Digests returns the md5 digests AWS SQS calculated for the reference or inline message actually sent in place of
+// the message with id `messageId`, from the result metadata of the output of SendHeftyMessage or ReceiveHeftyMessage.
+// It returns false for messages that were sent as is.
+func SqsMd5Digests(metadata middleware.Metadata, messageId string) (Md5Digests, bool) {
+	return md5DigestsOf(metadata, sqsMd5DigestsKey{}, messageId)
+}
+
+// HeftyMd5Digests returns the md5 digests of the message with id `messageId` as it was given to SendHeftyMessage or is
+// returned by ReceiveHeftyMessage, from the result metadata of their outputs. It returns false for messages that were
+// sent as is.
+func HeftyMd5Digests(metadata middleware.Metadata, messageId string) (Md5Digests, bool) {
+	return md5DigestsOf(metadata, heftyMd5DigestsKey{}, messageId)
+}
+
+func md5DigestsOf(metadata middleware.Metadata, key any, messageId string) (Md5Digests, bool) {
+	digests, ok := metadata.Get(key).(map[string]Md5Digests)
+	if !ok {
+		return Md5Digests{}, false
+	}
+
+	messageDigests, ok := digests[messageId]
+	return messageDigests, ok
+}
+
+// replaceMd5Digests records the md5 digests calculated by AWS SQS and the md5 digests of the hefty message of the message
+// with id `messageId` in the result metadata of an output, and replaces the md5 digests in the output with the digests of
+// the hefty message unless they are preserved
+func (wrapper *SqsClientWrapper) replaceMd5Digests(metadata *middleware.Metadata, messageId *string, md5Body, md5Attr **string, hefty Md5Digests) {
+	if messageId != nil {
+		recordMd5Digests(metadata, sqsMd5DigestsKey{}, *messageId, Md5Digests{Body: *md5Body, Attributes: *md5Attr})
+		recordMd5Digests(metadata, heftyMd5DigestsKey{}, *messageId, hefty)
+	}
+
+	if !wrapper.preserveMd5Digests {
+		*md5Body = hefty.Body
+		*md5Attr = hefty.Attributes
+	}
+}
+
+func recordMd5Digests(metadata *middleware.Metadata, key any, messageId string, messageDigests Md5Digests) {
+	digests, ok := metadata.Get(key).(map[string]Md5Digests)
+	if !ok {
+		digests = map[string]Md5Digests{}
+		metadata.Set(key, digests)
+	}
+
+	digests[messageId] = messageDigests
+}
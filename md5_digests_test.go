@@ -0,0 +1,51 @@
+package hefty
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceMd5Digests(t *testing.T) {
+	hefty := Md5Digests{Body: aws.String("hefty-body"), Attributes: aws.String("hefty-attr")}
+
+	var tests = []struct {
+		desc      string
+		preserve  bool
+		expBody   string
+		expAttr   string
+		messageId *string
+		expRecord bool
+	}{
+		{desc: "replaced", messageId: aws.String("id"), expBody: "hefty-body", expAttr: "hefty-attr", expRecord: true},
+		{desc: "preserved", preserve: true, messageId: aws.String("id"), expBody: "sqs-body", expAttr: "sqs-attr", expRecord: true},
+		{desc: "without_message_id", expBody: "hefty-body", expAttr: "hefty-attr"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			wrapper := &SqsClientWrapper{preserveMd5Digests: tt.preserve}
+			out := &sqs.SendMessageOutput{
+				MessageId:              tt.messageId,
+				MD5OfMessageBody:       aws.String("sqs-body"),
+				MD5OfMessageAttributes: aws.String("sqs-attr"),
+			}
+
+			wrapper.replaceMd5Digests(&out.ResultMetadata, out.MessageId, &out.MD5OfMessageBody, &out.MD5OfMessageAttributes, hefty)
+			assert.Equal(t, tt.expBody, aws.ToString(out.MD5OfMessageBody))
+			assert.Equal(t, tt.expAttr, aws.ToString(out.MD5OfMessageAttributes))
+
+			sqsDigests, ok := SqsMd5Digests(out.ResultMetadata, "id")
+			assert.Equal(t, tt.expRecord, ok)
+			heftyDigests, ok := HeftyMd5Digests(out.ResultMetadata, "id")
+			assert.Equal(t, tt.expRecord, ok)
+			if tt.expRecord {
+				assert.Equal(t, "sqs-body", aws.ToString(sqsDigests.Body))
+				assert.Equal(t, "sqs-attr", aws.ToString(sqsDigests.Attributes))
+				assert.Equal(t, hefty, heftyDigests)
+			}
+		})
+	}
+}
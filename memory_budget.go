@@ -0,0 +1,76 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// key of the ids of unresolved messages recorded in the result metadata of AWS SQS outputs
+type unresolvedKey struct{}
+
+// receiveBudget tracks the bytes of the hefty messages resolved by a single receive. A max of 0 is unlimited.
+type receiveBudget struct {
+	max  int64
+	used int64
+}
+
+// reserve reserves `size` bytes for a hefty message and reports whether it fits in the budget. The first hefty message
+// always fits. A hefty message of unknown size fits while the budget is not used up.
+func (budget *receiveBudget) reserve(size int64) bool {
+	if budget.max <= 0 {
+		return true
+	}
+
+	if budget.used > 0 && (budget.used+size > budget.max || budget.used >= budget.max) {
+		return false
+	}
+
+	budget.used += size
+	return true
+}
+
+// add accounts for a resolved hefty message whose size was unknown
+func (budget *receiveBudget) add(size int64) {
+	budget.used += size
+}
+
+// recordUnresolved records the id of a message left unresolved in the result metadata of an output
+func recordUnresolved(metadata *middleware.Metadata, messageId *string) {
+	unresolved, _ := metadata.Get(unresolvedKey{}).([]string)
+	metadata.Set(unresolvedKey{}, append(unresolved, aws.ToString(messageId)))
+}
+
+// UnresolvedMessages returns the ids of the messages ReceiveHeftyMessage returned with their reference message as body
+// because their hefty message did not fit in the memory budget, from the result metadata of its output. See
+// WithReceiveMemoryBudget.
+func UnresolvedMessages(metadata middleware.Metadata) []string {
+	unresolved, _ := metadata.Get(unresolvedKey{}).([]string)
+	return unresolved
+}
+
+// ResolveHeftyMessage replaces the reference message of a message received from the queue at `queueUrl` by
+// ReceiveHeftyMessage with its hefty message, e.g. for a message listed by UnresolvedMessages. The receipt handle of the
+// message is kept, so the message is deleted with DeleteHeftyMessage as usual. Messages without a reference message are
+// left unchanged.
+func (wrapper *SqsClientWrapper) ResolveHeftyMessage(ctx context.Context, queueUrl string, msg *sqs_types.Message) error {
+	if msg == nil {
+		return errors.New("message is nil")
+	}
+
+	if !types.IsReferenceMsg(aws.ToString(msg.Body)) {
+		return nil
+	}
+
+	refMsg, err := types.ToReferenceMsg(*msg.Body)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal reference message. %v", err)
+	}
+
+	return wrapper.resolveMessage(ctx, &middleware.Metadata{}, queueUrl, msg, refMsg)
+}
@@ -0,0 +1,99 @@
+package hefty
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeReceiveAPI returns copies of the same messages on every receive
+type fakeReceiveAPI struct {
+	SqsAPI
+	messages []sqs_types.Message
+}
+
+func (client *fakeReceiveAPI) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	return &sqs.ReceiveMessageOutput{Messages: append([]sqs_types.Message(nil), client.messages...)}, nil
+}
+
+// withSize sets the size of the hefty message of a reference message
+func withSize(t *testing.T, jsonRefMsg string, size int64) string {
+	refMsg, err := types.ToReferenceMsg(jsonRefMsg)
+	assert.NoError(t, err)
+	refMsg.Size = size
+
+	sized, err := json.Marshal(refMsg)
+	assert.NoError(t, err)
+
+	return string(sized)
+}
+
+func TestReceiveMemoryBudget(t *testing.T) {
+	storage := &payloadStorage{payloadStore: &memoryStore{payloads: map[string][]byte{}}, payloadMaxSize: 1024}
+	known := []string{
+		withSize(t, storedReferenceMessage(t, storage, "MyQueue/known1", "first hefty message"), 100),
+		withSize(t, storedReferenceMessage(t, storage, "MyQueue/known2", "second hefty message"), 100),
+		withSize(t, storedReferenceMessage(t, storage, "MyQueue/known3", "third hefty message"), 100),
+	}
+	unknown := []string{
+		storedReferenceMessage(t, storage, "MyQueue/unknown1", "first hefty message"),
+		storedReferenceMessage(t, storage, "MyQueue/unknown2", "second hefty message"),
+	}
+
+	tests := []struct {
+		name          string
+		bodies        []string
+		budget        int64
+		expUnresolved []string
+	}{
+		{name: "unlimited", bodies: known, budget: 0},
+		{name: "within budget", bodies: known, budget: 300},
+		{name: "over budget", bodies: known, budget: 250, expUnresolved: []string{"2"}},
+		{name: "first always resolved", bodies: known, budget: 50, expUnresolved: []string{"1", "2"}},
+		{name: "unknown sizes", bodies: unknown, budget: 10, expUnresolved: []string{"1"}},
+		{name: "plain messages", bodies: []string{"plain message", "plain message"}, budget: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeReceiveAPI{}
+			for i, body := range test.bodies {
+				client.messages = append(client.messages, sqs_types.Message{
+					MessageId:     aws.String(string(rune('0' + i))),
+					ReceiptHandle: aws.String("cmVjZWlwdA=="),
+					Body:          aws.String(body),
+				})
+			}
+			wrapper := &SqsClientWrapper{storage: storage, api: client, receiveMemoryBudget: test.budget}
+
+			out, err := wrapper.ReceiveHeftyMessage(context.TODO(), &sqs.ReceiveMessageInput{QueueUrl: aws.String("https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue")})
+			assert.NoError(t, err)
+			assert.Equal(t, test.expUnresolved, UnresolvedMessages(out.ResultMetadata))
+
+			for i := range out.Messages {
+				msg := &out.Messages[i]
+				assert.Equal(t, slices.Contains(test.expUnresolved, *msg.MessageId), types.IsReferenceMsg(*msg.Body))
+
+				// unresolved messages are resolved on their own, keeping their hefty receipt handle
+				receiptHandle := aws.ToString(msg.ReceiptHandle)
+				assert.NoError(t, wrapper.ResolveHeftyMessage(context.TODO(), "https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue", msg))
+				assert.False(t, types.IsReferenceMsg(*msg.Body))
+				assert.Equal(t, receiptHandle, aws.ToString(msg.ReceiptHandle))
+			}
+		})
+	}
+}
+
+func TestWithReceiveMemoryBudget(t *testing.T) {
+	opts := defaultOptions()
+	assert.NoError(t, WithReceiveMemoryBudget(1024)(&opts))
+	assert.Equal(t, int64(1024), opts.receiveMemoryBudget)
+	assert.Error(t, WithReceiveMemoryBudget(0)(&opts))
+}
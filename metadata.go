@@ -0,0 +1,89 @@
+package hefty
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+)
+
+// newObjectMetadata creates the S3 user metadata stored alongside a hefty message. The metadata allows
+// hefty messages in AWS S3 to be inspected and targeted by lifecycle policies without downloading them.
+func newObjectMetadata(source string, bodySize int, heftyMsg *messages.HeftyMessage) map[string]string {
+	return map[string]string{
+		MetadataKeySource:         source,
+		MetadataKeyFormatVersion:  strconv.Itoa(messages.FormatVersion),
+		MetadataKeyBodySize:       strconv.Itoa(bodySize),
+		MetadataKeyAttributeCount: strconv.Itoa(len(heftyMsg.MessageAttributes)),
+		KeySentTimestamp:          time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// tagObjectWithMessageId tags a hefty message in AWS S3 with the message id of its reference message. PutObjectTagging
+// replaces all tags of an object, so the tags the hefty message was uploaded with are given as `tags` to keep them.
+func tagObjectWithMessageId(ctx context.Context, s3Client S3API, bucket, key, versionId, expectedBucketOwner string, messageId *string, tags map[string]string, optFns ...func(*s3.Options)) error {
+	tagSet := []s3types.Tag{
+		{Key: aws.String(TagKeyMessageId), Value: aws.String(aws.ToString(messageId))},
+		{Key: aws.String(KeySentTimestamp), Value: aws.String(time.Now().UTC().Format(time.RFC3339))},
+	}
+	tagSet = append(tagSet, tagSetOf(tags)...)
+
+	_, err := s3Client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:              aws.String(bucket),
+		Key:                 aws.String(key),
+		VersionId:           optionalString(versionId),
+		ExpectedBucketOwner: optionalString(expectedBucketOwner),
+		Tagging:             &s3types.Tagging{TagSet: tagSet},
+	}, optFns...)
+
+	return err
+}
+
+// encodeTags encodes the tags of a hefty message as URL query parameters for uploads, or returns nil without tags
+func encodeTags(tags map[string]string) *string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	values := url.Values{}
+	for key, value := range tags {
+		values.Set(key, value)
+	}
+
+	return aws.String(values.Encode())
+}
+
+// tagSetOf returns the tags of a hefty message as AWS S3 tag set sorted by key
+func tagSetOf(tags map[string]string) []s3types.Tag {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tagSet := make([]s3types.Tag, 0, len(tags))
+	for _, key := range keys {
+		tagSet = append(tagSet, s3types.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+
+	return tagSet
+}
+
+// retainedTags returns the tags of a tag set that are kept when a hefty message is tagged with a new message id
+func retainedTags(tagSet []s3types.Tag) map[string]string {
+	tags := map[string]string{}
+	for _, tag := range tagSet {
+		key := aws.ToString(tag.Key)
+		if key != TagKeyMessageId && key != KeySentTimestamp {
+			tags[key] = aws.ToString(tag.Value)
+		}
+	}
+
+	return tags
+}
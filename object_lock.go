@@ -0,0 +1,72 @@
+package hefty
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// LockedObject describes a hefty message that could not be deleted from AWS S3 because of Object Lock
+type LockedObject struct {
+	Bucket      string
+	Key         string
+	VersionId   string    // empty for unversioned deletes
+	RetainUntil time.Time // zero when the hefty message has no retention period
+	LegalHold   bool
+	DeleteError error // error returned by AWS S3 for the delete
+}
+
+// ObjectLockHandler is called by DeleteHeftyMessage for a hefty message that is protected by Object Lock, e.g. to
+// schedule the delete for after its retention period. See WithObjectLockCompliance.
+type ObjectLockHandler func(ctx context.Context, locked LockedObject)
+
+// lockedObject checks whether a hefty message whose delete failed with `deleteErr` is protected by a retention period or
+// legal hold. Lookups that fail, e.g. because the bucket does not have Object Lock enabled, are treated as not locked.
+func (storage *payloadStorage) lockedObject(ctx context.Context, bucket, key, versionId string, deleteErr error) (LockedObject, bool) {
+	var retention *s3types.ObjectLockRetention
+	retentionOut, err := storage.s3Client.GetObjectRetention(ctx, &s3.GetObjectRetentionInput{
+		Bucket:              aws.String(bucket),
+		Key:                 aws.String(key),
+		VersionId:           optionalString(versionId),
+		ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+	}, storage.s3OptFns...)
+	if err == nil {
+		retention = retentionOut.Retention
+	}
+
+	var legalHold *s3types.ObjectLockLegalHold
+	legalHoldOut, err := storage.s3Client.GetObjectLegalHold(ctx, &s3.GetObjectLegalHoldInput{
+		Bucket:              aws.String(bucket),
+		Key:                 aws.String(key),
+		VersionId:           optionalString(versionId),
+		ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+	}, storage.s3OptFns...)
+	if err == nil {
+		legalHold = legalHoldOut.LegalHold
+	}
+
+	locked := LockedObject{
+		Bucket:      bucket,
+		Key:         key,
+		VersionId:   versionId,
+		DeleteError: deleteErr,
+	}
+
+	return locked, applyObjectLock(&locked, retention, legalHold, time.Now())
+}
+
+// applyObjectLock records the retention period and legal hold of a hefty message and reports whether they prevent it
+// from being deleted at `now`
+func applyObjectLock(locked *LockedObject, retention *s3types.ObjectLockRetention, legalHold *s3types.ObjectLockLegalHold, now time.Time) bool {
+	if retention != nil && retention.RetainUntilDate != nil && retention.RetainUntilDate.After(now) {
+		locked.RetainUntil = *retention.RetainUntilDate
+	}
+	if legalHold != nil && legalHold.Status == s3types.ObjectLockLegalHoldStatusOn {
+		locked.LegalHold = true
+	}
+
+	return !locked.RetainUntil.IsZero() || locked.LegalHold
+}
@@ -0,0 +1,36 @@
+package hefty
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyObjectLock(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		desc         string
+		retention    *s3types.ObjectLockRetention
+		legalHold    *s3types.ObjectLockLegalHold
+		expLocked    bool
+		expLegalHold bool
+	}{
+		{desc: "no_lock"},
+		{desc: "retention_expired", retention: &s3types.ObjectLockRetention{Mode: s3types.ObjectLockRetentionModeCompliance, RetainUntilDate: aws.Time(now.Add(-time.Hour))}},
+		{desc: "retention_active", retention: &s3types.ObjectLockRetention{Mode: s3types.ObjectLockRetentionModeCompliance, RetainUntilDate: aws.Time(now.Add(time.Hour))}, expLocked: true},
+		{desc: "legal_hold_off", legalHold: &s3types.ObjectLockLegalHold{Status: s3types.ObjectLockLegalHoldStatusOff}},
+		{desc: "legal_hold_on", legalHold: &s3types.ObjectLockLegalHold{Status: s3types.ObjectLockLegalHoldStatusOn}, expLocked: true, expLegalHold: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var locked LockedObject
+			assert.Equal(t, tt.expLocked, applyObjectLock(&locked, tt.retention, tt.legalHold, now))
+			assert.Equal(t, tt.expLegalHold, locked.LegalHold)
+		})
+	}
+}
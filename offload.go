@@ -0,0 +1,178 @@
+package hefty
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// OffloadDecision is how a message was sent
+type OffloadDecision int
+
+const (
+	// OffloadInline sends the message as is
+	OffloadInline OffloadDecision = iota
+	// OffloadCompressedInline sends the message with its body compressed in an inline message
+	OffloadCompressedInline
+	// OffloadToStorage stores the message as a hefty message and sends a reference message
+	OffloadToStorage
+)
+
+func (decision OffloadDecision) String() string {
+	switch decision {
+	case OffloadInline:
+		return "inline"
+	case OffloadCompressedInline:
+		return "compressed-inline"
+	case OffloadToStorage:
+		return "storage"
+	default:
+		return fmt.Sprintf("OffloadDecision(%d)", int(decision))
+	}
+}
+
+// OffloadEvent describes the decision taken for a single message
+type OffloadEvent struct {
+	// Target is the AWS SQS queue url or AWS SNS topic arn the message is sent to.
+	Target string
+	// Decision is how the message is sent.
+	Decision OffloadDecision
+	// Size is the size in bytes of the message body and message attributes.
+	Size int
+	// CompressedSize is the size in bytes of the message with its body compressed, or 0 when it was not compressed.
+	CompressedSize int
+}
+
+// OffloadPolicy decides how messages are sent. Each step is tried in order and the first step the message fits is taken:
+//
+//  1. inline: the message is sent as is when it is no larger than the threshold, unless SkipInline is set.
+//  2. compressed inline: the message body is compressed with Compression and sent in an inline message when the
+//     compressed message is no larger than the threshold, unless Compression is nil.
+//  3. storage: the message is stored as a hefty message and a reference message is sent.
+//
+// AlwaysSendToS3 skips both inline steps.
+type OffloadPolicy struct {
+	// SkipInline skips sending messages as is, so that every message is either compressed or stored.
+	SkipInline bool
+	// Threshold is the message size in bytes above which a step is skipped. The AWS SQS or AWS SNS message size limit is
+	// used when 0 or greater than the limit. A TopicConfig threshold takes precedence for its topic.
+	Threshold int
+	// Compression compresses message bodies for the compressed inline step, e.g. Gzip(). Receivers must be configured
+	// with the same compression, or with a transform of the same name, unless it is Gzip().
+	Compression Transform
+	// OnDecision is called with the decision taken for every message, e.g. to record metrics.
+	OnDecision func(ctx context.Context, event OffloadEvent)
+}
+
+// threshold returns the message size above which a step is skipped given the message size limit `limit`
+func (policy OffloadPolicy) threshold(limit int) int {
+	if policy.Threshold <= 0 || policy.Threshold > limit {
+		return limit
+	}
+
+	return policy.Threshold
+}
+
+// inline reports whether a message of `msgSize` bytes is sent as is
+func (policy OffloadPolicy) inline(alwaysSendToS3 bool, threshold, msgSize int) bool {
+	return !alwaysSendToS3 && !policy.SkipInline && msgSize <= threshold
+}
+
+// decide decides how a message is sent to `target`. The compressed message body is returned for OffloadCompressedInline.
+func (policy OffloadPolicy) decide(ctx context.Context, target string, alwaysSendToS3 bool, threshold int, body *string, msgAttributes map[string]messages.MessageAttributeValue, msgSize int) (OffloadDecision, *string, error) {
+	event := OffloadEvent{
+		Target:   target,
+		Decision: OffloadToStorage,
+		Size:     msgSize,
+	}
+
+	var compressed *string
+	switch {
+	case policy.inline(alwaysSendToS3, threshold, msgSize):
+		event.Decision = OffloadInline
+	case alwaysSendToS3:
+	case policy.Compression != nil:
+		var err error
+		compressed, err = compressInline(ctx, policy.Compression, *body)
+		if err != nil {
+			return OffloadToStorage, nil, err
+		}
+
+		event.CompressedSize, err = messages.MessageSize(compressed, msgAttributes)
+		if err != nil {
+			return OffloadToStorage, nil, fmt.Errorf("unable to get size of message. %v", err)
+		}
+
+		if event.CompressedSize <= threshold {
+			event.Decision = OffloadCompressedInline
+		} else {
+			compressed = nil
+		}
+	}
+
+	if policy.OnDecision != nil {
+		policy.OnDecision(ctx, event)
+	}
+
+	return event.Decision, compressed, nil
+}
+
+// compressInline compresses a message body into a serialized inline message
+func compressInline(ctx context.Context, compression Transform, body string) (*string, error) {
+	reader, err := compression.Apply(ctx, strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("unable to compress message body. %v", err)
+	}
+
+	compressed, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compress message body. %v", err)
+	}
+
+	jsonInlineMsg, err := json.Marshal(types.NewInlineMsg(compression.Name(), compressed))
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal json message. %v", err)
+	}
+
+	inline := string(jsonInlineMsg)
+	return &inline, nil
+}
+
+// decompressInline restores the message body of a serialized inline message. The transform named in the inline message
+// is looked up in the compression of the policy, then in the transforms of the wrapper, then in the built-in transforms.
+func decompressInline(ctx context.Context, policy OffloadPolicy, chain *transformChain, msg string) (string, error) {
+	inlineMsg, err := types.ToInlineMsg(msg)
+	if err != nil {
+		return "", fmt.Errorf("unable to unmarshal inline message. %v", err)
+	}
+
+	var compression Transform
+	switch {
+	case policy.Compression != nil && policy.Compression.Name() == inlineMsg.Transform:
+		compression = policy.Compression
+	case chain != nil && chain.byName[inlineMsg.Transform] != nil:
+		compression = chain.byName[inlineMsg.Transform]
+	case inlineMsg.Transform == Gzip().Name():
+		compression = Gzip()
+	default:
+		return "", fmt.Errorf("no transform configured for %s", inlineMsg.Transform)
+	}
+
+	reader, err := compression.Reverse(ctx, bytes.NewReader(inlineMsg.Body))
+	if err != nil {
+		return "", fmt.Errorf("unable to decompress message body. %v", err)
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("unable to decompress message body. %v", err)
+	}
+
+	return string(body), nil
+}
@@ -0,0 +1,79 @@
+package hefty
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffloadPolicyDecide(t *testing.T) {
+	small := "hefty message"
+	compressible := strings.Repeat("hefty message ", 100)
+
+	var tests = []struct {
+		desc           string
+		policy         OffloadPolicy
+		alwaysSendToS3 bool
+		threshold      int
+		body           string
+		expDecision    OffloadDecision
+	}{
+		{desc: "inline", body: small, expDecision: OffloadInline},
+		{desc: "above_threshold_without_compression", body: compressible, expDecision: OffloadToStorage},
+		{desc: "compressed_inline", policy: OffloadPolicy{Compression: Gzip()}, body: compressible, expDecision: OffloadCompressedInline},
+		{desc: "skip_inline", policy: OffloadPolicy{SkipInline: true, Compression: Gzip()}, body: small, expDecision: OffloadCompressedInline},
+		{desc: "compressed_above_threshold", policy: OffloadPolicy{SkipInline: true, Compression: Gzip()}, threshold: 50, body: small, expDecision: OffloadToStorage},
+		{desc: "always_send_to_s3", policy: OffloadPolicy{Compression: Gzip()}, alwaysSendToS3: true, body: small, expDecision: OffloadToStorage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if tt.threshold == 0 {
+				tt.threshold = 200
+			}
+
+			var events []OffloadEvent
+			tt.policy.OnDecision = func(_ context.Context, event OffloadEvent) {
+				events = append(events, event)
+			}
+
+			decision, compressed, err := tt.policy.decide(context.TODO(), "queue", tt.alwaysSendToS3, tt.threshold, &tt.body, nil, len(tt.body))
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expDecision, decision)
+			assert.Len(t, events, 1)
+			assert.Equal(t, OffloadEvent{Target: "queue", Decision: tt.expDecision, Size: len(tt.body), CompressedSize: events[0].CompressedSize}, events[0])
+
+			if decision != OffloadCompressedInline {
+				assert.Nil(t, compressed)
+				return
+			}
+			assert.True(t, types.IsInlineMsg(*compressed))
+			assert.Equal(t, len(*compressed), events[0].CompressedSize)
+
+			body, err := decompressInline(context.TODO(), OffloadPolicy{}, nil, *compressed)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.body, body)
+		})
+	}
+}
+
+func TestDecompressInlineTransformLookup(t *testing.T) {
+	compressed, err := compressInline(context.TODO(), reverseBytes{}, "hefty message")
+	assert.Nil(t, err)
+
+	_, err = decompressInline(context.TODO(), OffloadPolicy{}, nil, *compressed)
+	assert.NotNil(t, err)
+
+	body, err := decompressInline(context.TODO(), OffloadPolicy{Compression: reverseBytes{}}, nil, *compressed)
+	assert.Nil(t, err)
+	assert.Equal(t, "hefty message", body)
+
+	chain, err := newTransformChain([]Transform{reverseBytes{}})
+	assert.Nil(t, err)
+	body, err = decompressInline(context.TODO(), OffloadPolicy{}, chain, *compressed)
+	assert.Nil(t, err)
+	assert.Equal(t, "hefty message", body)
+}
@@ -1,7 +1,80 @@
 package hefty
 
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
 type options struct {
-	alwaysSendToS3 bool
+	alwaysSendToS3       bool
+	tagWithMessageId     bool
+	messagingRetryTokens *RetryTokenBucket
+	storageRetryTokens   *RetryTokenBucket
+	payloadStore         PayloadStore
+	payloadStoreMaxSize  int
+	digestRetries        int
+	s3Endpoint           string
+	s3UsePathStyle       bool
+	s3InsecureSkipVerify bool
+	uploader             *s3manager.Uploader
+	downloader           *s3manager.Downloader
+	downloadPartSize     int64
+	downloadConcurrency  int
+	transferLimiter      *TransferLimiter
+	storageRateLimiter   *StorageRateLimiter
+	circuitBreaker       *CircuitBreaker
+	keys                 keyGenerator
+	contentAddressable   bool
+	references           ReferenceCounter
+	shards               []Shard
+	shardSelector        ShardSelector
+	bucketSelector       BucketSelector
+	topics               map[string]TopicConfig
+	tenants              TenantExtractor
+	storageClass         s3types.StorageClass
+	storageClassPolicy   StorageClassPolicy
+	objectLockHandler    ObjectLockHandler
+	encryption           serverSideEncryption
+	clientEncryption     *clientSideEncryption
+	transforms           []Transform
+	offload              OffloadPolicy
+	redactor             Redactor
+	digestAlgorithm      string
+	checksumAlgorithm    s3types.ChecksumAlgorithm
+	preserveMd5Digests   bool
+	receiptHandleKey     []byte
+	receiptHandles       ReceiptHandleStore
+	bucketPosture        *BucketPosture
+	ownership            objectOwnership
+	autoCreateBucket     *BucketDefaults
+	skipBucketCheck      bool
+	lazyBucketCheck      bool
+	expiry               *queueRetentionExpiry
+	retainPayloads       bool
+	deleteOrder          DeleteOrder
+	receiveMemoryBudget  int64
+	spoolThreshold       int64
+	spoolDir             string
+	cleanup              *CleanupConfig
+	orphanHook           OrphanCleanupHook
+	presignExpiry        time.Duration
+}
+
+func defaultOptions() options {
+	return options{
+		digestRetries: 1,
+	}
 }
 
 type Option func(opts *options) error
@@ -13,3 +86,842 @@ func AlwaysSendToS3() Option {
 		return nil
 	}
 }
+
+// TagWithMessageId will tag hefty messages in AWS S3 with the message id returned by AWS SQS or AWS SNS, and the time the
+// reference message was sent, after the reference message was successfully sent. This allows a message to be correlated
+// with its hefty message in AWS S3. Note that this adds a PutObjectTagging call to every hefty message sent.
+func TagWithMessageId() Option {
+	return func(opts *options) error {
+		opts.tagWithMessageId = true
+		return nil
+	}
+}
+
+// WithSharedRetryTokens makes the AWS SQS/SNS calls and the AWS S3 calls made by the wrapper take their retry tokens
+// from the same bucket. The bucket can also be given to multiple wrappers so that they share a single retry quota.
+func WithSharedRetryTokens(bucket *RetryTokenBucket) Option {
+	return WithIsolatedRetryTokens(bucket, bucket)
+}
+
+// WithIsolatedRetryTokens makes the AWS SQS/SNS calls made by the wrapper take their retry tokens from `messaging` and the
+// AWS S3 calls take their retry tokens from `storage`. This prevents a throttled AWS S3 from using up the retry quota
+// needed by AWS SQS/SNS and vice versa. A nil bucket leaves the retry quota of the corresponding AWS SDK client unchanged.
+func WithIsolatedRetryTokens(messaging, storage *RetryTokenBucket) Option {
+	return func(opts *options) error {
+		opts.messagingRetryTokens = messaging
+		opts.storageRetryTokens = storage
+		return nil
+	}
+}
+
+// WithPayloadStore will store hefty messages whose serialized size is at most `maxSize` bytes in `store` instead of AWS S3.
+// Larger hefty messages are still stored in AWS S3. The backend of the payload store is recorded in the reference message.
+// The receiving AWS SQS client wrapper must be configured with a payload store for the same backend.
+func WithPayloadStore(store PayloadStore, maxSize int) Option {
+	return func(opts *options) error {
+		if store == nil || store.Backend() == "" {
+			return errors.New("payload store must not be nil and must have a backend name")
+		}
+		if maxSize <= 0 {
+			return fmt.Errorf("payload store max size of %d bytes must be greater than 0", maxSize)
+		}
+
+		opts.payloadStore = store
+		opts.payloadStoreMaxSize = maxSize
+		return nil
+	}
+}
+
+// WithDigestMismatchRetries sets the number of times a hefty message is downloaded again when its md5 digests do not
+// match the reference message, which is usually caused by a truncated download. Only when the digests still do not match
+// is an error placed in the message body. The default is 1 retry and 0 disables retrying.
+func WithDigestMismatchRetries(retries int) Option {
+	return func(opts *options) error {
+		if retries < 0 {
+			return fmt.Errorf("digest mismatch retries of %d must not be negative", retries)
+		}
+
+		opts.digestRetries = retries
+		return nil
+	}
+}
+
+// WithS3Endpoint sends all AWS S3 requests made by the wrapper to `endpoint` instead of the AWS S3 endpoint of the
+// region. This allows S3 compatible storage like MinIO or LocalStack to be used, e.g. "http://localhost:4566".
+func WithS3Endpoint(endpoint string) Option {
+	return func(opts *options) error {
+		if _, err := url.ParseRequestURI(endpoint); err != nil {
+			return fmt.Errorf("invalid s3 endpoint %s. %v", endpoint, err)
+		}
+
+		opts.s3Endpoint = endpoint
+		return nil
+	}
+}
+
+// WithS3PathStyle addresses buckets using path style (https://endpoint/bucket/key) instead of virtual hosted style
+// (https://bucket.endpoint/key). Path style addressing is required by most S3 compatible storage.
+func WithS3PathStyle() Option {
+	return func(opts *options) error {
+		opts.s3UsePathStyle = true
+		return nil
+	}
+}
+
+// WithS3InsecureSkipVerify disables TLS certificate verification for AWS S3 requests made by the wrapper. This should only
+// be used for local development or on-premises S3 compatible storage with self-signed certificates. The HTTP client of the
+// AWS S3 client must be an *awshttp.BuildableClient, e.g. the default client, since the transport of other clients cannot
+// be changed; creating the wrapper fails otherwise, and requests made with such a client fail.
+func WithS3InsecureSkipVerify() Option {
+	return func(opts *options) error {
+		opts.s3InsecureSkipVerify = true
+		return nil
+	}
+}
+
+// WithUploader uploads hefty messages with `uploader` instead of an uploader created for the AWS S3 client of the wrapper,
+// e.g. to reuse an uploader with a custom buffer provider, part size or instrumentation. The AWS S3 SDK options of the
+// wrapper, like those of WithS3Endpoint, are applied to its requests as well. The LeavePartsOnError setting of `uploader`
+// is kept, so the parts of a failed multipart upload are only aborted when it is false, as it is by default.
+func WithUploader(uploader *s3manager.Uploader) Option {
+	return func(opts *options) error {
+		if uploader == nil {
+			return errors.New("uploader must not be nil")
+		}
+
+		opts.uploader = uploader
+		return nil
+	}
+}
+
+// WithDownloader downloads hefty messages with `downloader` instead of a downloader created for the AWS S3 client of the
+// wrapper, e.g. to reuse a downloader with a custom buffer provider, part size or instrumentation. The AWS S3 SDK options
+// of the wrapper are applied to its requests as well.
+func WithDownloader(downloader *s3manager.Downloader) Option {
+	return func(opts *options) error {
+		if downloader == nil {
+			return errors.New("downloader must not be nil")
+		}
+
+		opts.downloader = downloader
+		return nil
+	}
+}
+
+// WithDownloadConcurrency downloads hefty messages larger than `partSize` bytes as ranges of `partSize` bytes, with up
+// to `concurrency` ranges in flight, to cut the latency of receiving large hefty messages. The default is 5 ranges of
+// 5MB. Hefty messages with an AWS S3 checksum are downloaded with a single request to validate the checksum.
+func WithDownloadConcurrency(partSize int64, concurrency int) Option {
+	return func(opts *options) error {
+		if partSize <= 0 {
+			return fmt.Errorf("download part size of %d bytes must be greater than 0", partSize)
+		}
+		if concurrency <= 0 {
+			return fmt.Errorf("download concurrency of %d must be greater than 0", concurrency)
+		}
+
+		opts.downloadPartSize = partSize
+		opts.downloadConcurrency = concurrency
+		return nil
+	}
+}
+
+// WithTransferLimiter makes the wrapper wait for room in `limiter` before uploading or downloading a hefty message. The
+// limiter can be given to multiple wrappers so that they share a single limit on concurrent AWS S3 transfers.
+func WithTransferLimiter(limiter *TransferLimiter) Option {
+	return func(opts *options) error {
+		if limiter == nil {
+			return errors.New("transfer limiter must not be nil")
+		}
+
+		opts.transferLimiter = limiter
+		return nil
+	}
+}
+
+// WithStorageRateLimiter limits the rate of the AWS S3 requests made by the wrapper with `limiter`, including every part
+// of multipart uploads and downloads. The limiter can be given to multiple wrappers so that they share a single rate.
+// Payload stores are not limited.
+func WithStorageRateLimiter(limiter *StorageRateLimiter) Option {
+	return func(opts *options) error {
+		if limiter == nil {
+			return errors.New("storage rate limiter must not be nil")
+		}
+
+		opts.storageRateLimiter = limiter
+		return nil
+	}
+}
+
+// WithCircuitBreaker sends the AWS S3 requests made by the wrapper through `breaker`, so that they fail or are queued
+// right away while AWS S3 has an outage. The circuit breaker can be given to multiple wrappers so that they share a
+// single circuit. Payload stores are not protected.
+func WithCircuitBreaker(breaker *CircuitBreaker) Option {
+	return func(opts *options) error {
+		if breaker == nil {
+			return errors.New("circuit breaker must not be nil")
+		}
+
+		opts.circuitBreaker = breaker
+		return nil
+	}
+}
+
+// WithKeyPrefix prepends `prefix` to the key of every hefty message stored by the wrapper, e.g. "hefty/". This allows
+// hefty messages to be targeted by existing bucket policies and lifecycle rules. The prefix is used as is, so a trailing
+// '/' must be included if one is wanted.
+func WithKeyPrefix(prefix string) Option {
+	return func(opts *options) error {
+		opts.keys.prefix = prefix
+		return nil
+	}
+}
+
+// WithKeyTemplate sets the text/template used to create the key of every hefty message stored by the wrapper. The
+// template is executed with KeyTemplateData, e.g. "{{.Name}}/{{.Date}}/{{.ID}}". Keys should contain {{.ID}} to stay
+// unique. When not set, keys are created as "queueName/uuid" for AWS SQS and "accountId/uuid" for AWS SNS.
+func WithKeyTemplate(text string) Option {
+	return func(opts *options) error {
+		tmpl, err := parseKeyTemplate(text)
+		if err != nil {
+			return fmt.Errorf("invalid key template. %v", err)
+		}
+
+		opts.keys.template = tmpl
+		return nil
+	}
+}
+
+// WithIdGenerator sets the IdGenerator used to create the unique identifier in the key of every hefty message stored by
+// the wrapper. Use ULIDs to create keys that are ordered by time, or provide a custom generator. The default is UUIDs.
+func WithIdGenerator(newId IdGenerator) Option {
+	return func(opts *options) error {
+		if newId == nil {
+			return errors.New("id generator must not be nil")
+		}
+
+		opts.keys.newId = newId
+		return nil
+	}
+}
+
+// WithContentAddressableKeys uses the SHA-256 digest of a serialized hefty message as the id in its key instead of a
+// generated id. Identical hefty messages, such as retries of the same message, then have the same key and the upload to
+// AWS S3 is skipped when the hefty message is already stored. Note that a hefty message can then be referenced by
+// multiple messages, and deleting one of them deletes the hefty message for all of them unless WithReferenceCounter is
+// also used.
+func WithContentAddressableKeys() Option {
+	return func(opts *options) error {
+		opts.contentAddressable = true
+		return nil
+	}
+}
+
+// WithReferenceCounter counts the messages that reference a content addressed hefty message in `counter`, so that
+// DeleteHeftyMessage only deletes a hefty message once the last message referencing it is deleted. The counter must be
+// configured on both the sending and the receiving client wrappers, and only has an effect on the sender when
+// WithContentAddressableKeys is used. Reference messages record whether their reference was counted, so that deleting a
+// message sent without a counter does not remove a reference. A versioned bucket is recommended, since a hefty message
+// uploaded again while its last reference is deleted is only certain to be kept when the delete removes a version.
+func WithReferenceCounter(counter ReferenceCounter) Option {
+	return func(opts *options) error {
+		if counter == nil {
+			return errors.New("reference counter must not be nil")
+		}
+
+		opts.references = counter
+		return nil
+	}
+}
+
+// WithShards spreads the hefty messages stored in AWS S3 over `shards`, using `selector` to select the shard of each
+// hefty message. This avoids a single bucket or key prefix becoming a hotspot at high send rates. The bucket and key of
+// each hefty message is recorded in its reference message, so receivers do not need to be configured with the shards.
+func WithShards(selector ShardSelector, shards ...Shard) Option {
+	return func(opts *options) error {
+		if selector == nil {
+			return errors.New("shard selector must not be nil")
+		}
+		if len(shards) == 0 {
+			return errors.New("at least one shard is required")
+		}
+		for _, shard := range shards {
+			if strings.Contains(shard.Bucket, "|") || strings.Contains(shard.Prefix, "|") {
+				return fmt.Errorf("shard bucket %s and prefix %s must not contain '|'", shard.Bucket, shard.Prefix)
+			}
+		}
+
+		opts.shards = shards
+		opts.shardSelector = selector
+		return nil
+	}
+}
+
+// WithBucketSelector calls `selector` on every send with the queue url or topic arn the message is sent to, and stores
+// the hefty message in the returned bucket and key prefix. This allows a single client wrapper to store hefty messages
+// in different buckets per queue or topic. The selected buckets are not checked when the wrapper is created. When
+// WithShards is also used, the bucket of the selected shard takes precedence and its prefix is prepended.
+func WithBucketSelector(selector BucketSelector) Option {
+	return func(opts *options) error {
+		if selector == nil {
+			return errors.New("bucket selector must not be nil")
+		}
+
+		opts.bucketSelector = selector
+		return nil
+	}
+}
+
+// WithTopicConfig overrides the bucket, key prefix, size threshold and attribute preservation of the AWS SNS client wrapper
+// for messages published to `topicArn`. The configuration is resolved from the TopicArn of every publish. The bucket and
+// prefix of a topic take precedence over WithBucketSelector. This option is ignored by the AWS SQS client wrapper.
+func WithTopicConfig(topicArn string, config TopicConfig) Option {
+	return func(opts *options) error {
+		if topicArn == "" {
+			return errors.New("topic arn must not be empty")
+		}
+		if config.Threshold < 0 {
+			return fmt.Errorf("threshold of %d bytes for topic %s must not be negative", config.Threshold, topicArn)
+		}
+		if strings.Contains(config.Bucket, "|") || strings.Contains(config.Prefix, "|") {
+			return fmt.Errorf("bucket %s and prefix %s for topic %s must not contain '|'", config.Bucket, config.Prefix, topicArn)
+		}
+
+		if opts.topics == nil {
+			opts.topics = map[string]TopicConfig{}
+		}
+		opts.topics[topicArn] = config
+		return nil
+	}
+}
+
+// WithTenantExtractor prepends the tenant returned by `extractor` as the first segment of the key of every hefty message
+// sent by the AWS SQS client wrapper or published by the AWS SNS client wrapper, e.g. "tenant/queueName/uuid". This allows
+// per-tenant lifecycle rules and access policies. Sends fail when the tenant is empty or not a valid key segment, and
+// DeleteHeftyMessage refuses to delete hefty messages whose key does not start with the tenant of the delete, which is
+// given with ContextWithTenant or else extracted from the queue url.
+func WithTenantExtractor(extractor TenantExtractor) Option {
+	return func(opts *options) error {
+		if extractor == nil {
+			return errors.New("tenant extractor must not be nil")
+		}
+
+		opts.tenants = extractor
+		return nil
+	}
+}
+
+// WithStorageClass uploads hefty messages to AWS S3 using `class` instead of STANDARD. Since most hefty messages are read
+// once shortly after being sent, STANDARD_IA, ONEZONE_IA or INTELLIGENT_TIERING can reduce storage costs. Archive storage
+// classes that require a restore before reading are not allowed.
+func WithStorageClass(class s3types.StorageClass) Option {
+	return func(opts *options) error {
+		if !isReadableStorageClass(class) {
+			return fmt.Errorf("storage class %s is not supported for hefty messages", class)
+		}
+
+		opts.storageClass = class
+		return nil
+	}
+}
+
+// WithStorageClassPolicy selects the storage class of every hefty message uploaded to AWS S3 based on its size, using
+// SizeTiers or a custom policy. Hefty messages for which the policy returns an empty storage class use the storage class
+// of WithStorageClass. Uploads fail when the policy returns an archive storage class that requires a restore.
+func WithStorageClassPolicy(policy StorageClassPolicy) Option {
+	return func(opts *options) error {
+		if policy == nil {
+			return errors.New("storage class policy must not be nil")
+		}
+
+		opts.storageClassPolicy = policy
+		return nil
+	}
+}
+
+// WithObjectLockCompliance is for buckets with Object Lock enabled. When the AWS S3 delete of a hefty message fails and
+// the hefty message is under a retention period or legal hold, DeleteHeftyMessage calls `handler` and still deletes the
+// message from AWS SQS instead of returning an error. The handler can be used to record or schedule the delete for later.
+func WithObjectLockCompliance(handler ObjectLockHandler) Option {
+	return func(opts *options) error {
+		if handler == nil {
+			return errors.New("object lock handler must not be nil")
+		}
+
+		opts.objectLockHandler = handler
+		return nil
+	}
+}
+
+// WithSSEKMS encrypts every hefty message uploaded to AWS S3 with the AWS KMS key `kmsKeyId`, given as key id, key arn or
+// alias arn, instead of relying on the default encryption of the bucket. `bucketKeyEnabled` uses an S3 Bucket Key to
+// reduce the number of AWS KMS requests. Senders need kms:GenerateDataKey and receivers kms:Decrypt on the key.
+func WithSSEKMS(kmsKeyId string, bucketKeyEnabled bool) Option {
+	return func(opts *options) error {
+		if kmsKeyId == "" {
+			return errors.New("kms key id must not be empty")
+		}
+
+		opts.encryption = serverSideEncryption{
+			algorithm:        string(s3types.ServerSideEncryptionAwsKms),
+			kmsKeyId:         kmsKeyId,
+			bucketKeyEnabled: bucketKeyEnabled,
+		}
+		return nil
+	}
+}
+
+// WithServerSideEncryption sets the server side encryption algorithm of every hefty message uploaded to AWS S3, e.g.
+// AES256 or aws:kms using the AWS managed key. Use WithSSEKMS to encrypt with a customer managed AWS KMS key.
+func WithServerSideEncryption(algorithm s3types.ServerSideEncryption) Option {
+	return func(opts *options) error {
+		switch algorithm {
+		case s3types.ServerSideEncryptionAes256, s3types.ServerSideEncryptionAwsKms, s3types.ServerSideEncryptionAwsKmsDsse:
+		default:
+			return fmt.Errorf("server side encryption %s is not supported", algorithm)
+		}
+
+		opts.encryption = serverSideEncryption{algorithm: string(algorithm)}
+		return nil
+	}
+}
+
+// WithObjectAcl uploads every hefty message with the canned ACL `acl`, e.g. bucket-owner-full-control, so that the owner
+// of a bucket in another AWS account can read hefty messages uploaded by this account. Buckets with the object ownership
+// BucketOwnerEnforced have ACLs disabled and reject every ACL other than bucket-owner-full-control.
+func WithObjectAcl(acl s3types.ObjectCannedACL) Option {
+	return func(opts *options) error {
+		if !isObjectCannedAcl(acl) {
+			return fmt.Errorf("object acl %s is not supported", acl)
+		}
+
+		opts.ownership.acl = acl
+		return nil
+	}
+}
+
+// WithExpectedBucketOwner makes AWS S3 reject every upload, download and delete of a hefty message when the bucket is not
+// owned by the AWS account `accountId`. This prevents hefty messages from being written to or read from a bucket that was
+// deleted and recreated by another AWS account.
+func WithExpectedBucketOwner(accountId string) Option {
+	return func(opts *options) error {
+		if !isAccountId(accountId) {
+			return fmt.Errorf("expected bucket owner %s is not a 12 digit aws account id", accountId)
+		}
+
+		opts.ownership.expectedBucketOwner = accountId
+		return nil
+	}
+}
+
+// WithClientSideEncryption encrypts hefty messages with AES-256-GCM before they are stored, using a new data key from
+// `keys` for every hefty message. The data key is bound to an encryption context holding the queue url or topic arn the
+// message is sent to and its message body digest, so that a hefty message cannot be decrypted when its reference message
+// is replayed to another queue. Receivers accept hefty messages sent to the queue they receive from and to `channels`,
+// which must include the topic arn for messages published to AWS SNS. Cannot be used with WithContentAddressableKeys.
+func WithClientSideEncryption(keys DataKeyProvider, channels ...string) Option {
+	return func(opts *options) error {
+		if keys == nil {
+			return errors.New("data key provider must not be nil")
+		}
+
+		opts.clientEncryption = &clientSideEncryption{
+			keys:     keys,
+			channels: map[string]struct{}{},
+		}
+		for _, channel := range channels {
+			opts.clientEncryption.channels[channel] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithTransforms applies `transforms` in order to every hefty message before it is stored, e.g. Gzip(), and reverses
+// the transforms recorded in the reference message of every hefty message received. Receivers must be configured with
+// transforms of the same names as the senders.
+func WithTransforms(transforms ...Transform) Option {
+	return func(opts *options) error {
+		if _, err := newTransformChain(transforms); err != nil {
+			return err
+		}
+
+		opts.transforms = transforms
+		return nil
+	}
+}
+
+// isReadableStorageClass reports whether objects in storage class `class` can be read without a restore
+func isReadableStorageClass(class s3types.StorageClass) bool {
+	switch class {
+	case s3types.StorageClassStandard,
+		s3types.StorageClassReducedRedundancy,
+		s3types.StorageClassStandardIa,
+		s3types.StorageClassOnezoneIa,
+		s3types.StorageClassIntelligentTiering,
+		s3types.StorageClassGlacierIr:
+		return true
+	default:
+		return false
+	}
+}
+
+// s3OptFns returns the AWS S3 SDK options applied to every AWS S3 call made by the wrapper
+func (opts *options) s3OptFns() []func(*s3.Options) {
+	var optFns []func(*s3.Options)
+
+	if opts.storageRetryTokens != nil {
+		optFns = append(optFns, s3RetryTokenOption(opts.storageRetryTokens))
+	}
+
+	// requests not sent because of an open circuit do not count towards the rate
+	if opts.circuitBreaker != nil {
+		optFns = append(optFns, opts.circuitBreaker.s3Option())
+	}
+
+	if opts.storageRateLimiter != nil {
+		optFns = append(optFns, opts.storageRateLimiter.s3Option())
+	}
+
+	if opts.s3Endpoint != "" || opts.s3UsePathStyle || opts.s3InsecureSkipVerify {
+		endpoint, usePathStyle := opts.s3Endpoint, opts.s3UsePathStyle
+		var insecureClients *insecureHTTPClients
+		if opts.s3InsecureSkipVerify {
+			insecureClients = &insecureHTTPClients{clients: map[*awshttp.BuildableClient]*awshttp.BuildableClient{}}
+		}
+
+		optFns = append(optFns, func(o *s3.Options) {
+			if endpoint != "" {
+				o.BaseEndpoint = &endpoint
+			}
+			if usePathStyle {
+				o.UsePathStyle = true
+			}
+			if insecureClients != nil {
+				o.HTTPClient = insecureClients.get(o.HTTPClient)
+			}
+		})
+	}
+
+	return optFns
+}
+
+// insecureHTTPClients keeps the HTTP clients that skip TLS certificate verification for WithS3InsecureSkipVerify, so that
+// every AWS S3 request reuses the connections of a single client instead of building a new one
+type insecureHTTPClients struct {
+	mu      sync.Mutex
+	clients map[*awshttp.BuildableClient]*awshttp.BuildableClient
+}
+
+// get returns the client skipping TLS certificate verification for `client`. The transport of `client` is cloned when it
+// is an *awshttp.BuildableClient, e.g. the default client of the AWS S3 client, or a new client is built when it has
+// none. Other clients configured by the caller are replaced by a client failing every request, as their transport cannot
+// be changed.
+func (insecure *insecureHTTPClients) get(client s3.HTTPClient) s3.HTTPClient {
+	if !isBuildableHTTPClient(client) {
+		return failingHTTPClient{err: errOpaqueHTTPClient}
+	}
+	buildable, _ := client.(*awshttp.BuildableClient)
+
+	insecure.mu.Lock()
+	defer insecure.mu.Unlock()
+
+	key := buildable
+	if insecureClient, ok := insecure.clients[key]; ok {
+		return insecureClient
+	}
+
+	if buildable == nil {
+		buildable = awshttp.NewBuildableClient()
+	}
+	insecureClient := buildable.WithTransportOptions(func(tr *http.Transport) {
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		tr.TLSClientConfig.InsecureSkipVerify = true
+	})
+	insecure.clients[key] = insecureClient
+	return insecureClient
+}
+
+// errOpaqueHTTPClient is returned when TLS certificate verification cannot be disabled for the HTTP client of AWS S3
+var errOpaqueHTTPClient = errors.New("TLS certificate verification can only be skipped for AWS S3 clients with an *awshttp.BuildableClient or no HTTP client")
+
+// isBuildableHTTPClient reports whether the transport of an HTTP client of AWS S3 can be changed
+func isBuildableHTTPClient(client s3.HTTPClient) bool {
+	_, ok := client.(*awshttp.BuildableClient)
+	return client == nil || ok
+}
+
+// failingHTTPClient fails every request with an error
+type failingHTTPClient struct {
+	err error
+}
+
+func (client failingHTTPClient) Do(*http.Request) (*http.Response, error) {
+	return nil, client.err
+}
+
+// WithOffloadPolicy sets the policy deciding whether messages are sent as is, sent with their body compressed, or stored
+// as hefty messages. See OffloadPolicy for the steps of the policy.
+func WithOffloadPolicy(policy OffloadPolicy) Option {
+	return func(opts *options) error {
+		if policy.Threshold < 0 {
+			return errors.New("offload threshold must not be negative")
+		}
+		if policy.Compression != nil {
+			if _, err := newTransformChain([]Transform{policy.Compression}); err != nil {
+				return err
+			}
+		}
+
+		opts.offload = policy
+		return nil
+	}
+}
+
+// WithRedactor applies `redactor` to the body of every message before it is stored as a hefty message, e.g. to mask
+// fields the readers of the bucket must not see. Messages that are not stored as hefty messages are sent as is.
+func WithRedactor(redactor Redactor) Option {
+	return func(opts *options) error {
+		if redactor == nil {
+			return errors.New("redactor must not be nil")
+		}
+
+		opts.redactor = redactor
+		return nil
+	}
+}
+
+// WithDigestAlgorithm sets the algorithm of the digests of hefty messages, which are recorded in the reference message and
+// verified on receive. DigestMd5 is the default. DigestSha256 requires receivers that support it.
+func WithDigestAlgorithm(algorithm DigestAlgorithm) Option {
+	return func(opts *options) error {
+		switch algorithm {
+		case DigestMd5:
+			// md5 is not recorded in reference messages for compatibility with older receivers
+			opts.digestAlgorithm = ""
+		case DigestSha256:
+			opts.digestAlgorithm = string(algorithm)
+		default:
+			return fmt.Errorf("unsupported digest algorithm %s", algorithm)
+		}
+		return nil
+	}
+}
+
+// WithChecksum makes AWS S3 store a checksum of every hefty message using `algorithm`, e.g. CRC32C or SHA256, which is
+// validated when the hefty message is received. Hefty messages are uploaded in a single part so that AWS S3 keeps a
+// checksum of the full object.
+func WithChecksum(algorithm s3types.ChecksumAlgorithm) Option {
+	return func(opts *options) error {
+		if !isChecksumAlgorithm(algorithm) {
+			return fmt.Errorf("unsupported checksum algorithm %s", algorithm)
+		}
+
+		opts.checksumAlgorithm = algorithm
+		return nil
+	}
+}
+
+// PreserveMd5Digests keeps the md5 digests AWS SQS calculated for reference and inline messages in the outputs of
+// SendHeftyMessage and ReceiveHeftyMessage, instead of replacing them with the md5 digests of the hefty message. Both
+// digests are always available through SqsMd5Digests and HeftyMd5Digests.
+func PreserveMd5Digests() Option {
+	return func(opts *options) error {
+		opts.preserveMd5Digests = true
+		return nil
+	}
+}
+
+// WithReceiptHandleSigningKey signs the receipt handles of hefty messages returned by ReceiveHeftyMessage with an
+// HMAC-SHA256 using `key`, and makes DeleteHeftyMessage reject receipt handles of hefty messages that are not signed with
+// it. This prevents a tampered receipt handle from deleting unrelated objects. The key must be at least 32 bytes and be
+// shared by all receivers of the queue.
+func WithReceiptHandleSigningKey(key []byte) Option {
+	return func(opts *options) error {
+		if len(key) < minReceiptHandleKeyLength {
+			return fmt.Errorf("receipt handle signing key must be at least %d bytes", minReceiptHandleKeyLength)
+		}
+
+		opts.receiptHandleKey = append([]byte{}, key...)
+		return nil
+	}
+}
+
+// WithReceiptHandleStore stores receipt handles of hefty messages longer than MaxReceiptHandleLength in `store`, so that
+// ReceiveHeftyMessage returns a short receipt handle referencing the stored one instead.
+func WithReceiptHandleStore(store ReceiptHandleStore) Option {
+	return func(opts *options) error {
+		if store == nil {
+			return errors.New("receipt handle store must not be nil")
+		}
+
+		opts.receiptHandles = store
+		return nil
+	}
+}
+
+// WithBucketPosture verifies that the buckets hefty messages are stored in have the security configuration `posture`
+// when the client wrapper is created, and fails with a descriptive error instead of storing hefty messages in a
+// misconfigured bucket. The AWS S3 client must be allowed to read the bucket configuration.
+func WithBucketPosture(posture BucketPosture) Option {
+	return func(opts *options) error {
+		opts.bucketPosture = &posture
+		return nil
+	}
+}
+
+// WithAutoCreateBucket creates the buckets hefty messages are stored in when they do not exist, using `defaults` for the
+// region, default encryption and expiration of hefty messages. Block Public Access is enabled on created buckets. This is
+// meant for ephemeral environments and integration tests; production buckets should be provisioned out of band. The AWS
+// S3 client must be allowed to create and configure buckets.
+func WithAutoCreateBucket(defaults BucketDefaults) Option {
+	return func(opts *options) error {
+		switch defaults.Encryption {
+		case "", s3types.ServerSideEncryptionAes256, s3types.ServerSideEncryptionAwsKms, s3types.ServerSideEncryptionAwsKmsDsse:
+		default:
+			return fmt.Errorf("server side encryption %s is not supported", defaults.Encryption)
+		}
+		if defaults.KmsKeyId != "" && (defaults.Encryption == "" || defaults.Encryption == s3types.ServerSideEncryptionAes256) {
+			return errors.New("kms key id requires aws:kms or aws:kms:dsse encryption")
+		}
+
+		opts.autoCreateBucket = &defaults
+		return nil
+	}
+}
+
+// WithSkipBucketCheck skips checking that the buckets hefty messages are stored in exist when the client wrapper is
+// created. The check calls HeadBucket, which requires s3:ListBucket and adds latency to cold starts, e.g. in AWS Lambda.
+// A missing or inaccessible bucket is then only reported by the first send or receive of a hefty message. Cannot be used
+// with WithAutoCreateBucket.
+func WithSkipBucketCheck() Option {
+	return func(opts *options) error {
+		opts.skipBucketCheck = true
+		return nil
+	}
+}
+
+// WithLazyBucketCheck checks that a bucket exists, creates it when enabled with WithAutoCreateBucket and verifies its
+// security posture when enabled with WithBucketPosture on the first AWS S3 operation on the bucket, instead of when the
+// client wrapper is created. Client wrappers that only ever send messages small enough to not be stored never call AWS S3.
+// A bucket is not checked again once it was checked successfully.
+func WithLazyBucketCheck() Option {
+	return func(opts *options) error {
+		opts.lazyBucketCheck = true
+		return nil
+	}
+}
+
+// WithExpiryFromQueueRetention tags every hefty message uploaded to AWS S3 with the number of days after which it expires,
+// which is the message retention period of the queue rounded up to whole days plus `graceDays`. The retention period is
+// looked up with GetQueueAttributes on the first send to a queue. The tag is consumed by the lifecycle rules installed by
+// ConfigureTaggedExpiration, so that hefty messages expire shortly after their reference messages would have.
+func WithExpiryFromQueueRetention(graceDays int32) Option {
+	return func(opts *options) error {
+		if graceDays < 0 {
+			return fmt.Errorf("grace days of %d must not be negative", graceDays)
+		}
+
+		opts.expiry = newQueueRetentionExpiry(graceDays)
+		return nil
+	}
+}
+
+// WithRetainPayloads makes DeleteHeftyMessage only delete the reference message from AWS SQS and leave the hefty message in
+// AWS S3 or the payload store, e.g. for audits or replays. Retained hefty messages are never deleted by the wrapper, so
+// they should be cleaned up by a lifecycle rule, see ConfigureLifecycle.
+func WithRetainPayloads() Option {
+	return func(opts *options) error {
+		opts.retainPayloads = true
+		return nil
+	}
+}
+
+// WithDeleteOrder sets the order in which DeleteHeftyMessage deletes the hefty message and the reference message. The
+// default is DeletePayloadFirst. DeleteMessageFirst keeps the hefty message when the reference message could not be
+// deleted, at the cost of leaving the hefty message behind when its own delete fails.
+func WithDeleteOrder(order DeleteOrder) Option {
+	return func(opts *options) error {
+		switch order {
+		case DeletePayloadFirst, DeleteMessageFirst:
+		default:
+			return fmt.Errorf("delete order %d is not supported", order)
+		}
+
+		opts.deleteOrder = order
+		return nil
+	}
+}
+
+// WithPayloadCleanup retries deletes of hefty messages that failed in DeleteHeftyMessage in a background goroutine instead
+// of reporting them to the caller, so that hefty messages are eventually deleted even when AWS S3 is briefly unavailable.
+// Cleanups that fail too often are given to the spool of `config`, if any. Close must be called on shutdown to stop the
+// background goroutine and spool the pending cleanups.
+func WithPayloadCleanup(config CleanupConfig) Option {
+	return func(opts *options) error {
+		if config.QueueSize < 0 || config.MaxAttempts < 0 || config.Backoff < 0 {
+			return errors.New("payload cleanup queue size, max attempts and backoff must not be negative")
+		}
+
+		opts.cleanup = &config
+		return nil
+	}
+}
+
+// WithOrphanCleanupHook sets the hook called with the outcome of deleting a hefty message whose reference message could
+// not be sent. Such hefty messages are deleted when AWS SQS or AWS SNS rejected the send, and kept when the reference
+// message may have been sent, e.g. when the request timed out.
+func WithOrphanCleanupHook(hook OrphanCleanupHook) Option {
+	return func(opts *options) error {
+		opts.orphanHook = hook
+		return nil
+	}
+}
+
+// WithPresignedUrls embeds a presigned GET url that expires after `expiry` in the reference message of every hefty message
+// uploaded to AWS S3, so that consumers without AWS S3 credentials, e.g. partners in other accounts, can get the hefty
+// message, see resolve.ResolvePresignedReference. The expiry should be at least the message retention period of the
+// queue and is at most 7 days. Urls presigned with temporary credentials expire with those credentials at the latest.
+func WithPresignedUrls(expiry time.Duration) Option {
+	return func(opts *options) error {
+		if expiry <= 0 || expiry > maxPresignExpiry {
+			return fmt.Errorf("presigned url expiry of %s must be greater than 0 and at most %s", expiry, maxPresignExpiry)
+		}
+
+		opts.presignExpiry = expiry
+		return nil
+	}
+}
+
+// WithReceiveMemoryBudget limits the bytes of hefty messages ReceiveHeftyMessage resolves in a single call to `maxBytes`.
+// Messages whose hefty message does not fit are returned with their reference message as body, are listed by
+// UnresolvedMessages, and can be resolved one at a time with ResolveHeftyMessage. The first hefty message of a call is
+// always resolved, so that hefty messages larger than the budget are still received. Consumers resolve such messages
+// once a handler is free.
+func WithReceiveMemoryBudget(maxBytes int64) Option {
+	return func(opts *options) error {
+		if maxBytes <= 0 {
+			return fmt.Errorf("receive memory budget of %d bytes must be greater than 0", maxBytes)
+		}
+
+		opts.receiveMemoryBudget = maxBytes
+		return nil
+	}
+}
+
+// WithSpooling leaves hefty messages larger than `threshold` bytes unresolved on receive, so that they are not held in
+// memory. Such messages are listed by UnresolvedMessages and are read from a temporary file in `dir` with
+// OpenHeftyMessage. The temporary directory of the system is used when `dir` is empty. Hefty messages sent by versions
+// that did not record their size are always resolved in memory.
+func WithSpooling(threshold int64, dir string) Option {
+	return func(opts *options) error {
+		if threshold <= 0 {
+			return fmt.Errorf("spooling threshold of %d bytes must be greater than 0", threshold)
+		}
+
+		opts.spoolThreshold = threshold
+		opts.spoolDir = dir
+		return nil
+	}
+}
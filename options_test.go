@@ -0,0 +1,216 @@
+package hefty
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithStorageClass(t *testing.T) {
+	var tests = []struct {
+		desc   string
+		class  s3types.StorageClass
+		expErr bool
+	}{
+		{desc: "standard_ia", class: s3types.StorageClassStandardIa},
+		{desc: "onezone_ia", class: s3types.StorageClassOnezoneIa},
+		{desc: "intelligent_tiering", class: s3types.StorageClassIntelligentTiering},
+		{desc: "glacier_requires_restore", class: s3types.StorageClassGlacier, expErr: true},
+		{desc: "deep_archive_requires_restore", class: s3types.StorageClassDeepArchive, expErr: true},
+		{desc: "unknown", class: "FOO", expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			opts := defaultOptions()
+			err := WithStorageClass(tt.class)(&opts)
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.class, opts.storageClass)
+		})
+	}
+}
+
+func TestWithDigestAlgorithm(t *testing.T) {
+	var tests = []struct {
+		desc         string
+		algorithm    DigestAlgorithm
+		expAlgorithm string
+		expErr       bool
+	}{
+		{desc: "md5_not_recorded", algorithm: DigestMd5, expAlgorithm: ""},
+		{desc: "sha256", algorithm: DigestSha256, expAlgorithm: "sha256"},
+		{desc: "unsupported", algorithm: "sha1", expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			opts := defaultOptions()
+			err := WithDigestAlgorithm(tt.algorithm)(&opts)
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expAlgorithm, opts.digestAlgorithm)
+		})
+	}
+}
+
+func TestWithObjectAcl(t *testing.T) {
+	var tests = []struct {
+		desc   string
+		acl    s3types.ObjectCannedACL
+		expErr bool
+	}{
+		{desc: "bucket_owner_full_control", acl: s3types.ObjectCannedACLBucketOwnerFullControl},
+		{desc: "private", acl: s3types.ObjectCannedACLPrivate},
+		{desc: "unknown", acl: "public", expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			opts := defaultOptions()
+			err := WithObjectAcl(tt.acl)(&opts)
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.acl, opts.ownership.acl)
+		})
+	}
+}
+
+func TestWithExpectedBucketOwner(t *testing.T) {
+	var tests = []struct {
+		desc      string
+		accountId string
+		expErr    bool
+	}{
+		{desc: "account_id", accountId: "123456789012"},
+		{desc: "too_short", accountId: "12345678901", expErr: true},
+		{desc: "not_numeric", accountId: "12345678901a", expErr: true},
+		{desc: "empty", accountId: "", expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			opts := defaultOptions()
+			err := WithExpectedBucketOwner(tt.accountId)(&opts)
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.accountId, opts.ownership.expectedBucketOwner)
+		})
+	}
+}
+
+func TestWithDownloadConcurrency(t *testing.T) {
+	var tests = []struct {
+		desc        string
+		partSize    int64
+		concurrency int
+		expErr      bool
+	}{
+		{desc: "valid", partSize: 1024 * 1024, concurrency: 10},
+		{desc: "zero_part_size", partSize: 0, concurrency: 10, expErr: true},
+		{desc: "zero_concurrency", partSize: 1024 * 1024, concurrency: 0, expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			opts := defaultOptions()
+			err := WithDownloadConcurrency(tt.partSize, tt.concurrency)(&opts)
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.partSize, opts.downloadPartSize)
+			assert.Equal(t, tt.concurrency, opts.downloadConcurrency)
+		})
+	}
+}
+
+func TestWithS3Endpoint(t *testing.T) {
+	var paths []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	s3Client := s3.New(s3.Options{Region: "us-east-1", Credentials: aws.AnonymousCredentials{}, RetryMaxAttempts: 1})
+	input := &s3.PutObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key"), Body: strings.NewReader("hefty")}
+
+	// the certificate of the server is not trusted
+	opts := defaultOptions()
+	assert.Nil(t, WithS3Endpoint(server.URL)(&opts))
+	assert.Nil(t, WithS3PathStyle()(&opts))
+	_, err := s3Client.PutObject(context.TODO(), input, opts.s3OptFns()...)
+	assert.ErrorContains(t, err, "certificate")
+	assert.Empty(t, paths)
+
+	assert.Nil(t, WithS3InsecureSkipVerify()(&opts))
+	_, err = s3Client.PutObject(context.TODO(), input, opts.s3OptFns()...)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/bucket/key"}, paths)
+
+	assert.NotNil(t, WithS3Endpoint("localhost")(&opts))
+}
+
+func TestWithS3InsecureSkipVerify(t *testing.T) {
+	opts := defaultOptions()
+	assert.Nil(t, WithS3InsecureSkipVerify()(&opts))
+	optFns := opts.s3OptFns()
+
+	apply := func(client s3.HTTPClient) s3.HTTPClient {
+		o := s3.Options{HTTPClient: client}
+		for _, optFn := range optFns {
+			optFn(&o)
+		}
+		return o.HTTPClient
+	}
+
+	// the transport of a buildable client is cloned once, keeping its other settings
+	buildable := awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		tr.MaxIdleConns = 7
+	})
+	insecure := apply(buildable)
+	assert.NotSame(t, buildable, insecure)
+	assert.Same(t, insecure, apply(buildable))
+	transport := insecure.(*awshttp.BuildableClient).GetTransport()
+	assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+	assert.Equal(t, 7, transport.MaxIdleConns)
+	assert.False(t, buildable.GetTransport().TLSClientConfig.InsecureSkipVerify)
+
+	// a client is built once when there is none
+	built := apply(nil)
+	assert.NotNil(t, built)
+	assert.Same(t, built, apply(nil))
+
+	// requests with other clients configured by the caller fail, as their transport cannot be changed
+	_, err := apply(&http.Client{}).Do(&http.Request{})
+	assert.ErrorIs(t, err, errOpaqueHTTPClient)
+
+	// so do wrappers for an AWS S3 client with such a client
+	assert.ErrorIs(t, checkS3Client(s3.New(s3.Options{HTTPClient: &http.Client{}}), &opts), errOpaqueHTTPClient)
+	assert.Nil(t, checkS3Client(s3.New(s3.Options{HTTPClient: buildable}), &opts))
+}
@@ -0,0 +1,113 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// OrphanCleanup describes the cleanup of a hefty message whose reference message could not be sent
+type OrphanCleanup struct {
+	Bucket    string
+	Key       string
+	Backend   string
+	VersionId string
+	SendErr   error // error of the failed send
+	Deleted   bool  // whether the hefty message was deleted
+	Err       error // why the hefty message was not deleted; nil when deleted
+}
+
+// OrphanCleanupHook is called with the outcome of every cleanup of a hefty message whose reference message could not be
+// sent, e.g. to record metrics. See WithOrphanCleanupHook.
+type OrphanCleanupHook func(ctx context.Context, cleanup OrphanCleanup)
+
+// errMaybeSent is the reason a hefty message is kept when it is unknown whether its reference message was sent
+var errMaybeSent = errors.New("hefty message kept since the reference message may have been sent")
+
+// cleanupOrphan deletes the hefty message of a reference message that could not be sent, so that it is not left behind in
+// AWS S3 or the payload store. The hefty message is only deleted when AWS rejected the send, since the reference message
+// may have been sent when the request failed otherwise, e.g. when it timed out. With payload cleanup, a failed delete is
+// retried in the background.
+func (storage *payloadStorage) cleanupOrphan(ctx context.Context, refMsg *types.ReferenceMsg, sendErr error) OrphanCleanup {
+	cleanup := OrphanCleanup{
+		Bucket:    refMsg.S3Bucket,
+		Key:       refMsg.S3Key,
+		Backend:   refMsg.Backend,
+		VersionId: refMsg.S3VersionId,
+		SendErr:   sendErr,
+	}
+
+	if !isRejected(sendErr) {
+		cleanup.Err = errMaybeSent
+		if storage.orphanHook != nil {
+			storage.orphanHook(ctx, cleanup)
+		}
+
+		return cleanup
+	}
+
+	return storage.deleteOrphan(ctx, refMsg, sendErr)
+}
+
+// cleanupFailedEntries deletes the hefty messages of the entries of a batch send that AWS SQS did not accept, and returns
+// the cleanup of every such entry by entry id. `refMsgs` holds the reference messages of the entries that were stored as
+// hefty messages by entry id. An entry that failed is known not to have been sent, so its hefty message is always deleted.
+// The hefty messages of all entries are cleaned up as for a single send when the whole batch failed with `batchErr`.
+func (storage *payloadStorage) cleanupFailedEntries(ctx context.Context, refMsgs map[string]*types.ReferenceMsg, failed []sqstypes.BatchResultErrorEntry, batchErr error) map[string]OrphanCleanup {
+	cleanups := map[string]OrphanCleanup{}
+	if batchErr != nil {
+		for id, refMsg := range refMsgs {
+			cleanups[id] = storage.cleanupOrphan(ctx, refMsg, batchErr)
+		}
+
+		return cleanups
+	}
+
+	for _, entry := range failed {
+		refMsg, ok := refMsgs[aws.ToString(entry.Id)]
+		if !ok {
+			continue
+		}
+
+		entryErr := fmt.Errorf("batch entry %s failed with %s. %s", aws.ToString(entry.Id), aws.ToString(entry.Code), aws.ToString(entry.Message))
+		cleanups[aws.ToString(entry.Id)] = storage.deleteOrphan(ctx, refMsg, entryErr)
+	}
+
+	return cleanups
+}
+
+// deleteOrphan deletes the hefty message of a reference message that is known not to have been sent
+func (storage *payloadStorage) deleteOrphan(ctx context.Context, refMsg *types.ReferenceMsg, sendErr error) OrphanCleanup {
+	cleanup := OrphanCleanup{
+		Bucket:    refMsg.S3Bucket,
+		Key:       refMsg.S3Key,
+		Backend:   refMsg.Backend,
+		VersionId: refMsg.S3VersionId,
+		SendErr:   sendErr,
+	}
+
+	// the send may have failed because the context was canceled, which must not prevent the delete
+	cleanup.Err = storage.delete(context.WithoutCancel(ctx), refMsg.S3Bucket, refMsg.S3Key, refMsg.Backend, refMsg.S3VersionId, refMsg.Counted)
+	cleanup.Deleted = cleanup.Err == nil
+
+	if storage.orphanHook != nil {
+		storage.orphanHook(ctx, cleanup)
+	}
+
+	return cleanup
+}
+
+// isRejected checks whether a request failed with a client error response, which means AWS did not accept it
+func isRejected(err error) bool {
+	var respErr *awshttp.ResponseError
+	if !errors.As(err, &respErr) {
+		return false
+	}
+
+	return respErr.HTTPStatusCode() >= 400 && respErr.HTTPStatusCode() < 500
+}
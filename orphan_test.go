@@ -0,0 +1,94 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func responseError(statusCode int) error {
+	return &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: statusCode}},
+		Err:      errors.New("api error"),
+	}}
+}
+
+func TestCleanupOrphan(t *testing.T) {
+	var tests = []struct {
+		desc       string
+		sendErr    error
+		expDeleted bool
+	}{
+		{desc: "rejected", sendErr: responseError(http.StatusBadRequest), expDeleted: true},
+		{desc: "server_error_may_have_been_sent", sendErr: responseError(http.StatusInternalServerError)},
+		{desc: "timeout_may_have_been_sent", sendErr: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var cleanups []OrphanCleanup
+			store := &memoryStore{payloads: map[string][]byte{"key": []byte("hefty message")}}
+			storage := &payloadStorage{
+				payloadStore: store,
+				orphanHook: func(_ context.Context, cleanup OrphanCleanup) {
+					cleanups = append(cleanups, cleanup)
+				},
+			}
+
+			ctx, cancel := context.WithCancel(context.TODO())
+			cancel()
+			storage.cleanupOrphan(ctx, &types.ReferenceMsg{S3Key: "key", Backend: "memory"}, tt.sendErr)
+
+			assert.Len(t, cleanups, 1)
+			assert.Equal(t, tt.expDeleted, cleanups[0].Deleted)
+			assert.Equal(t, tt.sendErr, cleanups[0].SendErr)
+			assert.Equal(t, !tt.expDeleted, cleanups[0].Err != nil)
+			assert.Equal(t, !tt.expDeleted, len(store.payloads) == 1)
+		})
+	}
+}
+
+func TestCleanupFailedEntries(t *testing.T) {
+	newStorage := func() (*payloadStorage, *memoryStore) {
+		store := &memoryStore{payloads: map[string][]byte{"a": {}, "b": {}, "c": {}}}
+		return &payloadStorage{payloadStore: store}, store
+	}
+	refMsgs := map[string]*types.ReferenceMsg{
+		"1": {S3Key: "a", Backend: "memory"},
+		"2": {S3Key: "b", Backend: "memory"},
+		"3": {S3Key: "c", Backend: "memory"},
+	}
+
+	// only the hefty messages of failed entries are deleted
+	storage, store := newStorage()
+	failed := []sqstypes.BatchResultErrorEntry{
+		{Id: aws.String("2"), Code: aws.String("InvalidParameterValue"), SenderFault: true},
+		{Id: aws.String("4"), Code: aws.String("InvalidParameterValue"), SenderFault: true}, // sent as is
+	}
+	cleanups := storage.cleanupFailedEntries(context.TODO(), refMsgs, failed, nil)
+	assert.Len(t, cleanups, 1)
+	assert.True(t, cleanups["2"].Deleted)
+	assert.ErrorContains(t, cleanups["2"].SendErr, "InvalidParameterValue")
+	assert.Equal(t, map[string][]byte{"a": {}, "c": {}}, store.payloads)
+
+	// hefty messages of all entries are deleted when the batch was rejected
+	storage, store = newStorage()
+	cleanups = storage.cleanupFailedEntries(context.TODO(), refMsgs, nil, responseError(http.StatusBadRequest))
+	assert.Len(t, cleanups, 3)
+	assert.Empty(t, store.payloads)
+
+	// hefty messages are kept when the batch may have been sent
+	storage, store = newStorage()
+	cleanups = storage.cleanupFailedEntries(context.TODO(), refMsgs, nil, context.DeadlineExceeded)
+	assert.Len(t, cleanups, 3)
+	assert.False(t, cleanups["1"].Deleted)
+	assert.Len(t, store.payloads, 3)
+}
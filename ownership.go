@@ -0,0 +1,36 @@
+package hefty
+
+import (
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// objectOwnership holds the settings needed to store hefty messages in a bucket owned by another AWS account
+type objectOwnership struct {
+	acl                 s3types.ObjectCannedACL
+	expectedBucketOwner string
+}
+
+// isObjectCannedAcl checks whether `acl` is an AWS S3 canned ACL for objects
+func isObjectCannedAcl(acl s3types.ObjectCannedACL) bool {
+	for _, known := range acl.Values() {
+		if acl == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isAccountId checks whether `accountId` is a 12 digit AWS account id
+func isAccountId(accountId string) bool {
+	if len(accountId) != 12 {
+		return false
+	}
+	for _, c := range accountId {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
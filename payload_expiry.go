@@ -0,0 +1,107 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const secondsPerDay = 86_400
+
+type payloadTtlKey struct{}
+
+// ContextWithPayloadTtl returns a context that makes the hefty message sent with it expire after `days` days instead of
+// the expiry derived from the queue retention, so that specific messages can be kept shorter or longer. The hefty message
+// is tagged with the number of days, which is consumed by the lifecycle rules installed by ConfigureTaggedExpiration.
+// The number of days must be at least 1 and should be longer than the message retention period of the queue.
+func ContextWithPayloadTtl(ctx context.Context, days int32) context.Context {
+	return context.WithValue(ctx, payloadTtlKey{}, days)
+}
+
+// payloadTtlTags returns the tags of a hefty message sent with a payload ttl, or nil when the context has no payload ttl
+func payloadTtlTags(ctx context.Context) (map[string]string, error) {
+	days, ok := ctx.Value(payloadTtlKey{}).(int32)
+	if !ok {
+		return nil, nil
+	}
+	if days < 1 {
+		return nil, fmt.Errorf("payload ttl of %d days must be at least 1", days)
+	}
+
+	return expirationTags(days), nil
+}
+
+// queueAttributesClient is the part of the AWS SQS client used to get the message retention period of a queue
+type queueAttributesClient interface {
+	GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error)
+}
+
+// queueRetentionExpiry derives the number of days after which hefty messages expire from the message retention period of
+// the queue their reference message is sent to. The retention period of a queue is only looked up on the first send to it.
+type queueRetentionExpiry struct {
+	graceDays int32
+	mu        sync.Mutex
+	days      map[string]int32 // expiration days by queue url
+}
+
+func newQueueRetentionExpiry(graceDays int32) *queueRetentionExpiry {
+	return &queueRetentionExpiry{
+		graceDays: graceDays,
+		days:      map[string]int32{},
+	}
+}
+
+// tags returns the tags of hefty messages sent to `queueUrl`. A payload ttl of the context takes precedence over the
+// queue retention. Nil is returned when neither is available.
+func (expiry *queueRetentionExpiry) tags(ctx context.Context, client queueAttributesClient, queueUrl string, optFns ...func(*sqs.Options)) (map[string]string, error) {
+	if tags, err := payloadTtlTags(ctx); tags != nil || err != nil {
+		return tags, err
+	}
+	if expiry == nil {
+		return nil, nil
+	}
+
+	days, err := expiry.expirationDays(ctx, client, queueUrl, optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	return expirationTags(days), nil
+}
+
+func (expiry *queueRetentionExpiry) expirationDays(ctx context.Context, client queueAttributesClient, queueUrl string, optFns ...func(*sqs.Options)) (int32, error) {
+	expiry.mu.Lock()
+	defer expiry.mu.Unlock()
+
+	if days, ok := expiry.days[queueUrl]; ok {
+		return days, nil
+	}
+
+	out, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueUrl),
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameMessageRetentionPeriod},
+	}, optFns...)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get message retention period of queue %s. %v", queueUrl, err)
+	}
+
+	retention, err := strconv.Atoi(out.Attributes[string(sqstypes.QueueAttributeNameMessageRetentionPeriod)])
+	if err != nil {
+		return 0, fmt.Errorf("invalid message retention period of queue %s. %v", queueUrl, err)
+	}
+
+	// hefty messages expire on the first day boundary after their reference message would have expired
+	days := int32((retention+secondsPerDay-1)/secondsPerDay) + expiry.graceDays
+	expiry.days[queueUrl] = days
+	return days, nil
+}
+
+// expirationTags returns the tags of a hefty message that expires after `days` days
+func expirationTags(days int32) map[string]string {
+	return map[string]string{TagKeyExpirationDays: strconv.Itoa(int(days))}
+}
@@ -0,0 +1,91 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeQueueAttributesClient struct {
+	retention string
+	err       error
+	calls     int
+}
+
+func (c *fakeQueueAttributesClient) GetQueueAttributes(context.Context, *sqs.GetQueueAttributesInput, ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &sqs.GetQueueAttributesOutput{Attributes: map[string]string{"MessageRetentionPeriod": c.retention}}, nil
+}
+
+func TestQueueRetentionExpiry(t *testing.T) {
+	var tests = []struct {
+		desc      string
+		retention string
+		graceDays int32
+		err       error
+		expDays   string
+		expErr    bool
+	}{
+		{desc: "default_retention", retention: "345600", expDays: "4"},
+		{desc: "partial_day_rounds_up", retention: "60", expDays: "1"},
+		{desc: "grace_days", retention: "1209600", graceDays: 1, expDays: "15"},
+		{desc: "lookup_fails", err: errors.New("access denied"), expErr: true},
+		{desc: "invalid_retention", retention: "", expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			client := &fakeQueueAttributesClient{retention: tt.retention, err: tt.err}
+			expiry := newQueueRetentionExpiry(tt.graceDays)
+			for i := 0; i < 2; i++ {
+				tags, err := expiry.tags(context.TODO(), client, "queue")
+				if tt.expErr {
+					assert.NotNil(t, err)
+					return
+				}
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]string{TagKeyExpirationDays: tt.expDays}, tags)
+			}
+
+			// retention period is only looked up on the first send
+			assert.Equal(t, 1, client.calls)
+		})
+	}
+
+	// no tags when expiry is not derived from the queue retention
+	var disabled *queueRetentionExpiry
+	tags, err := disabled.tags(context.TODO(), nil, "queue")
+	assert.Nil(t, err)
+	assert.Nil(t, tags)
+}
+
+func TestPayloadTtl(t *testing.T) {
+	client := &fakeQueueAttributesClient{retention: "345600"}
+	expiry := newQueueRetentionExpiry(0)
+
+	// payload ttl takes precedence over the queue retention
+	tags, err := expiry.tags(ContextWithPayloadTtl(context.TODO(), 30), client, "queue")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{TagKeyExpirationDays: "30"}, tags)
+	assert.Equal(t, 0, client.calls)
+
+	// payload ttl is used without expiry from the queue retention
+	var disabled *queueRetentionExpiry
+	tags, err = disabled.tags(ContextWithPayloadTtl(context.TODO(), 1), nil, "queue")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{TagKeyExpirationDays: "1"}, tags)
+
+	_, err = payloadTtlTags(ContextWithPayloadTtl(context.TODO(), 0))
+	assert.NotNil(t, err)
+}
+
+func TestEncodeTags(t *testing.T) {
+	assert.Nil(t, encodeTags(nil))
+	assert.Equal(t, "a=1&hefty-expiration-days=3", *encodeTags(map[string]string{TagKeyExpirationDays: "3", "a": "1"}))
+}
@@ -0,0 +1,50 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// PayloadStore is an alternative to AWS S3 for storing hefty messages. A payload store is selected with the
+// WithPayloadStore option for hefty messages up to a configurable size, while larger hefty messages are still stored in
+// AWS S3. The name returned by Backend is recorded in the reference message so that the receiver knows where to get the
+// hefty message from. The receiver must be configured with a payload store for the same backend.
+type PayloadStore interface {
+	// Backend returns the name of the payload store, e.g. "dynamodb". It must not be empty.
+	Backend() string
+	// Put stores the serialized hefty message under `key`.
+	Put(ctx context.Context, key string, payload []byte) error
+	// Get returns the serialized hefty message stored under `key`.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete removes the serialized hefty message stored under `key`.
+	Delete(ctx context.Context, key string) error
+}
+
+// selectPayloadStore returns the payload store to use for a serialized hefty message of `size` bytes, or nil when the
+// hefty message should be stored in AWS S3.
+func selectPayloadStore(store PayloadStore, maxSize, size int) PayloadStore {
+	if store == nil || size > maxSize {
+		return nil
+	}
+
+	return store
+}
+
+// payloadStoreForBackend returns the configured payload store that holds hefty messages for `backend`.
+func payloadStoreForBackend(store PayloadStore, backend string) (PayloadStore, error) {
+	if store == nil || store.Backend() != backend {
+		return nil, fmt.Errorf("no payload store configured for backend %s", backend)
+	}
+
+	return store, nil
+}
+
+// putPayload stores a serialized hefty message in a payload store and records the backend in the reference message.
+func putPayload(ctx context.Context, store PayloadStore, refMsg *types.ReferenceMsg, serialized []byte) error {
+	refMsg.S3Bucket = ""
+	refMsg.Backend = store.Backend()
+
+	return store.Put(ctx, refMsg.S3Key, serialized)
+}
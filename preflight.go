@@ -0,0 +1,163 @@
+package hefty
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
+	"github.com/google/uuid"
+)
+
+// PreflightCheck is the result of checking whether the clients of a wrapper are allowed to perform a single action
+type PreflightCheck struct {
+	Action   string // e.g. s3:PutObject
+	Resource string // bucket and key, queue url or topic arn the action was checked on
+	Allowed  bool
+	Err      error // why the action is not allowed or could not be checked; nil when allowed
+}
+
+// PreflightReport holds the results of a preflight check
+type PreflightReport struct {
+	Checks []PreflightCheck
+}
+
+// Missing returns the checks of actions that are not allowed or could not be checked
+func (report *PreflightReport) Missing() []PreflightCheck {
+	var missing []PreflightCheck
+	for _, check := range report.Checks {
+		if !check.Allowed {
+			missing = append(missing, check)
+		}
+	}
+
+	return missing
+}
+
+// Err returns an error listing the actions that are not allowed or could not be checked, or nil when all are allowed
+func (report *PreflightReport) Err() error {
+	missing := report.Missing()
+	if len(missing) == 0 {
+		return nil
+	}
+
+	lines := make([]string, 0, len(missing))
+	for _, check := range missing {
+		lines = append(lines, fmt.Sprintf("%s on %s. %v", check.Action, check.Resource, check.Err))
+	}
+
+	return fmt.Errorf("preflight check failed for %d actions: %s", len(missing), strings.Join(lines, "; "))
+}
+
+func (report *PreflightReport) add(action, resource string, err error) {
+	report.Checks = append(report.Checks, PreflightCheck{
+		Action:   action,
+		Resource: resource,
+		Allowed:  err == nil,
+		Err:      err,
+	})
+}
+
+// Preflight checks that the AWS S3 client of the wrapper can put, get and delete hefty messages under the configured key
+// prefix, and that the AWS SQS client can send, receive and delete messages on the queue `queueUrl`. A small object is
+// put and deleted again to check AWS S3. AWS SQS is checked with requests AWS SQS rejects after authorizing them, so no
+// messages are sent, received or deleted.
+func (wrapper *SqsClientWrapper) Preflight(ctx context.Context, queueUrl string) *PreflightReport {
+	report := &PreflightReport{}
+	wrapper.storage.preflight(ctx, report)
+
+	optFns := wrapper.withOptFns(nil)
+	_, err := wrapper.sqsClient().SendMessage(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(queueUrl), MessageBody: aws.String("")}, optFns...)
+	report.add("sqs:SendMessage", queueUrl, authorizedByRejection(err))
+
+	_, err = wrapper.sqsClient().ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueUrl), MaxNumberOfMessages: -1}, optFns...)
+	report.add("sqs:ReceiveMessage", queueUrl, authorizedByRejection(err))
+
+	_, err = wrapper.sqsClient().DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(queueUrl), ReceiptHandle: aws.String("hefty-preflight")}, optFns...)
+	report.add("sqs:DeleteMessage", queueUrl, authorizedByRejection(err))
+
+	return report
+}
+
+// Preflight checks that the AWS S3 client of the wrapper can put, get and delete hefty messages under the configured key
+// prefix, and that the AWS SNS client can publish to the topic `topicArn`. A small object is put and deleted again to
+// check AWS S3. AWS SNS is checked with a request AWS SNS rejects after authorizing it, so no message is published.
+func (wrapper *SnsClientWrapper) Preflight(ctx context.Context, topicArn string) *PreflightReport {
+	report := &PreflightReport{}
+	wrapper.storage.preflight(ctx, report)
+
+	_, err := wrapper.snsClient().Publish(ctx, &sns.PublishInput{TopicArn: aws.String(topicArn), Message: aws.String("")}, wrapper.withOptFns(nil)...)
+	report.add("sns:Publish", topicArn, authorizedByRejection(err))
+
+	return report
+}
+
+// preflight checks that hefty messages can be put, got and deleted by putting, getting and deleting a small object
+func (storage *payloadStorage) preflight(ctx context.Context, report *PreflightReport) {
+	key := storage.keys.prefix + "preflight/" + uuid.New().String()
+	resource := storage.bucket + "/" + key
+
+	_, err := storage.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(storage.bucket),
+		Key:                  aws.String(key),
+		Body:                 bytes.NewReader([]byte("hefty preflight")),
+		ServerSideEncryption: s3types.ServerSideEncryption(storage.encryption.algorithm),
+		SSEKMSKeyId:          optionalString(storage.encryption.kmsKeyId),
+		BucketKeyEnabled:     optionalBool(storage.encryption.bucketKeyEnabled),
+		ACL:                  storage.ownership.acl,
+		ExpectedBucketOwner:  optionalString(storage.ownership.expectedBucketOwner),
+	}, storage.s3OptFns...)
+	report.add("s3:PutObject", resource, err)
+
+	// getting a missing object is denied without s3:ListBucket, so get is only checked once the object was put
+	if err != nil {
+		report.add("s3:GetObject", resource, errors.New("not checked since the object could not be put"))
+	} else {
+		var out *s3.GetObjectOutput
+		out, err = storage.s3Client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket:              aws.String(storage.bucket),
+			Key:                 aws.String(key),
+			ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+		}, storage.s3OptFns...)
+		if err == nil {
+			_ = out.Body.Close()
+		}
+		report.add("s3:GetObject", resource, err)
+	}
+
+	_, err = storage.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:              aws.String(storage.bucket),
+		Key:                 aws.String(key),
+		ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+	}, storage.s3OptFns...)
+	report.add("s3:DeleteObject", resource, err)
+}
+
+// authorizedByRejection returns nil when a request that is invalid on purpose was rejected by AWS after it was authorized,
+// or the error of the request otherwise
+func authorizedByRejection(err error) error {
+	var apiErr smithy.APIError
+	if err == nil || (errors.As(err, &apiErr) && !isAccessDenied(err)) {
+		return nil
+	}
+
+	return err
+}
+
+// isAccessDenied checks whether an AWS error was caused by missing permissions
+func isAccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	code := apiErr.ErrorCode()
+	return strings.Contains(code, "AccessDenied") || code == "AuthorizationError" || code == "Forbidden"
+}
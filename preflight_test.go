@@ -0,0 +1,47 @@
+package hefty
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizedByRejection(t *testing.T) {
+	var tests = []struct {
+		desc       string
+		err        error
+		expAllowed bool
+	}{
+		{desc: "no_error", expAllowed: true},
+		{desc: "invalid_parameter", err: &smithy.GenericAPIError{Code: "InvalidParameterValue"}, expAllowed: true},
+		{desc: "invalid_receipt_handle", err: fmt.Errorf("operation error. %w", &smithy.GenericAPIError{Code: "ReceiptHandleIsInvalid"}), expAllowed: true},
+		{desc: "sqs_access_denied", err: &smithy.GenericAPIError{Code: "AccessDenied"}},
+		{desc: "sqs_access_denied_exception", err: &smithy.GenericAPIError{Code: "AccessDeniedException"}},
+		{desc: "sns_authorization_error", err: &smithy.GenericAPIError{Code: "AuthorizationError"}},
+		{desc: "not_api_error", err: errors.New("connection reset")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			err := authorizedByRejection(tt.err)
+			assert.Equal(t, tt.expAllowed, err == nil)
+		})
+	}
+}
+
+func TestPreflightReport(t *testing.T) {
+	report := &PreflightReport{}
+	report.add("s3:PutObject", "bucket/key", nil)
+	assert.Empty(t, report.Missing())
+	assert.NoError(t, report.Err())
+
+	report.add("sqs:SendMessage", "queue", &smithy.GenericAPIError{Code: "AccessDenied"})
+	missing := report.Missing()
+	assert.Len(t, missing, 1)
+	assert.Equal(t, "sqs:SendMessage", missing[0].Action)
+	assert.False(t, missing[0].Allowed)
+	assert.ErrorContains(t, report.Err(), "sqs:SendMessage on queue")
+}
@@ -0,0 +1,34 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// maxPresignExpiry is the longest expiry of a url presigned with signature version 4
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// presign records a presigned GET url of a hefty message uploaded to AWS S3 in its reference message, when presigned urls
+// are enabled. The url only has the bucket, key and version of the hefty message, so that it can be used without headers.
+func (storage *payloadStorage) presign(ctx context.Context, refMsg *types.ReferenceMsg) error {
+	if storage.presigner == nil {
+		return nil
+	}
+
+	req, err := storage.presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:    aws.String(refMsg.S3Bucket),
+		Key:       aws.String(refMsg.S3Key),
+		VersionId: optionalString(refMsg.S3VersionId),
+	}, s3.WithPresignExpires(storage.presignExpiry))
+	if err != nil {
+		return fmt.Errorf("unable to presign url of hefty message. %v", err)
+	}
+
+	refMsg.PresignedUrl = req.URL
+	return nil
+}
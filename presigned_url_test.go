@@ -0,0 +1,69 @@
+package hefty
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadStoragePresign(t *testing.T) {
+	s3Client := s3.New(s3.Options{
+		Region: "us-west-2",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	})
+
+	opts := defaultOptions()
+	assert.Nil(t, WithSkipBucketCheck()(&opts))
+	assert.Nil(t, WithPresignedUrls(12*time.Hour)(&opts))
+	storage, err := newPayloadStorage(s3Client, "bucket", &opts)
+	assert.Nil(t, err)
+
+	refMsg := types.NewReferenceMsg("us-west-2", "bucket", "queue/id", "", "")
+	refMsg.S3VersionId = "v1"
+	assert.Nil(t, storage.presign(context.TODO(), refMsg))
+
+	presigned, err := url.Parse(refMsg.PresignedUrl)
+	assert.Nil(t, err)
+	assert.Equal(t, "https", presigned.Scheme)
+	assert.Contains(t, presigned.Host, "bucket")
+	assert.Equal(t, "/queue/id", presigned.Path)
+	assert.Equal(t, "v1", presigned.Query().Get("versionId"))
+	assert.Equal(t, "43200", presigned.Query().Get("X-Amz-Expires"))
+
+	// presigned urls are only embedded when enabled
+	refMsg.PresignedUrl = ""
+	storage.presigner = nil
+	assert.Nil(t, storage.presign(context.TODO(), refMsg))
+	assert.Empty(t, refMsg.PresignedUrl)
+}
+
+func TestWithPresignedUrls(t *testing.T) {
+	tests := []struct {
+		expiry time.Duration
+		valid  bool
+	}{
+		{expiry: time.Hour, valid: true},
+		{expiry: 7 * 24 * time.Hour, valid: true},
+		{expiry: 0},
+		{expiry: 8 * 24 * time.Hour},
+	}
+
+	for _, test := range tests {
+		opts := defaultOptions()
+		err := WithPresignedUrls(test.expiry)(&opts)
+		if test.valid {
+			assert.Nil(t, err)
+			assert.Equal(t, test.expiry, opts.presignExpiry)
+		} else {
+			assert.NotNil(t, err)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/limits"
+)
+
+const (
+	defaultProducerFlushInterval = 100 * time.Millisecond
+	defaultProducerBuffer        = 100
+	maxBatchEntries              = 10
+)
+
+// ProducerConfig configures a Producer
+type ProducerConfig struct {
+	// FlushInterval is about the longest time a message waits for a batch to fill up before the batch is sent. 100
+	// milliseconds is used when 0.
+	FlushInterval time.Duration
+	// Buffer is the number of messages Send accepts for batching before it blocks. 100 is used when 0.
+	Buffer int
+}
+
+// SendCallback is called once a message passed to Producer.Send was sent, or with the error when it could not be sent
+type SendCallback func(out *sqs.SendMessageOutput, err error)
+
+// producerClient is the part of the AWS SQS client wrapper used by a Producer
+type producerClient interface {
+	SendHeftyMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	SendHeftyMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+}
+
+// Producer sends messages asynchronously and groups the messages that are sent as is into batches, so that far fewer
+// requests are made to AWS SQS than with SendHeftyMessage. Messages that are stored as hefty messages, or compressed,
+// are sent on their own with SendHeftyMessage. Batches are per queue and sent once they hold 10 messages, would exceed
+// the AWS SQS message size limit or waited for the flush interval.
+//
+// Since batched and individually sent messages are sent independently, the order of messages sent to a FIFO queue is
+// only kept among messages of the same kind.
+type Producer struct {
+	client    producerClient
+	batchable func(ctx context.Context, params *sqs.SendMessageInput) (bool, int, error)
+	config    ProducerConfig
+	mu        sync.RWMutex
+	closed    bool
+	pending   chan *producedMessage
+	sends     sync.WaitGroup
+	done      chan struct{}
+
+	tracked     sync.Mutex
+	inFlight    map[*producedMessage]struct{} // messages passed to Send that were not completed
+	draining    bool
+	undelivered []UndeliveredMessage // messages that failed while draining
+}
+
+// UndeliveredMessage is a message that could not be delivered before a Producer was drained
+type UndeliveredMessage struct {
+	Params *sqs.SendMessageInput
+	Err    error
+}
+
+// producedMessage is a message passed to Producer.Send
+type producedMessage struct {
+	producer *Producer
+	ctx      context.Context
+	params   *sqs.SendMessageInput
+	size     int
+	callback SendCallback
+}
+
+// producerBatch is a batch of messages sent to the same queue
+type producerBatch struct {
+	queueUrl string
+	msgs     []*producedMessage
+	size     int
+	started  time.Time
+}
+
+// NewProducer creates a producer sending messages with the wrapper. Close must be called to send the messages that are
+// still batched.
+func (wrapper *SqsClientWrapper) NewProducer(config ProducerConfig) *Producer {
+	return newProducer(wrapper, wrapper.batchable, config)
+}
+
+func newProducer(client producerClient, batchable func(ctx context.Context, params *sqs.SendMessageInput) (bool, int, error), config ProducerConfig) *Producer {
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultProducerFlushInterval
+	}
+	if config.Buffer <= 0 {
+		config.Buffer = defaultProducerBuffer
+	}
+
+	producer := &Producer{
+		client:    client,
+		batchable: batchable,
+		config:    config,
+		pending:   make(chan *producedMessage, config.Buffer),
+		done:      make(chan struct{}),
+		inFlight:  map[*producedMessage]struct{}{},
+	}
+	go producer.run()
+
+	return producer
+}
+
+// Send sends a message asynchronously and calls `callback`, when not nil, once it was sent. `ctx` bounds the wait for
+// a full buffer; the message itself is sent with a context that is not cancelled, so that it is not lost when the
+// caller returns. `params` must not be changed until `callback` was called.
+func (producer *Producer) Send(ctx context.Context, params *sqs.SendMessageInput, callback SendCallback) error {
+	producer.mu.RLock()
+	defer producer.mu.RUnlock()
+
+	if producer.closed {
+		return errors.New("unable to send message with a closed producer")
+	}
+
+	batchable, size, err := producer.batchable(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	msg := &producedMessage{producer: producer, ctx: context.WithoutCancel(ctx), params: params, size: size, callback: callback}
+	producer.track(msg)
+	if !batchable {
+		producer.sends.Add(1)
+		go func() {
+			defer producer.sends.Done()
+			msg.complete(producer.client.SendHeftyMessage(msg.ctx, params))
+		}()
+		return nil
+	}
+
+	select {
+	case producer.pending <- msg:
+		return nil
+	case <-ctx.Done():
+		producer.untrack(msg)
+		return ctx.Err()
+	}
+}
+
+// Close sends the messages that are still batched and waits until every message passed to Send was sent, see Drain
+func (producer *Producer) Close() {
+	_, _ = producer.Drain(context.Background())
+}
+
+// Drain stops accepting messages, sends the messages that are still batched and waits until every message passed to
+// Send was sent, including the uploads of hefty messages, so that a shutdown does not silently drop messages. It
+// returns the messages that could not be delivered: those whose send failed while draining and, when `ctx` is done
+// first, those that were not sent yet. Messages that were not sent yet are still sent in the background.
+func (producer *Producer) Drain(ctx context.Context) ([]UndeliveredMessage, error) {
+	producer.tracked.Lock()
+	producer.draining = true
+	producer.tracked.Unlock()
+
+	producer.mu.Lock()
+	if !producer.closed {
+		producer.closed = true
+		close(producer.pending)
+	}
+	producer.mu.Unlock()
+
+	var err error
+	select {
+	case <-producer.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	producer.tracked.Lock()
+	defer producer.tracked.Unlock()
+
+	undelivered := append([]UndeliveredMessage{}, producer.undelivered...)
+	if err != nil {
+		for msg := range producer.inFlight {
+			undelivered = append(undelivered, UndeliveredMessage{Params: msg.params, Err: err})
+		}
+	}
+
+	if len(undelivered) > 0 {
+		if err == nil {
+			err = undelivered[0].Err
+		}
+		return undelivered, fmt.Errorf("unable to deliver %d messages. %v", len(undelivered), err)
+	}
+
+	return nil, nil
+}
+
+// track records a message passed to Send until it is completed
+func (producer *Producer) track(msg *producedMessage) {
+	producer.tracked.Lock()
+	defer producer.tracked.Unlock()
+	producer.inFlight[msg] = struct{}{}
+}
+
+// untrack forgets a message that was not accepted by Send
+func (producer *Producer) untrack(msg *producedMessage) {
+	producer.tracked.Lock()
+	defer producer.tracked.Unlock()
+	delete(producer.inFlight, msg)
+}
+
+// run batches the pending messages until the producer is closed
+func (producer *Producer) run() {
+	defer close(producer.done)
+	defer producer.sends.Wait()
+
+	ticker := time.NewTicker(producer.config.FlushInterval / 2)
+	defer ticker.Stop()
+
+	batches := map[string]*producerBatch{}
+	for {
+		select {
+		case msg, ok := <-producer.pending:
+			if !ok {
+				for _, batch := range batches {
+					producer.flush(batch)
+				}
+				return
+			}
+
+			queueUrl := aws.ToString(msg.params.QueueUrl)
+			batch := batches[queueUrl]
+			if batch != nil && batch.size+msg.size > limits.MaxMessageLength(limits.SQS) {
+				producer.flush(batch)
+				batch = nil
+			}
+			if batch == nil {
+				batch = &producerBatch{queueUrl: queueUrl, started: time.Now()}
+				batches[queueUrl] = batch
+			}
+
+			batch.msgs = append(batch.msgs, msg)
+			batch.size += msg.size
+			if len(batch.msgs) == maxBatchEntries {
+				producer.flush(batch)
+				delete(batches, queueUrl)
+			}
+		case now := <-ticker.C:
+			for queueUrl, batch := range batches {
+				if now.Sub(batch.started) >= producer.config.FlushInterval {
+					producer.flush(batch)
+					delete(batches, queueUrl)
+				}
+			}
+		}
+	}
+}
+
+// flush sends a batch in the background
+func (producer *Producer) flush(batch *producerBatch) {
+	producer.sends.Add(1)
+	go func() {
+		defer producer.sends.Done()
+		producer.sendBatch(batch)
+	}()
+}
+
+// sendBatch sends a batch with SendHeftyMessageBatch and completes its messages
+func (producer *Producer) sendBatch(batch *producerBatch) {
+	input := &sqs.SendMessageBatchInput{QueueUrl: aws.String(batch.queueUrl)}
+	for i, msg := range batch.msgs {
+		input.Entries = append(input.Entries, sqstypes.SendMessageBatchRequestEntry{
+			Id:                      aws.String(strconv.Itoa(i)),
+			MessageBody:             msg.params.MessageBody,
+			MessageAttributes:       msg.params.MessageAttributes,
+			MessageSystemAttributes: msg.params.MessageSystemAttributes,
+			DelaySeconds:            msg.params.DelaySeconds,
+			MessageGroupId:          msg.params.MessageGroupId,
+			MessageDeduplicationId:  msg.params.MessageDeduplicationId,
+		})
+	}
+
+	// the batch is sent with the context of its first message
+	out, err := producer.client.SendHeftyMessageBatch(batch.msgs[0].ctx, input)
+	if err != nil {
+		for _, msg := range batch.msgs {
+			msg.complete(nil, err)
+		}
+		return
+	}
+
+	completed := make([]bool, len(batch.msgs))
+	for _, entry := range out.Successful {
+		i, err := strconv.Atoi(aws.ToString(entry.Id))
+		if err != nil || i < 0 || i >= len(batch.msgs) || completed[i] {
+			continue
+		}
+
+		completed[i] = true
+		batch.msgs[i].complete(&sqs.SendMessageOutput{
+			MessageId:                    entry.MessageId,
+			MD5OfMessageBody:             entry.MD5OfMessageBody,
+			MD5OfMessageAttributes:       entry.MD5OfMessageAttributes,
+			MD5OfMessageSystemAttributes: entry.MD5OfMessageSystemAttributes,
+			SequenceNumber:               entry.SequenceNumber,
+			ResultMetadata:               out.ResultMetadata,
+		}, nil)
+	}
+	for _, entry := range out.Failed {
+		i, err := strconv.Atoi(aws.ToString(entry.Id))
+		if err != nil || i < 0 || i >= len(batch.msgs) || completed[i] {
+			continue
+		}
+
+		completed[i] = true
+		batch.msgs[i].complete(nil, fmt.Errorf("unable to send message. %s: %s", aws.ToString(entry.Code), aws.ToString(entry.Message)))
+	}
+	for i, msg := range batch.msgs {
+		if !completed[i] {
+			msg.complete(nil, errors.New("unable to send message. no result was returned for the message"))
+		}
+	}
+}
+
+// complete calls the callback of a message
+func (msg *producedMessage) complete(out *sqs.SendMessageOutput, err error) {
+	producer := msg.producer
+	producer.tracked.Lock()
+	delete(producer.inFlight, msg)
+	if err != nil && producer.draining {
+		producer.undelivered = append(producer.undelivered, UndeliveredMessage{Params: msg.params, Err: err})
+	}
+	producer.tracked.Unlock()
+
+	if msg.callback != nil {
+		msg.callback(out, err)
+	}
+}
+
+// batchable reports whether a message is sent as is, so that it can be batched with other messages, and returns its size
+func (wrapper *SqsClientWrapper) batchable(ctx context.Context, params *sqs.SendMessageInput) (bool, int, error) {
+	// invalid input is left to SendHeftyMessage
+	if params == nil || params.MessageBody == nil || len(*params.MessageBody) == 0 {
+		return false, 0, nil
+	}
+
+	msgSize, err := messages.MessageSize(params.MessageBody, messages.MapFromSqsMessageAttributeValues(params.MessageAttributes))
+	if err != nil {
+		return false, 0, fmt.Errorf("unable to get size of message. %v", err)
+	}
+
+	if !wrapper.offload.inline(wrapper.alwaysSendToS3, wrapper.offload.threshold(limits.MaxMessageLength(limits.SQS)), msgSize) {
+		return false, msgSize, nil
+	}
+
+	// messages sent with SendHeftyMessage report their decision themselves
+	if wrapper.offload.OnDecision != nil {
+		wrapper.offload.OnDecision(ctx, OffloadEvent{Target: aws.ToString(params.QueueUrl), Decision: OffloadInline, Size: msgSize})
+	}
+
+	return true, msgSize, nil
+}
@@ -0,0 +1,187 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProducerClient records the messages sent on their own and in batches
+type fakeProducerClient struct {
+	mu      sync.Mutex
+	single  []string
+	batches [][]string
+}
+
+func (client *fakeProducerClient) SendHeftyMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.single = append(client.single, aws.ToString(params.MessageBody))
+	return &sqs.SendMessageOutput{MessageId: aws.String("single")}, nil
+}
+
+func (client *fakeProducerClient) SendHeftyMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	out := &sqs.SendMessageBatchOutput{}
+	var bodies []string
+	for _, entry := range params.Entries {
+		body := aws.ToString(entry.MessageBody)
+		bodies = append(bodies, body)
+		if body == "rejected" {
+			out.Failed = append(out.Failed, sqstypes.BatchResultErrorEntry{Id: entry.Id, Code: aws.String("InvalidMessageContents"), Message: aws.String("invalid")})
+			continue
+		}
+		out.Successful = append(out.Successful, sqstypes.SendMessageBatchResultEntry{Id: entry.Id, MessageId: aws.String(body)})
+	}
+	client.batches = append(client.batches, bodies)
+
+	return out, nil
+}
+
+// batchableUnder batches messages shorter than `size`
+func batchableUnder(size int) func(ctx context.Context, params *sqs.SendMessageInput) (bool, int, error) {
+	return func(ctx context.Context, params *sqs.SendMessageInput) (bool, int, error) {
+		msgSize := len(aws.ToString(params.MessageBody))
+		return msgSize < size, msgSize, nil
+	}
+}
+
+func TestProducer(t *testing.T) {
+	client := &fakeProducerClient{}
+	producer := newProducer(client, batchableUnder(100), ProducerConfig{FlushInterval: time.Hour})
+
+	var mu sync.Mutex
+	results := map[string]string{}
+	callback := func(body string) SendCallback {
+		return func(out *sqs.SendMessageOutput, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				results[body] = "error"
+				return
+			}
+			results[body] = aws.ToString(out.MessageId)
+		}
+	}
+
+	send := func(queueUrl, body string) {
+		assert.NoError(t, producer.Send(context.Background(), &sqs.SendMessageInput{QueueUrl: aws.String(queueUrl), MessageBody: aws.String(body)}, callback(body)))
+	}
+	for i := 0; i < 12; i++ {
+		send("orders", fmt.Sprintf("order-%d", i))
+	}
+	send("orders", "rejected")
+	send("refunds", "refund")
+	hefty := string(make([]byte, 200))
+	send("orders", hefty)
+	producer.Close()
+
+	assert.Equal(t, []string{hefty}, client.single)
+	assert.Len(t, client.batches, 3)
+	assert.Len(t, results, 15)
+	assert.Equal(t, "order-11", results["order-11"])
+	assert.Equal(t, "error", results["rejected"])
+	assert.Equal(t, "single", results[hefty])
+
+	assert.Error(t, producer.Send(context.Background(), &sqs.SendMessageInput{QueueUrl: aws.String("orders"), MessageBody: aws.String("late")}, nil))
+}
+
+func TestProducerFlushInterval(t *testing.T) {
+	client := &fakeProducerClient{}
+	producer := newProducer(client, batchableUnder(100), ProducerConfig{FlushInterval: 10 * time.Millisecond})
+	defer producer.Close()
+
+	sent := make(chan error, 1)
+	err := producer.Send(context.Background(), &sqs.SendMessageInput{QueueUrl: aws.String("orders"), MessageBody: aws.String("order")}, func(out *sqs.SendMessageOutput, err error) {
+		sent <- err
+	})
+	assert.NoError(t, err)
+
+	select {
+	case err = <-sent:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "batch was not flushed")
+	}
+}
+
+func TestProducerBatchSizeLimit(t *testing.T) {
+	client := &fakeProducerClient{}
+	producer := newProducer(client, func(ctx context.Context, params *sqs.SendMessageInput) (bool, int, error) {
+		return true, 100_000, nil
+	}, ProducerConfig{FlushInterval: time.Hour})
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, producer.Send(context.Background(), &sqs.SendMessageInput{QueueUrl: aws.String("orders"), MessageBody: aws.String("order")}, nil))
+	}
+	producer.Close()
+
+	// two messages of 100,000 bytes fit into the 262,144 byte limit of a batch
+	assert.Len(t, client.batches, 3)
+}
+
+func TestProducerBatchableError(t *testing.T) {
+	producer := newProducer(&fakeProducerClient{}, func(ctx context.Context, params *sqs.SendMessageInput) (bool, int, error) {
+		return false, 0, errors.New("unexpected data type")
+	}, ProducerConfig{})
+	defer producer.Close()
+
+	assert.Error(t, producer.Send(context.Background(), &sqs.SendMessageInput{}, nil))
+}
+
+// blockingProducerClient fails batches and blocks individual sends until unblocked
+type blockingProducerClient struct {
+	unblock chan struct{}
+}
+
+func (client *blockingProducerClient) SendHeftyMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	<-client.unblock
+	return &sqs.SendMessageOutput{MessageId: aws.String("single")}, nil
+}
+
+func (client *blockingProducerClient) SendHeftyMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	return nil, errors.New("throttled")
+}
+
+func TestProducerDrain(t *testing.T) {
+	client := &blockingProducerClient{unblock: make(chan struct{})}
+	defer close(client.unblock)
+	producer := newProducer(client, batchableUnder(100), ProducerConfig{FlushInterval: time.Hour})
+
+	batched := &sqs.SendMessageInput{QueueUrl: aws.String("orders"), MessageBody: aws.String("order")}
+	stored := &sqs.SendMessageInput{QueueUrl: aws.String("orders"), MessageBody: aws.String(string(make([]byte, 200)))}
+	assert.NoError(t, producer.Send(context.Background(), batched, nil))
+	assert.NoError(t, producer.Send(context.Background(), stored, nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	undelivered, err := producer.Drain(ctx)
+	assert.Error(t, err)
+	assert.ElementsMatch(t, []*sqs.SendMessageInput{batched, stored}, []*sqs.SendMessageInput{undelivered[0].Params, undelivered[1].Params})
+	for _, msg := range undelivered {
+		if msg.Params == batched {
+			assert.ErrorContains(t, msg.Err, "throttled")
+		} else {
+			assert.ErrorIs(t, msg.Err, context.DeadlineExceeded)
+		}
+	}
+}
+
+func TestProducerDrainDelivered(t *testing.T) {
+	producer := newProducer(&fakeProducerClient{}, batchableUnder(100), ProducerConfig{FlushInterval: time.Hour})
+	assert.NoError(t, producer.Send(context.Background(), &sqs.SendMessageInput{QueueUrl: aws.String("orders"), MessageBody: aws.String("order")}, nil))
+
+	undelivered, err := producer.Drain(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, undelivered)
+}
@@ -0,0 +1,201 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// RateLimitBehavior is what happens to an AWS S3 request that exceeds the rate of a StorageRateLimiter
+type RateLimitBehavior int
+
+const (
+	// RateLimitBlock delays the request until it fits in the rate, or its context is done. This is the default.
+	RateLimitBlock RateLimitBehavior = iota
+	// RateLimitFailFast fails the request with a *RateLimitedError instead of delaying it
+	RateLimitFailFast
+)
+
+// RateLimitedError is returned for AWS S3 requests that exceed the rate of a StorageRateLimiter with RateLimitFailFast
+type RateLimitedError struct {
+	// RetryAfter is how long the request would have been delayed
+	RetryAfter time.Duration
+}
+
+func (err *RateLimitedError) Error() string {
+	return fmt.Sprintf("storage rate limit exceeded; retry after %s", err.RetryAfter)
+}
+
+// asBackoffError returns the *RateLimitedError or *CircuitOpenError that failed an AWS S3 request, which is returned to
+// callers as is so that they can back off
+func asBackoffError(err error) (error, bool) {
+	var rateLimitedErr *RateLimitedError
+	if errors.As(err, &rateLimitedErr) {
+		return rateLimitedErr, true
+	}
+
+	var circuitOpenErr *CircuitOpenError
+	if errors.As(err, &circuitOpenErr) {
+		return circuitOpenErr, true
+	}
+
+	return nil, false
+}
+
+// StorageRateLimiter limits the rate of the AWS S3 requests made by wrappers, so that hefty messages do not starve other
+// users of the same bucket prefix or cause AWS S3 to throttle with SlowDown errors. Requests are limited per second and
+// bytes are limited per second; the bytes of uploads are counted before they are sent and the bytes of downloads once the
+// response has been received, which delays the requests that follow. Every part of a multipart transfer is a request. A
+// limiter can be given to multiple wrappers so that they share a single rate.
+type StorageRateLimiter struct {
+	behavior RateLimitBehavior
+	now      func() time.Time
+
+	mu       sync.Mutex
+	requests rateBucket
+	bytes    rateBucket
+}
+
+// NewStorageRateLimiter creates a rate limiter allowing `requestsPerSecond` AWS S3 requests and `bytesPerSecond` bytes
+// per second, where 0 does not limit requests or bytes. Requests exceeding the rate are delayed or failed according to
+// `behavior`.
+func NewStorageRateLimiter(requestsPerSecond, bytesPerSecond float64, behavior RateLimitBehavior) *StorageRateLimiter {
+	return &StorageRateLimiter{
+		behavior: behavior,
+		now:      time.Now,
+		requests: rateBucket{rate: max(requestsPerSecond, 0), tokens: max(requestsPerSecond, 0)},
+		bytes:    rateBucket{rate: max(bytesPerSecond, 0), tokens: max(bytesPerSecond, 0)},
+	}
+}
+
+// rateBucket is a token bucket refilled at `rate` tokens per second up to one second worth of tokens. Its tokens go
+// negative when more is taken than it has, which delays what is taken next.
+type rateBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens accumulated since the last refill
+func (bucket *rateBucket) refill(now time.Time) {
+	if !bucket.last.IsZero() {
+		bucket.tokens = min(bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate, bucket.rate)
+	}
+	bucket.last = now
+}
+
+// take takes `n` tokens and returns how long to wait until they are covered by the rate
+func (bucket *rateBucket) take(n float64) time.Duration {
+	if bucket.rate == 0 || n <= 0 {
+		return 0
+	}
+
+	bucket.tokens -= n
+	if bucket.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+}
+
+// fullWait returns how long taking `n` tokens from a full bucket waits
+func (bucket *rateBucket) fullWait(n float64) time.Duration {
+	if bucket.rate == 0 || n <= bucket.rate {
+		return 0
+	}
+
+	return time.Duration((n - bucket.rate) / bucket.rate * float64(time.Second))
+}
+
+// reserve takes a request and `size` bytes from the limiter and returns how long to wait before sending the request.
+// With RateLimitFailFast nothing is taken and a *RateLimitedError is returned when the request would have to wait longer
+// than it would when the limiter is idle, so that requests of more than a second worth of bytes can be sent.
+func (limiter *StorageRateLimiter) reserve(size int64) (time.Duration, error) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	now := limiter.now()
+	limiter.requests.refill(now)
+	limiter.bytes.refill(now)
+
+	wait := max(limiter.requests.take(1), limiter.bytes.take(float64(size)))
+	if wait > limiter.bytes.fullWait(float64(size)) && limiter.behavior == RateLimitFailFast {
+		limiter.refund(size)
+		return 0, &RateLimitedError{RetryAfter: wait}
+	}
+
+	return wait, nil
+}
+
+// refund returns a request and `size` bytes to the limiter
+func (limiter *StorageRateLimiter) refund(size int64) {
+	if limiter.requests.rate > 0 {
+		limiter.requests.tokens++
+	}
+	if limiter.bytes.rate > 0 {
+		limiter.bytes.tokens += float64(size)
+	}
+}
+
+// wait waits until a request of `size` bytes fits in the rate
+func (limiter *StorageRateLimiter) wait(ctx context.Context, size int64) error {
+	wait, err := limiter.reserve(size)
+	if err != nil || wait <= 0 {
+		return err
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		limiter.mu.Lock()
+		limiter.refund(size)
+		limiter.mu.Unlock()
+		return fmt.Errorf("unable to send s3 request within storage rate limit. %v", ctx.Err())
+	}
+}
+
+// take takes `size` bytes of a received response from the limiter
+func (limiter *StorageRateLimiter) take(size int64) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	limiter.bytes.refill(limiter.now())
+	limiter.bytes.take(float64(size))
+}
+
+// s3Option limits every attempt of the AWS S3 requests made with the options
+func (limiter *StorageRateLimiter) s3Option() func(*s3.Options) {
+	return func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc("HeftyStorageRateLimit", limiter.handleDeserialize), middleware.After)
+		})
+	}
+}
+
+func (limiter *StorageRateLimiter) handleDeserialize(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (middleware.DeserializeOutput, middleware.Metadata, error) {
+	var size int64
+	if req, ok := in.Request.(*smithyhttp.Request); ok {
+		size = max(req.ContentLength, 0)
+	}
+
+	if err := limiter.wait(ctx, size); err != nil {
+		return middleware.DeserializeOutput{}, middleware.Metadata{}, err
+	}
+
+	out, metadata, err := next.HandleDeserialize(ctx, in)
+	if resp, ok := out.RawResponse.(*smithyhttp.Response); ok && resp.ContentLength > 0 {
+		limiter.take(resp.ContentLength)
+	}
+
+	return out, metadata, err
+}
@@ -0,0 +1,164 @@
+package hefty
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a clock that only moves when advanced
+type fakeClock struct {
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	return clock.now
+}
+
+func newTestRateLimiter(requestsPerSecond, bytesPerSecond float64, behavior RateLimitBehavior) (*StorageRateLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	limiter := NewStorageRateLimiter(requestsPerSecond, bytesPerSecond, behavior)
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+func TestStorageRateLimiterRequests(t *testing.T) {
+	limiter, clock := newTestRateLimiter(2, 0, RateLimitBlock)
+
+	// a second worth of requests is sent right away
+	for i := 0; i < 2; i++ {
+		wait, err := limiter.reserve(1024)
+		assert.Nil(t, err)
+		assert.Equal(t, time.Duration(0), wait)
+	}
+
+	wait, err := limiter.reserve(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	clock.now = clock.now.Add(time.Second)
+	wait, err = limiter.reserve(0)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+}
+
+func TestStorageRateLimiterBytes(t *testing.T) {
+	limiter, clock := newTestRateLimiter(0, 1000, RateLimitBlock)
+
+	// a request larger than a second worth of bytes waits for the bytes it exceeds it by
+	wait, err := limiter.reserve(3000)
+	assert.Nil(t, err)
+	assert.Equal(t, 2*time.Second, wait)
+
+	// and so does the next request
+	clock.now = clock.now.Add(time.Second)
+	wait, err = limiter.reserve(500)
+	assert.Nil(t, err)
+	assert.Equal(t, 1500*time.Millisecond, wait)
+
+	// received bytes are taken once the response has been received
+	limiter, _ = newTestRateLimiter(0, 1000, RateLimitBlock)
+	limiter.take(2000)
+	wait, err = limiter.reserve(0)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+	wait, err = limiter.reserve(1000)
+	assert.Nil(t, err)
+	assert.Equal(t, 2*time.Second, wait)
+}
+
+func TestStorageRateLimiterFailFast(t *testing.T) {
+	limiter, clock := newTestRateLimiter(1, 0, RateLimitFailFast)
+
+	_, err := limiter.reserve(0)
+	assert.Nil(t, err)
+
+	_, err = limiter.reserve(0)
+	assert.Equal(t, &RateLimitedError{RetryAfter: time.Second}, err)
+
+	// failed requests are not counted
+	clock.now = clock.now.Add(time.Second)
+	_, err = limiter.reserve(0)
+	assert.Nil(t, err)
+
+	// a request larger than a second worth of bytes only fails when the limiter is not idle
+	limiter, _ = newTestRateLimiter(0, 1000, RateLimitFailFast)
+	wait, err := limiter.reserve(3000)
+	assert.Nil(t, err)
+	assert.Equal(t, 2*time.Second, wait)
+
+	_, err = limiter.reserve(3000)
+	assert.Equal(t, &RateLimitedError{RetryAfter: 5 * time.Second}, err)
+}
+
+func TestStorageRateLimiterWait(t *testing.T) {
+	limiter := NewStorageRateLimiter(1, 0, RateLimitBlock)
+	assert.Nil(t, limiter.wait(context.TODO(), 0))
+
+	// a request waits until its context is done, after which it is not counted
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	err := limiter.wait(ctx, 0)
+	assert.ErrorContains(t, err, context.DeadlineExceeded.Error())
+	assert.InDelta(t, 0, limiter.requests.tokens, 0.1)
+
+	opts := defaultOptions()
+	assert.NotNil(t, WithStorageRateLimiter(nil)(&opts))
+}
+
+func TestStorageRateLimiterHandleDeserialize(t *testing.T) {
+	limiter, _ := newTestRateLimiter(0, 1000, RateLimitFailFast)
+
+	req := smithyhttp.NewStackRequest().(*smithyhttp.Request)
+	req.ContentLength = 600
+	resp := &smithyhttp.Response{Response: &http.Response{ContentLength: 600}}
+	next := middleware.DeserializeHandlerFunc(func(ctx context.Context, in middleware.DeserializeInput) (middleware.DeserializeOutput, middleware.Metadata, error) {
+		return middleware.DeserializeOutput{RawResponse: resp}, middleware.Metadata{}, nil
+	})
+
+	// the bytes of the request and of the response are counted
+	_, _, err := limiter.handleDeserialize(context.TODO(), middleware.DeserializeInput{Request: req}, next)
+	assert.Nil(t, err)
+	assert.Equal(t, float64(-200), limiter.bytes.tokens)
+
+	_, _, err = limiter.handleDeserialize(context.TODO(), middleware.DeserializeInput{Request: req}, next)
+	var rateLimitedErr *RateLimitedError
+	assert.ErrorAs(t, err, &rateLimitedErr)
+}
+
+// stubHttpClient responds to every request with an empty response with its status, or 200 when it has none
+type stubHttpClient struct {
+	status   int
+	requests int
+}
+
+func (client *stubHttpClient) Do(req *http.Request) (*http.Response, error) {
+	client.requests++
+	return &http.Response{StatusCode: max(client.status, http.StatusOK), Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func TestStorageRateLimiterS3Option(t *testing.T) {
+	httpClient := &stubHttpClient{}
+	s3Client := s3.New(s3.Options{Region: "us-east-1", Credentials: aws.AnonymousCredentials{}, HTTPClient: httpClient})
+	limiter := NewStorageRateLimiter(1, 0, RateLimitFailFast)
+
+	input := &s3.PutObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key"), Body: strings.NewReader("hefty")}
+	_, err := s3Client.PutObject(context.TODO(), input, limiter.s3Option())
+	assert.Nil(t, err)
+
+	// the second request is failed before it is sent
+	_, err = s3Client.PutObject(context.TODO(), input, limiter.s3Option())
+	backoffErr, ok := asBackoffError(err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, backoffErr.(*RateLimitedError).RetryAfter.Round(time.Second))
+	assert.Equal(t, 1, httpClient.requests)
+}
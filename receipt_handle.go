@@ -0,0 +1,220 @@
+package hefty
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	receiptHandleTokenCount             = 4
+	payloadStoreReceiptHandleTokenCount = 5 // includes the payload store backend
+	versionedReceiptHandleTokenCount    = 6 // includes the, possibly empty, payload store backend and the version id
+	signedReceiptHandleTokenCount       = 7 // includes the, possibly empty, payload store backend and version id, and the signature
+
+	minReceiptHandleKeyLength = 32
+)
+
+const (
+	// versionedFormatPrefix differentiates a versioned receipt handle belonging to a hefty message from the
+	// receipt handles of the original, unversioned format, which start with receiptHandlePrefix
+	versionedFormatPrefix = "4566d26b34fc44849b47f585e672bc9f"
+	// receiptHandleVersion is the version of the receipt handle format ReceiveHeftyMessage returns
+	receiptHandleVersion = 2
+	// versionedFormatTokenCount is the number of tokens of a versioned receipt handle: the prefix, the version,
+	// the, possibly empty, signature and the fields of the version
+	versionedFormatTokenCount = 4
+)
+
+// heftyReceiptHandle is the receipt handle ReceiveHeftyMessage returns for a hefty message. It holds the receipt handle of
+// the reference message and the location of the hefty message. The bucket can be a bucket name, an access point arn or a
+// multi-region access point arn.
+//
+// Receipt handles are encoded as the base64 encoding of `prefix|version|signature|fields`, where the fields of version 2
+// are a json object. New fields can be added to the json object without changing the version, since unknown fields are
+// ignored when decoding. Receipt handles of the original, unversioned format `prefix|receipt handle|bucket|key[|backend
+// [|version id[|signature]]]` are still decoded so that messages received before an upgrade can be deleted after it.
+type heftyReceiptHandle struct {
+	receiptHandle string
+	bucket        string
+	key           string
+	backend       string
+	versionId     string
+	counted       bool   // reference to the hefty message is counted by the reference counter
+	ref           string // id of the receipt handle in a ReceiptHandleStore; the other fields are empty when set
+}
+
+// receiptHandleFields are the fields of a version 2 receipt handle
+type receiptHandleFields struct {
+	ReceiptHandle string `json:"rh,omitempty"`
+	Bucket        string `json:"b,omitempty"`
+	Key           string `json:"k,omitempty"`
+	Backend       string `json:"be,omitempty"`
+	VersionId     string `json:"v,omitempty"`
+	Counted       bool   `json:"c,omitempty"`
+	Ref           string `json:"r,omitempty"`
+}
+
+// encode encodes the receipt handle in the current format. The receipt handle is signed with an HMAC-SHA256 of its fields
+// when `signingKey` is not empty.
+func (handle heftyReceiptHandle) encode(signingKey []byte) string {
+	fields, _ := json.Marshal(receiptHandleFields{
+		ReceiptHandle: handle.receiptHandle,
+		Bucket:        handle.bucket,
+		Key:           handle.key,
+		Backend:       handle.backend,
+		VersionId:     handle.versionId,
+		Counted:       handle.counted,
+		Ref:           handle.ref,
+	})
+
+	signature := ""
+	if len(signingKey) > 0 {
+		signature = signReceiptHandle(signingKey, string(fields))
+	}
+
+	decoded := fmt.Sprintf("%s|%d|%s|%s", versionedFormatPrefix, receiptHandleVersion, signature, fields)
+	return base64.StdEncoding.EncodeToString([]byte(decoded))
+}
+
+// encodeUnversioned encodes the receipt handle in the original, '|' delimited format, which is shorter than the current
+// format since it has no field names. It returns false when a field contains the delimiter, the receipt handle references
+// a ReceiptHandleStore or the reference to the hefty message is counted, none of which the original format can hold.
+func (handle heftyReceiptHandle) encodeUnversioned(signingKey []byte) (string, bool) {
+	fields := []string{handle.receiptHandle, handle.bucket, handle.key, handle.backend, handle.versionId}
+	for _, field := range fields {
+		if strings.Contains(field, "|") {
+			return "", false
+		}
+	}
+	if handle.ref != "" || handle.counted {
+		return "", false
+	}
+
+	decoded := receiptHandlePrefix + "|" + strings.Join(fields, "|")
+	if len(signingKey) > 0 {
+		decoded += "|" + signReceiptHandle(signingKey, decoded)
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(decoded)), true
+}
+
+// decodeHeftyReceiptHandle decodes a receipt handle returned by ReceiveHeftyMessage of the current or a previous format.
+// It returns false when the receipt handle does not belong to a hefty message. When `signingKey` is not empty, receipt
+// handles that are not signed with it are rejected.
+func decodeHeftyReceiptHandle(encoded string, signingKey []byte) (heftyReceiptHandle, bool, error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return heftyReceiptHandle{}, false, fmt.Errorf("could not decode receipt handle. %v", err)
+	}
+	decodedStr := string(decoded)
+
+	// check if decoded receipt handle is for a hefty message
+	switch {
+	case strings.HasPrefix(decodedStr, versionedFormatPrefix+"|"):
+		handle, err := decodeVersionedReceiptHandle(decodedStr, signingKey)
+		return handle, true, err
+	case strings.HasPrefix(decodedStr, receiptHandlePrefix):
+		handle, err := decodeUnversionedReceiptHandle(decodedStr, signingKey)
+		return handle, true, err
+	default:
+		return heftyReceiptHandle{}, false, nil
+	}
+}
+
+// decodeVersionedReceiptHandle decodes a decoded receipt handle of the versioned format
+func decodeVersionedReceiptHandle(decoded string, signingKey []byte) (heftyReceiptHandle, error) {
+	tokens := strings.SplitN(decoded, "|", versionedFormatTokenCount)
+	if len(tokens) != versionedFormatTokenCount {
+		return heftyReceiptHandle{}, fmt.Errorf("expected number of tokens (%d) not available in receipt handle", versionedFormatTokenCount)
+	}
+
+	version, err := strconv.Atoi(tokens[1])
+	if err != nil {
+		return heftyReceiptHandle{}, fmt.Errorf("invalid receipt handle version %s", tokens[1])
+	}
+	if version != receiptHandleVersion {
+		return heftyReceiptHandle{}, fmt.Errorf("unsupported receipt handle version %d; the receipt handle was likely created by a newer version of this library", version)
+	}
+
+	if err = verifyReceiptHandle(signingKey, tokens[3], tokens[2]); err != nil {
+		return heftyReceiptHandle{}, err
+	}
+
+	var fields receiptHandleFields
+	if err = json.Unmarshal([]byte(tokens[3]), &fields); err != nil {
+		return heftyReceiptHandle{}, fmt.Errorf("unable to unmarshal receipt handle. %v", err)
+	}
+
+	return heftyReceiptHandle{
+		receiptHandle: fields.ReceiptHandle,
+		bucket:        fields.Bucket,
+		key:           fields.Key,
+		backend:       fields.Backend,
+		versionId:     fields.VersionId,
+		counted:       fields.Counted,
+		ref:           fields.Ref,
+	}, nil
+}
+
+// decodeUnversionedReceiptHandle decodes a decoded receipt handle of the original, '|' delimited format
+func decodeUnversionedReceiptHandle(decoded string, signingKey []byte) (heftyReceiptHandle, error) {
+	tokens := strings.Split(decoded, "|")
+	if len(tokens) < receiptHandleTokenCount || len(tokens) > signedReceiptHandleTokenCount {
+		return heftyReceiptHandle{}, fmt.Errorf("expected number of tokens (%d) not available in receipt handle", receiptHandleTokenCount)
+	}
+
+	// verify signature
+	if len(signingKey) > 0 {
+		signature := ""
+		if len(tokens) == signedReceiptHandleTokenCount {
+			signature = tokens[6]
+			decoded = decoded[:strings.LastIndex(decoded, "|")]
+		}
+		if err := verifyReceiptHandle(signingKey, decoded, signature); err != nil {
+			return heftyReceiptHandle{}, err
+		}
+	}
+
+	handle := heftyReceiptHandle{
+		receiptHandle: tokens[1],
+		bucket:        tokens[2],
+		key:           tokens[3],
+	}
+	if len(tokens) >= payloadStoreReceiptHandleTokenCount {
+		handle.backend = tokens[4]
+	}
+	if len(tokens) >= versionedReceiptHandleTokenCount {
+		handle.versionId = tokens[5]
+	}
+
+	return handle, nil
+}
+
+// verifyReceiptHandle verifies the signature of the signed part of a receipt handle when `signingKey` is not empty
+func verifyReceiptHandle(signingKey []byte, signed, signature string) error {
+	if len(signingKey) == 0 {
+		return nil
+	}
+	if signature == "" {
+		return errors.New("receipt handle is not signed")
+	}
+	if !hmac.Equal([]byte(signature), []byte(signReceiptHandle(signingKey, signed))) {
+		return errors.New("receipt handle signature is invalid")
+	}
+
+	return nil
+}
+
+// signReceiptHandle returns the hex encoded HMAC-SHA256 of the signed part of a receipt handle
+func signReceiptHandle(signingKey []byte, signed string) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(signed))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,78 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// MaxReceiptHandleLength is the maximum length in characters of a receipt handle accepted by AWS SQS
+const MaxReceiptHandleLength = 1024
+
+// ReceiptHandleStore holds the receipt handles of hefty messages that are longer than MaxReceiptHandleLength, e.g. due
+// to long keys, so that ReceiveHeftyMessage can return a short receipt handle referencing the stored one instead. The
+// store must be shared by all receivers of the queue and should expire receipt handles after the visibility timeout of
+// the queue, since receipt handles of messages that are not deleted are never removed.
+type ReceiptHandleStore interface {
+	// Put stores the receipt handle `receiptHandle` under `id`.
+	Put(ctx context.Context, id, receiptHandle string) error
+	// Get returns the receipt handle stored under `id`.
+	Get(ctx context.Context, id string) (string, error)
+	// Delete removes the receipt handle stored under `id`.
+	Delete(ctx context.Context, id string) error
+}
+
+// encodeReceiptHandle encodes the receipt handle of a hefty message. A receipt handle longer than MaxReceiptHandleLength
+// is stored in the receipt handle store, if configured, and a short receipt handle referencing it is returned. Otherwise,
+// the receipt handle is encoded in the shorter, original format, and an error is returned when it is still too long.
+func (wrapper *SqsClientWrapper) encodeReceiptHandle(ctx context.Context, handle heftyReceiptHandle) (string, error) {
+	encoded := handle.encode(wrapper.receiptHandleKey)
+	if len(encoded) <= MaxReceiptHandleLength {
+		return encoded, nil
+	}
+
+	reason := "no receipt handle store configured"
+	if wrapper.receiptHandles != nil {
+		id := uuid.New().String()
+		err := wrapper.receiptHandles.Put(ctx, id, encoded)
+		if err == nil {
+			return heftyReceiptHandle{ref: id}.encode(wrapper.receiptHandleKey), nil
+		}
+		reason = fmt.Sprintf("unable to put it in the receipt handle store. %v", err)
+	}
+
+	unversioned, ok := handle.encodeUnversioned(wrapper.receiptHandleKey)
+	if ok && len(unversioned) <= MaxReceiptHandleLength {
+		return unversioned, nil
+	}
+
+	return "", fmt.Errorf("receipt handle of %s is longer than %d characters; %s", handle.key, MaxReceiptHandleLength, reason)
+}
+
+// decodeReceiptHandle decodes the receipt handle of a hefty message, getting receipt handles referenced by a short receipt
+// handle from the receipt handle store. It returns false when the receipt handle does not belong to a hefty message.
+func (wrapper *SqsClientWrapper) decodeReceiptHandle(ctx context.Context, encoded string) (heftyReceiptHandle, bool, error) {
+	handle, ok, err := decodeHeftyReceiptHandle(encoded, wrapper.receiptHandleKey)
+	if err != nil || !ok || handle.ref == "" {
+		return handle, ok, err
+	}
+
+	if wrapper.receiptHandles == nil {
+		return handle, true, fmt.Errorf("no receipt handle store configured for receipt handle %s", handle.ref)
+	}
+
+	stored, err := wrapper.receiptHandles.Get(ctx, handle.ref)
+	if err != nil {
+		return handle, true, fmt.Errorf("unable to get receipt handle %s from receipt handle store. %v", handle.ref, err)
+	}
+
+	ref := handle.ref
+	handle, ok, err = decodeHeftyReceiptHandle(stored, wrapper.receiptHandleKey)
+	if err == nil && (!ok || handle.ref != "") {
+		err = fmt.Errorf("invalid receipt handle %s in receipt handle store", ref)
+	}
+	handle.ref = ref
+
+	return handle, true, err
+}
@@ -0,0 +1,95 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryReceiptHandles keeps receipt handles in memory and fails every put with its error when it has one
+type memoryReceiptHandles struct {
+	handles map[string]string
+	err     error
+}
+
+func (store *memoryReceiptHandles) Put(_ context.Context, id, receiptHandle string) error {
+	if store.err != nil {
+		return store.err
+	}
+
+	store.handles[id] = receiptHandle
+	return nil
+}
+
+func (store *memoryReceiptHandles) Get(_ context.Context, id string) (string, error) {
+	return store.handles[id], nil
+}
+
+func (store *memoryReceiptHandles) Delete(_ context.Context, id string) error {
+	delete(store.handles, id)
+	return nil
+}
+
+func TestReceiptHandleStore(t *testing.T) {
+	store := &memoryReceiptHandles{handles: map[string]string{}}
+	failing := &memoryReceiptHandles{err: errors.New("store unavailable")}
+	signingKey := []byte(strings.Repeat("k", minReceiptHandleKeyLength))
+	short := heftyReceiptHandle{receiptHandle: "AQEB", bucket: "my-bucket", key: "queue/id"}
+	long := heftyReceiptHandle{receiptHandle: "AQEB", bucket: "my-bucket", key: strings.Repeat("prefix/", 150) + "id"}
+	// too long for the current format, but not for the shorter, original format
+	unversioned := heftyReceiptHandle{receiptHandle: "AQEB", bucket: "my-bucket", key: strings.Repeat("prefix/", 100) + "id"}
+	signedUnversioned := heftyReceiptHandle{receiptHandle: "AQEB", bucket: "my-bucket", key: strings.Repeat("prefix/", 91) + "id"}
+
+	var tests = []struct {
+		desc           string
+		store          ReceiptHandleStore
+		signingKey     []byte
+		handle         heftyReceiptHandle
+		expStored      bool
+		expUnversioned bool
+		expErr         bool
+	}{
+		{desc: "short", store: store, handle: short},
+		{desc: "long", store: store, handle: long, expStored: true},
+		{desc: "long_without_store", handle: long, expErr: true},
+		{desc: "long_store_fails", store: failing, handle: long, expErr: true},
+		{desc: "long_delimiter_in_key", handle: heftyReceiptHandle{receiptHandle: "AQEB", bucket: "my-bucket", key: strings.Repeat("prefix|", 100) + "id"}, expErr: true},
+		{desc: "unversioned_without_store", handle: unversioned, expUnversioned: true},
+		{desc: "unversioned_store_fails", store: failing, handle: unversioned, expUnversioned: true},
+		{desc: "unversioned_signed", signingKey: signingKey, handle: signedUnversioned, expUnversioned: true},
+		{desc: "unversioned_signed_too_long", signingKey: signingKey, handle: unversioned, expErr: true},
+		{desc: "unversioned_stored", store: store, handle: unversioned, expStored: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			assert.Equal(t, tt.handle != short, len(tt.handle.encode(tt.signingKey)) > MaxReceiptHandleLength)
+
+			wrapper := &SqsClientWrapper{receiptHandles: tt.store, receiptHandleKey: tt.signingKey}
+			encoded, err := wrapper.encodeReceiptHandle(context.TODO(), tt.handle)
+			if tt.expErr {
+				assert.ErrorContains(t, err, "longer than 1024 characters")
+				return
+			}
+			assert.Nil(t, err)
+			assert.LessOrEqual(t, len(encoded), MaxReceiptHandleLength)
+			assert.Equal(t, tt.expUnversioned, encoded != tt.handle.encode(tt.signingKey) && !tt.expStored)
+
+			handle, ok, err := wrapper.decodeReceiptHandle(context.TODO(), encoded)
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, tt.expStored, handle.ref != "")
+			handle.ref = ""
+			assert.Equal(t, tt.handle, handle)
+		})
+	}
+
+	// short receipt handles cannot be decoded without the store
+	encoded, err := (&SqsClientWrapper{receiptHandles: store}).encodeReceiptHandle(context.TODO(), long)
+	assert.Nil(t, err)
+	_, _, err = (&SqsClientWrapper{}).decodeReceiptHandle(context.TODO(), encoded)
+	assert.NotNil(t, err)
+}
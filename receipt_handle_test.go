@@ -0,0 +1,132 @@
+package hefty
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeftyReceiptHandle(t *testing.T) {
+	var tests = []struct {
+		desc   string
+		handle heftyReceiptHandle
+	}{
+		{desc: "bucket", handle: heftyReceiptHandle{receiptHandle: "AQEB", bucket: "my-bucket", key: "queue/id"}},
+		{desc: "access_point_arn", handle: heftyReceiptHandle{receiptHandle: "AQEB", bucket: "arn:aws:s3:us-west-2:765908583888:accesspoint/my-ap", key: "queue/id"}},
+		{desc: "multi_region_access_point_arn", handle: heftyReceiptHandle{receiptHandle: "AQEB", bucket: "arn:aws:s3::765908583888:accesspoint/mfzwi23gnjvgw.mrap", key: "queue/id"}},
+		{desc: "versioned_bucket", handle: heftyReceiptHandle{receiptHandle: "AQEB", bucket: "my-bucket", key: "queue/id", versionId: "3HL4kqtJlcpXroDTDmJ.rmSpXd3dIbrHY"}},
+		{desc: "payload_store", handle: heftyReceiptHandle{receiptHandle: "AQEB", key: "queue/id", backend: "dynamodb"}},
+		{desc: "counted", handle: heftyReceiptHandle{receiptHandle: "AQEB", bucket: "my-bucket", key: "queue/id", counted: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			handle, ok, err := decodeHeftyReceiptHandle(tt.handle.encode(nil), nil)
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, tt.handle, handle)
+		})
+	}
+}
+
+func TestDecodeHeftyReceiptHandle(t *testing.T) {
+	_, ok, err := decodeHeftyReceiptHandle(base64.StdEncoding.EncodeToString([]byte("AQEB")), nil)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	_, ok, err = decodeHeftyReceiptHandle(base64.StdEncoding.EncodeToString([]byte(receiptHandlePrefix+"|AQEB|bucket")), nil)
+	assert.NotNil(t, err)
+	assert.True(t, ok)
+
+	_, _, err = decodeHeftyReceiptHandle("not base64!", nil)
+	assert.NotNil(t, err)
+}
+
+func TestSignedHeftyReceiptHandle(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	handle := heftyReceiptHandle{receiptHandle: "AQEB", bucket: "my-bucket", key: "queue/id"}
+	signed := handle.encode(key)
+
+	decoded, ok, err := decodeHeftyReceiptHandle(signed, key)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, handle, decoded)
+
+	// receivers without a signing key can still decode signed receipt handles
+	decoded, _, err = decodeHeftyReceiptHandle(signed, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, handle, decoded)
+
+	// unsigned receipt handles are rejected
+	_, ok, err = decodeHeftyReceiptHandle(handle.encode(nil), key)
+	assert.NotNil(t, err)
+	assert.True(t, ok)
+
+	// tampered receipt handles are rejected
+	tampered := heftyReceiptHandle{receiptHandle: "AQEB", bucket: "other-bucket", key: "queue/id"}.encode([]byte("fedcba9876543210fedcba9876543210"))
+	_, _, err = decodeHeftyReceiptHandle(tampered, key)
+	assert.NotNil(t, err)
+
+	_, _, err = decodeHeftyReceiptHandle(signed, []byte("fedcba9876543210fedcba9876543210"))
+	assert.NotNil(t, err)
+}
+
+// encodeUnversioned encodes a receipt handle in the original, unversioned format
+func encodeUnversioned(handle heftyReceiptHandle, signingKey []byte) string {
+	decoded := fmt.Sprintf("%s|%s|%s|%s", receiptHandlePrefix, handle.receiptHandle, handle.bucket, handle.key)
+	if len(signingKey) > 0 {
+		decoded = fmt.Sprintf("%s|%s|%s", decoded, handle.backend, handle.versionId)
+		decoded = fmt.Sprintf("%s|%s", decoded, signReceiptHandle(signingKey, decoded))
+	} else if handle.versionId != "" {
+		decoded = fmt.Sprintf("%s|%s|%s", decoded, handle.backend, handle.versionId)
+	} else if handle.backend != "" {
+		decoded = fmt.Sprintf("%s|%s", decoded, handle.backend)
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(decoded))
+}
+
+func TestUnversionedHeftyReceiptHandle(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	var tests = []struct {
+		desc       string
+		handle     heftyReceiptHandle
+		signingKey []byte
+	}{
+		{desc: "bucket", handle: heftyReceiptHandle{receiptHandle: "AQEB", bucket: "my-bucket", key: "queue/id"}},
+		{desc: "payload_store", handle: heftyReceiptHandle{receiptHandle: "AQEB", key: "queue/id", backend: "dynamodb"}},
+		{desc: "versioned_bucket", handle: heftyReceiptHandle{receiptHandle: "AQEB", bucket: "my-bucket", key: "queue/id", versionId: "3HL4kqtJlcpXroDTDmJ.rmSpXd3dIbrHY"}},
+		{desc: "signed", handle: heftyReceiptHandle{receiptHandle: "AQEB", bucket: "my-bucket", key: "queue/id"}, signingKey: key},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			handle, ok, err := decodeHeftyReceiptHandle(encodeUnversioned(tt.handle, tt.signingKey), tt.signingKey)
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, tt.handle, handle)
+		})
+	}
+
+	// unsigned receipt handles of the unversioned format are rejected when signing
+	_, _, err := decodeHeftyReceiptHandle(encodeUnversioned(tests[0].handle, nil), key)
+	assert.NotNil(t, err)
+}
+
+func TestHeftyReceiptHandleVersion(t *testing.T) {
+	// fields added by newer versions of the same format are ignored
+	decoded := fmt.Sprintf(`%s|%d||{"rh":"AQEB","b":"my-bucket","k":"queue/id","new":"field"}`, versionedFormatPrefix, receiptHandleVersion)
+	handle, ok, err := decodeHeftyReceiptHandle(base64.StdEncoding.EncodeToString([]byte(decoded)), nil)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, heftyReceiptHandle{receiptHandle: "AQEB", bucket: "my-bucket", key: "queue/id"}, handle)
+
+	// newer formats are rejected
+	decoded = fmt.Sprintf(`%s|%d||{}`, versionedFormatPrefix, receiptHandleVersion+1)
+	_, ok, err = decodeHeftyReceiptHandle(base64.StdEncoding.EncodeToString([]byte(decoded)), nil)
+	assert.NotNil(t, err)
+	assert.True(t, ok)
+}
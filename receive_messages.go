@@ -0,0 +1,61 @@
+package hefty
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// receiveClient is the part of the AWS SQS client wrapper used to receive messages
+type receiveClient interface {
+	ReceiveHeftyMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+}
+
+// ReceiveHeftyMessages receives up to `count` messages with as many calls to ReceiveHeftyMessage as needed, since AWS SQS
+// receives at most 10 messages per call, for processors that handle messages in larger batches. MaxNumberOfMessages of
+// `params` is ignored.
+//
+// Without a deadline on `ctx`, receiving stops once a call returns no messages. With a deadline, messages are gathered
+// until the deadline, and the wait time of every call is shortened so that the messages are returned by the deadline
+// rather than lost to a cancelled call. Every call waits for messages for WaitTimeSeconds of `params` at most. When a
+// call fails the messages received before are returned with the error, so that the caller can still handle them.
+func (wrapper *SqsClientWrapper) ReceiveHeftyMessages(ctx context.Context, params *sqs.ReceiveMessageInput, count int, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	return receiveHeftyMessages(ctx, wrapper, params, count, optFns...)
+}
+
+func receiveHeftyMessages(ctx context.Context, client receiveClient, params *sqs.ReceiveMessageInput, count int, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	output := &sqs.ReceiveMessageOutput{}
+	if params == nil || count <= 0 {
+		return output, nil
+	}
+
+	// copy the input so that the caller's input is left unchanged
+	input := *params
+	deadline, hasDeadline := ctx.Deadline()
+	for len(output.Messages) < count {
+		input.MaxNumberOfMessages = int32(min(count-len(output.Messages), maxReceiveMessages))
+		if hasDeadline {
+			// a call needs at least a second, since wait times are whole seconds
+			left := int32(time.Until(deadline) / time.Second)
+			if left < 1 {
+				break
+			}
+			input.WaitTimeSeconds = min(params.WaitTimeSeconds, left-1)
+		}
+
+		out, err := client.ReceiveHeftyMessage(ctx, &input, optFns...)
+		if err != nil {
+			return output, err
+		}
+		output.ResultMetadata = out.ResultMetadata
+		output.Messages = append(output.Messages, out.Messages...)
+
+		// without a wait time an empty queue would be polled in a busy loop until the deadline
+		if len(out.Messages) == 0 && (!hasDeadline || input.WaitTimeSeconds == 0) {
+			break
+		}
+	}
+
+	return output, nil
+}
@@ -0,0 +1,65 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiveHeftyMessages(t *testing.T) {
+	var tests = []struct {
+		desc     string
+		pending  int
+		count    int
+		expCount int
+	}{
+		{desc: "more than one call", pending: 30, count: 25, expCount: 25},
+		{desc: "drained queue", pending: 13, count: 25, expCount: 13},
+		{desc: "single call", pending: 30, count: 4, expCount: 4},
+		{desc: "nothing requested", pending: 30, count: 0, expCount: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			client := &fakeConsumerClient{pending: tt.pending}
+			params := &sqs.ReceiveMessageInput{QueueUrl: aws.String("queue"), WaitTimeSeconds: 20}
+
+			out, err := receiveHeftyMessages(context.Background(), client, params, tt.count)
+			assert.NoError(t, err)
+			assert.Len(t, out.Messages, tt.expCount)
+			assert.LessOrEqual(t, client.maxBatch, int32(maxReceiveMessages))
+			assert.Equal(t, int32(0), params.MaxNumberOfMessages)
+		})
+	}
+}
+
+func TestReceiveHeftyMessagesDeadline(t *testing.T) {
+	client := &fakeConsumerClient{pending: 5}
+	ctx, cancel := context.WithTimeout(context.Background(), 1100*time.Millisecond)
+	defer cancel()
+
+	// the queue is drained but messages are gathered until the deadline
+	out, err := receiveHeftyMessages(ctx, client, &sqs.ReceiveMessageInput{QueueUrl: aws.String("queue"), WaitTimeSeconds: 20}, 10)
+	assert.NoError(t, err)
+	assert.Len(t, out.Messages, 5)
+	assert.NoError(t, ctx.Err())
+}
+
+func TestReceiveHeftyMessagesError(t *testing.T) {
+	client := &fakeConsumerClient{pending: 5}
+
+	out, err := receiveHeftyMessages(context.Background(), client, &sqs.ReceiveMessageInput{QueueUrl: aws.String("queue")}, 5)
+	assert.NoError(t, err)
+	assert.Len(t, out.Messages, 5)
+
+	client.pending = 5
+	client.receiveErr = errors.New("throttled")
+	out, err = receiveHeftyMessages(context.Background(), client, &sqs.ReceiveMessageInput{QueueUrl: aws.String("queue")}, 5)
+	assert.Error(t, err)
+	assert.Empty(t, out.Messages)
+}
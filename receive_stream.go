@@ -0,0 +1,235 @@
+package hefty
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// HeftyMessageReader reads the body of a message as it is downloaded from AWS S3, see StreamHeftyMessage. It must be
+// closed to release the connection.
+type HeftyMessageReader struct {
+	// Size is the number of bytes of the message body
+	Size int64
+	// MessageAttributes are the message attributes of the hefty message, or of the message itself when it is not a hefty
+	// message
+	MessageAttributes map[string]sqs_types.MessageAttributeValue
+
+	body    io.ReadCloser
+	refMsg  *types.ReferenceMsg
+	digest  hash.Hash // nil when the body has already been verified
+	read    int64
+	release func() // releases the transfer of the body; nil when the body is read from memory
+}
+
+// Read reads the message body. An *IntegrityError is returned instead of io.EOF when the body does not match the digest
+// of its reference message.
+func (reader *HeftyMessageReader) Read(p []byte) (int, error) {
+	n, err := reader.body.Read(p)
+	reader.read += int64(n)
+	if reader.digest == nil {
+		return n, err
+	}
+
+	reader.digest.Write(p[:n])
+	if err != io.EOF {
+		return n, err
+	}
+
+	if reader.read != reader.Size {
+		return n, fmt.Errorf("unable to read body of hefty message. %v", io.ErrUnexpectedEOF)
+	}
+	if bodyDigest := hex.EncodeToString(reader.digest.Sum(nil)); bodyDigest != reader.refMsg.Md5DigestMsgBody {
+		return n, digestMismatch(reader.refMsg, bodyDigest, reader.refMsg.Md5DigestMsgAttr)
+	}
+
+	return n, io.EOF
+}
+
+// Close releases the connection of the message body
+func (reader *HeftyMessageReader) Close() error {
+	err := reader.body.Close()
+	if reader.release != nil {
+		reader.release()
+	}
+
+	return err
+}
+
+// StreamHeftyMessage returns a reader of the body of a message received from the queue at `queueUrl` by
+// ReceiveHeftyMessage, e.g. for a message left unresolved because of WithSpooling, or by ReceiveHeftyMessageLazy. The
+// message attributes are downloaded and verified first, after which the body is passed through from AWS S3 as it is
+// read and verified once it has been read completely. Hefty messages in a payload store or with transforms or client
+// side encryption are decoded in memory first. The body of a message without a reference message is read from memory.
+func (wrapper *SqsClientWrapper) StreamHeftyMessage(ctx context.Context, queueUrl string, msg *sqs_types.Message) (*HeftyMessageReader, error) {
+	if msg == nil {
+		return nil, errors.New("message is nil")
+	}
+
+	if !types.IsReferenceMsg(aws.ToString(msg.Body)) {
+		return &HeftyMessageReader{
+			Size:              int64(len(aws.ToString(msg.Body))),
+			MessageAttributes: msg.MessageAttributes,
+			body:              io.NopCloser(strings.NewReader(aws.ToString(msg.Body))),
+		}, nil
+	}
+
+	refMsg, err := types.ToReferenceMsg(*msg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal reference message. %v", err)
+	}
+
+	return wrapper.storage.stream(ctx, queueUrl, refMsg)
+}
+
+// Stream returns a reader of the body of the hefty message like StreamHeftyMessage
+func (handle *PayloadHandle) Stream(ctx context.Context) (*HeftyMessageReader, error) {
+	return handle.wrapper.storage.stream(ctx, handle.queueUrl, handle.refMsg)
+}
+
+// stream returns a reader of the body of the hefty message of a reference message
+func (storage *payloadStorage) stream(ctx context.Context, queueUrl string, refMsg *types.ReferenceMsg) (*HeftyMessageReader, error) {
+	if refMsg.Backend != "" || len(refMsg.Transforms) > 0 || len(refMsg.EncryptedDataKey) > 0 {
+		heftyMsg, err := storage.getHeftyMessage(ctx, queueUrl, refMsg)
+		if err != nil {
+			return nil, err
+		}
+
+		return &HeftyMessageReader{
+			Size:              int64(len(aws.ToString(heftyMsg.Body))),
+			MessageAttributes: messages.MapToSqsMessageAttributeValues(heftyMsg.MessageAttributes),
+			body:              io.NopCloser(strings.NewReader(aws.ToString(heftyMsg.Body))),
+		}, nil
+	}
+
+	if err := storage.lazyBuckets.ensure(ctx, refMsg.S3Bucket); err != nil {
+		return nil, err
+	}
+
+	// the transfer lasts until the reader is closed
+	release, err := storage.transfers.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := storage.streamBody(ctx, refMsg)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	reader.release = release
+
+	return reader, nil
+}
+
+// streamBody verifies the message attributes of a hefty message in AWS S3 and returns a reader of its body
+func (storage *payloadStorage) streamBody(ctx context.Context, refMsg *types.ReferenceMsg) (*HeftyMessageReader, error) {
+	// the body is length prefixed and followed by the message attributes
+	header, size, err := storage.getRange(ctx, refMsg, 0, 4)
+	if err != nil {
+		return nil, err
+	}
+	var bodyLength uint32
+	err = binary.Read(header, binary.BigEndian, &bodyLength)
+	header.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read body during deserialization. %v", err)
+	}
+	msgAttrOffset := 4 + int64(bodyLength)
+	if msgAttrOffset > size {
+		return nil, fmt.Errorf("unable to read body during deserialization")
+	}
+
+	// message attributes are verified before the body is read
+	var serializedAttributes []byte
+	if msgAttrOffset < size {
+		attributes, _, err := storage.getRange(ctx, refMsg, msgAttrOffset, size-msgAttrOffset)
+		if err != nil {
+			return nil, err
+		}
+		serializedAttributes, err = io.ReadAll(attributes)
+		attributes.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get message from s3. %v", err)
+		}
+	}
+	msgAttributes, err := messages.DeserializeMessageAttributes(serializedAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	var attrDigest string
+	if len(msgAttributes) > 0 {
+		if attrDigest, err = messages.Digest(refMsg.DigestAlgorithm, serializedAttributes); err != nil {
+			return nil, fmt.Errorf("unable to verify digests of hefty message. %v", err)
+		}
+	}
+	if attrDigest != refMsg.Md5DigestMsgAttr {
+		return nil, digestMismatch(refMsg, "", attrDigest)
+	}
+
+	digest, err := messages.NewDigestHash(refMsg.DigestAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("unable to verify digests of hefty message. %v", err)
+	}
+
+	body := io.NopCloser(bytes.NewReader(nil))
+	if bodyLength > 0 {
+		if body, _, err = storage.getRange(ctx, refMsg, 4, int64(bodyLength)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &HeftyMessageReader{
+		Size:              int64(bodyLength),
+		MessageAttributes: messages.MapToSqsMessageAttributeValues(msgAttributes),
+		body:              body,
+		refMsg:            refMsg,
+		digest:            digest,
+	}, nil
+}
+
+// getRange gets `length` bytes of a serialized hefty message in AWS S3 from `offset` and returns them with the size of
+// the serialized hefty message
+func (storage *payloadStorage) getRange(ctx context.Context, refMsg *types.ReferenceMsg, offset, length int64) (io.ReadCloser, int64, error) {
+	out, err := storage.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:              aws.String(refMsg.S3Bucket),
+		Key:                 aws.String(refMsg.S3Key),
+		VersionId:           optionalString(refMsg.S3VersionId),
+		ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+		Range:               aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	}, storage.s3OptFns...)
+	if err != nil {
+		if backoffErr, ok := asBackoffError(err); ok {
+			return nil, 0, backoffErr
+		}
+		if isKmsError(err) {
+			return nil, 0, fmt.Errorf("unable to get message from s3; check that the kms key it is encrypted with can be used by the caller. %v", err)
+		}
+
+		return nil, 0, fmt.Errorf("unable to get message from s3. %v", err)
+	}
+
+	// content range is formatted as "bytes start-end/size"
+	contentRange := aws.ToString(out.ContentRange)
+	size, err := strconv.ParseInt(contentRange[strings.LastIndex(contentRange, "/")+1:], 10, 64)
+	if err != nil {
+		out.Body.Close()
+		return nil, 0, fmt.Errorf("unable to get size of message from s3 content range %s. %v", contentRange, err)
+	}
+
+	return out.Body, size, nil
+}
@@ -0,0 +1,40 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Redactor strips or masks sensitive content from the body of a message sent to the AWS SQS queue url or AWS SNS topic
+// arn `target` before it is stored as a hefty message, and returns the body to store. It can refuse to send the
+// message by returning a *VetoError. Receivers get the redacted body.
+type Redactor func(ctx context.Context, target string, body string) (string, error)
+
+// VetoError is returned by a Redactor to refuse sending a message, and is returned as is by the client wrappers
+type VetoError struct {
+	Reason string
+}
+
+func (err *VetoError) Error() string {
+	return fmt.Sprintf("message vetoed before it was stored. %s", err.Reason)
+}
+
+// redact applies the redactor to the body of a message sent to `target`
+func (storage *payloadStorage) redact(ctx context.Context, target string, body *string) (*string, error) {
+	if storage.redactor == nil {
+		return body, nil
+	}
+
+	redacted, err := storage.redactor(ctx, target, *body)
+	if err != nil {
+		var veto *VetoError
+		if errors.As(err, &veto) {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("unable to redact message. %v", err)
+	}
+
+	return &redacted, nil
+}
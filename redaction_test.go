@@ -0,0 +1,86 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	var tests = []struct {
+		desc     string
+		redactor Redactor
+		expBody  string
+		expVeto  bool
+		expErr   bool
+	}{
+		{desc: "no_redactor", expBody: "card=4111111111111111"},
+		{
+			desc: "masked",
+			redactor: func(_ context.Context, _ string, body string) (string, error) {
+				return strings.ReplaceAll(body, "4111111111111111", "****"), nil
+			},
+			expBody: "card=****",
+		},
+		{
+			desc: "vetoed",
+			redactor: func(context.Context, string, string) (string, error) {
+				return "", &VetoError{Reason: "message contains a card number"}
+			},
+			expVeto: true,
+			expErr:  true,
+		},
+		{
+			desc: "failed",
+			redactor: func(context.Context, string, string) (string, error) {
+				return "", errors.New("redaction failed")
+			},
+			expErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			storage := &payloadStorage{redactor: tt.redactor}
+			body, err := storage.redact(context.TODO(), "queue", aws.String("card=4111111111111111"))
+
+			var veto *VetoError
+			assert.Equal(t, tt.expVeto, errors.As(err, &veto))
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expBody, *body)
+		})
+	}
+}
+
+func TestPublishHeftyMessageRedacted(t *testing.T) {
+	store := &memoryStore{payloads: map[string][]byte{}}
+	redactor := func(_ context.Context, _ string, body string) (string, error) {
+		return strings.ReplaceAll(body, "4111111111111111", "****"), nil
+	}
+	wrapper, err := NewSnsClientWrapperFromAPI(&fakeSnsAPI{}, &fakeS3API{}, "bucket", WithSkipBucketCheck(), AlwaysSendToS3(), WithPayloadStore(store, 1024), WithRedactor(redactor))
+	assert.Nil(t, err)
+
+	attributes := map[string]snstypes.MessageAttributeValue{"attr": {DataType: aws.String("String"), StringValue: aws.String("value")}}
+	params := &sns.PublishInput{TopicArn: aws.String("arn:aws:sns:us-west-2:765908583888:topic"), Message: aws.String("card=4111111111111111"), MessageAttributes: attributes}
+	_, err = wrapper.PublishHeftyMessage(context.TODO(), params)
+	assert.Nil(t, err)
+
+	// the stored message is redacted, while the input is restored to the original message
+	assert.Len(t, store.payloads, 1)
+	for _, payload := range store.payloads {
+		assert.Contains(t, string(payload), "card=****")
+		assert.NotContains(t, string(payload), "4111111111111111")
+	}
+	assert.Equal(t, "card=4111111111111111", aws.ToString(params.Message))
+	assert.Equal(t, attributes, params.MessageAttributes)
+}
@@ -0,0 +1,133 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// redriveVisibilityTimeout is the visibility timeout in seconds of messages received from a dead-letter queue while they
+// are moved
+const redriveVisibilityTimeout = 60
+
+// RedriveOutput is the output of Redrive
+type RedriveOutput struct {
+	// Moved is the number of messages that were sent to the target queue and deleted from the dead-letter queue.
+	Moved int
+}
+
+// Redrive moves the messages of the dead-letter queue `sourceDlq` to the queue `targetQueue`, usually the queue the
+// messages were originally sent to, until the dead-letter queue is empty. Reference messages are moved as they are, so
+// the hefty messages stay where they are stored and are never deleted by a redrive. Message attributes and the AWS X-Ray
+// trace header are kept. Messages sent to a FIFO queue keep their message group id and are deduplicated by their message
+// id. With TagWithMessageId, hefty messages are tagged with the message id of their new reference message.
+//
+// Each message is sent to the target queue before it is deleted from the dead-letter queue, so a message can be in both
+// queues when the redrive fails, but is never lost. The redrive stops at the first message that cannot be moved. Hefty
+// messages encrypted with client side encryption can only be redriven to the queue they were sent to.
+func (wrapper *SqsClientWrapper) Redrive(ctx context.Context, sourceDlq, targetQueue string, optFns ...func(*sqs.Options)) (*RedriveOutput, error) {
+	if sourceDlq == targetQueue {
+		return nil, errors.New("messages cannot be redriven to the dead-letter queue they are received from")
+	}
+
+	optFns = wrapper.withOptFns(optFns)
+	output := &RedriveOutput{}
+	for {
+		out, err := wrapper.sqsClient().ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(sourceDlq),
+			MaxNumberOfMessages:   10,
+			VisibilityTimeout:     redriveVisibilityTimeout,
+			WaitTimeSeconds:       1,
+			AttributeNames:        []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameAll},
+			MessageAttributeNames: []string{"All"},
+		}, optFns...)
+		if err != nil {
+			return output, fmt.Errorf("unable to receive messages from %s. %v", sourceDlq, err)
+		}
+		if len(out.Messages) == 0 {
+			return output, nil
+		}
+
+		for i := range out.Messages {
+			if err = wrapper.redriveMessage(ctx, &out.Messages[i], sourceDlq, targetQueue, optFns); err != nil {
+				return output, err
+			}
+			output.Moved++
+		}
+	}
+}
+
+// redriveMessage sends a message received from a dead-letter queue to the target queue and deletes it from the
+// dead-letter queue
+func (wrapper *SqsClientWrapper) redriveMessage(ctx context.Context, msg *sqstypes.Message, sourceDlq, targetQueue string, optFns []func(*sqs.Options)) error {
+	out, err := wrapper.sqsClient().SendMessage(ctx, redriveInput(msg, targetQueue), optFns...)
+	if err != nil {
+		return fmt.Errorf("unable to send message %s to %s. %v", aws.ToString(msg.MessageId), targetQueue, err)
+	}
+
+	// the hefty message now belongs to the new reference message
+	if types.IsReferenceMsg(aws.ToString(msg.Body)) {
+		if refMsg, err := types.ToReferenceMsg(aws.ToString(msg.Body)); err == nil {
+			wrapper.storage.retagWithMessageId(ctx, refMsg, out.MessageId)
+		}
+	}
+
+	// the reference message is deleted without its hefty message, which is referenced by the sent message
+	_, err = wrapper.sqsClient().DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(sourceDlq), ReceiptHandle: msg.ReceiptHandle}, optFns...)
+	if err != nil {
+		return fmt.Errorf("message %s was sent to %s but could not be deleted from %s. %v", aws.ToString(msg.MessageId), targetQueue, sourceDlq, err)
+	}
+
+	return nil
+}
+
+// redriveInput creates the input that sends a received message again to the queue `targetQueue`
+func redriveInput(msg *sqstypes.Message, targetQueue string) *sqs.SendMessageInput {
+	params := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(targetQueue),
+		MessageBody:       msg.Body,
+		MessageAttributes: msg.MessageAttributes,
+	}
+
+	if traceHeader, ok := msg.Attributes[string(sqstypes.MessageSystemAttributeNameAWSTraceHeader)]; ok {
+		params.MessageSystemAttributes = map[string]sqstypes.MessageSystemAttributeValue{
+			string(sqstypes.MessageSystemAttributeNameForSendsAWSTraceHeader): {DataType: aws.String("String"), StringValue: aws.String(traceHeader)},
+		}
+	}
+
+	// the original deduplication id is not reused, since the message would be dropped when it is redriven within the
+	// deduplication interval of its original send
+	if strings.HasSuffix(targetQueue, ".fifo") {
+		params.MessageGroupId = optionalString(msg.Attributes[string(sqstypes.MessageSystemAttributeNameMessageGroupId)])
+		params.MessageDeduplicationId = msg.MessageId
+	}
+
+	return params
+}
+
+// retagWithMessageId tags a hefty message with the message id of the reference message it was moved to. The other tags of
+// the hefty message are kept.
+func (storage *payloadStorage) retagWithMessageId(ctx context.Context, refMsg *types.ReferenceMsg, messageId *string) {
+	if !storage.tagWithMsgId || refMsg.Backend != "" {
+		return
+	}
+
+	out, err := storage.s3Client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket:              aws.String(refMsg.S3Bucket),
+		Key:                 aws.String(refMsg.S3Key),
+		VersionId:           optionalString(refMsg.S3VersionId),
+		ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+	}, storage.s3OptFns...)
+	if err != nil {
+		return
+	}
+
+	storage.tagWithMessageId(ctx, refMsg, messageId, retainedTags(out.TagSet))
+}
@@ -0,0 +1,56 @@
+package hefty
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedriveInput(t *testing.T) {
+	msg := &sqstypes.Message{
+		MessageId: aws.String("message-id"),
+		Body:      aws.String("body"),
+		Attributes: map[string]string{
+			"AWSTraceHeader":         "Root=1-5759e988-bd862e3fe1be46a994272793",
+			"MessageGroupId":         "group",
+			"MessageDeduplicationId": "dedup",
+		},
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+			"attr": {DataType: aws.String("String"), StringValue: aws.String("value")},
+		},
+	}
+
+	var tests = []struct {
+		desc        string
+		targetQueue string
+		expGroupId  *string
+		expDedupId  *string
+	}{
+		{desc: "standard", targetQueue: "https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue"},
+		{desc: "fifo", targetQueue: "https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue.fifo", expGroupId: aws.String("group"), expDedupId: aws.String("message-id")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			params := redriveInput(msg, tt.targetQueue)
+			assert.Equal(t, tt.targetQueue, aws.ToString(params.QueueUrl))
+			assert.Equal(t, msg.Body, params.MessageBody)
+			assert.Equal(t, msg.MessageAttributes, params.MessageAttributes)
+			assert.Equal(t, "Root=1-5759e988-bd862e3fe1be46a994272793", aws.ToString(params.MessageSystemAttributes["AWSTraceHeader"].StringValue))
+			assert.Equal(t, tt.expGroupId, params.MessageGroupId)
+			assert.Equal(t, tt.expDedupId, params.MessageDeduplicationId)
+		})
+	}
+}
+
+func TestRetainedTags(t *testing.T) {
+	tags := retainedTags([]s3types.Tag{
+		{Key: aws.String(TagKeyMessageId), Value: aws.String("message-id")},
+		{Key: aws.String(KeySentTimestamp), Value: aws.String("2024-03-01T10:00:00Z")},
+		{Key: aws.String(TagKeyExpirationDays), Value: aws.String("14")},
+	})
+	assert.Equal(t, map[string]string{TagKeyExpirationDays: "14"}, tags)
+}
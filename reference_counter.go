@@ -0,0 +1,25 @@
+package hefty
+
+import (
+	"context"
+)
+
+// ReferenceCounter counts the messages that reference a content addressed hefty message. With content addressable keys,
+// identical hefty messages are stored once and shared by every message that references them. A reference counter makes
+// DeleteHeftyMessage only delete a hefty message once no other message references it. See WithReferenceCounter.
+type ReferenceCounter interface {
+	// Increment adds a reference to the hefty message stored under `key` and returns the number of references.
+	Increment(ctx context.Context, key string) (int64, error)
+	// Decrement removes a reference to the hefty message stored under `key` and returns the number of references left.
+	Decrement(ctx context.Context, key string) (int64, error)
+}
+
+// referenceKey returns the key under which the references to a hefty message are counted. Hefty messages in a payload
+// store are counted per backend and hefty messages in AWS S3 per bucket.
+func referenceKey(bucket, key, backend string) string {
+	if backend != "" {
+		return backend + "|" + key
+	}
+
+	return bucket + "|" + key
+}
@@ -0,0 +1,132 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// ReplayInput is the hefty message Replay sends again and the queue it is sent to. The hefty message is given either by
+// its reference message or by its location.
+type ReplayInput struct {
+	// QueueUrl is the queue the message is sent to.
+	QueueUrl string
+	// ReferenceMessage is the body of the reference message of the hefty message. It takes precedence over the location.
+	ReferenceMessage string
+	// Bucket, Key, Backend and VersionId are the location of the hefty message. Hefty messages that were transformed or
+	// encrypted with client side encryption can only be replayed from their reference message.
+	Bucket    string
+	Key       string
+	Backend   string
+	VersionId string
+	// DelaySeconds, MessageGroupId and MessageDeduplicationId are used to send the message as with SendHeftyMessage.
+	DelaySeconds           int32
+	MessageGroupId         *string
+	MessageDeduplicationId *string
+}
+
+// GetHeftyMessageInput is the hefty message GetHeftyMessage gets, given either by its reference message or by its location
+type GetHeftyMessageInput struct {
+	// QueueUrl is the queue the message was sent to. It is only needed for hefty messages encrypted with client side
+	// encryption.
+	QueueUrl string
+	// ReferenceMessage is the body of the reference message of the hefty message. It takes precedence over the location.
+	ReferenceMessage string
+	// Bucket, Key, Backend and VersionId are the location of the hefty message. Hefty messages that were transformed or
+	// encrypted with client side encryption can only be got from their reference message.
+	Bucket    string
+	Key       string
+	Backend   string
+	VersionId string
+}
+
+// GetHeftyMessageOutput is the original message of a hefty message
+type GetHeftyMessageOutput struct {
+	Body              *string
+	MessageAttributes map[string]sqstypes.MessageAttributeValue
+}
+
+// GetHeftyMessage gets a stored hefty message and reconstructs its original message body and message attributes, e.g. to
+// see what is inside a stuck message. The hefty message is only read.
+func (wrapper *SqsClientWrapper) GetHeftyMessage(ctx context.Context, input *GetHeftyMessageInput) (*GetHeftyMessageOutput, error) {
+	heftyMsg, err := wrapper.storage.storedMessage(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetHeftyMessageOutput{
+		Body:              heftyMsg.Body,
+		MessageAttributes: messages.MapToSqsMessageAttributeValues(heftyMsg.MessageAttributes),
+	}, nil
+}
+
+// Replay reconstructs the original message body and message attributes of a stored hefty message and sends the message
+// again with SendHeftyMessage, e.g. to reprocess messages after a bug was fixed. The stored hefty message is only read;
+// it is neither changed nor deleted, and the replayed message is stored as a new hefty message if it is sent to AWS S3.
+// Hefty messages encrypted with client side encryption can only be replayed to the queue they were sent to.
+func (wrapper *SqsClientWrapper) Replay(ctx context.Context, input *ReplayInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	stored, err := wrapper.GetHeftyMessage(ctx, &GetHeftyMessageInput{
+		QueueUrl:         input.QueueUrl,
+		ReferenceMessage: input.ReferenceMessage,
+		Bucket:           input.Bucket,
+		Key:              input.Key,
+		Backend:          input.Backend,
+		VersionId:        input.VersionId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapper.SendHeftyMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:               aws.String(input.QueueUrl),
+		MessageBody:            stored.Body,
+		MessageAttributes:      stored.MessageAttributes,
+		DelaySeconds:           input.DelaySeconds,
+		MessageGroupId:         input.MessageGroupId,
+		MessageDeduplicationId: input.MessageDeduplicationId,
+	}, optFns...)
+}
+
+// storedMessage gets and decodes a stored hefty message. Hefty messages given by their reference message are verified
+// against its digests; hefty messages given by their location cannot be verified.
+func (storage *payloadStorage) storedMessage(ctx context.Context, input *GetHeftyMessageInput) (*messages.HeftyMessage, error) {
+	if input.ReferenceMessage != "" {
+		if !types.IsReferenceMsg(input.ReferenceMessage) {
+			return nil, errors.New("message is not a reference message")
+		}
+
+		refMsg, err := types.ToReferenceMsg(input.ReferenceMessage)
+		if err != nil {
+			return nil, fmt.Errorf("unable to unmarshal reference message. %v", err)
+		}
+
+		return storage.getHeftyMessage(ctx, input.QueueUrl, refMsg)
+	}
+
+	if input.Key == "" || (input.Bucket == "" && input.Backend == "") {
+		return nil, errors.New("either the reference message or the bucket and key of the hefty message must be given")
+	}
+
+	payload, err := storage.get(ctx, &types.ReferenceMsg{
+		S3Bucket:    input.Bucket,
+		S3Key:       input.Key,
+		Backend:     input.Backend,
+		S3VersionId: input.VersionId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	heftyMsg, err := messages.DeserializeHeftyMessage(payload)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode bytes from s3 into hefty message type; transformed or encrypted hefty messages can only be got from their reference message. %v", err)
+	}
+
+	return heftyMsg, nil
+}
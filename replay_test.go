@@ -0,0 +1,53 @@
+package hefty
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadStorageStoredMessage(t *testing.T) {
+	store := &memoryStore{payloads: map[string][]byte{"queue/garbage": []byte("garbage")}}
+	storage := &payloadStorage{payloadStore: store, payloadMaxSize: 1024}
+
+	heftyMsg := messages.NewHeftyMessage(aws.String("hefty message"), nil, 13)
+	serialized, _, _, err := heftyMsg.Serialize()
+	assert.Nil(t, err)
+	bodyDigest, attrDigest, err := messageDigests("", serialized, heftyMsg)
+	assert.Nil(t, err)
+
+	refMsg := types.NewReferenceMsg("", "", "queue/id", bodyDigest, attrDigest)
+	err = storage.put(context.TODO(), "queue", "", refMsg, serialized, nil, nil)
+	assert.Nil(t, err)
+	jsonRefMsg, err := json.Marshal(refMsg)
+	assert.Nil(t, err)
+
+	var tests = []struct {
+		desc   string
+		input  GetHeftyMessageInput
+		expErr bool
+	}{
+		{desc: "reference_message", input: GetHeftyMessageInput{ReferenceMessage: string(jsonRefMsg)}},
+		{desc: "location", input: GetHeftyMessageInput{Key: "queue/id", Backend: "memory"}},
+		{desc: "not_a_reference_message", input: GetHeftyMessageInput{ReferenceMessage: "message"}, expErr: true},
+		{desc: "missing_location", input: GetHeftyMessageInput{Key: "queue/id"}, expErr: true},
+		{desc: "not_a_hefty_message", input: GetHeftyMessageInput{Key: "queue/garbage", Backend: "memory"}, expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			stored, err := storage.storedMessage(context.TODO(), &tt.input)
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "hefty message", aws.ToString(stored.Body))
+		})
+	}
+}
@@ -0,0 +1,280 @@
+// Package resolve downloads and decodes the hefty messages of reference messages without an AWS SQS or AWS SNS client
+// wrapper, for AWS Lambda functions and other thin consumers that only read hefty messages. Hefty messages stored in
+// other payload stores or encrypted with client side encryption need the client wrappers.
+package resolve
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// S3Client is the subset of the AWS S3 client used to download hefty messages
+type S3Client interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// Transform reverses a transform applied to hefty messages by the sender. hefty.Transform values satisfy it.
+type Transform interface {
+	// Name identifies the transform in reference messages.
+	Name() string
+	// Reverse restores a serialized hefty message.
+	Reverse(ctx context.Context, payload io.Reader) (io.Reader, error)
+}
+
+// MessageAttributeValue is a message attribute of a hefty message
+type MessageAttributeValue struct {
+	DataType    *string
+	StringValue *string
+	BinaryValue []byte
+}
+
+// Message is the original body and message attributes of a hefty message
+type Message struct {
+	Body              string
+	MessageAttributes map[string]MessageAttributeValue
+}
+
+type options struct {
+	transforms          map[string]Transform
+	expectedBucketOwner string
+	s3OptFns            []func(*s3.Options)
+	httpClient          *http.Client
+}
+
+type Option func(opts *options) error
+
+// WithTransforms reverses the transforms of the same names applied by the sender. gzip is reversed without this option.
+func WithTransforms(transforms ...Transform) Option {
+	return func(opts *options) error {
+		for _, transform := range transforms {
+			if transform == nil {
+				return errors.New("transform must not be nil")
+			}
+			opts.transforms[transform.Name()] = transform
+		}
+		return nil
+	}
+}
+
+// WithExpectedBucketOwner makes downloads fail when the bucket is not owned by the AWS account `accountId`
+func WithExpectedBucketOwner(accountId string) Option {
+	return func(opts *options) error {
+		opts.expectedBucketOwner = accountId
+		return nil
+	}
+}
+
+// WithS3OptFns passes `optFns` to every call to AWS S3
+func WithS3OptFns(optFns ...func(*s3.Options)) Option {
+	return func(opts *options) error {
+		opts.s3OptFns = append(opts.s3OptFns, optFns...)
+		return nil
+	}
+}
+
+// WithHTTPClient sets the client ResolvePresignedReference gets hefty messages with. http.DefaultClient is used otherwise.
+func WithHTTPClient(client *http.Client) Option {
+	return func(opts *options) error {
+		if client == nil {
+			return errors.New("http client must not be nil")
+		}
+		opts.httpClient = client
+		return nil
+	}
+}
+
+// ResolveReference downloads the hefty message of `refMsg` from AWS S3, reverses its transforms and verifies its digests.
+// Use types.IsReferenceMsg and types.ToReferenceMsg to get the reference message of a message body.
+func ResolveReference(ctx context.Context, client S3Client, refMsg *types.ReferenceMsg, opts ...Option) (*Message, error) {
+	options, err := resolveOptions(refMsg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := download(ctx, client, refMsg, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(ctx, refMsg, payload, options)
+}
+
+// ResolvePresignedReference gets the hefty message of `refMsg` with the presigned url embedded by the sender, see
+// hefty.WithPresignedUrls, so that no AWS S3 credentials are needed. Its transforms are reversed and its digests verified
+// like with ResolveReference.
+func ResolvePresignedReference(ctx context.Context, refMsg *types.ReferenceMsg, opts ...Option) (*Message, error) {
+	options, err := resolveOptions(refMsg, opts)
+	if err != nil {
+		return nil, err
+	}
+	if refMsg.PresignedUrl == "" {
+		return nil, errors.New("reference message has no presigned url")
+	}
+
+	payload, err := fetch(ctx, refMsg.PresignedUrl, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(ctx, refMsg, payload, options)
+}
+
+// resolveOptions applies `opts` and checks that the hefty message of `refMsg` can be resolved without a client wrapper
+func resolveOptions(refMsg *types.ReferenceMsg, opts []Option) (*options, error) {
+	options := &options{transforms: map[string]Transform{"gzip": gzipTransform{}}, httpClient: http.DefaultClient}
+	for _, opt := range opts {
+		if err := opt(options); err != nil {
+			return nil, fmt.Errorf("unable to apply option. %v", err)
+		}
+	}
+
+	if refMsg == nil {
+		return nil, errors.New("reference message must not be nil")
+	}
+	if refMsg.Backend != "" {
+		return nil, fmt.Errorf("hefty message is stored in the %s payload store and needs a client wrapper", refMsg.Backend)
+	}
+	if len(refMsg.EncryptedDataKey) > 0 {
+		return nil, errors.New("hefty message is encrypted with client side encryption and needs a client wrapper")
+	}
+
+	return options, nil
+}
+
+// decode reverses the transforms of a downloaded hefty message, deserializes it and verifies its digests
+func decode(ctx context.Context, refMsg *types.ReferenceMsg, payload []byte, options *options) (*Message, error) {
+	payload, err := reverse(ctx, options.transforms, refMsg.Transforms, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	heftyMsg, err := messages.DeserializeHeftyMessage(payload)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode bytes from s3 into hefty message type. %v", err)
+	}
+
+	ok, err := messages.VerifyDigests(refMsg.DigestAlgorithm, payload, heftyMsg, refMsg.Md5DigestMsgBody, refMsg.Md5DigestMsgAttr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to verify digests of hefty message. %v", err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("digests of hefty message s3://%s/%s do not match reference message", refMsg.S3Bucket, refMsg.S3Key)
+	}
+
+	msg := &Message{Body: aws.ToString(heftyMsg.Body)}
+	if heftyMsg.MessageAttributes != nil {
+		msg.MessageAttributes = make(map[string]MessageAttributeValue, len(heftyMsg.MessageAttributes))
+		for name, value := range heftyMsg.MessageAttributes {
+			msg.MessageAttributes[name] = MessageAttributeValue(value)
+		}
+	}
+
+	return msg, nil
+}
+
+// fetch gets a serialized hefty message with a presigned url
+func fetch(ctx context.Context, presignedUrl string, options *options) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, presignedUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get message with presigned url. %v", err)
+	}
+
+	resp, err := options.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get message with presigned url. %v", err)
+	}
+	defer resp.Body.Close()
+
+	// an expired url is rejected with 403
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to get message with presigned url. status %d", resp.StatusCode)
+	}
+
+	payload, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read message from presigned url. %v", err)
+	}
+
+	return payload, nil
+}
+
+// download gets a serialized hefty message from AWS S3
+func download(ctx context.Context, client S3Client, refMsg *types.ReferenceMsg, options *options) ([]byte, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(refMsg.S3Bucket),
+		Key:    aws.String(refMsg.S3Key),
+	}
+	if refMsg.S3VersionId != "" {
+		input.VersionId = aws.String(refMsg.S3VersionId)
+	}
+	if options.expectedBucketOwner != "" {
+		input.ExpectedBucketOwner = aws.String(options.expectedBucketOwner)
+	}
+	if refMsg.S3ChecksumAlgorithm != "" {
+		input.ChecksumMode = s3types.ChecksumModeEnabled
+	}
+
+	out, err := client.GetObject(ctx, input, options.s3OptFns...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get message from s3. %v", err)
+	}
+	defer out.Body.Close()
+
+	// a checksum is validated once the body has been read completely
+	payload, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read message from s3. %v", err)
+	}
+
+	return payload, nil
+}
+
+// reverse reverses the transforms `names` in reverse order
+func reverse(ctx context.Context, transforms map[string]Transform, names []string, payload []byte) ([]byte, error) {
+	if len(names) == 0 {
+		return payload, nil
+	}
+
+	var reader io.Reader = bytes.NewReader(payload)
+	for i := len(names) - 1; i >= 0; i-- {
+		transform, ok := transforms[names[i]]
+		if !ok {
+			return nil, fmt.Errorf("no transform configured for %s", names[i])
+		}
+
+		var err error
+		reader, err = transform.Reverse(ctx, reader)
+		if err != nil {
+			return nil, fmt.Errorf("unable to reverse transform %s. %v", names[i], err)
+		}
+	}
+
+	reversed, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reverse transforms. %v", err)
+	}
+
+	return reversed, nil
+}
+
+// gzipTransform reverses hefty.Gzip
+type gzipTransform struct{}
+
+func (gzipTransform) Name() string {
+	return "gzip"
+}
+
+func (gzipTransform) Reverse(_ context.Context, payload io.Reader) (io.Reader, error) {
+	return gzip.NewReader(payload)
+}
@@ -0,0 +1,136 @@
+package resolve
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeS3Client struct {
+	objects map[string][]byte
+	input   *s3.GetObjectInput
+}
+
+func (c *fakeS3Client) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	c.input = params
+	payload, ok := c.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, errors.New("NoSuchKey")
+	}
+
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(payload))}, nil
+}
+
+// storeHeftyMessage stores a hefty message in `client` and returns its reference message
+func storeHeftyMessage(t *testing.T, client *fakeS3Client, key, body string, compress bool) *types.ReferenceMsg {
+	heftyMsg := messages.NewHeftyMessage(aws.String(body), map[string]messages.MessageAttributeValue{
+		"attr": {DataType: aws.String("String"), StringValue: aws.String("value")},
+	}, len(body))
+	serialized, bodyOffset, msgAttrOffset, err := heftyMsg.Serialize()
+	assert.NoError(t, err)
+
+	refMsg := types.NewReferenceMsg("us-west-2", "bucket", key,
+		messages.Md5Digest(serialized[bodyOffset:msgAttrOffset]), messages.Md5Digest(serialized[msgAttrOffset:]))
+
+	if compress {
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		_, _ = writer.Write(serialized)
+		assert.NoError(t, writer.Close())
+		serialized = buf.Bytes()
+		refMsg.Transforms = []string{"gzip"}
+	}
+
+	client.objects[key] = serialized
+	return refMsg
+}
+
+func TestResolveReference(t *testing.T) {
+	client := &fakeS3Client{objects: map[string][]byte{}}
+	plain := storeHeftyMessage(t, client, "plain", "hefty message", false)
+	compressed := storeHeftyMessage(t, client, "compressed", "compressed hefty message", true)
+
+	tamperedKey := storeHeftyMessage(t, client, "tampered", "hefty message", false)
+	tampered := *tamperedKey
+	tampered.Md5DigestMsgBody = "0"
+
+	unknownTransform := *plain
+	unknownTransform.Transforms = []string{"zstd"}
+
+	encrypted := *plain
+	encrypted.EncryptedDataKey = []byte("key")
+
+	stored := *plain
+	stored.Backend = "memory"
+
+	tests := []struct {
+		name   string
+		refMsg *types.ReferenceMsg
+		body   string
+		err    string
+	}{
+		{name: "plain", refMsg: plain, body: "hefty message"},
+		{name: "gzip", refMsg: compressed, body: "compressed hefty message"},
+		{name: "missing", refMsg: types.NewReferenceMsg("us-west-2", "bucket", "missing", "", ""), err: "unable to get message from s3"},
+		{name: "digest mismatch", refMsg: &tampered, err: "do not match"},
+		{name: "unknown transform", refMsg: &unknownTransform, err: "no transform configured for zstd"},
+		{name: "client side encryption", refMsg: &encrypted, err: "client side encryption"},
+		{name: "payload store", refMsg: &stored, err: "memory payload store"},
+		{name: "nil", err: "must not be nil"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg, err := ResolveReference(context.TODO(), client, test.refMsg, WithExpectedBucketOwner("123456789012"))
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.body, msg.Body)
+			assert.Equal(t, "value", aws.ToString(msg.MessageAttributes["attr"].StringValue))
+			assert.Equal(t, "123456789012", aws.ToString(client.input.ExpectedBucketOwner))
+		})
+	}
+}
+
+func TestResolvePresignedReference(t *testing.T) {
+	client := &fakeS3Client{objects: map[string][]byte{}}
+	refMsg := storeHeftyMessage(t, client, "presigned", "hefty message", true)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, ok := client.objects[r.URL.Path[1:]]
+		if !ok || r.URL.Query().Get("X-Amz-Signature") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write(payload)
+	}))
+	defer server.Close()
+
+	refMsg.PresignedUrl = server.URL + "/presigned?X-Amz-Signature=signature"
+	msg, err := ResolvePresignedReference(context.TODO(), refMsg, WithHTTPClient(server.Client()))
+	assert.NoError(t, err)
+	assert.Equal(t, "hefty message", msg.Body)
+
+	// an expired url is rejected by AWS S3
+	refMsg.PresignedUrl = server.URL + "/presigned"
+	_, err = ResolvePresignedReference(context.TODO(), refMsg, WithHTTPClient(server.Client()))
+	assert.ErrorContains(t, err, "status 403")
+
+	refMsg.PresignedUrl = ""
+	_, err = ResolvePresignedReference(context.TODO(), refMsg)
+	assert.ErrorContains(t, err, "no presigned url")
+}
@@ -0,0 +1,138 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// RetryTokenBucket is a retry quota which limits the number of retry attempts the AWS SDK may make. A bucket can be shared
+// between the AWS SQS/SNS and AWS S3 calls made by a wrapper, or between wrappers, using the retry token options. Buckets
+// keep count of the number of times a retry was denied due to the bucket being exhausted.
+type RetryTokenBucket struct {
+	limiter   *ratelimit.TokenRateLimit
+	exhausted atomic.Int64
+}
+
+// NewRetryTokenBucket creates a retry token bucket holding `tokens` tokens. The AWS SDK default is retry.DefaultRetryRateTokens.
+func NewRetryTokenBucket(tokens uint) *RetryTokenBucket {
+	return &RetryTokenBucket{
+		limiter: ratelimit.NewTokenRateLimit(tokens),
+	}
+}
+
+// Remaining returns the number of tokens remaining in the bucket.
+func (b *RetryTokenBucket) Remaining() uint {
+	return b.limiter.Remaining()
+}
+
+// Exhausted returns the number of retry attempts that were denied because the bucket did not have enough tokens.
+func (b *RetryTokenBucket) Exhausted() int64 {
+	return b.exhausted.Load()
+}
+
+func (b *RetryTokenBucket) getToken(ctx context.Context, cost uint) (func() error, error) {
+	release, err := b.limiter.GetToken(ctx, cost)
+	if err != nil {
+		var quotaErr ratelimit.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			b.exhausted.Add(1)
+		}
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// tokenBucketRetryer keeps the retry behavior of the retryer configured on the AWS SDK client, but takes retry tokens
+// from a RetryTokenBucket instead of the retryer's own token bucket.
+type tokenBucketRetryer struct {
+	aws.Retryer
+	bucket   *RetryTokenBucket
+	timeouts retry.IsErrorTimeouts
+}
+
+func newTokenBucketRetryer(retryer aws.Retryer, bucket *RetryTokenBucket) aws.RetryerV2 {
+	if retryer == nil {
+		retryer = retry.NewStandard()
+	}
+
+	return &tokenBucketRetryer{
+		Retryer:  retryer,
+		bucket:   bucket,
+		timeouts: retry.DefaultTimeouts,
+	}
+}
+
+func (r *tokenBucketRetryer) GetRetryToken(ctx context.Context, opErr error) (func(error) error, error) {
+	cost := retry.DefaultRetryCost
+	if r.timeouts.IsErrorTimeout(opErr).Bool() {
+		cost = retry.DefaultRetryTimeoutCost
+	}
+
+	release, err := r.bucket.getToken(ctx, cost)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(err error) error {
+		if err != nil {
+			return nil
+		}
+		return release()
+	}, nil
+}
+
+func (r *tokenBucketRetryer) GetInitialToken() func(error) error {
+	return r.refundOnSuccess(r.Retryer.GetInitialToken())
+}
+
+// GetAttemptToken delegates to the wrapped retryer so that client side rate limiting, like the one used by
+// retry.AdaptiveMode, is still applied.
+func (r *tokenBucketRetryer) GetAttemptToken(ctx context.Context) (func(error) error, error) {
+	v2, ok := r.Retryer.(aws.RetryerV2)
+	if !ok {
+		return r.GetInitialToken(), nil
+	}
+
+	release, err := v2.GetAttemptToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.refundOnSuccess(release), nil
+}
+
+func (r *tokenBucketRetryer) refundOnSuccess(release func(error) error) func(error) error {
+	return func(err error) error {
+		if err == nil {
+			_ = r.bucket.limiter.AddTokens(retry.DefaultNoRetryIncrement)
+		}
+		return release(err)
+	}
+}
+
+func sqsRetryTokenOption(bucket *RetryTokenBucket) func(*sqs.Options) {
+	return func(o *sqs.Options) {
+		o.Retryer = newTokenBucketRetryer(o.Retryer, bucket)
+	}
+}
+
+func snsRetryTokenOption(bucket *RetryTokenBucket) func(*sns.Options) {
+	return func(o *sns.Options) {
+		o.Retryer = newTokenBucketRetryer(o.Retryer, bucket)
+	}
+}
+
+func s3RetryTokenOption(bucket *RetryTokenBucket) func(*s3.Options) {
+	return func(o *s3.Options) {
+		o.Retryer = newTokenBucketRetryer(o.Retryer, bucket)
+	}
+}
@@ -0,0 +1,115 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// timeoutError is an error the AWS SDK considers a timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestTokenBucketRetryerDrain(t *testing.T) {
+	bucket := NewRetryTokenBucket(2 * retry.DefaultRetryCost)
+	retryer := newTokenBucketRetryer(nil, bucket)
+	opErr := errors.New("internal error")
+
+	// retries take tokens until the bucket is drained
+	for i := 0; i < 2; i++ {
+		_, err := retryer.GetRetryToken(context.TODO(), opErr)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, uint(0), bucket.Remaining())
+
+	_, err := retryer.GetRetryToken(context.TODO(), opErr)
+	var quotaErr ratelimit.QuotaExceededError
+	assert.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, int64(1), bucket.Exhausted())
+
+	// timeouts cost more than other errors
+	bucket = NewRetryTokenBucket(retry.DefaultRetryTimeoutCost)
+	retryer = newTokenBucketRetryer(nil, bucket)
+	_, err = retryer.GetRetryToken(context.TODO(), timeoutError{})
+	assert.Nil(t, err)
+	assert.Equal(t, uint(0), bucket.Remaining())
+}
+
+func TestTokenBucketRetryerRefund(t *testing.T) {
+	bucket := NewRetryTokenBucket(2 * retry.DefaultRetryCost)
+	retryer := newTokenBucketRetryer(nil, bucket)
+
+	// a failed retry keeps its tokens
+	release, err := retryer.GetRetryToken(context.TODO(), errors.New("internal error"))
+	assert.Nil(t, err)
+	assert.Nil(t, release(errors.New("internal error")))
+	assert.Equal(t, retry.DefaultRetryCost, bucket.Remaining())
+
+	// a successful retry returns its tokens
+	release, err = retryer.GetRetryToken(context.TODO(), errors.New("internal error"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint(0), bucket.Remaining())
+	assert.Nil(t, release(nil))
+	assert.Equal(t, retry.DefaultRetryCost, bucket.Remaining())
+
+	// successful attempts add tokens up to the size of the bucket
+	release, err = retryer.GetAttemptToken(context.TODO())
+	assert.Nil(t, err)
+	assert.Nil(t, release(nil))
+	assert.Equal(t, retry.DefaultRetryCost+retry.DefaultNoRetryIncrement, bucket.Remaining())
+
+	release, err = retryer.GetAttemptToken(context.TODO())
+	assert.Nil(t, err)
+	assert.Nil(t, release(errors.New("internal error")))
+	assert.Equal(t, retry.DefaultRetryCost+retry.DefaultNoRetryIncrement, bucket.Remaining())
+
+	for i := uint(0); i < 2*retry.DefaultRetryCost; i++ {
+		assert.Nil(t, retryer.GetInitialToken()(nil))
+	}
+	assert.Equal(t, 2*retry.DefaultRetryCost, bucket.Remaining())
+}
+
+func TestS3RetryTokenOption(t *testing.T) {
+	httpClient := &stubHttpClient{status: http.StatusInternalServerError}
+	s3Client := s3.New(s3.Options{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+		HTTPClient:  httpClient,
+		Retryer: retry.NewStandard(func(o *retry.StandardOptions) {
+			o.MaxAttempts = 10
+			o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+		}),
+	})
+	bucket := NewRetryTokenBucket(2 * retry.DefaultRetryCost)
+	input := &s3.PutObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key"), Body: strings.NewReader("hefty")}
+
+	// retries stop once the bucket is drained, long before the attempts of the retryer are used up
+	_, err := s3Client.PutObject(context.TODO(), input, s3RetryTokenOption(bucket))
+	var quotaErr ratelimit.QuotaExceededError
+	assert.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, 3, httpClient.requests)
+	assert.Equal(t, int64(1), bucket.Exhausted())
+
+	// requests are not retried while the bucket is drained
+	_, err = s3Client.PutObject(context.TODO(), input, s3RetryTokenOption(bucket))
+	assert.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, 4, httpClient.requests)
+
+	// successful requests return tokens to the bucket
+	httpClient.status = 0
+	_, err = s3Client.PutObject(context.TODO(), input, s3RetryTokenOption(bucket))
+	assert.Nil(t, err)
+	assert.Equal(t, retry.DefaultNoRetryIncrement, bucket.Remaining())
+}
@@ -0,0 +1,193 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/limits"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// key of the orphan cleanups recorded in the result metadata of the output of SendHeftyMessageBatch
+type orphanCleanupsKey struct{}
+
+// SendBatchError is returned by SendHeftyMessageBatch when the whole batch could not be sent. Cleanups holds the cleanup
+// of the hefty message of every entry that was stored as a hefty message by entry id.
+type SendBatchError struct {
+	Err      error
+	Cleanups map[string]OrphanCleanup
+}
+
+func (err *SendBatchError) Error() string {
+	return fmt.Sprintf("unable to send batch. %v", err.Err)
+}
+
+func (err *SendBatchError) Unwrap() error {
+	return err.Err
+}
+
+// batchEntry is an entry of a batch that was not sent as is
+type batchEntry struct {
+	refMsg     *types.ReferenceMsg // nil for entries sent as compressed inline messages
+	tags       map[string]string
+	md5Body    *string
+	md5Attr    *string
+	compressed bool
+}
+
+// SendHeftyMessageBatch sends a batch of messages to AWS SQS like SendHeftyMessage. Entries that exceed the message size
+// limit are stored as hefty messages and reference messages are sent in their place. The hefty messages of entries AWS
+// SQS did not accept are deleted, since those entries are known not to have been sent, and the cleanup of every such entry
+// is available by entry id through OrphanCleanups. When the whole batch fails, a *SendBatchError holding the cleanups is
+// returned. `params` is not modified.
+//
+// AWS SQS also limits the size of a whole batch, so the entries of a batch should be kept well below the limit.
+//
+// Note that this function's signature matches that of the AWS SQS SDK's SendMessageBatch function.
+func (wrapper *SqsClientWrapper) SendHeftyMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	optFns = wrapper.withOptFns(optFns)
+
+	// input validation; if invalid input let AWS SDK handle it
+	if params == nil || len(params.Entries) == 0 {
+		return wrapper.sqsClient().SendMessageBatch(ctx, params, optFns...)
+	}
+
+	input := *params
+	input.Entries = append([]sqs_types.SendMessageBatchRequestEntry{}, params.Entries...)
+
+	// store the entries that are not sent as is
+	entries := map[string]batchEntry{}
+	refMsgs := map[string]*types.ReferenceMsg{}
+	for i := range input.Entries {
+		entry, err := wrapper.prepareBatchEntry(ctx, input.QueueUrl, &input.Entries[i], optFns)
+		if err != nil {
+			// the reference messages of the entries stored so far are never sent
+			for _, refMsg := range refMsgs {
+				wrapper.storage.deleteOrphan(ctx, refMsg, err)
+			}
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+
+		id := aws.ToString(input.Entries[i].Id)
+		entries[id] = *entry
+		if entry.refMsg != nil {
+			refMsgs[id] = entry.refMsg
+		}
+	}
+
+	// send batch and clean up the hefty messages of the entries that were not sent
+	out, err := wrapper.sqsClient().SendMessageBatch(ctx, &input, optFns...)
+	var failed []sqs_types.BatchResultErrorEntry
+	if out != nil {
+		failed = out.Failed
+	}
+	cleanups := wrapper.storage.cleanupFailedEntries(ctx, refMsgs, failed, err)
+	if err != nil {
+		if len(refMsgs) == 0 {
+			return out, err
+		}
+		return out, &SendBatchError{Err: err, Cleanups: cleanups}
+	}
+	if len(cleanups) > 0 {
+		out.ResultMetadata.Set(orphanCleanupsKey{}, cleanups)
+	}
+
+	for i := range out.Successful {
+		result := &out.Successful[i]
+		entry, ok := entries[aws.ToString(result.Id)]
+		if !ok {
+			continue
+		}
+
+		// tag hefty message with message id
+		if entry.refMsg != nil {
+			wrapper.storage.tagWithMessageId(ctx, entry.refMsg, result.MessageId, entry.tags)
+		}
+
+		// overwrite md5 values; the message attributes of compressed inline messages are sent as is
+		md5Attr := entry.md5Attr
+		if entry.compressed {
+			md5Attr = result.MD5OfMessageAttributes
+		}
+		wrapper.replaceMd5Digests(&out.ResultMetadata, result.MessageId, &result.MD5OfMessageBody, &result.MD5OfMessageAttributes, Md5Digests{Body: entry.md5Body, Attributes: md5Attr})
+	}
+
+	return out, nil
+}
+
+// prepareBatchEntry replaces the body of a batch entry with a compressed inline message or the reference message of its
+// hefty message as decided by the offload policy. It returns nil for entries that are sent as is.
+func (wrapper *SqsClientWrapper) prepareBatchEntry(ctx context.Context, queueUrl *string, entry *sqs_types.SendMessageBatchRequestEntry, optFns []func(*sqs.Options)) (*batchEntry, error) {
+	if entry.MessageBody == nil || len(*entry.MessageBody) == 0 {
+		return nil, nil
+	}
+
+	// normalize message attributes
+	msgAttributes := messages.MapFromSqsMessageAttributeValues(entry.MessageAttributes)
+
+	// calculate message size
+	msgSize, err := messages.MessageSize(entry.MessageBody, msgAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get size of batch entry %s. %v", aws.ToString(entry.Id), err)
+	}
+
+	// decide how to send the entry
+	decision, compressed, err := wrapper.offload.decide(ctx, aws.ToString(queueUrl), wrapper.alwaysSendToS3, wrapper.offload.threshold(limits.MaxMessageLength(limits.SQS)), entry.MessageBody, msgAttributes, msgSize)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case decision == OffloadInline:
+		return nil, nil
+	case decision == OffloadCompressedInline:
+		md5Body, _ := sqsMd5Digests(entry.MessageBody, nil)
+		entry.MessageBody = compressed
+		return &batchEntry{md5Body: md5Body, compressed: true}, nil
+	case msgSize > MaxHeftyMessageLengthBytes:
+		return nil, fmt.Errorf("size of batch entry %s of %d bytes greater than allowed message size of %d bytes", aws.ToString(entry.Id), msgSize, MaxHeftyMessageLengthBytes)
+	}
+
+	// tag hefty message with its expiration
+	tags, err := wrapper.expiry.tags(ctx, wrapper.sqsClient(), aws.ToString(queueUrl), optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	// store hefty message in payload store or s3
+	params := &sqs.SendMessageInput{
+		QueueUrl:                queueUrl,
+		MessageBody:             entry.MessageBody,
+		MessageAttributes:       entry.MessageAttributes,
+		MessageSystemAttributes: entry.MessageSystemAttributes,
+		DelaySeconds:            entry.DelaySeconds,
+		MessageGroupId:          entry.MessageGroupId,
+		MessageDeduplicationId:  entry.MessageDeduplicationId,
+	}
+	refMsg, heftyMsg, jsonRefMsg, err := wrapper.storeHeftyMessage(ctx, params, msgAttributes, msgSize, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	// replace body of the entry with reference message and clear out all message attributes
+	entry.MessageBody = aws.String(jsonRefMsg)
+	entry.MessageAttributes = nil
+
+	md5Body, md5Attr := sqsMd5Digests(heftyMsg.Body, heftyMsg.MessageAttributes)
+	return &batchEntry{refMsg: refMsg, tags: tags, md5Body: md5Body, md5Attr: md5Attr}, nil
+}
+
+// OrphanCleanups returns the cleanups of the hefty messages of the entries AWS SQS did not accept by entry id, from the
+// result metadata of the output of SendHeftyMessageBatch. It is empty when every entry was sent.
+func OrphanCleanups(metadata middleware.Metadata) map[string]OrphanCleanup {
+	cleanups, _ := metadata.Get(orphanCleanupsKey{}).(map[string]OrphanCleanup)
+	return cleanups
+}
@@ -0,0 +1,236 @@
+package hefty
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// SendHeftyMessageStream sends a hefty message with a body of `size` bytes read from `body` and message attributes
+// `msgAttributes` to the queue at `queueUrl`. The hefty message is uploaded to AWS S3 as it is read, without holding it
+// in memory, and is always stored in AWS S3 regardless of its size or a payload store. An error is returned when `body`
+// does not have exactly `size` bytes.
+//
+// Client side encryption, content addressable keys, shards and redaction need the whole hefty message, so they are not
+// supported.
+func (wrapper *SqsClientWrapper) SendHeftyMessageStream(ctx context.Context, queueUrl string, body io.Reader, size int64, msgAttributes map[string]sqs_types.MessageAttributeValue, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	optFns = wrapper.withOptFns(optFns)
+
+	if err := wrapper.storage.checkStreaming(); err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, errors.New("body is nil")
+	}
+
+	// calculate message size
+	attributes := messages.MapFromSqsMessageAttributeValues(msgAttributes)
+	attrSize, err := messages.MessageSize(nil, attributes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get size of message. %v", err)
+	}
+	if size < 0 || size+int64(attrSize) > MaxHeftyMessageLengthBytes {
+		return nil, fmt.Errorf("message size of %d bytes must be between 0 and %d bytes", size+int64(attrSize), MaxHeftyMessageLengthBytes)
+	}
+
+	// serialize message attributes; they follow the body in the serialized hefty message
+	attrMsg := messages.NewHeftyMessage(aws.String(""), attributes, attrSize)
+	serialized, _, msgAttrOffset, err := attrMsg.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("unable to serialize message. %v", err)
+	}
+	serializedAttributes := serialized[msgAttrOffset:]
+
+	var msgAttrHash string
+	if len(attributes) > 0 {
+		if msgAttrHash, err = messages.Digest(wrapper.storage.digestAlgorithm, serializedAttributes); err != nil {
+			return nil, fmt.Errorf("unable to create digest of message attributes. %v", err)
+		}
+	}
+
+	// create reference message; the digest of the body is added once it has been read
+	refMsg, err := newSqsReferenceMessage(&queueUrl, nil, wrapper.storage.keys, "", wrapper.storage.bucket, clientRegion(wrapper.sqsClient()), "", msgAttrHash)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create reference message from queueUrl. %v", err)
+	}
+	refMsg.DigestAlgorithm = wrapper.storage.digestAlgorithm
+	refMsg.Size = int64(msgAttrOffset) + size + int64(len(serializedAttributes))
+
+	// get tenant of hefty message
+	tenant := ""
+	if wrapper.tenants != nil {
+		tenant = wrapper.tenants(&sqs.SendMessageInput{QueueUrl: &queueUrl, MessageAttributes: msgAttributes})
+		if err = validateTenant(tenant); err != nil {
+			return nil, err
+		}
+	}
+
+	// tag hefty message with its expiration
+	tags, err := wrapper.expiry.tags(ctx, wrapper.sqsClient(), queueUrl, optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	// upload hefty message to s3 while digesting its body
+	bodyHash, err := messages.NewDigestHash(wrapper.storage.digestAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create digest of message body. %v", err)
+	}
+	md5Hash, _ := messages.NewDigestHash(messages.DigestMd5)
+	digests := io.MultiWriter(bodyHash)
+	if md5Hash != nil {
+		digests = io.MultiWriter(bodyHash, md5Hash)
+	}
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(size))
+	payload := io.MultiReader(
+		bytes.NewReader(length[:]),
+		io.TeeReader(&exactReader{reader: body, remaining: size}, digests),
+		bytes.NewReader(serializedAttributes),
+	)
+
+	err = wrapper.storage.putStream(ctx, queueUrl, tenant, refMsg, payload, int(refMsg.Size), newObjectMetadata(queueUrl, int(size), attrMsg), tags)
+	if err != nil {
+		return nil, err
+	}
+	refMsg.Md5DigestMsgBody = hex.EncodeToString(bodyHash.Sum(nil))
+
+	// send reference message to sqs
+	jsonRefMsg, err := json.Marshal(refMsg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal json message. %v", err)
+	}
+
+	out, err := wrapper.sqsClient().SendMessage(ctx, &sqs.SendMessageInput{QueueUrl: &queueUrl, MessageBody: aws.String(string(jsonRefMsg))}, optFns...)
+	if err != nil {
+		wrapper.storage.cleanupOrphan(ctx, refMsg, err)
+		return out, err
+	}
+
+	// tag hefty message with message id
+	wrapper.storage.tagWithMessageId(ctx, refMsg, out.MessageId, tags)
+
+	// overwrite md5 values
+	var md5Body *string
+	if md5Hash != nil {
+		md5Body = aws.String(hex.EncodeToString(md5Hash.Sum(nil)))
+	}
+	_, md5Attr := sqsMd5Digests(nil, attributes)
+	wrapper.replaceMd5Digests(&out.ResultMetadata, out.MessageId, &out.MD5OfMessageBody, &out.MD5OfMessageAttributes, Md5Digests{Body: md5Body, Attributes: md5Attr})
+
+	return out, nil
+}
+
+// checkStreaming returns an error when the payload storage is configured with options that need the whole hefty message
+func (storage *payloadStorage) checkStreaming() error {
+	switch {
+	case storage.clientEncryption != nil:
+		return errors.New("streaming hefty messages is not supported with client side encryption")
+	case storage.contentAddressable:
+		return errors.New("streaming hefty messages is not supported with content addressable keys")
+	case len(storage.shards) > 0:
+		return errors.New("streaming hefty messages is not supported with shards")
+	case storage.redactor != nil:
+		return errors.New("streaming hefty messages is not supported with redaction")
+	}
+
+	return nil
+}
+
+// putStream uploads a serialized hefty message of about `size` bytes read from `payload` to the AWS S3 bucket selected for
+// `target` and records its location in the reference message. A non-empty `tenant` is prepended to the key.
+func (storage *payloadStorage) putStream(ctx context.Context, target, tenant string, refMsg *types.ReferenceMsg, payload io.Reader, size int, metadata, tags map[string]string) error {
+	err := applyBucketSelector(refMsg, target, storage.bucketSelector)
+	if err != nil {
+		return err
+	}
+
+	// store hefty message under the prefix of its tenant
+	if tenant != "" {
+		refMsg.S3Key, err = tenantKey(tenant, refMsg.S3Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = storage.lazyBuckets.ensure(ctx, refMsg.S3Bucket); err != nil {
+		return err
+	}
+
+	payload, err = storage.transforms.applyReader(ctx, refMsg, payload)
+	if err != nil {
+		return err
+	}
+	if len(refMsg.Transforms) == 0 {
+		return storage.upload(ctx, refMsg, payload, size, metadata, tags)
+	}
+
+	// the size of a transformed hefty message is only known once it has been uploaded
+	counter := &countingReader{reader: payload}
+	if err = storage.upload(ctx, refMsg, counter, size, metadata, tags); err != nil {
+		return err
+	}
+	refMsg.StoredSize = counter.count
+
+	return nil
+}
+
+// countingReader counts the bytes read from a reader
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	reader.count += int64(n)
+	return n, err
+}
+
+// exactReader reads exactly `remaining` bytes from a reader and fails when it has fewer or more bytes, so that a
+// truncated or oversized body aborts the upload instead of storing a hefty message that does not match its size
+type exactReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (reader *exactReader) Read(p []byte) (int, error) {
+	if reader.remaining <= 0 {
+		// the body must be exhausted
+		var extra [1]byte
+		n, err := reader.reader.Read(extra[:])
+		if n > 0 {
+			return 0, errors.New("body has more bytes than its size")
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > reader.remaining {
+		p = p[:reader.remaining]
+	}
+	n, err := reader.reader.Read(p)
+	reader.remaining -= int64(n)
+	if err == io.EOF {
+		if reader.remaining > 0 {
+			return n, fmt.Errorf("body has fewer bytes than its size. %v", io.ErrUnexpectedEOF)
+		}
+		err = nil
+	}
+
+	return n, err
+}
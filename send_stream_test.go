@@ -0,0 +1,42 @@
+package hefty
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExactReader(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		size      int64
+		expectErr bool
+	}{
+		{name: "exact size", body: "hefty message", size: 13},
+		{name: "empty", body: "", size: 0},
+		{name: "fewer bytes", body: "hefty", size: 13, expectErr: true},
+		{name: "more bytes", body: "hefty message", size: 5, expectErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			read, err := io.ReadAll(&exactReader{reader: strings.NewReader(test.body), remaining: test.size})
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.body, string(read))
+		})
+	}
+}
+
+func TestCheckStreaming(t *testing.T) {
+	assert.NoError(t, (&payloadStorage{}).checkStreaming())
+	assert.Error(t, (&payloadStorage{contentAddressable: true}).checkStreaming())
+	assert.Error(t, (&payloadStorage{shards: []Shard{{Prefix: "a/"}}}).checkStreaming())
+}
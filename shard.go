@@ -0,0 +1,75 @@
+package hefty
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// Shard is a bucket and key prefix that hefty messages can be stored in. An empty bucket is the bucket of the client
+// wrapper. The prefix is prepended to the key of the hefty message and is used as is.
+type Shard struct {
+	Bucket string
+	Prefix string
+}
+
+// BucketSelector returns the bucket and key prefix that hefty messages sent to the AWS SQS queue url or AWS SNS topic arn
+// `queueUrlOrTopicArn` are stored in. An empty bucket is the bucket of the client wrapper. The prefix is prepended to the
+// key of the hefty message and is used as is.
+type BucketSelector func(queueUrlOrTopicArn string) (bucket, prefix string)
+
+// ShardSelector returns the index of the shard, in the range [0, numShards), that a serialized hefty message is stored in
+type ShardSelector func(serialized []byte, numShards int) int
+
+// HashSharding selects a shard by hashing the serialized hefty message. Identical hefty messages are always stored in
+// the same shard, which keeps WithContentAddressableKeys effective.
+func HashSharding() ShardSelector {
+	return func(serialized []byte, numShards int) int {
+		hash := fnv.New32a()
+		_, _ = hash.Write(serialized)
+		return int(hash.Sum32() % uint32(numShards))
+	}
+}
+
+// RoundRobinSharding selects each shard in turn, which spreads request rates evenly over the shards
+func RoundRobinSharding() ShardSelector {
+	var next atomic.Uint64
+	return func(_ []byte, numShards int) int {
+		return int((next.Add(1) - 1) % uint64(numShards))
+	}
+}
+
+// applyShard records the shard selected for a serialized hefty message in the reference message
+func applyShard(refMsg *types.ReferenceMsg, serialized []byte, shards []Shard, selector ShardSelector) {
+	if len(shards) == 0 {
+		return
+	}
+
+	shard := shards[selector(serialized, len(shards))]
+	if shard.Bucket != "" {
+		refMsg.S3Bucket = shard.Bucket
+	}
+	refMsg.S3Key = shard.Prefix + refMsg.S3Key
+}
+
+// applyBucketSelector records the bucket and key prefix selected for the queue url or topic arn `target` in the
+// reference message
+func applyBucketSelector(refMsg *types.ReferenceMsg, target string, selector BucketSelector) error {
+	if selector == nil {
+		return nil
+	}
+
+	bucket, prefix := selector(target)
+	if strings.Contains(bucket, "|") || strings.Contains(prefix, "|") {
+		return fmt.Errorf("selected bucket %s and prefix %s must not contain '|'", bucket, prefix)
+	}
+
+	if bucket != "" {
+		refMsg.S3Bucket = bucket
+	}
+	refMsg.S3Key = prefix + refMsg.S3Key
+	return nil
+}
@@ -0,0 +1,75 @@
+package hefty
+
+import (
+	"testing"
+
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyShard(t *testing.T) {
+	shards := []Shard{
+		{Bucket: "bucket-a", Prefix: "a/"},
+		{Prefix: "b/"},
+	}
+
+	var tests = []struct {
+		desc      string
+		shards    []Shard
+		selector  ShardSelector
+		expBucket string
+		expKey    string
+	}{
+		{desc: "no_shards", selector: HashSharding(), expBucket: "bucket", expKey: "queue/id"},
+		{desc: "shard_with_bucket", shards: shards, selector: func([]byte, int) int { return 0 }, expBucket: "bucket-a", expKey: "a/queue/id"},
+		{desc: "shard_without_bucket", shards: shards, selector: func([]byte, int) int { return 1 }, expBucket: "bucket", expKey: "b/queue/id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			refMsg := &types.ReferenceMsg{S3Bucket: "bucket", S3Key: "queue/id"}
+			applyShard(refMsg, []byte("hefty message"), tt.shards, tt.selector)
+			assert.Equal(t, tt.expBucket, refMsg.S3Bucket)
+			assert.Equal(t, tt.expKey, refMsg.S3Key)
+		})
+	}
+}
+
+func TestShardSelectors(t *testing.T) {
+	hash := HashSharding()
+	assert.Equal(t, hash([]byte("hefty message"), 3), hash([]byte("hefty message"), 3))
+
+	roundRobin := RoundRobinSharding()
+	for i := 0; i < 6; i++ {
+		assert.Equal(t, i%3, roundRobin(nil, 3))
+	}
+}
+
+func TestApplyBucketSelector(t *testing.T) {
+	var tests = []struct {
+		desc      string
+		selector  BucketSelector
+		expBucket string
+		expKey    string
+		expErr    bool
+	}{
+		{desc: "no_selector", expBucket: "bucket", expKey: "queue/id"},
+		{desc: "selected_bucket_and_prefix", selector: func(string) (string, string) { return "pii-bucket", "pii/" }, expBucket: "pii-bucket", expKey: "pii/queue/id"},
+		{desc: "selected_prefix_only", selector: func(string) (string, string) { return "", "pii/" }, expBucket: "bucket", expKey: "pii/queue/id"},
+		{desc: "invalid_prefix", selector: func(string) (string, string) { return "", "pii|" }, expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			refMsg := &types.ReferenceMsg{S3Bucket: "bucket", S3Key: "queue/id"}
+			err := applyBucketSelector(refMsg, "https://sqs.us-west-2.amazonaws.com/765908583888/queue", tt.selector)
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expBucket, refMsg.S3Bucket)
+			assert.Equal(t, tt.expKey, refMsg.S3Key)
+		})
+	}
+}
@@ -1,31 +1,30 @@
 package hefty
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/jo-parker/sqs-hefty/types"
-	"log"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
-	"github.com/google/uuid"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/jo-parker/sqs-hefty/internal/messages"
-	"github.com/jo-parker/sqs-hefty/internal/utils"
+	"github.com/jo-parker/sqs-hefty/limits"
+	"github.com/jo-parker/sqs-hefty/types"
 )
 
 type SnsClientWrapper struct {
 	sns.Client
-	bucket         string
-	s3Client       *s3.Client
-	uploader       *s3manager.Uploader
-	downloader     *s3manager.Downloader
+	storage        *payloadStorage
 	alwaysSendToS3 bool
+	topics         map[string]TopicConfig
+	offload        OffloadPolicy
+	tenants        TenantExtractor
+	snsOptFns      []func(*sns.Options)
+	api            SnsAPI // client given to NewSnsClientWrapperFromAPI that is not an *sns.Client
 }
 
 // NewSnsClientWrapper will create a new Hefty SNS client wrapper using an existing AWS SNS client and AWS S3 client.
@@ -33,36 +32,58 @@ type SnsClientWrapper struct {
 // bucket that is specified via `bucketName`. The S3 client should have the ability of reading and writing to this bucket.
 // This function will also check if the bucket exists and is accessible.
 func NewSnsClientWrapper(snsClient *sns.Client, s3Client *s3.Client, bucketName string, opts ...Option) (*SnsClientWrapper, error) {
-	// check if bucket exits
-	if ok, err := utils.BucketExists(s3Client, bucketName); !ok {
+	return NewSnsClientWrapperFromAPI(snsClient, s3Client, bucketName, opts...)
+}
+
+// NewSnsClientWrapperFromAPI creates a Hefty SNS client wrapper like NewSnsClientWrapper from clients that only need the
+// operations the wrapper uses, e.g. fakes or instrumented clients. The embedded sns.Client of the wrapper is only set when
+// `snsClient` is an *sns.Client, so the methods of the wrapper must be used otherwise.
+func NewSnsClientWrapperFromAPI(snsClient SnsAPI, s3Client S3API, bucketName string, opts ...Option) (*SnsClientWrapper, error) {
+	// process available options
+	wrapperOptions := defaultOptions()
+	for _, opt := range opts {
+		err := opt(&wrapperOptions)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		return nil, fmt.Errorf("bucket %s does not exist or is not accessible", bucketName)
+	var snsOptFns []func(*sns.Options)
+	if wrapperOptions.messagingRetryTokens != nil {
+		snsOptFns = append(snsOptFns, snsRetryTokenOption(wrapperOptions.messagingRetryTokens))
 	}
 
-	wrapper := &SnsClientWrapper{
-		Client:     *snsClient,
-		bucket:     bucketName,
-		s3Client:   s3Client,
-		uploader:   s3manager.NewUploader(s3Client),
-		downloader: s3manager.NewDownloader(s3Client),
+	storage, err := newPayloadStorage(s3Client, bucketName, &wrapperOptions)
+	if err != nil {
+		return nil, err
 	}
 
-	// process available options
-	var wrapperOptions options
-	for _, opt := range opts {
-		err := opt(&wrapperOptions)
-		if err != nil {
-			return nil, err
-		}
+	wrapper := &SnsClientWrapper{
+		storage:        storage,
+		alwaysSendToS3: wrapperOptions.alwaysSendToS3,
+		topics:         wrapperOptions.topics,
+		offload:        wrapperOptions.offload,
+		tenants:        wrapperOptions.tenants,
+		snsOptFns:      snsOptFns,
+	}
+	if client, ok := snsClient.(*sns.Client); ok {
+		wrapper.Client = *client
+	} else {
+		wrapper.api = snsClient
 	}
-	wrapper.alwaysSendToS3 = wrapperOptions.alwaysSendToS3
 
 	return wrapper, nil
 }
 
+// snsClient returns the AWS SNS client of the wrapper
+func (wrapper *SnsClientWrapper) snsClient() SnsAPI {
+	if wrapper.api != nil {
+		return wrapper.api
+	}
+
+	return &wrapper.Client
+}
+
 // PublishHeftyMessage will calculate the messages size from `params` and determine if the MaxSqsSnsMessageLengthBytes is exceeded.
 // If so, the message is saved in AWS S3 as a hefty message and a reference message is sent to AWS SNS instead.
 // If not, the message is directly sent to AWS SNS.
@@ -75,12 +96,14 @@ func NewSnsClientWrapper(snsClient *sns.Client, s3Client *s3.Client, bucketName
 //
 // Note that this function's signature matches that of the AWS SNS SDK's Publish method.
 func (wrapper *SnsClientWrapper) PublishHeftyMessage(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	optFns = wrapper.withOptFns(optFns)
+
 	// input validation; if invalid input let AWS SDK handle it
 	if params == nil ||
 		params.Message == nil ||
 		len(*params.Message) == 0 {
 
-		return wrapper.Publish(ctx, params, optFns...)
+		return wrapper.snsClient().Publish(ctx, params, optFns...)
 	}
 
 	// normalize message attributes
@@ -92,15 +115,52 @@ func (wrapper *SnsClientWrapper) PublishHeftyMessage(ctx context.Context, params
 		return nil, fmt.Errorf("unable to get size of message. %v", err)
 	}
 
-	// validate message size
-	if !wrapper.alwaysSendToS3 && msgSize <= MaxAwsMessageLengthBytes {
-		return wrapper.Publish(ctx, params, optFns...)
-	} else if msgSize > MaxHeftyMessageLengthBytes {
+	// resolve topic configuration
+	topic := wrapper.topics[aws.ToString(params.TopicArn)]
+
+	threshold := wrapper.offload.threshold(limits.MaxMessageLength(limits.SNS))
+	if topic.Threshold > 0 {
+		threshold = topic.threshold()
+	}
+
+	// decide how to publish the message
+	decision, compressed, err := wrapper.offload.decide(ctx, aws.ToString(params.TopicArn), wrapper.alwaysSendToS3, threshold, params.Message, msgAttributes, msgSize)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case decision == OffloadInline:
+		return wrapper.snsClient().Publish(ctx, params, optFns...)
+	case decision == OffloadCompressedInline:
+		origMsg := params.Message
+		params.Message = compressed
+		defer func() {
+			params.Message = origMsg
+		}()
+
+		return wrapper.snsClient().Publish(ctx, params, optFns...)
+	case msgSize > MaxHeftyMessageLengthBytes:
 		return nil, fmt.Errorf("message size of %d bytes greater than allowed message size of %d bytes", msgSize, MaxHeftyMessageLengthBytes)
 	}
 
+	// replace overwritten values with original values
+	origMsg, origMsgAttr := params.Message, params.MessageAttributes
+	defer func() {
+		params.Message = origMsg
+		params.MessageAttributes = origMsgAttr
+	}()
+
+	// redact message before it is stored
+	body, err := wrapper.storage.redact(ctx, aws.ToString(params.TopicArn), params.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	origMsgSize := len(*body)
+
 	sqsRefMsg := types.SQSMessage{
-		Message: *params.Message,
+		Message: *body,
 	}
 
 	jsonSQSRefMsg, err := json.Marshal(sqsRefMsg)
@@ -112,32 +172,50 @@ func (wrapper *SnsClientWrapper) PublishHeftyMessage(ctx context.Context, params
 
 	// create and serialize hefty message
 	heftyMsg := messages.NewHeftyMessage(params.Message, msgAttributes, msgSize)
-	serialized, bodyOffset, msgAttrOffset, err := heftyMsg.Serialize()
+	serialized, _, _, err := heftyMsg.Serialize()
 	if err != nil {
 		return nil, fmt.Errorf("unable to serialize message. %v", err)
 	}
 
-	// create md5 digests
-	msgBodyHash := messages.Md5Digest(serialized[bodyOffset:msgAttrOffset])
-	msgAttrHash := ""
-	if len(heftyMsg.MessageAttributes) > 0 {
-		msgAttrHash = messages.Md5Digest(serialized[msgAttrOffset:])
+	// create digests
+	msgBodyHash, msgAttrHash, err := messageDigests(wrapper.storage.digestAlgorithm, serialized, heftyMsg)
+	if err != nil {
+		return nil, err
 	}
 
 	// create reference message
-	refMsg, err := newSnsReferenceMessage(params.TopicArn, wrapper.bucket, wrapper.Options().Region, msgBodyHash, msgAttrHash)
+	refMsg, err := newSnsReferenceMessage(params.TopicArn, params.MessageGroupId, wrapper.storage.keys, wrapper.storage.contentDigest(serialized), wrapper.storage.bucket, clientRegion(wrapper.snsClient()), msgBodyHash, msgAttrHash)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create reference message from topicArn. %v", err)
 	}
+	refMsg.DigestAlgorithm = wrapper.storage.digestAlgorithm
+	refMsg.Size = int64(len(serialized))
 
-	// upload hefty message to s3
-	_, err = wrapper.uploader.Upload(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(wrapper.bucket),
-		Key:    aws.String(refMsg.S3Key),
-		Body:   bytes.NewReader(serialized),
-	})
+	// tag hefty message with its expiration
+	tags, err := payloadTtlTags(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("unable to upload hefty message to s3. %v", err)
+		return nil, err
+	}
+
+	// get tenant of hefty message
+	tenant := ""
+	if wrapper.tenants != nil {
+		tenant = wrapper.tenants(&sqs.SendMessageInput{
+			QueueUrl:               params.TopicArn,
+			MessageBody:            origMsg,
+			MessageAttributes:      messages.MapToSqsMessageAttributeValues(msgAttributes),
+			MessageGroupId:         params.MessageGroupId,
+			MessageDeduplicationId: params.MessageDeduplicationId,
+		})
+		if err = validateTenant(tenant); err != nil {
+			return nil, err
+		}
+	}
+
+	// put hefty message in payload store or upload it to s3
+	err = wrapper.storage.put(ctx, aws.ToString(params.TopicArn), tenant, refMsg, serialized, newObjectMetadata(aws.ToString(params.TopicArn), origMsgSize, heftyMsg), tags)
+	if err != nil {
+		return nil, err
 	}
 
 	// replace incoming message body with reference message
@@ -162,28 +240,30 @@ func (wrapper *SnsClientWrapper) PublishHeftyMessage(ctx context.Context, params
 
 	params.Message = aws.String(refMsgStr)
 
-	// clear out all message attributes
-	orgMsgAttr := params.MessageAttributes
-	params.MessageAttributes = nil
-
-	// replace overwritten values with original values
-	defer func() {
-		params.Message = heftyMsg.Body
-		params.MessageAttributes = orgMsgAttr
-	}()
-
-	log.Printf("%+v", &params)
+	// clear out all message attributes unless they are preserved for the topic
+	if !topic.PreserveAttributes {
+		params.MessageAttributes = nil
+	}
 
-	out, err := wrapper.Publish(ctx, params, optFns...)
+	out, err := wrapper.snsClient().Publish(ctx, params, optFns...)
 	if err != nil {
+		wrapper.storage.cleanupOrphan(ctx, refMsg, err)
 		return out, err
 	}
 
+	// tag hefty message with message id
+	wrapper.storage.tagWithMessageId(ctx, refMsg, out.MessageId, tags)
+
 	return out, err
 }
 
+// withOptFns returns the AWS SNS SDK options of a call followed by the options configured on the wrapper
+func (wrapper *SnsClientWrapper) withOptFns(optFns []func(*sns.Options)) []func(*sns.Options) {
+	return append(append([]func(*sns.Options){}, optFns...), wrapper.snsOptFns...)
+}
+
 // Example topicArn: arn:aws:sns:us-west-2:765908583888:MyTopic
-func newSnsReferenceMessage(topicArn *string, bucketName, region, msgBodyHash, msgAttrHash string) (*types.ReferenceMsg, error) {
+func newSnsReferenceMessage(topicArn, messageGroupId *string, keys keyGenerator, contentDigest, bucketName, region, msgBodyHash, msgAttrHash string) (*types.ReferenceMsg, error) {
 	const expectedTokenCount = 6
 
 	if topicArn != nil {
@@ -191,10 +271,16 @@ func newSnsReferenceMessage(topicArn *string, bucketName, region, msgBodyHash, m
 		if len(tokens) != expectedTokenCount {
 			return nil, fmt.Errorf("expected %d tokens when splitting topicArn by ':' but received %d", expectedTokenCount, len(tokens))
 		} else {
+			// S3Key: accountId/id unless a key prefix or template is configured
+			key, err := keys.newKey(tokens[4], tokens[5], messageGroupId, contentDigest)
+			if err != nil {
+				return nil, err
+			}
+
 			return types.NewReferenceMsg(
 				region,
 				bucketName,
-				fmt.Sprintf("%s/%s", tokens[4], uuid.New().String()), // S3Key: topicArn/uuid,
+				key,
 				msgBodyHash,
 				msgAttrHash), nil
 		}
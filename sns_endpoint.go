@@ -0,0 +1,368 @@
+package hefty
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSNSRequestBytes bounds the body of a request to an SNS endpoint. Notifications are at most 256KB plus their
+	// envelope.
+	maxSNSRequestBytes = 1 << 20
+	defaultSNSMaxAge   = time.Hour
+)
+
+// snsHost matches the hosts of the signing certificates and subscribe urls of AWS SNS
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// SNSHTTPMessage is the json body of a request AWS SNS makes to an HTTP or HTTPS subscription endpoint
+type SNSHTTPMessage struct {
+	Type              string                 `json:"Type"`
+	MessageId         string                 `json:"MessageId"`
+	Token             string                 `json:"Token,omitempty"`
+	TopicArn          string                 `json:"TopicArn"`
+	Subject           string                 `json:"Subject,omitempty"`
+	Message           string                 `json:"Message"`
+	MessageAttributes map[string]interface{} `json:"MessageAttributes,omitempty"`
+	Timestamp         string                 `json:"Timestamp"`
+	SignatureVersion  string                 `json:"SignatureVersion"`
+	Signature         string                 `json:"Signature"`
+	SigningCertURL    string                 `json:"SigningCertURL"`
+	SubscribeURL      string                 `json:"SubscribeURL,omitempty"`
+	UnsubscribeURL    string                 `json:"UnsubscribeURL,omitempty"`
+}
+
+// SNSEndpointConfig configures SNSEndpoint
+type SNSEndpointConfig struct {
+	// Client downloads signing certificates and confirms subscriptions. http.DefaultClient is used when nil.
+	Client *http.Client
+	// TopicArns are the topics whose messages are accepted. Messages of all topics are accepted when empty.
+	TopicArns []string
+	// MaxAge is how far the timestamp of a message may be from the current time before it is rejected, so that captured
+	// messages cannot be replayed. 1 hour is used when 0.
+	MaxAge time.Duration
+	// OnError is called with the error of every request that was rejected or could not be handled. Errors are dropped
+	// when nil.
+	OnError func(err error)
+}
+
+// snsEndpoint is the http.Handler returned by SNSEndpoint
+type snsEndpoint struct {
+	wrapper *SnsClientWrapper
+	next    http.Handler
+	config  SNSEndpointConfig
+	now     func() time.Time
+
+	mu           sync.Mutex
+	certificates map[string]*x509.Certificate
+}
+
+// SNSEndpoint returns an http.Handler for an HTTP or HTTPS subscription to an AWS SNS topic. It validates the signature of
+// every request, confirms subscriptions, and resolves the hefty messages of notifications before passing them to `next`.
+// The request passed to `next` has the json of an SNSHTTPMessage with the original message and message attributes:
+//
+//	http.Handle("/sns", snsHeftyClient.SNSEndpoint(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//		var msg hefty.SNSHTTPMessage
+//		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+//			http.Error(w, err.Error(), http.StatusBadRequest)
+//			return
+//		}
+//		// handle msg.Message
+//	}), hefty.SNSEndpointConfig{TopicArns: []string{topicArn}}))
+//
+// Requests that are not signed by AWS SNS are rejected, so subscriptions must not use raw message delivery, and so are
+// messages whose timestamp is more than the max age from the current time. A notification
+// whose hefty message cannot be resolved fails with a server error, which makes AWS SNS retry its delivery.
+func (wrapper *SnsClientWrapper) SNSEndpoint(next http.Handler, config SNSEndpointConfig) http.Handler {
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = defaultSNSMaxAge
+	}
+
+	return &snsEndpoint{
+		wrapper:      wrapper,
+		next:         next,
+		config:       config,
+		now:          time.Now,
+		certificates: map[string]*x509.Certificate{},
+	}
+}
+
+func (endpoint *snsEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		endpoint.reject(w, http.StatusMethodNotAllowed, fmt.Errorf("unable to handle %s request", r.Method))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSNSRequestBytes))
+	if err != nil {
+		endpoint.reject(w, http.StatusBadRequest, fmt.Errorf("unable to read request. %v", err))
+		return
+	}
+
+	var msg SNSHTTPMessage
+	if err = json.Unmarshal(body, &msg); err != nil {
+		endpoint.reject(w, http.StatusBadRequest, fmt.Errorf("unable to unmarshal request. %v", err))
+		return
+	}
+
+	if !endpoint.acceptsTopic(msg.TopicArn) {
+		endpoint.reject(w, http.StatusForbidden, fmt.Errorf("topic %s is not accepted", msg.TopicArn))
+		return
+	}
+
+	if err = endpoint.verify(r.Context(), &msg); err != nil {
+		endpoint.reject(w, http.StatusForbidden, fmt.Errorf("unable to verify signature of message %s. %v", msg.MessageId, err))
+		return
+	}
+
+	// the timestamp is signed, so a message cannot be replayed with a new one
+	if err = endpoint.checkTimestamp(msg.Timestamp); err != nil {
+		endpoint.reject(w, http.StatusForbidden, fmt.Errorf("unable to accept message %s. %v", msg.MessageId, err))
+		return
+	}
+
+	switch msg.Type {
+	case "SubscriptionConfirmation":
+		if err = endpoint.confirm(r.Context(), &msg); err != nil {
+			endpoint.reject(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case "UnsubscribeConfirmation":
+		w.WriteHeader(http.StatusOK)
+	case "Notification":
+		if err = endpoint.wrapper.resolveSNSMessage(r.Context(), msg.TopicArn, &msg.Message, &msg.MessageAttributes); err != nil {
+			endpoint.reject(w, http.StatusInternalServerError, fmt.Errorf("unable to resolve message %s. %v", msg.MessageId, err))
+			return
+		}
+
+		resolved, err := json.Marshal(msg)
+		if err != nil {
+			endpoint.reject(w, http.StatusInternalServerError, fmt.Errorf("unable to marshal message %s. %v", msg.MessageId, err))
+			return
+		}
+
+		r = r.Clone(r.Context())
+		r.Body = io.NopCloser(bytes.NewReader(resolved))
+		r.ContentLength = int64(len(resolved))
+		endpoint.next.ServeHTTP(w, r)
+	default:
+		endpoint.reject(w, http.StatusBadRequest, fmt.Errorf("unable to handle message type %s", msg.Type))
+	}
+}
+
+// reject responds with `status` and reports `err`
+func (endpoint *snsEndpoint) reject(w http.ResponseWriter, status int, err error) {
+	if endpoint.config.OnError != nil {
+		endpoint.config.OnError(err)
+	}
+
+	http.Error(w, http.StatusText(status), status)
+}
+
+// acceptsTopic checks whether the messages of the topic `topicArn` are accepted
+func (endpoint *snsEndpoint) acceptsTopic(topicArn string) bool {
+	if len(endpoint.config.TopicArns) == 0 {
+		return true
+	}
+
+	for _, accepted := range endpoint.config.TopicArns {
+		if accepted == topicArn {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkTimestamp checks that `timestamp` is within the max age of the current time
+func (endpoint *snsEndpoint) checkTimestamp(timestamp string) error {
+	sent, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp '%s'. %v", timestamp, err)
+	}
+
+	if age := endpoint.now().Sub(sent); age > endpoint.config.MaxAge || age < -endpoint.config.MaxAge {
+		return fmt.Errorf("timestamp %s is more than %s from the current time", timestamp, endpoint.config.MaxAge)
+	}
+
+	return nil
+}
+
+// confirm confirms a subscription by visiting its subscribe url
+func (endpoint *snsEndpoint) confirm(ctx context.Context, msg *SNSHTTPMessage) error {
+	if err := checkSNSUrl(msg.SubscribeURL); err != nil {
+		return fmt.Errorf("unable to confirm subscription to %s. %v", msg.TopicArn, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, msg.SubscribeURL, nil)
+	if err != nil {
+		return fmt.Errorf("unable to confirm subscription to %s. %v", msg.TopicArn, err)
+	}
+
+	resp, err := endpoint.config.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to confirm subscription to %s. %v", msg.TopicArn, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to confirm subscription to %s. status %d", msg.TopicArn, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// verify verifies the signature of a message with the signing certificate of AWS SNS
+func (endpoint *snsEndpoint) verify(ctx context.Context, msg *SNSHTTPMessage) error {
+	var hash crypto.Hash
+	switch msg.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("unsupported signature version '%s'", msg.SignatureVersion)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return fmt.Errorf("unable to decode signature. %v", err)
+	}
+
+	certificate, err := endpoint.certificate(ctx, msg.SigningCertURL)
+	if err != nil {
+		return err
+	}
+
+	publicKey, ok := certificate.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("signing certificate has no rsa public key")
+	}
+
+	var digest []byte
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum(snsStringToSign(msg))
+		digest = sum[:]
+	} else {
+		sum := sha256.Sum256(snsStringToSign(msg))
+		digest = sum[:]
+	}
+
+	return rsa.VerifyPKCS1v15(publicKey, hash, digest, signature)
+}
+
+// certificate returns the signing certificate at `certUrl`, which is downloaded once
+func (endpoint *snsEndpoint) certificate(ctx context.Context, certUrl string) (*x509.Certificate, error) {
+	if err := checkSNSUrl(certUrl); err != nil {
+		return nil, fmt.Errorf("invalid signing certificate url. %v", err)
+	}
+
+	endpoint.mu.Lock()
+	certificate, ok := endpoint.certificates[certUrl]
+	endpoint.mu.Unlock()
+	if ok {
+		return certificate, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, certUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get signing certificate. %v", err)
+	}
+
+	resp, err := endpoint.config.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get signing certificate. %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to get signing certificate. status %d", resp.StatusCode)
+	}
+
+	encoded, err := io.ReadAll(io.LimitReader(resp.Body, maxSNSRequestBytes))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get signing certificate. %v", err)
+	}
+
+	block, _ := pem.Decode(encoded)
+	if block == nil {
+		return nil, errors.New("unable to decode signing certificate")
+	}
+
+	certificate, err = x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse signing certificate. %v", err)
+	}
+
+	endpoint.mu.Lock()
+	endpoint.certificates[certUrl] = certificate
+	endpoint.mu.Unlock()
+
+	return certificate, nil
+}
+
+// checkSNSUrl checks that `rawUrl` is an https url of AWS SNS, so that neither a forged certificate nor a forged
+// subscribe url is requested
+func checkSNSUrl(rawUrl string) error {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+
+	if parsed.Scheme != "https" || !snsHost.MatchString(parsed.Hostname()) {
+		return fmt.Errorf("%s is not an AWS SNS url", rawUrl)
+	}
+
+	return nil
+}
+
+// snsStringToSign returns the string AWS SNS signs for a message
+func snsStringToSign(msg *SNSHTTPMessage) []byte {
+	var buf bytes.Buffer
+	add := func(key, value string) {
+		buf.WriteString(key)
+		buf.WriteByte('\n')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+
+	add("Message", msg.Message)
+	add("MessageId", msg.MessageId)
+	if msg.Type == "Notification" {
+		if msg.Subject != "" {
+			add("Subject", msg.Subject)
+		}
+		add("Timestamp", msg.Timestamp)
+		add("TopicArn", msg.TopicArn)
+		add("Type", msg.Type)
+		return buf.Bytes()
+	}
+
+	add("SubscribeURL", msg.SubscribeURL)
+	add("Timestamp", msg.Timestamp)
+	add("Token", msg.Token)
+	add("TopicArn", msg.TopicArn)
+	add("Type", msg.Type)
+
+	return buf.Bytes()
+}
@@ -0,0 +1,185 @@
+package hefty
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSigningCertURL = "https://sns.us-west-2.amazonaws.com/SimpleNotificationService.pem"
+
+// fakeSNSTransport serves the signing certificate and records the visited urls
+type fakeSNSTransport struct {
+	certificate []byte
+	visited     []string
+}
+
+func (transport *fakeSNSTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.visited = append(transport.visited, req.URL.String())
+	body := []byte("<ConfirmSubscriptionResponse/>")
+	if req.URL.String() == testSigningCertURL {
+		body = transport.certificate
+	}
+
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body)), Request: req}, nil
+}
+
+// newSNSSigner returns a key and a transport serving its self-signed certificate
+func newSNSSigner(t *testing.T) (*rsa.PrivateKey, *fakeSNSTransport) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	return key, &fakeSNSTransport{certificate: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// signSNSMessage signs a message the way AWS SNS does
+func signSNSMessage(t *testing.T, key *rsa.PrivateKey, msg *SNSHTTPMessage) {
+	msg.SigningCertURL = testSigningCertURL
+
+	var signature []byte
+	var err error
+	if msg.SignatureVersion == "1" {
+		digest := sha1.Sum(snsStringToSign(msg))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, digest[:])
+	} else {
+		digest := sha256.Sum256(snsStringToSign(msg))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	}
+	assert.NoError(t, err)
+
+	msg.Signature = base64.StdEncoding.EncodeToString(signature)
+}
+
+func TestSNSEndpoint(t *testing.T) {
+	key, transport := newSNSSigner(t)
+	store := &memoryStore{payloads: map[string][]byte{}}
+	wrapper, snsClient := newPublishingWrapper(t, store)
+	topicArn := "arn:aws:sns:us-west-2:765908583888:MyTopic"
+
+	tests := []struct {
+		name       string
+		msg        SNSHTTPMessage
+		forge      func(msg *SNSHTTPMessage)
+		status     int
+		handled    string
+		attributes map[string]interface{}
+		visited    string
+	}{
+		{
+			name:    "plain notification",
+			msg:     SNSHTTPMessage{Type: "Notification", TopicArn: topicArn, Message: "plain message", SignatureVersion: "1"},
+			status:  http.StatusOK,
+			handled: "plain message",
+		},
+		{
+			name:       "hefty notification",
+			msg:        SNSHTTPMessage{Type: "Notification", TopicArn: topicArn, Subject: "subject", Message: publishedMessage(t, wrapper, snsClient, topicArn, "hefty message"), SignatureVersion: "2"},
+			status:     http.StatusOK,
+			handled:    "hefty message",
+			attributes: map[string]interface{}{"attr": map[string]interface{}{"Type": "String", "Value": "value"}},
+		},
+		{
+			name:    "subscription confirmation",
+			msg:     SNSHTTPMessage{Type: "SubscriptionConfirmation", TopicArn: topicArn, Token: "token", SubscribeURL: "https://sns.us-west-2.amazonaws.com/?Action=ConfirmSubscription", SignatureVersion: "1"},
+			status:  http.StatusOK,
+			visited: "https://sns.us-west-2.amazonaws.com/?Action=ConfirmSubscription",
+		},
+		{
+			name:   "forged subscribe url",
+			msg:    SNSHTTPMessage{Type: "SubscriptionConfirmation", TopicArn: topicArn, Token: "token", SubscribeURL: "https://example.com/", SignatureVersion: "1"},
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "tampered message",
+			msg:    SNSHTTPMessage{Type: "Notification", TopicArn: topicArn, Message: "plain message", SignatureVersion: "1"},
+			forge:  func(msg *SNSHTTPMessage) { msg.Message = "tampered message" },
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "forged certificate url",
+			msg:    SNSHTTPMessage{Type: "Notification", TopicArn: topicArn, Message: "plain message", SignatureVersion: "1"},
+			forge:  func(msg *SNSHTTPMessage) { msg.SigningCertURL = "https://sns.example.com/cert.pem" },
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "replayed notification",
+			msg:    SNSHTTPMessage{Type: "Notification", TopicArn: topicArn, Message: "plain message", Timestamp: time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339), SignatureVersion: "1"},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "timestamp in the future",
+			msg:    SNSHTTPMessage{Type: "Notification", TopicArn: topicArn, Message: "plain message", Timestamp: time.Now().Add(2 * time.Hour).UTC().Format(time.RFC3339), SignatureVersion: "1"},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "invalid timestamp",
+			msg:    SNSHTTPMessage{Type: "Notification", TopicArn: topicArn, Message: "plain message", Timestamp: "yesterday", SignatureVersion: "1"},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "topic not accepted",
+			msg:    SNSHTTPMessage{Type: "Notification", TopicArn: "arn:aws:sns:us-west-2:765908583888:OtherTopic", Message: "plain message", SignatureVersion: "1"},
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport.visited = nil
+			if test.msg.Timestamp == "" {
+				test.msg.Timestamp = time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+			}
+			signSNSMessage(t, key, &test.msg)
+			if test.forge != nil {
+				test.forge(&test.msg)
+			}
+
+			var handled *SNSHTTPMessage
+			endpoint := wrapper.SNSEndpoint(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled = &SNSHTTPMessage{}
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(handled))
+			}), SNSEndpointConfig{Client: &http.Client{Transport: transport}, TopicArns: []string{topicArn}})
+
+			body, err := json.Marshal(test.msg)
+			assert.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			endpoint.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/sns", bytes.NewReader(body)))
+
+			assert.Equal(t, test.status, recorder.Code)
+			if test.handled != "" {
+				assert.Equal(t, test.handled, handled.Message)
+				assert.Equal(t, test.attributes, handled.MessageAttributes)
+			} else {
+				assert.Nil(t, handled)
+			}
+			if test.visited != "" {
+				assert.Contains(t, transport.visited, test.visited)
+			}
+		})
+	}
+}
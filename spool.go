@@ -0,0 +1,221 @@
+package hefty
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// SpooledMessage is the body of a message read from a temporary file instead of memory, see OpenHeftyMessage. It must be
+// closed to remove the file.
+type SpooledMessage struct {
+	// Size is the number of bytes of the message body
+	Size int64
+	// MessageAttributes are the message attributes of the hefty message, or of the message itself when it is not a hefty
+	// message
+	MessageAttributes map[string]sqs_types.MessageAttributeValue
+
+	body io.ReadSeeker
+	file *os.File
+}
+
+// Read reads the message body
+func (msg *SpooledMessage) Read(p []byte) (int, error) {
+	return msg.body.Read(p)
+}
+
+// Seek sets the offset of the next Read of the message body
+func (msg *SpooledMessage) Seek(offset int64, whence int) (int64, error) {
+	return msg.body.Seek(offset, whence)
+}
+
+// Close removes the temporary file of the message body
+func (msg *SpooledMessage) Close() error {
+	if msg.file == nil {
+		return nil
+	}
+
+	return errors.Join(msg.file.Close(), os.Remove(msg.file.Name()))
+}
+
+// OpenHeftyMessage spools the hefty message of a message received from the queue at `queueUrl` by ReceiveHeftyMessage to
+// a temporary file and returns a reader of its body, e.g. for a message left unresolved because of WithSpooling. The
+// body of a message without a reference message is read from memory. Hefty messages stored in AWS S3 are written to the
+// file as they are downloaded, except those with transforms or client side encryption, which are decoded in memory
+// first.
+func (wrapper *SqsClientWrapper) OpenHeftyMessage(ctx context.Context, queueUrl string, msg *sqs_types.Message) (*SpooledMessage, error) {
+	if msg == nil {
+		return nil, errors.New("message is nil")
+	}
+
+	if !types.IsReferenceMsg(aws.ToString(msg.Body)) {
+		return &SpooledMessage{
+			Size:              int64(len(aws.ToString(msg.Body))),
+			MessageAttributes: msg.MessageAttributes,
+			body:              strings.NewReader(aws.ToString(msg.Body)),
+		}, nil
+	}
+
+	refMsg, err := types.ToReferenceMsg(*msg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal reference message. %v", err)
+	}
+
+	file, err := os.CreateTemp(wrapper.spoolDir, "hefty-*")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create spool file. %v", err)
+	}
+
+	spooled, err := wrapper.storage.spool(ctx, queueUrl, refMsg, file)
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+
+	return spooled, nil
+}
+
+// spool writes the serialized hefty message of a reference message to `file`, verifies its digests and returns a reader
+// of its body
+func (storage *payloadStorage) spool(ctx context.Context, queueUrl string, refMsg *types.ReferenceMsg, file *os.File) (*SpooledMessage, error) {
+	if err := storage.spoolPayload(ctx, queueUrl, refMsg, file); err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get size of spool file. %v", err)
+	}
+
+	// the body is length prefixed and followed by the message attributes
+	var bodyLength uint32
+	if err = binary.Read(io.NewSectionReader(file, 0, 4), binary.BigEndian, &bodyLength); err != nil {
+		return nil, fmt.Errorf("unable to read body during deserialization. %v", err)
+	}
+	bodyOffset, msgAttrOffset := int64(4), 4+int64(bodyLength)
+	if msgAttrOffset > info.Size() {
+		return nil, fmt.Errorf("unable to read body during deserialization")
+	}
+
+	serializedAttributes := make([]byte, info.Size()-msgAttrOffset)
+	if _, err = file.ReadAt(serializedAttributes, msgAttrOffset); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("unable to read message attributes of spool file. %v", err)
+	}
+	msgAttributes, err := messages.DeserializeMessageAttributes(serializedAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	body := io.NewSectionReader(file, bodyOffset, int64(bodyLength))
+	if err = verifySpooledDigests(refMsg, body, serializedAttributes, len(msgAttributes)); err != nil {
+		return nil, err
+	}
+	if _, err = body.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return &SpooledMessage{
+		Size:              int64(bodyLength),
+		MessageAttributes: messages.MapToSqsMessageAttributeValues(msgAttributes),
+		body:              body,
+		file:              file,
+	}, nil
+}
+
+// spoolPayload writes the serialized hefty message of a reference message to `file`
+func (storage *payloadStorage) spoolPayload(ctx context.Context, queueUrl string, refMsg *types.ReferenceMsg, file *os.File) error {
+	if refMsg.Backend != "" || len(refMsg.Transforms) > 0 || len(refMsg.EncryptedDataKey) > 0 {
+		payload, err := storage.get(ctx, refMsg)
+		if err != nil {
+			return err
+		}
+
+		if payload, err = storage.clientEncryption.decrypt(ctx, queueUrl, refMsg, payload); err != nil {
+			return err
+		}
+
+		if payload, err = storage.transforms.reverse(ctx, refMsg, payload); err != nil {
+			return err
+		}
+
+		if _, err = file.Write(payload); err != nil {
+			return fmt.Errorf("unable to write spool file. %v", err)
+		}
+
+		return nil
+	}
+
+	if err := storage.lazyBuckets.ensure(ctx, refMsg.S3Bucket); err != nil {
+		return err
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket:              aws.String(refMsg.S3Bucket),
+		Key:                 aws.String(refMsg.S3Key),
+		VersionId:           optionalString(refMsg.S3VersionId),
+		ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+	}
+
+	release, err := storage.transfers.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if refMsg.S3ChecksumAlgorithm != "" {
+		// the checksum is validated once the body has been read completely
+		input.ChecksumMode = s3types.ChecksumModeEnabled
+		var out *s3.GetObjectOutput
+		if out, err = storage.s3Client.GetObject(ctx, input, storage.s3OptFns...); err == nil {
+			_, err = io.Copy(file, out.Body)
+			out.Body.Close()
+		}
+	} else {
+		_, err = storage.downloader.Download(ctx, file, input, storage.downloaderOptFns...)
+	}
+	if err != nil {
+		if backoffErr, ok := asBackoffError(err); ok {
+			return backoffErr
+		}
+		if isKmsError(err) {
+			return fmt.Errorf("unable to get message from s3; check that the kms key it is encrypted with can be used by the caller. %v", err)
+		}
+
+		return fmt.Errorf("unable to get message from s3. %v", err)
+	}
+
+	return nil
+}
+
+// verifySpooledDigests checks the digests of a spooled hefty message against its reference message
+func verifySpooledDigests(refMsg *types.ReferenceMsg, body io.Reader, serializedAttributes []byte, numAttributes int) error {
+	bodyDigest, err := messages.DigestReader(refMsg.DigestAlgorithm, body)
+	if err != nil {
+		return fmt.Errorf("unable to verify digests of hefty message. %v", err)
+	}
+
+	var attrDigest string
+	if numAttributes > 0 {
+		if attrDigest, err = messages.Digest(refMsg.DigestAlgorithm, serializedAttributes); err != nil {
+			return fmt.Errorf("unable to verify digests of hefty message. %v", err)
+		}
+	}
+
+	if bodyDigest == refMsg.Md5DigestMsgBody && attrDigest == refMsg.Md5DigestMsgAttr {
+		return nil
+	}
+
+	return digestMismatch(refMsg, bodyDigest, attrDigest)
+}
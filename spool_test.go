@@ -0,0 +1,80 @@
+package hefty
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpooling(t *testing.T) {
+	queueUrl := "https://sqs.us-west-2.amazonaws.com/765908583888/MyQueue"
+	store := &memoryStore{payloads: map[string][]byte{}}
+	storage := &payloadStorage{payloadStore: store, payloadMaxSize: 1024}
+	client := &fakeReceiveAPI{messages: []sqs_types.Message{
+		{MessageId: aws.String("small"), ReceiptHandle: aws.String("cmVjZWlwdA=="), Body: aws.String(withSize(t, storedReferenceMessage(t, storage, "MyQueue/small", "small hefty message"), 10))},
+		{MessageId: aws.String("large"), ReceiptHandle: aws.String("cmVjZWlwdA=="), Body: aws.String(withSize(t, storedReferenceMessage(t, storage, "MyQueue/large", "large hefty message"), 1000))},
+		{MessageId: aws.String("unknown"), ReceiptHandle: aws.String("cmVjZWlwdA=="), Body: aws.String(storedReferenceMessage(t, storage, "MyQueue/unknown", "hefty message of unknown size"))},
+		{MessageId: aws.String("plain"), ReceiptHandle: aws.String("cmVjZWlwdA=="), Body: aws.String("plain message")},
+	}}
+	dir := t.TempDir()
+	wrapper := &SqsClientWrapper{storage: storage, api: client, spoolThreshold: 100, spoolDir: dir}
+
+	out, err := wrapper.ReceiveHeftyMessage(context.TODO(), &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueUrl)})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"large"}, UnresolvedMessages(out.ResultMetadata))
+	assert.Equal(t, "small hefty message", aws.ToString(out.Messages[0].Body))
+	assert.Equal(t, "hefty message of unknown size", aws.ToString(out.Messages[2].Body))
+
+	tests := []struct {
+		msg      *sqs_types.Message
+		expBody  string
+		expAttr  string
+		expFiles int
+	}{
+		{msg: &out.Messages[1], expBody: "large hefty message", expAttr: "value", expFiles: 1},
+		{msg: &out.Messages[3], expBody: "plain message"},
+	}
+
+	for _, test := range tests {
+		t.Run(aws.ToString(test.msg.MessageId), func(t *testing.T) {
+			spooled, err := wrapper.OpenHeftyMessage(context.TODO(), queueUrl, test.msg)
+			assert.NoError(t, err)
+			files, _ := os.ReadDir(dir)
+			assert.Len(t, files, test.expFiles)
+
+			body, err := io.ReadAll(spooled)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expBody, string(body))
+			assert.Equal(t, int64(len(test.expBody)), spooled.Size)
+			if test.expAttr != "" {
+				assert.Equal(t, test.expAttr, aws.ToString(spooled.MessageAttributes["attr"].StringValue))
+			}
+
+			assert.NoError(t, spooled.Close())
+			files, _ = os.ReadDir(dir)
+			assert.Empty(t, files)
+		})
+	}
+
+	// a corrupted hefty message fails verification and leaves no file behind
+	store.payloads["MyQueue/large"][5] ^= 0xff
+	_, err = wrapper.OpenHeftyMessage(context.TODO(), queueUrl, &out.Messages[1])
+	var integrityErr *IntegrityError
+	assert.ErrorAs(t, err, &integrityErr)
+	files, _ := os.ReadDir(dir)
+	assert.Empty(t, files)
+}
+
+func TestWithSpooling(t *testing.T) {
+	opts := defaultOptions()
+	assert.NoError(t, WithSpooling(1024, "dir")(&opts))
+	assert.Equal(t, int64(1024), opts.spoolThreshold)
+	assert.Equal(t, "dir", opts.spoolDir)
+	assert.Error(t, WithSpooling(0, "")(&opts))
+}
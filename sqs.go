@@ -1,22 +1,19 @@
 package hefty
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
-	"github.com/google/uuid"
+	"github.com/aws/smithy-go/middleware"
 	"github.com/jo-parker/sqs-hefty/internal/messages"
-	"github.com/jo-parker/sqs-hefty/internal/utils"
+	"github.com/jo-parker/sqs-hefty/limits"
 	"github.com/jo-parker/sqs-hefty/types"
 )
 
@@ -26,11 +23,21 @@ const (
 
 type SqsClientWrapper struct {
 	sqs.Client
-	bucket         string
-	s3Client       *s3.Client
-	uploader       *s3manager.Uploader
-	downloader     *s3manager.Downloader
-	alwaysSendToS3 bool
+	storage             *payloadStorage
+	alwaysSendToS3      bool
+	tenants             TenantExtractor
+	offload             OffloadPolicy
+	preserveMd5Digests  bool
+	receiptHandleKey    []byte
+	receiptHandles      ReceiptHandleStore
+	expiry              *queueRetentionExpiry
+	retainPayloads      bool
+	deleteOrder         DeleteOrder
+	receiveMemoryBudget int64
+	spoolThreshold      int64
+	spoolDir            string
+	sqsOptFns           []func(*sqs.Options)
+	api                 SqsAPI // client given to NewSqsClientWrapperFromAPI that is not an *sqs.Client
 }
 
 // NewSqsClientWrapper will create a new Hefty SQS client wrapper using an existing AWS SQS client and AWS S3 client.
@@ -38,37 +45,72 @@ type SqsClientWrapper struct {
 // bucket that is specified via `bucketName`. The S3 client should have the ability of reading and writing to this bucket.
 // This function will also check if the bucket exists and is accessible.
 func NewSqsClientWrapper(sqsClient *sqs.Client, s3Client *s3.Client, bucketName string, opts ...Option) (*SqsClientWrapper, error) {
-	// check if bucket exits
-	if ok, err := utils.BucketExists(s3Client, bucketName); !ok {
+	return NewSqsClientWrapperFromAPI(sqsClient, s3Client, bucketName, opts...)
+}
+
+// NewSqsClientWrapperFromAPI creates a Hefty SQS client wrapper like NewSqsClientWrapper from clients that only need the
+// operations the wrapper uses, e.g. fakes or instrumented clients. The embedded sqs.Client of the wrapper is only set when
+// `sqsClient` is an *sqs.Client, so the methods of the wrapper must be used otherwise.
+func NewSqsClientWrapperFromAPI(sqsClient SqsAPI, s3Client S3API, bucketName string, opts ...Option) (*SqsClientWrapper, error) {
+	// process available options
+	wrapperOptions := defaultOptions()
+	for _, opt := range opts {
+		err := opt(&wrapperOptions)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		return nil, fmt.Errorf("bucket %s does not exist or is not accessible", bucketName)
+	var sqsOptFns []func(*sqs.Options)
+	if wrapperOptions.messagingRetryTokens != nil {
+		sqsOptFns = append(sqsOptFns, sqsRetryTokenOption(wrapperOptions.messagingRetryTokens))
+	}
+
+	storage, err := newPayloadStorage(s3Client, bucketName, &wrapperOptions)
+	if err != nil {
+		return nil, err
 	}
 
 	// create new wrapper
 	wrapper := &SqsClientWrapper{
-		Client:     *sqsClient,
-		bucket:     bucketName,
-		s3Client:   s3Client,
-		uploader:   s3manager.NewUploader(s3Client),
-		downloader: s3manager.NewDownloader(s3Client),
+		storage:             storage,
+		alwaysSendToS3:      wrapperOptions.alwaysSendToS3,
+		tenants:             wrapperOptions.tenants,
+		offload:             wrapperOptions.offload,
+		preserveMd5Digests:  wrapperOptions.preserveMd5Digests,
+		receiptHandleKey:    wrapperOptions.receiptHandleKey,
+		receiptHandles:      wrapperOptions.receiptHandles,
+		expiry:              wrapperOptions.expiry,
+		retainPayloads:      wrapperOptions.retainPayloads,
+		deleteOrder:         wrapperOptions.deleteOrder,
+		receiveMemoryBudget: wrapperOptions.receiveMemoryBudget,
+		spoolThreshold:      wrapperOptions.spoolThreshold,
+		spoolDir:            wrapperOptions.spoolDir,
+		sqsOptFns:           sqsOptFns,
 	}
-
-	// process available options
-	var wrapperOptions options
-	for _, opt := range opts {
-		err := opt(&wrapperOptions)
-		if err != nil {
-			return nil, err
-		}
+	if client, ok := sqsClient.(*sqs.Client); ok {
+		wrapper.Client = *client
+	} else {
+		wrapper.api = sqsClient
 	}
-	wrapper.alwaysSendToS3 = wrapperOptions.alwaysSendToS3
 
 	return wrapper, nil
 }
 
+// GetQueueAttributes gets the attributes of a queue with the AWS SQS client of the wrapper
+func (wrapper *SqsClientWrapper) GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+	return wrapper.sqsClient().GetQueueAttributes(ctx, params, optFns...)
+}
+
+// sqsClient returns the AWS SQS client of the wrapper
+func (wrapper *SqsClientWrapper) sqsClient() SqsAPI {
+	if wrapper.api != nil {
+		return wrapper.api
+	}
+
+	return &wrapper.Client
+}
+
 // SendHeftyMessage will calculate the messages size from `params` and determine if the MaxSqsSnsMessageLengthBytes is exceeded.
 // If so, the message is saved in AWS S3 as a hefty message and a reference message is sent to AWS SQS instead.
 // If not, the message is directly sent to AWS SNS.
@@ -78,12 +120,14 @@ func NewSqsClientWrapper(sqsClient *sqs.Client, s3Client *s3.Client, bucketName
 //
 // Note that this function's signature matches that of the AWS SQS SDK's SendMessage function.
 func (wrapper *SqsClientWrapper) SendHeftyMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	optFns = wrapper.withOptFns(optFns)
+
 	// input validation; if invalid input let AWS SDK handle it
 	if params == nil ||
 		params.MessageBody == nil ||
 		len(*params.MessageBody) == 0 {
 
-		return wrapper.SendMessage(ctx, params, optFns...)
+		return wrapper.sqsClient().SendMessage(ctx, params, optFns...)
 	}
 
 	// normalize message attributes
@@ -95,50 +139,36 @@ func (wrapper *SqsClientWrapper) SendHeftyMessage(ctx context.Context, params *s
 		return nil, fmt.Errorf("unable to get size of message. %v", err)
 	}
 
-	// validate message size
-	if !wrapper.alwaysSendToS3 && msgSize <= MaxAwsMessageLengthBytes {
-		return wrapper.SendMessage(ctx, params, optFns...)
-	} else if msgSize > MaxHeftyMessageLengthBytes {
-		return nil, fmt.Errorf("message size of %d bytes greater than allowed message size of %d bytes", msgSize, MaxHeftyMessageLengthBytes)
-	}
-
-	// create and serialize hefty message
-	heftyMsg := messages.NewHeftyMessage(params.MessageBody, msgAttributes, msgSize)
-	serialized, bodyOffset, msgAttrOffset, err := heftyMsg.Serialize()
+	// decide how to send the message
+	decision, compressed, err := wrapper.offload.decide(ctx, aws.ToString(params.QueueUrl), wrapper.alwaysSendToS3, wrapper.offload.threshold(limits.MaxMessageLength(limits.SQS)), params.MessageBody, msgAttributes, msgSize)
 	if err != nil {
-		return nil, fmt.Errorf("unable to serialize message. %v", err)
+		return nil, err
 	}
 
-	// create md5 digests
-	msgBodyHash := messages.Md5Digest(serialized[bodyOffset:msgAttrOffset])
-	msgAttrHash := ""
-	if len(heftyMsg.MessageAttributes) > 0 {
-		msgAttrHash = messages.Md5Digest(serialized[msgAttrOffset:])
+	switch {
+	case decision == OffloadInline:
+		return wrapper.sqsClient().SendMessage(ctx, params, optFns...)
+	case decision == OffloadCompressedInline:
+		return wrapper.sendCompressedMessage(ctx, params, compressed, optFns)
+	case msgSize > MaxHeftyMessageLengthBytes:
+		return nil, fmt.Errorf("message size of %d bytes greater than allowed message size of %d bytes", msgSize, MaxHeftyMessageLengthBytes)
 	}
 
-	// create reference message
-	refMsg, err := newSqsReferenceMessage(params.QueueUrl, wrapper.bucket, wrapper.Options().Region, msgBodyHash, msgAttrHash)
+	// tag hefty message with its expiration
+	tags, err := wrapper.expiry.tags(ctx, wrapper.sqsClient(), aws.ToString(params.QueueUrl), optFns...)
 	if err != nil {
-		return nil, fmt.Errorf("unable to create reference message from queueUrl. %v", err)
+		return nil, err
 	}
 
-	// upload hefty message to s3
-	_, err = wrapper.uploader.Upload(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(wrapper.bucket),
-		Key:    aws.String(refMsg.S3Key),
-		Body:   bytes.NewReader(serialized),
-	})
+	// store hefty message in payload store or s3
+	refMsg, heftyMsg, jsonRefMsg, err := wrapper.storeHeftyMessage(ctx, params, msgAttributes, msgSize, tags)
 	if err != nil {
-		return nil, fmt.Errorf("unable to upload hefty message to s3. %v", err)
+		return nil, err
 	}
 
 	// replace incoming message body with reference message
-	jsonRefMsg, err := json.Marshal(refMsg)
-	if err != nil {
-		return nil, fmt.Errorf("unable to marshal json message. %v", err)
-	}
-
-	params.MessageBody = aws.String(string(jsonRefMsg))
+	origMsgBody := params.MessageBody
+	params.MessageBody = aws.String(jsonRefMsg)
 
 	// clear out all message attributes
 	origMsgAttr := params.MessageAttributes
@@ -146,26 +176,99 @@ func (wrapper *SqsClientWrapper) SendHeftyMessage(ctx context.Context, params *s
 
 	// replace overwritten values with original values
 	defer func() {
-		params.MessageBody = heftyMsg.Body
+		params.MessageBody = origMsgBody
 		params.MessageAttributes = origMsgAttr
 	}()
 
 	// send reference message to sqs
-	out, err := wrapper.SendMessage(ctx, params, optFns...)
+	out, err := wrapper.sqsClient().SendMessage(ctx, params, optFns...)
 	if err != nil {
+		wrapper.storage.cleanupOrphan(ctx, refMsg, err)
 		return out, err
 	}
 
+	// tag hefty message with message id
+	wrapper.storage.tagWithMessageId(ctx, refMsg, out.MessageId, tags)
+
 	// overwrite md5 values
-	out.MD5OfMessageBody = aws.String(msgBodyHash)
-	out.MD5OfMessageAttributes = aws.String(msgAttrHash)
+	md5Body, md5Attr := sqsMd5Digests(heftyMsg.Body, heftyMsg.MessageAttributes)
+	wrapper.replaceMd5Digests(&out.ResultMetadata, out.MessageId, &out.MD5OfMessageBody, &out.MD5OfMessageAttributes, Md5Digests{Body: md5Body, Attributes: md5Attr})
 
 	return out, err
 }
 
-// SendHeftyMessageBatch is currently not supported and will use the underlying AWS SQS SDK's method `SendMessageBatch`
-func (wrapper *SqsClientWrapper) SendHeftyMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
-	return wrapper.SendMessageBatch(ctx, params, optFns...)
+// storeHeftyMessage stores the body and message attributes of a message that is sent to the queue at `params.QueueUrl`
+// as a hefty message. It returns the reference message to send in place of the message, the hefty message and the json
+// encoding of the reference message.
+func (wrapper *SqsClientWrapper) storeHeftyMessage(ctx context.Context, params *sqs.SendMessageInput, msgAttributes map[string]messages.MessageAttributeValue, msgSize int, tags map[string]string) (*types.ReferenceMsg, *messages.HeftyMessage, string, error) {
+	// redact message body before it is stored
+	body, err := wrapper.storage.redact(ctx, aws.ToString(params.QueueUrl), params.MessageBody)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	// create and serialize hefty message
+	heftyMsg := messages.NewHeftyMessage(body, msgAttributes, msgSize)
+	serialized, _, _, err := heftyMsg.Serialize()
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("unable to serialize message. %v", err)
+	}
+
+	// create digests
+	msgBodyHash, msgAttrHash, err := messageDigests(wrapper.storage.digestAlgorithm, serialized, heftyMsg)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	// create reference message
+	refMsg, err := newSqsReferenceMessage(params.QueueUrl, params.MessageGroupId, wrapper.storage.keys, wrapper.storage.contentDigest(serialized), wrapper.storage.bucket, clientRegion(wrapper.sqsClient()), msgBodyHash, msgAttrHash)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("unable to create reference message from queueUrl. %v", err)
+	}
+	refMsg.DigestAlgorithm = wrapper.storage.digestAlgorithm
+	refMsg.Size = int64(len(serialized))
+
+	// get tenant of hefty message
+	tenant := ""
+	if wrapper.tenants != nil {
+		tenant = wrapper.tenants(params)
+		if err = validateTenant(tenant); err != nil {
+			return nil, nil, "", err
+		}
+	}
+
+	// put hefty message in payload store or upload it to s3
+	err = wrapper.storage.put(ctx, aws.ToString(params.QueueUrl), tenant, refMsg, serialized, newObjectMetadata(aws.ToString(params.QueueUrl), len(*body), heftyMsg), tags)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	jsonRefMsg, err := json.Marshal(refMsg)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("unable to marshal json message. %v", err)
+	}
+
+	return refMsg, heftyMsg, string(jsonRefMsg), nil
+}
+
+// sendCompressedMessage sends a message with its body replaced by the inline message `compressed`
+func (wrapper *SqsClientWrapper) sendCompressedMessage(ctx context.Context, params *sqs.SendMessageInput, compressed *string, optFns []func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	origBody := params.MessageBody
+	params.MessageBody = compressed
+	defer func() {
+		params.MessageBody = origBody
+	}()
+
+	out, err := wrapper.sqsClient().SendMessage(ctx, params, optFns...)
+	if err != nil {
+		return out, err
+	}
+
+	// overwrite md5 value of the compressed body
+	md5Body, _ := sqsMd5Digests(origBody, nil)
+	wrapper.replaceMd5Digests(&out.ResultMetadata, out.MessageId, &out.MD5OfMessageBody, &out.MD5OfMessageAttributes, Md5Digests{Body: md5Body, Attributes: out.MD5OfMessageAttributes})
+
+	return out, err
 }
 
 // ReceiveHeftyMessage will determine if a message received is a reference to a hefty message residing in AWS S3.
@@ -175,12 +278,20 @@ func (wrapper *SqsClientWrapper) SendHeftyMessageBatch(ctx context.Context, para
 //
 // Note that this function's signature matches that of the AWS SQS SDK's ReceiveMessage function.
 func (wrapper *SqsClientWrapper) ReceiveHeftyMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
-	out, err := wrapper.ReceiveMessage(ctx, params, optFns...)
+	optFns = wrapper.withOptFns(optFns)
+
+	out, err := wrapper.sqsClient().ReceiveMessage(ctx, params, optFns...)
 	if err != nil || out == nil {
 		return out, err
 	}
 
+	budget := receiveBudget{max: wrapper.receiveMemoryBudget}
 	for i := range out.Messages {
+		if types.IsInlineMsg(aws.ToString(out.Messages[i].Body)) {
+			wrapper.decompressMessage(ctx, &out.ResultMetadata, &out.Messages[i])
+			continue
+		}
+
 		if !types.IsReferenceMsg(*out.Messages[i].Body) {
 			continue
 		}
@@ -192,40 +303,70 @@ func (wrapper *SqsClientWrapper) ReceiveHeftyMessage(ctx context.Context, params
 			continue
 		}
 
-		// make call to s3 to get message
-		buf := s3manager.NewWriteAtBuffer([]byte{})
-		_, err = wrapper.downloader.Download(ctx, buf, &s3.GetObjectInput{
-			Bucket: &refMsg.S3Bucket,
-			Key:    &refMsg.S3Key,
-		})
-		if err != nil {
-			addErrorToSqsMessage(&out.Messages[i], refMsg, fmt.Errorf("unable to get message from s3. %v", err))
+		// leave the reference message in place when its hefty message is spooled or does not fit in the memory budget of
+		// the receive
+		if wrapper.spoolThreshold > 0 && refMsg.Size > wrapper.spoolThreshold {
+			recordUnresolved(&out.ResultMetadata, out.Messages[i].MessageId)
+		} else if !budget.reserve(refMsg.Size) {
+			recordUnresolved(&out.ResultMetadata, out.Messages[i].MessageId)
+		} else if err = wrapper.resolveMessage(ctx, &out.ResultMetadata, aws.ToString(params.QueueUrl), &out.Messages[i], refMsg); err != nil {
+			addErrorToSqsMessage(&out.Messages[i], refMsg, err)
 			continue
+		} else if refMsg.Size == 0 {
+			budget.add(int64(len(aws.ToString(out.Messages[i].Body))))
 		}
 
-		// decode message from s3
-		heftyMsg, err := messages.DeserializeHeftyMessage(buf.Bytes())
+		// modify receipt handle to contain s3 bucket and key info
+		newReceiptHandle, err := wrapper.encodeReceiptHandle(ctx, heftyReceiptHandle{
+			receiptHandle: *out.Messages[i].ReceiptHandle,
+			bucket:        refMsg.S3Bucket,
+			key:           refMsg.S3Key,
+			backend:       refMsg.Backend,
+			versionId:     refMsg.S3VersionId,
+			counted:       refMsg.Counted,
+		})
 		if err != nil {
-			addErrorToSqsMessage(&out.Messages[i], refMsg, fmt.Errorf("unable to decode bytes from s3 into hefty message type. %v", err))
+			// the message must not be deleted without its hefty message, which cannot be done without the receipt handle
+			addErrorToSqsMessage(&out.Messages[i], refMsg, err)
+			out.Messages[i].ReceiptHandle = nil
 			continue
 		}
+		out.Messages[i].ReceiptHandle = &newReceiptHandle
+	}
 
-		// replace message body and attributes with s3 message
-		out.Messages[i].Body = heftyMsg.Body
-		sqsAttributes := messages.MapToSqsMessageAttributeValues(heftyMsg.MessageAttributes)
-		out.Messages[i].MessageAttributes = sqsAttributes
+	return out, nil
+}
 
-		// replace md5 hashes
-		out.Messages[i].MD5OfBody = &refMsg.Md5DigestMsgBody
-		out.Messages[i].MD5OfMessageAttributes = &refMsg.Md5DigestMsgAttr
+// decompressMessage replaces the compressed body of a received inline message with its original body
+func (wrapper *SqsClientWrapper) decompressMessage(ctx context.Context, metadata *middleware.Metadata, msg *sqs_types.Message) {
+	body, err := decompressInline(ctx, wrapper.offload, wrapper.storage.transforms, *msg.Body)
+	if err != nil {
+		addErrorToSqsMessage(msg, nil, err)
+		return
+	}
 
-		// modify receipt handle to contain s3 bucket and key info
-		newReceiptHandle := fmt.Sprintf("%s|%s|%s|%s", receiptHandlePrefix, *out.Messages[i].ReceiptHandle, refMsg.S3Bucket, refMsg.S3Key)
-		newReceiptHandle = base64.StdEncoding.EncodeToString([]byte(newReceiptHandle))
-		out.Messages[i].ReceiptHandle = &newReceiptHandle
+	msg.Body = aws.String(body)
+	md5Body, _ := sqsMd5Digests(msg.Body, nil)
+	wrapper.replaceMd5Digests(metadata, msg.MessageId, &msg.MD5OfBody, &msg.MD5OfMessageAttributes, Md5Digests{Body: md5Body, Attributes: msg.MD5OfMessageAttributes})
+}
+
+// resolveMessage replaces the reference message of a received message with its hefty message
+func (wrapper *SqsClientWrapper) resolveMessage(ctx context.Context, metadata *middleware.Metadata, queueUrl string, msg *sqs_types.Message, refMsg *types.ReferenceMsg) error {
+	// get message from payload store or s3 and decode it
+	heftyMsg, err := wrapper.storage.getHeftyMessage(ctx, queueUrl, refMsg)
+	if err != nil {
+		return err
 	}
 
-	return out, nil
+	// replace message body and attributes with s3 message
+	msg.Body = heftyMsg.Body
+	msg.MessageAttributes = messages.MapToSqsMessageAttributeValues(heftyMsg.MessageAttributes)
+
+	// replace md5 hashes
+	md5Body, md5Attr := sqsMd5Digests(heftyMsg.Body, heftyMsg.MessageAttributes)
+	wrapper.replaceMd5Digests(metadata, msg.MessageId, &msg.MD5OfBody, &msg.MD5OfMessageAttributes, Md5Digests{Body: md5Body, Attributes: md5Attr})
+
+	return nil
 }
 
 func addErrorToSqsMessage(msg *sqs_types.Message, refMsg *types.ReferenceMsg, err error) {
@@ -240,52 +381,114 @@ func addErrorToSqsMessage(msg *sqs_types.Message, refMsg *types.ReferenceMsg, er
 
 // DeleteHeftyMessage will delete a hefty message from AWS S3 and also the reference message from AWS SQS.
 // It is important to use the `ReceiptHandle` from `ReceiveHeftyMessage` in this function as this is the only way to determine
-// if a hefty message resides in AWS S3 or not.
+// if a hefty message resides in AWS S3 or not. With WithRetainPayloads, only the reference message is deleted.
+//
+// The reference message is deleted even when the hefty message could not be deleted, in which case the output is returned
+// together with a *PayloadDeleteError. The order of the deletes is set with WithDeleteOrder.
 //
 // Note that this function's signature matches that of the AWS SQS SDK's DeleteMessage function.
 func (wrapper *SqsClientWrapper) DeleteHeftyMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
-	const expectedHeftyReceiptHandleTokenCount = 4
+	optFns = wrapper.withOptFns(optFns)
 
 	if params.ReceiptHandle == nil {
-		return wrapper.DeleteMessage(ctx, params, optFns...)
+		return wrapper.sqsClient().DeleteMessage(ctx, params, optFns...)
 	}
 
 	// decode receipt handle
-	decoded, err := base64.StdEncoding.DecodeString(*params.ReceiptHandle)
+	handle, ok, err := wrapper.decodeReceiptHandle(ctx, *params.ReceiptHandle)
 	if err != nil {
-		return nil, fmt.Errorf("could not decode receipt handle. %v", err)
+		return nil, fmt.Errorf("refusing to delete hefty message. %v", err)
+	}
+	if !ok {
+		return wrapper.sqsClient().DeleteMessage(ctx, params, optFns...)
 	}
-	decodedStr := string(decoded)
 
-	// check if decoded receipt handle is for a hefty message
-	if !strings.HasPrefix(decodedStr, receiptHandlePrefix) {
-		return wrapper.DeleteMessage(ctx, params, optFns...)
+	if wrapper.tenants != nil {
+		err = validateTenantKey(requestTenant(ctx, wrapper.tenants, params.QueueUrl), handle.key)
+		if err != nil {
+			return nil, fmt.Errorf("refusing to delete hefty message. %v", err)
+		}
 	}
 
-	// get tokens from receipt handle
-	tokens := strings.Split(decodedStr, "|")
-	if len(tokens) != expectedHeftyReceiptHandleTokenCount {
-		return nil, fmt.Errorf("expected number of tokens (%d) not available in receipt handle", expectedHeftyReceiptHandleTokenCount)
+	// delete hefty message from payload store or s3 unless it is retained
+	var payloadErr error
+	deletePayload := func() {
+		if wrapper.retainPayloads {
+			return
+		}
+		if err := wrapper.storage.delete(ctx, handle.bucket, handle.key, handle.backend, handle.versionId, handle.counted); err != nil {
+			payloadErr = &PayloadDeleteError{
+				Bucket:    handle.bucket,
+				Key:       handle.key,
+				Backend:   handle.backend,
+				VersionId: handle.versionId,
+				Err:       err,
+			}
+		}
 	}
 
-	// delete hefty message from s3
-	receiptHandle, s3Bucket, s3Key := tokens[1], tokens[2], tokens[3]
-	_, err = wrapper.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: &s3Bucket,
-		Key:    &s3Key,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("could not delete s3 object for hefty message. %v", err)
+	if wrapper.deleteOrder == DeletePayloadFirst {
+		deletePayload()
 	}
 
 	// replace receipt handle with real one to delete sqs message
-	params.ReceiptHandle = &receiptHandle
+	params.ReceiptHandle = &handle.receiptHandle
+
+	out, err := wrapper.sqsClient().DeleteMessage(ctx, params, optFns...)
+	if err != nil {
+		// the hefty message is kept for the redelivered message unless it was already deleted
+		return out, errors.Join(err, payloadErr)
+	}
+
+	// remove receipt handle from receipt handle store; it expires otherwise
+	if handle.ref != "" {
+		_ = wrapper.receiptHandles.Delete(ctx, handle.ref)
+	}
+
+	if wrapper.deleteOrder == DeleteMessageFirst {
+		deletePayload()
+	}
+
+	return out, payloadErr
+}
+
+// ChangeHeftyMessageVisibility will change the visibility timeout of a message received with `ReceiveHeftyMessage`. The
+// `ReceiptHandle` from `ReceiveHeftyMessage` is replaced with the receipt handle of the reference message for the call.
+//
+// Note that this function's signature matches that of the AWS SQS SDK's ChangeMessageVisibility function.
+func (wrapper *SqsClientWrapper) ChangeHeftyMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	optFns = wrapper.withOptFns(optFns)
+
+	if params == nil || params.ReceiptHandle == nil {
+		return wrapper.sqsClient().ChangeMessageVisibility(ctx, params, optFns...)
+	}
+
+	// decode receipt handle
+	handle, ok, err := wrapper.decodeReceiptHandle(ctx, *params.ReceiptHandle)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return wrapper.sqsClient().ChangeMessageVisibility(ctx, params, optFns...)
+	}
+
+	// replace receipt handle with real one for the call only
+	origReceiptHandle := params.ReceiptHandle
+	params.ReceiptHandle = &handle.receiptHandle
+	defer func() {
+		params.ReceiptHandle = origReceiptHandle
+	}()
+
+	return wrapper.sqsClient().ChangeMessageVisibility(ctx, params, optFns...)
+}
 
-	return wrapper.DeleteMessage(ctx, params, optFns...)
+// withOptFns returns the AWS SQS SDK options of a call followed by the options configured on the wrapper
+func (wrapper *SqsClientWrapper) withOptFns(optFns []func(*sqs.Options)) []func(*sqs.Options) {
+	return append(append([]func(*sqs.Options){}, optFns...), wrapper.sqsOptFns...)
 }
 
 // Example queueUrl: https://sqs.us-west-2.amazonaws.com/765908583888/MyTestQueue
-func newSqsReferenceMessage(queueUrl *string, bucketName, region, msgBodyHash, msgAttrHash string) (*types.ReferenceMsg, error) {
+func newSqsReferenceMessage(queueUrl, messageGroupId *string, keys keyGenerator, contentDigest, bucketName, region, msgBodyHash, msgAttrHash string) (*types.ReferenceMsg, error) {
 	const expectedTokenCount = 5
 
 	if queueUrl != nil {
@@ -293,11 +496,16 @@ func newSqsReferenceMessage(queueUrl *string, bucketName, region, msgBodyHash, m
 		if len(tokens) != expectedTokenCount {
 			return nil, fmt.Errorf("expected %d tokens when splitting queueUrl by '/' but received %d", expectedTokenCount, len(tokens))
 		} else {
+			// S3Key: queueName/id unless a key prefix or template is configured
+			key, err := keys.newKey(tokens[4], tokens[4], messageGroupId, contentDigest)
+			if err != nil {
+				return nil, err
+			}
 
 			return types.NewReferenceMsg(
 				region,
 				bucketName,
-				fmt.Sprintf("%s/%s", tokens[4], uuid.New().String()), // S3Key: queueName/uuid
+				key,
 				msgBodyHash,
 				msgAttrHash), nil
 		}
@@ -0,0 +1,207 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/limits"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeQueueAPI is a single queue that returns every message it has until the message is deleted. Batch entries whose id
+// starts with "fail" are not accepted, and every batch fails with batchErr when it is set.
+type fakeQueueAPI struct {
+	SqsAPI
+	messages map[string]sqstypes.Message
+	batchErr error
+}
+
+func (client *fakeQueueAPI) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	id := strconv.Itoa(len(client.messages))
+	client.messages["handle-"+id] = sqstypes.Message{
+		MessageId:         aws.String(id),
+		ReceiptHandle:     aws.String("handle-" + id),
+		Body:              params.MessageBody,
+		MessageAttributes: params.MessageAttributes,
+	}
+
+	return &sqs.SendMessageOutput{MessageId: aws.String(id)}, nil
+}
+
+func (client *fakeQueueAPI) SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	if client.batchErr != nil {
+		return nil, client.batchErr
+	}
+
+	out := &sqs.SendMessageBatchOutput{}
+	for _, entry := range params.Entries {
+		if strings.HasPrefix(aws.ToString(entry.Id), "fail") {
+			out.Failed = append(out.Failed, sqstypes.BatchResultErrorEntry{Id: entry.Id, Code: aws.String("InvalidParameterValue"), SenderFault: true})
+			continue
+		}
+
+		msg, _ := client.SendMessage(ctx, &sqs.SendMessageInput{QueueUrl: params.QueueUrl, MessageBody: entry.MessageBody, MessageAttributes: entry.MessageAttributes})
+		md5Body, _ := messages.Md5OfMessageBody(aws.ToString(entry.MessageBody))
+		out.Successful = append(out.Successful, sqstypes.SendMessageBatchResultEntry{Id: entry.Id, MessageId: msg.MessageId, MD5OfMessageBody: aws.String(md5Body)})
+	}
+
+	return out, nil
+}
+
+func (client *fakeQueueAPI) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	out := &sqs.ReceiveMessageOutput{}
+	for _, msg := range client.messages {
+		out.Messages = append(out.Messages, msg)
+	}
+
+	return out, nil
+}
+
+func (client *fakeQueueAPI) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	delete(client.messages, aws.ToString(params.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func TestDeleteHeftyMessageRetainPayloads(t *testing.T) {
+	var tests = []struct {
+		desc        string
+		opts        []Option
+		expPayloads int
+	}{
+		{desc: "payload_deleted"},
+		{desc: "payload_retained", opts: []Option{WithRetainPayloads()}, expPayloads: 1},
+		{desc: "payload_retained_message_deleted_first", opts: []Option{WithRetainPayloads(), WithDeleteOrder(DeleteMessageFirst)}, expPayloads: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			sqsClient := &fakeQueueAPI{messages: map[string]sqstypes.Message{}}
+			store := &memoryStore{payloads: map[string][]byte{}}
+			opts := append([]Option{WithSkipBucketCheck(), AlwaysSendToS3(), WithPayloadStore(store, MaxHeftyMessageLengthBytes)}, tt.opts...)
+			wrapper, err := NewSqsClientWrapperFromAPI(sqsClient, &fakeS3API{}, "bucket", opts...)
+			assert.Nil(t, err)
+
+			queueUrl := aws.String("https://sqs.us-west-2.amazonaws.com/765908583888/queue")
+			_, err = wrapper.SendHeftyMessage(context.TODO(), &sqs.SendMessageInput{QueueUrl: queueUrl, MessageBody: aws.String("hefty message")})
+			assert.Nil(t, err)
+			assert.Len(t, store.payloads, 1)
+
+			out, err := wrapper.ReceiveHeftyMessage(context.TODO(), &sqs.ReceiveMessageInput{QueueUrl: queueUrl})
+			assert.Nil(t, err)
+			assert.Len(t, out.Messages, 1)
+			assert.Equal(t, "hefty message", aws.ToString(out.Messages[0].Body))
+
+			// the reference message is always deleted, while the hefty message is only deleted when it is not retained
+			_, err = wrapper.DeleteHeftyMessage(context.TODO(), &sqs.DeleteMessageInput{QueueUrl: queueUrl, ReceiptHandle: out.Messages[0].ReceiptHandle})
+			assert.Nil(t, err)
+			assert.Empty(t, sqsClient.messages)
+			assert.Len(t, store.payloads, tt.expPayloads)
+		})
+	}
+}
+
+func TestSendHeftyMessageBatch(t *testing.T) {
+	sqsClient := &fakeQueueAPI{messages: map[string]sqstypes.Message{}}
+	store := &memoryStore{payloads: map[string][]byte{}}
+	wrapper, err := NewSqsClientWrapperFromAPI(sqsClient, &fakeS3API{}, "bucket", WithSkipBucketCheck(), WithPayloadStore(store, MaxHeftyMessageLengthBytes))
+	assert.Nil(t, err)
+
+	queueUrl := aws.String("https://sqs.us-west-2.amazonaws.com/765908583888/queue")
+	hefty := strings.Repeat("h", limits.MaxMessageLength(limits.SQS)+1)
+	input := &sqs.SendMessageBatchInput{QueueUrl: queueUrl, Entries: []sqstypes.SendMessageBatchRequestEntry{
+		{Id: aws.String("small"), MessageBody: aws.String("small message")},
+		{Id: aws.String("hefty"), MessageBody: aws.String(hefty)},
+		{Id: aws.String("fail-hefty"), MessageBody: aws.String(hefty)},
+	}}
+
+	out, err := wrapper.SendHeftyMessageBatch(context.TODO(), input)
+	assert.Nil(t, err)
+	assert.Len(t, out.Successful, 2)
+	assert.Len(t, out.Failed, 1)
+	assert.Equal(t, hefty, aws.ToString(input.Entries[1].MessageBody))
+
+	// only the hefty message of the entry that was sent is kept
+	assert.Len(t, store.payloads, 1)
+	cleanups := OrphanCleanups(out.ResultMetadata)
+	assert.Len(t, cleanups, 1)
+	assert.True(t, cleanups["fail-hefty"].Deleted)
+	assert.ErrorContains(t, cleanups["fail-hefty"].SendErr, "InvalidParameterValue")
+
+	md5Body, _ := messages.Md5OfMessageBody(hefty)
+	assert.Equal(t, md5Body, aws.ToString(out.Successful[1].MD5OfMessageBody))
+
+	received, err := wrapper.ReceiveHeftyMessage(context.TODO(), &sqs.ReceiveMessageInput{QueueUrl: queueUrl})
+	assert.Nil(t, err)
+	var bodies []string
+	for _, msg := range received.Messages {
+		bodies = append(bodies, aws.ToString(msg.Body))
+	}
+	assert.ElementsMatch(t, []string{"small message", hefty}, bodies)
+}
+
+func TestSendHeftyMessageBatchErrors(t *testing.T) {
+	var tests = []struct {
+		desc        string
+		batchErr    error
+		expPayloads int
+	}{
+		{desc: "rejected_deleted", batchErr: responseError(http.StatusBadRequest)},
+		{desc: "timeout_kept", batchErr: context.DeadlineExceeded, expPayloads: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			sqsClient := &fakeQueueAPI{messages: map[string]sqstypes.Message{}, batchErr: tt.batchErr}
+			store := &memoryStore{payloads: map[string][]byte{}}
+			wrapper, err := NewSqsClientWrapperFromAPI(sqsClient, &fakeS3API{}, "bucket", WithSkipBucketCheck(), AlwaysSendToS3(), WithPayloadStore(store, MaxHeftyMessageLengthBytes))
+			assert.Nil(t, err)
+
+			_, err = wrapper.SendHeftyMessageBatch(context.TODO(), &sqs.SendMessageBatchInput{
+				QueueUrl: aws.String("https://sqs.us-west-2.amazonaws.com/765908583888/queue"),
+				Entries: []sqstypes.SendMessageBatchRequestEntry{
+					{Id: aws.String("1"), MessageBody: aws.String("hefty message")},
+					{Id: aws.String("2"), MessageBody: aws.String("hefty message")},
+				},
+			})
+
+			var batchErr *SendBatchError
+			assert.True(t, errors.As(err, &batchErr))
+			assert.Equal(t, tt.batchErr, batchErr.Err)
+			assert.Len(t, batchErr.Cleanups, 2)
+			assert.Len(t, store.payloads, tt.expPayloads)
+		})
+	}
+}
+
+func TestReceiveHeftyMessageReceiptHandleTooLong(t *testing.T) {
+	sqsClient := &fakeQueueAPI{messages: map[string]sqstypes.Message{}}
+	store := &memoryStore{payloads: map[string][]byte{}}
+	wrapper, err := NewSqsClientWrapperFromAPI(sqsClient, &fakeS3API{}, "bucket", WithSkipBucketCheck(), AlwaysSendToS3(), WithPayloadStore(store, MaxHeftyMessageLengthBytes), WithKeyPrefix(strings.Repeat("prefix/", 150)))
+	assert.Nil(t, err)
+
+	queueUrl := aws.String("https://sqs.us-west-2.amazonaws.com/765908583888/queue")
+	_, err = wrapper.SendHeftyMessage(context.TODO(), &sqs.SendMessageInput{QueueUrl: queueUrl, MessageBody: aws.String("hefty message")})
+	assert.Nil(t, err)
+
+	// the message cannot be deleted without its hefty message, so it is returned without a receipt handle
+	out, err := wrapper.ReceiveHeftyMessage(context.TODO(), &sqs.ReceiveMessageInput{QueueUrl: queueUrl})
+	assert.Nil(t, err)
+	assert.Len(t, out.Messages, 1)
+	assert.Contains(t, aws.ToString(out.Messages[0].Body), "longer than 1024 characters")
+	assert.Nil(t, out.Messages[0].ReceiptHandle)
+
+	lazyOut, err := wrapper.ReceiveHeftyMessageLazy(context.TODO(), &sqs.ReceiveMessageInput{QueueUrl: queueUrl})
+	assert.Nil(t, err)
+	assert.Len(t, lazyOut.Messages, 1)
+	assert.Contains(t, aws.ToString(lazyOut.Messages[0].Body), "longer than 1024 characters")
+	assert.Nil(t, lazyOut.Messages[0].ReceiptHandle)
+	assert.Len(t, store.payloads, 1)
+}
@@ -0,0 +1,655 @@
+package hefty
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/internal/utils"
+	"github.com/jo-parker/sqs-hefty/types"
+)
+
+// payloadStorage stores, gets and deletes hefty messages in AWS S3 or a payload store on behalf of the client wrappers
+type payloadStorage struct {
+	bucket             string
+	s3Client           S3API
+	uploader           *s3manager.Uploader
+	uploaderOptFns     []func(*s3manager.Uploader)
+	downloader         *s3manager.Downloader
+	downloaderOptFns   []func(*s3manager.Downloader)
+	transfers          *TransferLimiter
+	tagWithMsgId       bool
+	payloadStore       PayloadStore
+	payloadMaxSize     int
+	digestRetries      int
+	contentAddressable bool
+	references         ReferenceCounter
+	shards             []Shard
+	shardSelector      ShardSelector
+	bucketSelector     BucketSelector
+	storageClass       s3types.StorageClass
+	storageClassPolicy StorageClassPolicy
+	objectLockHandler  ObjectLockHandler
+	encryption         serverSideEncryption
+	ownership          objectOwnership
+	clientEncryption   *clientSideEncryption
+	transforms         *transformChain
+	redactor           Redactor
+	digestAlgorithm    string
+	checksumAlgorithm  s3types.ChecksumAlgorithm
+	keys               keyGenerator
+	lazyBuckets        *lazyBucketCheck
+	cleanup            *cleanupWorker
+	orphanHook         OrphanCleanupHook
+	presigner          *s3.PresignClient
+	presignExpiry      time.Duration
+	s3OptFns           []func(*s3.Options)
+}
+
+// newPayloadStorage creates the payload storage of a client wrapper and checks if the bucket exists and is accessible,
+// unless buckets are checked lazily
+func newPayloadStorage(s3Client S3API, bucketName string, opts *options) (*payloadStorage, error) {
+	s3OptFns := opts.s3OptFns()
+
+	// configuring buckets and presigning urls needs more than the operations of S3API
+	if err := checkS3Client(s3Client, opts); err != nil {
+		return nil, err
+	}
+
+	// encrypted hefty messages differ even when their content is the same
+	if opts.contentAddressable && opts.clientEncryption != nil {
+		return nil, errors.New("content addressable keys cannot be used with client side encryption")
+	}
+
+	// the receipt handle of a hefty message uses '|' as a delimiter
+	if strings.Contains(bucketName, "|") {
+		return nil, fmt.Errorf("invalid bucket %s; buckets must not contain '|'", bucketName)
+	}
+
+	// missing buckets cannot be created without checking if they exist
+	if opts.skipBucketCheck && opts.autoCreateBucket != nil {
+		return nil, errors.New("bucket check cannot be skipped when buckets are created automatically")
+	}
+
+	// check if buckets exist and verify their security posture
+	validate := func(ctx context.Context, bucket string) error {
+		if err := checkBucket(ctx, s3Client, bucket, opts, s3OptFns); err != nil {
+			return err
+		}
+
+		if opts.bucketPosture == nil {
+			return nil
+		}
+
+		return opts.bucketPosture.verify(ctx, s3Client.(bucketPostureClient), bucket, s3OptFns...)
+	}
+
+	var lazyBuckets *lazyBucketCheck
+	if opts.lazyBucketCheck {
+		lazyBuckets = newLazyBucketCheck(validate)
+	} else {
+		buckets := map[string]struct{}{bucketName: {}}
+		for _, shard := range opts.shards {
+			buckets[shard.Bucket] = struct{}{}
+		}
+		for _, topic := range opts.topics {
+			buckets[topic.Bucket] = struct{}{}
+		}
+		delete(buckets, "")
+		for bucket := range buckets {
+			if err := validate(context.TODO(), bucket); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	bucketSelector := opts.bucketSelector
+	if len(opts.topics) > 0 {
+		bucketSelector = topicBucketSelector(opts.topics, bucketSelector)
+	}
+
+	transforms, err := newTransformChain(opts.transforms)
+	if err != nil {
+		return nil, err
+	}
+
+	storage := &payloadStorage{
+		bucket:             bucketName,
+		s3Client:           s3Client,
+		uploader:           s3manager.NewUploader(s3Client, s3manager.WithUploaderRequestOptions(s3OptFns...)),
+		downloader:         s3manager.NewDownloader(s3Client, s3manager.WithDownloaderClientOptions(s3OptFns...)),
+		tagWithMsgId:       opts.tagWithMessageId,
+		payloadStore:       opts.payloadStore,
+		payloadMaxSize:     opts.payloadStoreMaxSize,
+		digestRetries:      opts.digestRetries,
+		contentAddressable: opts.contentAddressable,
+		references:         opts.references,
+		shards:             opts.shards,
+		shardSelector:      opts.shardSelector,
+		bucketSelector:     bucketSelector,
+		storageClass:       opts.storageClass,
+		storageClassPolicy: opts.storageClassPolicy,
+		objectLockHandler:  opts.objectLockHandler,
+		encryption:         opts.encryption,
+		ownership:          opts.ownership,
+		clientEncryption:   opts.clientEncryption,
+		transforms:         transforms,
+		redactor:           opts.redactor,
+		digestAlgorithm:    opts.digestAlgorithm,
+		checksumAlgorithm:  opts.checksumAlgorithm,
+		keys:               opts.keys,
+		lazyBuckets:        lazyBuckets,
+		orphanHook:         opts.orphanHook,
+		transfers:          opts.transferLimiter,
+		s3OptFns:           s3OptFns,
+	}
+
+	// reuse the uploader and downloader of the caller and apply the AWS S3 SDK options of the wrapper to their requests
+	if opts.uploader != nil {
+		storage.uploader = opts.uploader
+		storage.uploaderOptFns = []func(*s3manager.Uploader){func(uploader *s3manager.Uploader) {
+			uploader.ClientOptions = append(slices.Clip(uploader.ClientOptions), s3OptFns...)
+		}}
+	}
+	if opts.downloader != nil {
+		storage.downloader = opts.downloader
+		storage.downloaderOptFns = []func(*s3manager.Downloader){func(downloader *s3manager.Downloader) {
+			downloader.ClientOptions = append(slices.Clip(downloader.ClientOptions), s3OptFns...)
+		}}
+	}
+
+	if opts.downloadPartSize > 0 {
+		partSize, concurrency := opts.downloadPartSize, opts.downloadConcurrency
+		storage.downloaderOptFns = append(storage.downloaderOptFns, func(downloader *s3manager.Downloader) {
+			downloader.PartSize = partSize
+			downloader.Concurrency = concurrency
+		})
+	}
+
+	if opts.presignExpiry > 0 {
+		storage.presigner = s3.NewPresignClient(s3Client.(*s3.Client), func(presignOpts *s3.PresignOptions) {
+			presignOpts.ClientOptions = s3OptFns
+		})
+		storage.presignExpiry = opts.presignExpiry
+	}
+
+	// retry failed deletes of hefty messages in the background
+	if opts.cleanup != nil {
+		storage.cleanup = newCleanupWorker(*opts.cleanup, storage.deletePayload)
+	}
+
+	return storage, nil
+}
+
+// checkBucket checks if a bucket exists and is accessible, and creates it when it does not exist and automatic bucket
+// creation is enabled. Access points are never created. Nothing is checked when the bucket check is skipped.
+func checkBucket(ctx context.Context, s3Client S3API, bucket string, opts *options, s3OptFns []func(*s3.Options)) error {
+	if opts.skipBucketCheck {
+		return nil
+	}
+
+	ok, err := utils.BucketExists(s3Client, bucket, s3OptFns...)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	if opts.autoCreateBucket == nil || utils.IsAccessPointArn(bucket) {
+		return fmt.Errorf("bucket %s does not exist or is not accessible", bucket)
+	}
+
+	return opts.autoCreateBucket.create(ctx, s3Client.(bucketCreator), bucket, clientRegion(s3Client), opts.keys.prefix, s3OptFns...)
+}
+
+// checkS3Client checks that an AWS S3 client given as S3API has the operations needed by the options
+func checkS3Client(s3Client S3API, opts *options) error {
+	if _, ok := s3Client.(bucketCreator); opts.autoCreateBucket != nil && !ok {
+		return errors.New("automatic bucket creation needs an AWS S3 client that can create buckets")
+	}
+	if _, ok := s3Client.(bucketPostureClient); opts.bucketPosture != nil && !ok {
+		return errors.New("bucket posture verification needs an AWS S3 client that can get the bucket configuration")
+	}
+	if _, ok := s3Client.(*s3.Client); opts.presignExpiry > 0 && !ok {
+		return errors.New("presigned urls need an *s3.Client")
+	}
+	if client, ok := s3Client.(*s3.Client); opts.s3InsecureSkipVerify && ok && !isBuildableHTTPClient(client.Options().HTTPClient) {
+		return errOpaqueHTTPClient
+	}
+
+	return nil
+}
+
+// contentDigest returns the digest used as the id of a content addressable key, or an empty string when content
+// addressable keys are not enabled
+func (storage *payloadStorage) contentDigest(serialized []byte) string {
+	if !storage.contentAddressable {
+		return ""
+	}
+
+	hash := sha256.Sum256(serialized)
+	return hex.EncodeToString(hash[:])
+}
+
+// put stores a serialized hefty message in the payload store or AWS S3 bucket and records its location in the reference
+// message. Hefty messages stored in AWS S3 are stored in the bucket selected for `target`, the queue url or topic arn the
+// reference message is sent to, and spread over the configured shards, and are tagged with `tags`. A non-empty `tenant`
+// is prepended to the key. With content addressable keys, the upload to AWS S3 is skipped if the hefty message is
+// already stored. When a reference counter is also configured, the upload is only skipped if the hefty message is
+// referenced by another message.
+func (storage *payloadStorage) put(ctx context.Context, target, tenant string, refMsg *types.ReferenceMsg, serialized []byte, metadata, tags map[string]string) error {
+	// transform and encrypt hefty message
+	serialized, err := storage.transforms.apply(ctx, refMsg, serialized)
+	if err != nil {
+		return err
+	}
+	if storage.clientEncryption != nil {
+		serialized, err = storage.clientEncryption.encrypt(ctx, target, refMsg, serialized)
+		if err != nil {
+			return fmt.Errorf("unable to encrypt hefty message. %v", err)
+		}
+	}
+	if len(refMsg.Transforms) > 0 || len(refMsg.EncryptedDataKey) > 0 {
+		refMsg.StoredSize = int64(len(serialized))
+	}
+
+	store := selectPayloadStore(storage.payloadStore, storage.payloadMaxSize, len(serialized))
+	if store != nil {
+		refMsg.S3Bucket = ""
+		refMsg.Backend = store.Backend()
+	} else {
+		err = applyBucketSelector(refMsg, target, storage.bucketSelector)
+		if err != nil {
+			return err
+		}
+		applyShard(refMsg, serialized, storage.shards, storage.shardSelector)
+	}
+
+	// store hefty message under the prefix of its tenant
+	if tenant != "" {
+		refMsg.S3Key, err = tenantKey(tenant, refMsg.S3Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	// add reference to content addressed hefty message
+	references := int64(0)
+	if storage.contentAddressable && storage.references != nil {
+		references, err = storage.references.Increment(ctx, referenceKey(refMsg.S3Bucket, refMsg.S3Key, refMsg.Backend))
+		if err != nil {
+			return fmt.Errorf("unable to add reference to hefty message. %v", err)
+		}
+		refMsg.Counted = true
+	}
+
+	err = storage.putObject(ctx, store, refMsg, serialized, metadata, tags, references)
+	if err != nil && references > 0 {
+		// the reference message will not be sent so the reference is removed again; this is best effort
+		_, _ = storage.references.Decrement(ctx, referenceKey(refMsg.S3Bucket, refMsg.S3Key, refMsg.Backend))
+	}
+
+	return err
+}
+
+func (storage *payloadStorage) putObject(ctx context.Context, store PayloadStore, refMsg *types.ReferenceMsg, serialized []byte, metadata, tags map[string]string, references int64) error {
+	// put hefty message in payload store
+	if store != nil {
+		err := putPayload(ctx, store, refMsg, serialized)
+		if err != nil {
+			return fmt.Errorf("unable to put hefty message in %s payload store. %v", store.Backend(), err)
+		}
+
+		return nil
+	}
+
+	if err := storage.lazyBuckets.ensure(ctx, refMsg.S3Bucket); err != nil {
+		return err
+	}
+
+	// a hefty message without other references may be in the process of being deleted, so it is uploaded again
+	if storage.contentAddressable && (storage.references == nil || references > 1) {
+		versionId, exists, err := storage.objectExists(ctx, refMsg.S3Bucket, refMsg.S3Key)
+		if err != nil {
+			return fmt.Errorf("unable to check if hefty message exists in s3. %v", err)
+		}
+		if exists {
+			refMsg.S3VersionId = versionId
+			return storage.presign(ctx, refMsg)
+		}
+	}
+
+	// upload hefty message to s3
+	var uploadOpts []func(*s3manager.Uploader)
+	if storage.checksumAlgorithm != "" {
+		uploadOpts = append(uploadOpts, singlePartUpload(len(serialized)))
+	}
+
+	return storage.upload(ctx, refMsg, bytes.NewReader(serialized), len(serialized), metadata, tags, uploadOpts...)
+}
+
+// upload uploads a serialized hefty message of about `size` bytes read from `body` to AWS S3 and records its version
+// and checksum in the reference message
+func (storage *payloadStorage) upload(ctx context.Context, refMsg *types.ReferenceMsg, body io.Reader, size int, metadata, tags map[string]string, uploadOpts ...func(*s3manager.Uploader)) error {
+	storageClass, err := storage.storageClassFor(size)
+	if err != nil {
+		return err
+	}
+
+	release, err := storage.transfers.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	out, err := storage.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(refMsg.S3Bucket),
+		Key:                  aws.String(refMsg.S3Key),
+		Body:                 body,
+		Metadata:             metadata,
+		Tagging:              encodeTags(tags),
+		StorageClass:         storageClass,
+		ServerSideEncryption: s3types.ServerSideEncryption(storage.encryption.algorithm),
+		SSEKMSKeyId:          optionalString(storage.encryption.kmsKeyId),
+		BucketKeyEnabled:     optionalBool(storage.encryption.bucketKeyEnabled),
+		ChecksumAlgorithm:    storage.checksumAlgorithm,
+		ACL:                  storage.ownership.acl,
+		ExpectedBucketOwner:  optionalString(storage.ownership.expectedBucketOwner),
+	}, append(slices.Clip(storage.uploaderOptFns), uploadOpts...)...)
+	if err != nil {
+		if backoffErr, ok := asBackoffError(err); ok {
+			return backoffErr
+		}
+		if storage.encryption.kmsKeyId != "" && isKmsError(err) {
+			return fmt.Errorf("unable to upload hefty message to s3 using kms key %s; check that the key exists, is enabled and can be used by the caller. %v", storage.encryption.kmsKeyId, err)
+		}
+
+		return fmt.Errorf("unable to upload hefty message to s3. %v", err)
+	}
+
+	// record the version of the hefty message in versioned buckets
+	refMsg.S3VersionId = aws.ToString(out.VersionID)
+	refMsg.S3ChecksumAlgorithm = string(storage.checksumAlgorithm)
+
+	return storage.presign(ctx, refMsg)
+}
+
+// storageClassFor returns the storage class a serialized hefty message of `size` bytes is uploaded with
+func (storage *payloadStorage) storageClassFor(size int) (s3types.StorageClass, error) {
+	if storage.storageClassPolicy == nil {
+		return storage.storageClass, nil
+	}
+
+	class := storage.storageClassPolicy(size)
+	if class == "" {
+		return storage.storageClass, nil
+	}
+	if !isReadableStorageClass(class) {
+		return "", fmt.Errorf("storage class %s selected by policy is not supported for hefty messages", class)
+	}
+
+	return class, nil
+}
+
+// objectExists checks whether a hefty message exists in AWS S3 and returns its version in versioned buckets
+func (storage *payloadStorage) objectExists(ctx context.Context, bucket, key string) (string, bool, error) {
+	out, err := storage.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:              aws.String(bucket),
+		Key:                 aws.String(key),
+		ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+	}, storage.s3OptFns...)
+	if err != nil {
+		var notFound *s3types.NotFound
+		if errors.As(err, &notFound) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	return aws.ToString(out.VersionId), true, nil
+}
+
+// tagWithMessageId tags a hefty message in AWS S3 with the message id of its reference message if enabled. The tags the
+// hefty message was uploaded with are kept. The reference message has already been sent at this point so this is best
+// effort.
+func (storage *payloadStorage) tagWithMessageId(ctx context.Context, refMsg *types.ReferenceMsg, messageId *string, tags map[string]string) {
+	if !storage.tagWithMsgId || refMsg.Backend != "" {
+		return
+	}
+
+	_ = tagObjectWithMessageId(ctx, storage.s3Client, refMsg.S3Bucket, refMsg.S3Key, refMsg.S3VersionId, storage.ownership.expectedBucketOwner, messageId, tags, storage.s3OptFns...)
+}
+
+// getHeftyMessage gets and decodes the hefty message of a reference message. A hefty message that cannot be decoded or
+// whose digests do not match the reference message is downloaded again, up to the configured number of retries,
+// since this is most likely caused by a truncated download. An IntegrityError is returned when the digests still do not
+// match. Encrypted hefty messages received from `queueUrl` are decrypted first.
+func (storage *payloadStorage) getHeftyMessage(ctx context.Context, queueUrl string, refMsg *types.ReferenceMsg) (*messages.HeftyMessage, error) {
+	for attempt := 0; ; attempt++ {
+		payload, err := storage.get(ctx, refMsg)
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err = storage.clientEncryption.decrypt(ctx, queueUrl, refMsg, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err = storage.transforms.reverse(ctx, refMsg, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		heftyMsg, err := messages.DeserializeHeftyMessage(payload)
+		if err == nil {
+			ok, err := messages.VerifyDigests(refMsg.DigestAlgorithm, payload, heftyMsg, refMsg.Md5DigestMsgBody, refMsg.Md5DigestMsgAttr)
+			if err != nil {
+				return nil, fmt.Errorf("unable to verify digests of hefty message. %v", err)
+			}
+			if ok {
+				return heftyMsg, nil
+			}
+		}
+
+		if attempt < storage.digestRetries {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode bytes from s3 into hefty message type. %v", err)
+		}
+
+		return nil, newIntegrityError(refMsg, payload, heftyMsg)
+	}
+}
+
+// get gets a serialized hefty message from the payload store or AWS S3 bucket recorded in the reference message
+func (storage *payloadStorage) get(ctx context.Context, refMsg *types.ReferenceMsg) ([]byte, error) {
+	if refMsg.Backend != "" {
+		store, err := payloadStoreForBackend(storage.payloadStore, refMsg.Backend)
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err := store.Get(ctx, refMsg.S3Key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get message from %s payload store. %v", refMsg.Backend, err)
+		}
+
+		return payload, nil
+	}
+
+	if err := storage.lazyBuckets.ensure(ctx, refMsg.S3Bucket); err != nil {
+		return nil, err
+	}
+
+	release, err := storage.transfers.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// make call to s3 to get message
+	var payload []byte
+	if refMsg.S3ChecksumAlgorithm != "" {
+		payload, err = storage.getWithChecksum(ctx, refMsg)
+	} else {
+		// allocate the buffer once instead of growing it for every part
+		buf := s3manager.NewWriteAtBuffer(make([]byte, 0, payloadSize(refMsg)))
+		_, err = storage.downloader.Download(ctx, buf, &s3.GetObjectInput{
+			Bucket:              &refMsg.S3Bucket,
+			Key:                 &refMsg.S3Key,
+			VersionId:           optionalString(refMsg.S3VersionId),
+			ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+		}, storage.downloaderOptFns...)
+		payload = buf.Bytes()
+	}
+	if err != nil {
+		if backoffErr, ok := asBackoffError(err); ok {
+			return nil, backoffErr
+		}
+		if isKmsError(err) {
+			return nil, fmt.Errorf("unable to get message from s3; check that the kms key it is encrypted with can be used by the caller. %v", err)
+		}
+
+		return nil, fmt.Errorf("unable to get message from s3. %v", err)
+	}
+
+	return payload, nil
+}
+
+// payloadSize returns the number of bytes of the hefty message of a reference message as stored in AWS S3, or 0 when
+// it is unknown because the reference message was sent by an older version, in which case the buffer is grown instead
+func payloadSize(refMsg *types.ReferenceMsg) int64 {
+	if refMsg.StoredSize > 0 {
+		return refMsg.StoredSize
+	}
+	if len(refMsg.Transforms) > 0 || len(refMsg.EncryptedDataKey) > 0 {
+		return 0
+	}
+
+	return refMsg.Size
+}
+
+// delete deletes a hefty message from the payload store of `backend`, or from AWS S3 when `backend` is empty. A non-empty
+// `versionId` deletes that version of the hefty message in a versioned bucket instead of adding a delete marker. When a
+// reference counter is configured and the reference of the message is `counted`, the hefty message is only deleted if no
+// other message references it. With object lock compliance, a hefty message that cannot be deleted due to object lock is
+// passed to the object lock handler instead. With payload cleanup, a failed delete is retried in the background instead
+// of being returned.
+func (storage *payloadStorage) delete(ctx context.Context, bucket, key, backend, versionId string, counted bool) error {
+	// remove reference to hefty message
+	if storage.references != nil && counted {
+		refKey := referenceKey(bucket, key, backend)
+		references, err := storage.references.Decrement(ctx, refKey)
+		if err != nil {
+			return fmt.Errorf("unable to remove reference to hefty message. %v", err)
+		}
+		if references > 0 {
+			return nil
+		}
+
+		// a message sent since the reference was removed uploads the hefty message again, which deleting its version
+		// leaves in place; without a version, the references are counted again right before the delete
+		if versionId == "" {
+			references, err = storage.references.Increment(ctx, refKey)
+			if err != nil {
+				return fmt.Errorf("unable to count references to hefty message. %v", err)
+			}
+			_, _ = storage.references.Decrement(ctx, refKey)
+			if references > 1 {
+				return nil
+			}
+		}
+	}
+
+	err := storage.deletePayload(ctx, bucket, key, backend, versionId)
+	if err != nil && storage.cleanup != nil {
+		// the delete is retried in the background instead of failing the caller
+		if storage.cleanup.enqueue(ctx, PayloadCleanup{Bucket: bucket, Key: key, Backend: backend, VersionId: versionId, Err: err}) {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// deletePayload deletes a hefty message from the payload store of `backend`, or from AWS S3 when `backend` is empty
+func (storage *payloadStorage) deletePayload(ctx context.Context, bucket, key, backend, versionId string) error {
+	if backend != "" {
+		// delete hefty message from payload store
+		store, err := payloadStoreForBackend(storage.payloadStore, backend)
+		if err != nil {
+			return err
+		}
+
+		err = store.Delete(ctx, key)
+		if err != nil {
+			return fmt.Errorf("could not delete hefty message from %s payload store. %v", backend, err)
+		}
+
+		return nil
+	}
+
+	if err := storage.lazyBuckets.ensure(ctx, bucket); err != nil {
+		return err
+	}
+
+	// delete hefty message from s3
+	_, err := storage.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:              &bucket,
+		Key:                 &key,
+		VersionId:           optionalString(versionId),
+		ExpectedBucketOwner: optionalString(storage.ownership.expectedBucketOwner),
+	}, storage.s3OptFns...)
+	if err != nil {
+		// a hefty message that is already gone, e.g. deleted by a previous attempt or a lifecycle rule, is deleted
+		if isNoSuchKey(err) {
+			return nil
+		}
+
+		// hefty messages protected by object lock are reported instead of failing the delete
+		if storage.objectLockHandler != nil {
+			if locked, ok := storage.lockedObject(ctx, bucket, key, versionId, err); ok {
+				storage.objectLockHandler(ctx, locked)
+				return nil
+			}
+		}
+
+		return fmt.Errorf("could not delete s3 object for hefty message. %v", err)
+	}
+
+	return nil
+}
+
+// optionalString returns nil for an empty string so that optional AWS SDK input fields are left unset
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
+
+// optionalBool returns nil for false so that optional AWS SDK input fields are left unset
+func optionalBool(b bool) *bool {
+	if !b {
+		return nil
+	}
+
+	return &b
+}
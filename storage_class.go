@@ -0,0 +1,37 @@
+package hefty
+
+import (
+	"sort"
+
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// StorageClassPolicy returns the storage class a serialized hefty message of `size` bytes is uploaded to AWS S3 with.
+// An empty storage class uploads the hefty message using the storage class of WithStorageClass, or STANDARD.
+type StorageClassPolicy func(size int) s3types.StorageClass
+
+// StorageClassTier is a storage class used for hefty messages of at least MinSize bytes
+type StorageClassTier struct {
+	MinSize int
+	Class   s3types.StorageClass
+}
+
+// SizeTiers returns a StorageClassPolicy that uploads a hefty message with the storage class of the tier with the
+// largest MinSize that is at most the size of the hefty message, e.g. ONEZONE_IA for hefty messages of at least 5MB.
+// Hefty messages smaller than every tier use the default storage class.
+func SizeTiers(tiers ...StorageClassTier) StorageClassPolicy {
+	sorted := append([]StorageClassTier{}, tiers...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].MinSize > sorted[j].MinSize
+	})
+
+	return func(size int) s3types.StorageClass {
+		for _, tier := range sorted {
+			if size >= tier.MinSize {
+				return tier.Class
+			}
+		}
+
+		return ""
+	}
+}
@@ -0,0 +1,44 @@
+package hefty
+
+import (
+	"testing"
+
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorageClassFor(t *testing.T) {
+	tiers := SizeTiers(
+		StorageClassTier{MinSize: 5_242_880, Class: s3types.StorageClassOnezoneIa},
+		StorageClassTier{MinSize: 1_048_576, Class: s3types.StorageClassStandardIa},
+	)
+
+	var tests = []struct {
+		desc     string
+		class    s3types.StorageClass
+		policy   StorageClassPolicy
+		size     int
+		expClass s3types.StorageClass
+		expErr   bool
+	}{
+		{desc: "default", size: 1024, expClass: ""},
+		{desc: "storage_class", class: s3types.StorageClassIntelligentTiering, size: 1024, expClass: s3types.StorageClassIntelligentTiering},
+		{desc: "below_tiers_uses_storage_class", class: s3types.StorageClassIntelligentTiering, policy: tiers, size: 1024, expClass: s3types.StorageClassIntelligentTiering},
+		{desc: "lower_tier", policy: tiers, size: 1_048_576, expClass: s3types.StorageClassStandardIa},
+		{desc: "upper_tier", policy: tiers, size: 6_000_000, expClass: s3types.StorageClassOnezoneIa},
+		{desc: "archive_class", policy: func(int) s3types.StorageClass { return s3types.StorageClassGlacier }, expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			storage := &payloadStorage{storageClass: tt.class, storageClassPolicy: tt.policy}
+			class, err := storage.storageClassFor(tt.size)
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expClass, class)
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package hefty
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jo-parker/sqs-hefty/internal/messages"
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryStore struct {
+	payloads map[string][]byte
+}
+
+func (store *memoryStore) Backend() string { return "memory" }
+
+func (store *memoryStore) Put(_ context.Context, key string, payload []byte) error {
+	store.payloads[key] = payload
+	return nil
+}
+
+func (store *memoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	return store.payloads[key], nil
+}
+
+func (store *memoryStore) Delete(_ context.Context, key string) error {
+	delete(store.payloads, key)
+	return nil
+}
+
+type memoryCounter struct {
+	counts map[string]int64
+}
+
+func (counter *memoryCounter) Increment(_ context.Context, key string) (int64, error) {
+	counter.counts[key]++
+	return counter.counts[key], nil
+}
+
+func (counter *memoryCounter) Decrement(_ context.Context, key string) (int64, error) {
+	counter.counts[key]--
+	return counter.counts[key], nil
+}
+
+func TestPayloadStorageReferenceCounting(t *testing.T) {
+	store := &memoryStore{payloads: map[string][]byte{}}
+	counter := &memoryCounter{counts: map[string]int64{}}
+	storage := &payloadStorage{
+		payloadStore:       store,
+		payloadMaxSize:     1024,
+		contentAddressable: true,
+		references:         counter,
+	}
+
+	serialized := []byte("hefty message")
+	key := storage.contentDigest(serialized)
+
+	// two messages reference the same hefty message
+	for i := 0; i < 2; i++ {
+		refMsg := &types.ReferenceMsg{S3Bucket: "bucket", S3Key: key}
+		err := storage.put(context.TODO(), "queue", "", refMsg, serialized, nil, nil)
+		assert.Nil(t, err)
+		assert.True(t, refMsg.Counted)
+	}
+	assert.Equal(t, int64(2), counter.counts[referenceKey("", key, "memory")])
+
+	// the hefty message is kept while it is still referenced
+	err := storage.delete(context.TODO(), "", key, "memory", "", true)
+	assert.Nil(t, err)
+	assert.Contains(t, store.payloads, key)
+
+	// a message whose reference was not counted, e.g. sent without a reference counter, does not remove a reference
+	err = storage.delete(context.TODO(), "", key, "memory", "", false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), counter.counts[referenceKey("", key, "memory")])
+
+	err = storage.delete(context.TODO(), "", key, "memory", "", true)
+	assert.Nil(t, err)
+	assert.NotContains(t, store.payloads, key)
+}
+
+// racingCounter adds a reference, like a concurrent send of the same hefty message, once the last reference is removed
+type racingCounter struct {
+	memoryCounter
+	raced bool
+}
+
+func (counter *racingCounter) Decrement(ctx context.Context, key string) (int64, error) {
+	references, err := counter.memoryCounter.Decrement(ctx, key)
+	if references == 0 && !counter.raced {
+		counter.raced = true
+		_, _ = counter.memoryCounter.Increment(ctx, key)
+	}
+	return references, err
+}
+
+func TestPayloadStorageReferenceCountingConcurrentSend(t *testing.T) {
+	store := &memoryStore{payloads: map[string][]byte{}}
+	counter := &racingCounter{memoryCounter: memoryCounter{counts: map[string]int64{}}}
+	storage := &payloadStorage{
+		payloadStore:       store,
+		payloadMaxSize:     1024,
+		contentAddressable: true,
+		references:         counter,
+	}
+
+	serialized := []byte("hefty message")
+	key := storage.contentDigest(serialized)
+	err := storage.put(context.TODO(), "queue", "", &types.ReferenceMsg{S3Bucket: "bucket", S3Key: key}, serialized, nil, nil)
+	assert.Nil(t, err)
+
+	// the references are counted again before a hefty message without a version is deleted
+	err = storage.delete(context.TODO(), "", key, "memory", "", true)
+	assert.Nil(t, err)
+	assert.Contains(t, store.payloads, key)
+	assert.Equal(t, int64(1), counter.counts[referenceKey("", key, "memory")])
+}
+
+func TestPayloadStorageSha256Digests(t *testing.T) {
+	store := &memoryStore{payloads: map[string][]byte{}}
+	storage := &payloadStorage{
+		payloadStore:    store,
+		payloadMaxSize:  1024,
+		digestAlgorithm: string(DigestSha256),
+	}
+
+	heftyMsg := messages.NewHeftyMessage(aws.String("hefty message"), nil, 13)
+	serialized, _, _, err := heftyMsg.Serialize()
+	assert.Nil(t, err)
+
+	bodyDigest, attrDigest, err := messageDigests(storage.digestAlgorithm, serialized, heftyMsg)
+	assert.Nil(t, err)
+	assert.Len(t, bodyDigest, 64)
+	assert.Empty(t, attrDigest)
+
+	refMsg := &types.ReferenceMsg{S3Key: "queue/id", Md5DigestMsgBody: bodyDigest, DigestAlgorithm: storage.digestAlgorithm}
+	err = storage.put(context.TODO(), "queue", "", refMsg, serialized, nil, nil)
+	assert.Nil(t, err)
+
+	received, err := storage.getHeftyMessage(context.TODO(), "queue", refMsg)
+	assert.Nil(t, err)
+	assert.Equal(t, "hefty message", *received.Body)
+
+	// a digest of another algorithm does not verify
+	refMsg.DigestAlgorithm = ""
+	_, err = storage.getHeftyMessage(context.TODO(), "queue", refMsg)
+	assert.NotNil(t, err)
+}
+
+func TestPayloadStorageIntegrityError(t *testing.T) {
+	store := &memoryStore{payloads: map[string][]byte{}}
+	storage := &payloadStorage{
+		payloadStore:   store,
+		payloadMaxSize: 1024,
+	}
+
+	heftyMsg := messages.NewHeftyMessage(aws.String("hefty message"), nil, 13)
+	serialized, _, _, err := heftyMsg.Serialize()
+	assert.Nil(t, err)
+
+	refMsg := &types.ReferenceMsg{S3Key: "queue/id", Md5DigestMsgBody: messages.Md5Digest([]byte("other message"))}
+	err = storage.put(context.TODO(), "queue", "", refMsg, serialized, nil, nil)
+	assert.Nil(t, err)
+
+	_, err = storage.getHeftyMessage(context.TODO(), "queue", refMsg)
+	var integrityErr *IntegrityError
+	assert.ErrorAs(t, err, &integrityErr)
+	assert.Equal(t, DigestMd5, integrityErr.DigestAlgorithm)
+	assert.Equal(t, "queue/id", integrityErr.Key)
+	assert.Equal(t, messages.Md5Digest([]byte("hefty message")), integrityErr.BodyDigest)
+	assert.Equal(t, refMsg.Md5DigestMsgBody, integrityErr.ExpectedBodyDigest)
+}
+
+func TestNewPayloadStorageSkipBucketCheck(t *testing.T) {
+	// no AWS S3 client is needed when the bucket check is skipped
+	opts := defaultOptions()
+	assert.Nil(t, WithSkipBucketCheck()(&opts))
+	storage, err := newPayloadStorage(nil, "bucket", &opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "bucket", storage.bucket)
+
+	assert.Nil(t, WithAutoCreateBucket(BucketDefaults{})(&opts))
+	_, err = newPayloadStorage(nil, "bucket", &opts)
+	assert.NotNil(t, err)
+}
+
+func TestPayloadSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		refMsg  *types.ReferenceMsg
+		expSize int64
+	}{
+		{name: "recorded size", refMsg: &types.ReferenceMsg{Size: 100}, expSize: 100},
+		{name: "older version", refMsg: &types.ReferenceMsg{}, expSize: 0},
+		{name: "transformed", refMsg: &types.ReferenceMsg{Size: 100, StoredSize: 80, Transforms: []string{"gzip"}}, expSize: 80},
+		{name: "encrypted", refMsg: &types.ReferenceMsg{Size: 100, StoredSize: 128, EncryptedDataKey: []byte("key")}, expSize: 128},
+		{name: "transformed by older version", refMsg: &types.ReferenceMsg{Size: 100, Transforms: []string{"gzip"}}, expSize: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expSize, payloadSize(test.refMsg))
+		})
+	}
+}
+
+func TestPayloadStorageStoredSize(t *testing.T) {
+	store := &memoryStore{payloads: map[string][]byte{}}
+	storage := &payloadStorage{
+		payloadStore:     store,
+		payloadMaxSize:   1024,
+		clientEncryption: &clientSideEncryption{keys: &fakeKeys{keyId: "key-1"}, channels: map[string]struct{}{}},
+	}
+
+	serialized := []byte("hefty message")
+	refMsg := &types.ReferenceMsg{S3Key: "queue/id", Size: int64(len(serialized))}
+	err := storage.put(context.TODO(), "queue", "", refMsg, serialized, nil, nil)
+	assert.Nil(t, err)
+
+	// the length of the encrypted hefty message is recorded so that it is not looked up on receive
+	assert.Equal(t, int64(len(store.payloads["queue/id"])), refMsg.StoredSize)
+	assert.NotEqual(t, refMsg.Size, refMsg.StoredSize)
+	assert.Equal(t, refMsg.StoredSize, payloadSize(refMsg))
+}
+
+func TestNewPayloadStorageUploaderAndDownloader(t *testing.T) {
+	uploader := s3manager.NewUploader(nil)
+	downloader := s3manager.NewDownloader(nil)
+
+	opts := defaultOptions()
+	assert.Nil(t, WithSkipBucketCheck()(&opts))
+	assert.Nil(t, WithS3PathStyle()(&opts))
+	assert.Nil(t, WithUploader(uploader)(&opts))
+	assert.Nil(t, WithDownloader(downloader)(&opts))
+	assert.NotNil(t, WithUploader(nil)(&opts))
+	assert.NotNil(t, WithDownloader(nil)(&opts))
+
+	storage, err := newPayloadStorage(nil, "bucket", &opts)
+	assert.Nil(t, err)
+	assert.Same(t, uploader, storage.uploader)
+	assert.Same(t, downloader, storage.downloader)
+
+	// the options of the wrapper are applied per request without changing the uploader and downloader of the caller
+	uploaderCopy, downloaderCopy := *uploader, *downloader
+	storage.uploaderOptFns[0](&uploaderCopy)
+	storage.downloaderOptFns[0](&downloaderCopy)
+	assert.Len(t, uploaderCopy.ClientOptions, len(uploader.ClientOptions)+1)
+	assert.Len(t, downloaderCopy.ClientOptions, len(downloader.ClientOptions)+1)
+}
+
+// recordingS3API records the uploads and tagging calls of hefty messages
+type recordingS3API struct {
+	S3API
+	puts     []*s3.PutObjectInput
+	taggings []*s3.PutObjectTaggingInput
+}
+
+func (client *recordingS3API) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if _, err := io.Copy(io.Discard, params.Body); err != nil {
+		return nil, err
+	}
+
+	client.puts = append(client.puts, params)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (client *recordingS3API) PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	client.taggings = append(client.taggings, params)
+	return &s3.PutObjectTaggingOutput{}, nil
+}
+
+func TestPayloadStorageMetadataAndTags(t *testing.T) {
+	s3Client := &recordingS3API{}
+	wrapper, err := NewSqsClientWrapperFromAPI(&fakeSqsAPI{}, s3Client, "bucket", WithSkipBucketCheck(), AlwaysSendToS3(), TagWithMessageId())
+	assert.Nil(t, err)
+
+	queueUrl := "https://sqs.us-west-2.amazonaws.com/765908583888/queue"
+	body := strings.Repeat("hefty", 100)
+	before := time.Now().UTC().Truncate(time.Second)
+	_, err = wrapper.SendHeftyMessage(ContextWithPayloadTtl(context.TODO(), 7), &sqs.SendMessageInput{
+		QueueUrl:          aws.String(queueUrl),
+		MessageBody:       aws.String(body),
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{"attr": {DataType: aws.String("String"), StringValue: aws.String("value")}},
+	})
+	assert.Nil(t, err)
+
+	// the hefty message is uploaded with its metadata and expiration tag
+	assert.Len(t, s3Client.puts, 1)
+	put := s3Client.puts[0]
+	assert.Equal(t, queueUrl, put.Metadata[MetadataKeySource])
+	assert.Equal(t, strconv.Itoa(messages.FormatVersion), put.Metadata[MetadataKeyFormatVersion])
+	assert.Equal(t, strconv.Itoa(len(body)), put.Metadata[MetadataKeyBodySize])
+	assert.Equal(t, "1", put.Metadata[MetadataKeyAttributeCount])
+	uploaded, err := time.Parse(time.RFC3339, put.Metadata[KeySentTimestamp])
+	assert.Nil(t, err)
+	assert.False(t, uploaded.Before(before))
+
+	uploadTags, err := url.ParseQuery(aws.ToString(put.Tagging))
+	assert.Nil(t, err)
+	assert.Equal(t, "7", uploadTags.Get(TagKeyExpirationDays))
+
+	// once the reference message is sent, the hefty message is tagged with its message id and keeps its expiration tag
+	assert.Len(t, s3Client.taggings, 1)
+	tags := map[string]string{}
+	for _, tag := range s3Client.taggings[0].Tagging.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	assert.Equal(t, aws.ToString(put.Key), aws.ToString(s3Client.taggings[0].Key))
+	assert.Equal(t, "id", tags[TagKeyMessageId])
+	assert.Equal(t, "7", tags[TagKeyExpirationDays])
+	sent, err := time.Parse(time.RFC3339, tags[KeySentTimestamp])
+	assert.Nil(t, err)
+	assert.False(t, sent.Before(uploaded))
+}
@@ -0,0 +1,53 @@
+// Package azblobclient implements azurestore.BlobClient with an *azblob.Client of the Azure SDK. It is a separate module
+// so that the sqs-hefty module does not depend on the Azure SDK.
+package azblobclient
+
+import (
+	"context"
+	"io"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/jo-parker/sqs-hefty/stores/azurestore"
+)
+
+var _ azurestore.BlobClient = (*Client)(nil)
+
+// Client stores blobs with an *azblob.Client
+type Client struct {
+	client *azblob.Client
+}
+
+// New creates a BlobClient for azurestore.NewStore from an *azblob.Client
+func New(client *azblob.Client) *Client {
+	return &Client{client: client}
+}
+
+func (c *Client) UploadBlob(ctx context.Context, container, blob string, data []byte) error {
+	_, err := c.client.UploadBuffer(ctx, container, blob, data, nil)
+	return err
+}
+
+func (c *Client) DownloadBlob(ctx context.Context, container, blob string) ([]byte, error) {
+	res, err := c.client.DownloadStream(ctx, container, blob, nil)
+	if err != nil {
+		return nil, notFound(container, blob, err)
+	}
+	defer res.Body.Close()
+
+	return io.ReadAll(res.Body)
+}
+
+func (c *Client) DeleteBlob(ctx context.Context, container, blob string) error {
+	_, err := c.client.DeleteBlob(ctx, container, blob, nil)
+	return notFound(container, blob, err)
+}
+
+// notFound returns an *azurestore.BlobNotFoundError when `err` is caused by a blob that does not exist
+func notFound(container, blob string, err error) error {
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return &azurestore.BlobNotFoundError{Container: container, Blob: blob}
+	}
+
+	return err
+}
@@ -0,0 +1,110 @@
+package azblobclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/jo-parker/sqs-hefty/stores/azurestore"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBlobService is an Azure Blob Storage account keeping blobs in memory, which denies access to blobs under "denied/"
+type fakeBlobService struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func (service *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if strings.Contains(r.URL.Path, "/denied/") {
+		w.Header().Set("x-ms-error-code", "AuthorizationFailure")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	data, ok := service.blobs[r.URL.Path]
+	switch {
+	case r.Method == http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		service.blobs[r.URL.Path] = body
+		w.WriteHeader(http.StatusCreated)
+	case !ok:
+		w.Header().Set("x-ms-error-code", "BlobNotFound")
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(service.blobs, r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func newTestClient(t *testing.T) (*Client, *fakeBlobService) {
+	service := &fakeBlobService{blobs: map[string][]byte{}}
+	server := httptest.NewServer(service)
+	t.Cleanup(server.Close)
+
+	client, err := azblob.NewClientWithNoCredential(server.URL+"/account/", &azblob.ClientOptions{
+		ClientOptions: azcore.ClientOptions{Retry: policy.RetryOptions{MaxRetries: -1}},
+	})
+	assert.Nil(t, err)
+
+	return New(client), service
+}
+
+func TestClient(t *testing.T) {
+	client, service := newTestClient(t)
+	store := azurestore.NewStore(client, "container")
+
+	payload := []byte("hefty message")
+	err := store.Put(context.TODO(), "queue/key", payload)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, service.blobs["/account/container/queue/key"])
+
+	got, err := store.Get(context.TODO(), "queue/key")
+	assert.Nil(t, err)
+	assert.Equal(t, payload, got)
+
+	err = store.Delete(context.TODO(), "queue/key")
+	assert.Nil(t, err)
+	assert.Empty(t, service.blobs)
+
+	// missing blobs are reported as not found
+	_, err = store.Get(context.TODO(), "queue/key")
+	var notFound *azurestore.BlobNotFoundError
+	assert.ErrorAs(t, err, &notFound)
+	assert.Equal(t, &azurestore.BlobNotFoundError{Container: "container", Blob: "queue/key"}, notFound)
+
+	err = client.DeleteBlob(context.TODO(), "container", "queue/key")
+	assert.ErrorAs(t, err, &notFound)
+	assert.Nil(t, store.Delete(context.TODO(), "queue/key"))
+}
+
+func TestClientErrors(t *testing.T) {
+	client, _ := newTestClient(t)
+	store := azurestore.NewStore(client, "container")
+
+	var notFound *azurestore.BlobNotFoundError
+
+	err := store.Put(context.TODO(), "denied/key", []byte("hefty message"))
+	assert.ErrorContains(t, err, "AuthorizationFailure")
+
+	_, err = store.Get(context.TODO(), "denied/key")
+	assert.ErrorContains(t, err, "AuthorizationFailure")
+	assert.False(t, errors.As(err, &notFound))
+
+	err = store.Delete(context.TODO(), "denied/key")
+	assert.ErrorContains(t, err, "AuthorizationFailure")
+}
@@ -0,0 +1,79 @@
+// Package azurestore provides a hefty.PayloadStore that stores hefty messages in Azure Blob Storage. This allows AWS SQS
+// and AWS SNS to be used for messaging while hefty messages are kept in an Azure storage account.
+//
+// The package does not depend on the Azure SDK. Instead, Store uses the BlobClient interface, which is implemented for an
+// *azblob.Client from github.com/Azure/azure-sdk-for-go/sdk/storage/azblob by the separate module
+// github.com/jo-parker/sqs-hefty/stores/azurestore/azblobclient:
+//
+//	store := azurestore.NewStore(azblobclient.New(client), "hefty-messages")
+package azurestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jo-parker/sqs-hefty"
+)
+
+const Backend = "azureblob" // name of the backend recorded in reference messages
+
+var _ hefty.PayloadStore = (*Store)(nil)
+
+// BlobClient is the subset of Azure Blob Storage operations used by Store. DownloadBlob and DeleteBlob return a
+// *BlobNotFoundError when the blob does not exist.
+type BlobClient interface {
+	UploadBlob(ctx context.Context, container, blob string, data []byte) error
+	DownloadBlob(ctx context.Context, container, blob string) ([]byte, error)
+	DeleteBlob(ctx context.Context, container, blob string) error
+}
+
+// BlobNotFoundError is returned by a BlobClient for a blob that does not exist
+type BlobNotFoundError struct {
+	Container string
+	Blob      string
+}
+
+func (err *BlobNotFoundError) Error() string {
+	return fmt.Sprintf("blob %s not found in container %s", err.Blob, err.Container)
+}
+
+// Store stores hefty messages as block blobs in an Azure Blob Storage container. The key of a hefty message is used as the
+// blob name.
+type Store struct {
+	client    BlobClient
+	container string
+}
+
+// NewStore creates a payload store for the Azure Blob Storage container `containerName`.
+func NewStore(client BlobClient, containerName string) *Store {
+	return &Store{
+		client:    client,
+		container: containerName,
+	}
+}
+
+func (store *Store) Backend() string {
+	return Backend
+}
+
+func (store *Store) Put(ctx context.Context, key string, payload []byte) error {
+	return store.client.UploadBlob(ctx, store.container, key, payload)
+}
+
+func (store *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	return store.client.DownloadBlob(ctx, store.container, key)
+}
+
+// Delete deletes the blob of a hefty message. A hefty message that was already deleted is not an error, so that deletes
+// can be retried.
+func (store *Store) Delete(ctx context.Context, key string) error {
+	err := store.client.DeleteBlob(ctx, store.container, key)
+
+	var notFound *BlobNotFoundError
+	if errors.As(err, &notFound) {
+		return nil
+	}
+
+	return err
+}
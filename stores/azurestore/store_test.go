@@ -0,0 +1,89 @@
+package azurestore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClient keeps blobs in memory and fails every call with its error when it has one
+type fakeClient struct {
+	blobs map[string][]byte
+	err   error
+}
+
+func (c *fakeClient) UploadBlob(_ context.Context, container, blob string, data []byte) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	c.blobs[container+"/"+blob] = append([]byte{}, data...)
+	return nil
+}
+
+func (c *fakeClient) DownloadBlob(_ context.Context, container, blob string) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	data, ok := c.blobs[container+"/"+blob]
+	if !ok {
+		return nil, &BlobNotFoundError{Container: container, Blob: blob}
+	}
+	return data, nil
+}
+
+func (c *fakeClient) DeleteBlob(_ context.Context, container, blob string) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	if _, ok := c.blobs[container+"/"+blob]; !ok {
+		return &BlobNotFoundError{Container: container, Blob: blob}
+	}
+	delete(c.blobs, container+"/"+blob)
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	client := &fakeClient{blobs: map[string][]byte{}}
+	store := NewStore(client, "container")
+	assert.Equal(t, Backend, store.Backend())
+
+	payload := []byte("hefty message")
+	err := store.Put(context.TODO(), "queue/key", payload)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, client.blobs["container/queue/key"])
+
+	got, err := store.Get(context.TODO(), "queue/key")
+	assert.Nil(t, err)
+	assert.Equal(t, payload, got)
+
+	err = store.Delete(context.TODO(), "queue/key")
+	assert.Nil(t, err)
+	assert.Empty(t, client.blobs)
+
+	// a hefty message that was already deleted is not found, and deleting it again succeeds
+	_, err = store.Get(context.TODO(), "queue/key")
+	var notFound *BlobNotFoundError
+	assert.ErrorAs(t, err, &notFound)
+	assert.Equal(t, "blob queue/key not found in container container", err.Error())
+
+	err = store.Delete(context.TODO(), "queue/key")
+	assert.Nil(t, err)
+}
+
+func TestStoreErrors(t *testing.T) {
+	client := &fakeClient{blobs: map[string][]byte{"container/queue/key": []byte("hefty message")}, err: errors.New("service unavailable")}
+	store := NewStore(client, "container")
+
+	assert.ErrorContains(t, store.Put(context.TODO(), "queue/key", []byte("hefty message")), "service unavailable")
+
+	_, err := store.Get(context.TODO(), "queue/key")
+	assert.ErrorContains(t, err, "service unavailable")
+
+	assert.ErrorContains(t, store.Delete(context.TODO(), "queue/key"), "service unavailable")
+	assert.Len(t, client.blobs, 1)
+}
@@ -0,0 +1,102 @@
+package dynamostore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jo-parker/sqs-hefty"
+)
+
+const referencesAttribute = "references"
+
+var _ hefty.ReferenceCounter = (*Counter)(nil)
+
+// CounterClient is the subset of the AWS DynamoDB client used by Counter
+type CounterClient interface {
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// Counter is a hefty.ReferenceCounter that counts references in an AWS DynamoDB table whose partition key is a string
+// attribute named KeyAttribute. Counts are updated atomically and an item is removed once it has no references left.
+type Counter struct {
+	client CounterClient
+	table  string
+}
+
+// NewCounter creates a reference counter for the AWS DynamoDB table `tableName`
+func NewCounter(client CounterClient, tableName string) *Counter {
+	return &Counter{
+		client: client,
+		table:  tableName,
+	}
+}
+
+func (counter *Counter) Increment(ctx context.Context, key string) (int64, error) {
+	return counter.add(ctx, key, 1)
+}
+
+func (counter *Counter) Decrement(ctx context.Context, key string) (int64, error) {
+	references, err := counter.add(ctx, key, -1)
+	if err != nil {
+		return 0, err
+	}
+
+	if references <= 0 {
+		// only remove the item if no reference was added in the meantime
+		_, err = counter.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName:           aws.String(counter.table),
+			Key:                 counter.key(key),
+			ConditionExpression: aws.String("#references <= :zero"),
+			ExpressionAttributeNames: map[string]string{
+				"#references": referencesAttribute,
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":zero": &types.AttributeValueMemberN{Value: "0"},
+			},
+		})
+		var condErr *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &condErr) {
+			return 0, fmt.Errorf("unable to delete reference count. %v", err)
+		}
+	}
+
+	return references, nil
+}
+
+// add atomically adds `delta` to the number of references and returns the updated number of references
+func (counter *Counter) add(ctx context.Context, key string, delta int) (int64, error) {
+	out, err := counter.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(counter.table),
+		Key:              counter.key(key),
+		UpdateExpression: aws.String("ADD #references :delta"),
+		ExpressionAttributeNames: map[string]string{
+			"#references": referencesAttribute,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":delta": &types.AttributeValueMemberN{Value: strconv.Itoa(delta)},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to update reference count. %v", err)
+	}
+
+	references, ok := out.Attributes[referencesAttribute].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, errors.New("updated item is missing the reference count")
+	}
+
+	return strconv.ParseInt(references.Value, 10, 64)
+}
+
+func (counter *Counter) key(key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		KeyAttribute: &types.AttributeValueMemberS{Value: key},
+	}
+}
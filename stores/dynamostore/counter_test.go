@@ -0,0 +1,59 @@
+package dynamostore
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCounterClient struct {
+	counts map[string]int64
+}
+
+func (c *fakeCounterClient) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	key := params.Key[KeyAttribute].(*types.AttributeValueMemberS).Value
+	delta, _ := strconv.ParseInt(params.ExpressionAttributeValues[":delta"].(*types.AttributeValueMemberN).Value, 10, 64)
+	c.counts[key] += delta
+
+	return &dynamodb.UpdateItemOutput{Attributes: map[string]types.AttributeValue{
+		referencesAttribute: &types.AttributeValueMemberN{Value: strconv.FormatInt(c.counts[key], 10)},
+	}}, nil
+}
+
+func (c *fakeCounterClient) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	delete(c.counts, params.Key[KeyAttribute].(*types.AttributeValueMemberS).Value)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestCounter(t *testing.T) {
+	client := &fakeCounterClient{counts: map[string]int64{}}
+	counter := NewCounter(client, "table")
+
+	references, err := counter.Increment(context.TODO(), "bucket|key")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), references)
+
+	references, err = counter.Increment(context.TODO(), "bucket|key")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), references)
+
+	references, err = counter.Decrement(context.TODO(), "bucket|key")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), references)
+	assert.Len(t, client.counts, 1)
+
+	references, err = counter.Decrement(context.TODO(), "bucket|key")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), references)
+	assert.Empty(t, client.counts)
+
+	// decrementing a key that was never counted leaves no item behind
+	references, err = counter.Decrement(context.TODO(), "bucket|other")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), references)
+	assert.Empty(t, client.counts)
+}
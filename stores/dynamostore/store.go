@@ -0,0 +1,188 @@
+// Package dynamostore provides a hefty.PayloadStore that stores hefty messages in AWS DynamoDB. Storing medium sized
+// hefty messages in AWS DynamoDB avoids the latency of an AWS S3 round trip.
+package dynamostore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jo-parker/sqs-hefty"
+)
+
+const (
+	Backend          = "dynamodb" // name of the backend recorded in reference messages
+	KeyAttribute     = "key"      // name of the string partition key of the AWS DynamoDB table
+	DefaultChunkSize = 358_400    // 350KB; leaves room for the key and attribute names within the 400KB item size limit
+
+	payloadAttribute = "payload"
+	chunksAttribute  = "chunks"
+)
+
+var _ hefty.PayloadStore = (*Store)(nil)
+
+// Client is the subset of the AWS DynamoDB client used by Store
+type Client interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// ChunkNotFoundError is returned for a chunk of a hefty message that does not exist
+type ChunkNotFoundError struct {
+	Key   string
+	Index int
+}
+
+func (err *ChunkNotFoundError) Error() string {
+	return fmt.Sprintf("chunk %d of %s not found", err.Index+1, err.Key)
+}
+
+// Store stores hefty messages in an AWS DynamoDB table whose partition key is a string attribute named KeyAttribute.
+// A hefty message is stored as a single item when it fits within the chunk size and is otherwise split into chunks
+// stored as separate items. The first item records the number of chunks.
+type Store struct {
+	client    Client
+	table     string
+	chunkSize int
+}
+
+// NewStore creates a payload store for the AWS DynamoDB table `tableName`. Hefty messages are split into items of at
+// most `chunkSize` bytes; a value of 0 or less uses DefaultChunkSize.
+func NewStore(client Client, tableName string, chunkSize int) *Store {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	return &Store{
+		client:    client,
+		table:     tableName,
+		chunkSize: chunkSize,
+	}
+}
+
+func (store *Store) Backend() string {
+	return Backend
+}
+
+func (store *Store) Put(ctx context.Context, key string, payload []byte) error {
+	numChunks := (len(payload) + store.chunkSize - 1) / store.chunkSize
+	if numChunks == 0 {
+		numChunks = 1
+	}
+
+	// write the first item last so that a hefty message is never visible before all of its chunks are
+	for i := numChunks - 1; i >= 0; i-- {
+		chunk := payload[i*store.chunkSize : min((i+1)*store.chunkSize, len(payload))]
+		item := map[string]types.AttributeValue{
+			KeyAttribute:     &types.AttributeValueMemberS{Value: chunkKey(key, i)},
+			payloadAttribute: &types.AttributeValueMemberB{Value: chunk},
+		}
+		if i == 0 {
+			item[chunksAttribute] = &types.AttributeValueMemberN{Value: strconv.Itoa(numChunks)}
+		}
+
+		_, err := store.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(store.table),
+			Item:      item,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to put chunk %d of %d. %v", i+1, numChunks, err)
+		}
+	}
+
+	return nil
+}
+
+func (store *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	payload, numChunks, err := store.getChunk(ctx, key, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 1; i < numChunks; i++ {
+		chunk, _, err := store.getChunk(ctx, key, i)
+		if err != nil {
+			return nil, err
+		}
+		payload = append(payload, chunk...)
+	}
+
+	return payload, nil
+}
+
+func (store *Store) Delete(ctx context.Context, key string) error {
+	// a hefty message whose first chunk is missing was already deleted
+	_, numChunks, err := store.getChunk(ctx, key, 0)
+	var notFound *ChunkNotFoundError
+	if errors.As(err, &notFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// delete the first item last so that remaining chunks can still be found if a delete fails
+	for i := numChunks - 1; i >= 0; i-- {
+		_, err = store.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(store.table),
+			Key: map[string]types.AttributeValue{
+				KeyAttribute: &types.AttributeValueMemberS{Value: chunkKey(key, i)},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("unable to delete chunk %d of %d. %v", i+1, numChunks, err)
+		}
+	}
+
+	return nil
+}
+
+// getChunk returns the payload of a chunk and, for the first chunk, the total number of chunks
+func (store *Store) getChunk(ctx context.Context, key string, index int) ([]byte, int, error) {
+	out, err := store.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(store.table),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]types.AttributeValue{
+			KeyAttribute: &types.AttributeValueMemberS{Value: chunkKey(key, index)},
+		},
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to get chunk %d. %v", index+1, err)
+	}
+	if out.Item == nil {
+		return nil, 0, &ChunkNotFoundError{Key: key, Index: index}
+	}
+
+	payload, ok := out.Item[payloadAttribute].(*types.AttributeValueMemberB)
+	if !ok {
+		return nil, 0, errors.New("chunk is missing its payload")
+	}
+
+	numChunks := 1
+	if index == 0 {
+		chunks, ok := out.Item[chunksAttribute].(*types.AttributeValueMemberN)
+		if !ok {
+			return nil, 0, errors.New("first chunk is missing the number of chunks")
+		}
+		numChunks, err = strconv.Atoi(chunks.Value)
+		if err != nil || numChunks < 1 {
+			return nil, 0, fmt.Errorf("invalid number of chunks %s", chunks.Value)
+		}
+	}
+
+	return payload.Value, numChunks, nil
+}
+
+// chunkKey returns the partition key of a chunk; the first chunk uses the key of the hefty message itself
+func chunkKey(key string, index int) string {
+	if index == 0 {
+		return key
+	}
+
+	return fmt.Sprintf("%s#%d", key, index)
+}
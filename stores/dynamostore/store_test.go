@@ -0,0 +1,87 @@
+package dynamostore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClient struct {
+	items map[string]map[string]types.AttributeValue
+}
+
+func (c *fakeClient) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	c.items[params.Item[KeyAttribute].(*types.AttributeValueMemberS).Value] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (c *fakeClient) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: c.items[params.Key[KeyAttribute].(*types.AttributeValueMemberS).Value]}, nil
+}
+
+func (c *fakeClient) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	delete(c.items, params.Key[KeyAttribute].(*types.AttributeValueMemberS).Value)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestStore(t *testing.T) {
+	var tests = []struct {
+		desc        string
+		payloadSize int
+		expItems    int
+	}{
+		{desc: "empty_payload_1_item", payloadSize: 0, expItems: 1},
+		{desc: "payload_at_chunk_size_1_item", payloadSize: 10, expItems: 1},
+		{desc: "payload_over_chunk_size_2_items", payloadSize: 11, expItems: 2},
+		{desc: "payload_3_chunks_3_items", payloadSize: 25, expItems: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			client := &fakeClient{items: map[string]map[string]types.AttributeValue{}}
+			store := NewStore(client, "table", 10)
+
+			payload := make([]byte, tt.payloadSize)
+			for i := range payload {
+				payload[i] = byte(i)
+			}
+
+			err := store.Put(context.TODO(), "queue/key", payload)
+			assert.Nil(t, err)
+			assert.Len(t, client.items, tt.expItems)
+
+			got, err := store.Get(context.TODO(), "queue/key")
+			assert.Nil(t, err)
+			assert.Equal(t, payload, append([]byte{}, got...))
+
+			err = store.Delete(context.TODO(), "queue/key")
+			assert.Nil(t, err)
+			assert.Empty(t, client.items)
+		})
+	}
+}
+
+func TestStoreDeleteTwice(t *testing.T) {
+	client := &fakeClient{items: map[string]map[string]types.AttributeValue{}}
+	store := NewStore(client, "table", 10)
+
+	err := store.Put(context.TODO(), "queue/key", make([]byte, 25))
+	assert.Nil(t, err)
+
+	err = store.Delete(context.TODO(), "queue/key")
+	assert.Nil(t, err)
+	assert.Empty(t, client.items)
+
+	// a hefty message that was already deleted is not found, and deleting it again succeeds
+	_, err = store.Get(context.TODO(), "queue/key")
+	var notFound *ChunkNotFoundError
+	assert.True(t, errors.As(err, &notFound))
+	assert.Equal(t, "chunk 1 of queue/key not found", err.Error())
+
+	err = store.Delete(context.TODO(), "queue/key")
+	assert.Nil(t, err)
+}
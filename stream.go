@@ -0,0 +1,120 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// MessagesConfig configures Messages
+type MessagesConfig struct {
+	// VisibilityTimeout is the visibility timeout in seconds of received messages. The visibility timeout of the queue is
+	// used when 0.
+	VisibilityTimeout int32
+	// AttributeNames and MessageAttributeNames are the system attributes and message attributes received. All are
+	// received when nil.
+	AttributeNames        []sqstypes.QueueAttributeName
+	MessageAttributeNames []string
+	// Buffer is the number of received messages that wait in the channel for the caller. Every receive waits for a
+	// buffered message to be taken, so 0 receives one message at a time.
+	Buffer int
+}
+
+// MessageStream is a stream of messages received by Messages
+type MessageStream struct {
+	// C delivers the received messages. It is closed when the context of Messages was cancelled or a receive failed.
+	C   <-chan sqstypes.Message
+	err error
+}
+
+// Err returns the error that stopped the stream once C was closed, or nil when the stream was stopped by its context
+func (stream *MessageStream) Err() error {
+	return stream.err
+}
+
+// streamClient is the part of the AWS SQS client wrapper used by a MessageStream
+type streamClient interface {
+	ReceiveHeftyMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	ChangeHeftyMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+// Messages receives the messages of the queue `queueUrl` with ReceiveHeftyMessage and long polling until `ctx` is
+// cancelled, and delivers them one at a time on the channel of the returned stream. It hides the receive loop from
+// callers that do not need a Consumer:
+//
+//	stream := sqsHeftyClient.Messages(ctx, queueUrl, hefty.MessagesConfig{})
+//	for msg := range stream.C {
+//		// handle and delete msg with DeleteHeftyMessage
+//	}
+//	if err := stream.Err(); err != nil {
+//		// a receive failed
+//	}
+//
+// Messages are not deleted; the caller deletes them once they were handled. Messages that were received but not
+// delivered when `ctx` is cancelled are made visible again, so that they are received again right away.
+func (wrapper *SqsClientWrapper) Messages(ctx context.Context, queueUrl string, config MessagesConfig) *MessageStream {
+	return streamMessages(ctx, wrapper, queueUrl, config)
+}
+
+func streamMessages(ctx context.Context, client streamClient, queueUrl string, config MessagesConfig) *MessageStream {
+	if config.AttributeNames == nil {
+		config.AttributeNames = []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameAll}
+	}
+	if config.MessageAttributeNames == nil {
+		config.MessageAttributeNames = []string{"All"}
+	}
+
+	c := make(chan sqstypes.Message, config.Buffer)
+	stream := &MessageStream{C: c}
+
+	go func() {
+		defer close(c)
+
+		for ctx.Err() == nil {
+			out, err := client.ReceiveHeftyMessage(ctx, &sqs.ReceiveMessageInput{
+				QueueUrl:              aws.String(queueUrl),
+				MaxNumberOfMessages:   int32(min(max(config.Buffer, 1), maxReceiveMessages)),
+				WaitTimeSeconds:       maxWaitTimeSeconds,
+				VisibilityTimeout:     config.VisibilityTimeout,
+				AttributeNames:        config.AttributeNames,
+				MessageAttributeNames: config.MessageAttributeNames,
+			})
+			if err != nil {
+				if ctx.Err() == nil {
+					stream.err = fmt.Errorf("unable to receive messages from %s. %v", queueUrl, err)
+				}
+				return
+			}
+
+			for i, msg := range out.Messages {
+				select {
+				case c <- msg:
+				case <-ctx.Done():
+					stream.err = releaseMessages(context.WithoutCancel(ctx), client, queueUrl, out.Messages[i:])
+					return
+				}
+			}
+		}
+	}()
+
+	return stream
+}
+
+// releaseMessages makes messages that were received but not delivered visible again
+func releaseMessages(ctx context.Context, client streamClient, queueUrl string, msgs []sqstypes.Message) error {
+	for _, msg := range msgs {
+		_, err := client.ChangeHeftyMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(queueUrl),
+			ReceiptHandle:     msg.ReceiptHandle,
+			VisibilityTimeout: 0,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to release message %s. %v", aws.ToString(msg.MessageId), err)
+		}
+	}
+
+	return nil
+}
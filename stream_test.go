@@ -0,0 +1,39 @@
+package hefty
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamMessages(t *testing.T) {
+	client := &fakeConsumerClient{pending: 5}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stream := streamMessages(ctx, client, "queue", MessagesConfig{})
+	assert.Equal(t, "msg-1", aws.ToString((<-stream.C).MessageId))
+	assert.Equal(t, "msg-2", aws.ToString((<-stream.C).MessageId))
+	cancel()
+
+	delivered := 2
+	for range stream.C {
+		delivered++
+	}
+	assert.NoError(t, stream.Err())
+
+	// a message that was received but not delivered is released
+	assert.Equal(t, client.received-delivered, len(client.extended))
+	assert.Equal(t, int32(1), client.maxBatch)
+}
+
+func TestStreamMessagesReceiveError(t *testing.T) {
+	client := &fakeConsumerClient{receiveErr: errors.New("access denied")}
+
+	stream := streamMessages(context.Background(), client, "queue", MessagesConfig{Buffer: 20})
+	_, ok := <-stream.C
+	assert.False(t, ok)
+	assert.ErrorContains(t, stream.Err(), "access denied")
+}
@@ -0,0 +1,68 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// TenantExtractor returns the tenant a message sent to AWS SQS belongs to, e.g. from one of its message attributes.
+// The tenant is used as the first segment of the key of the hefty message so that each tenant's hefty messages are
+// stored under their own prefix. Messages published to AWS SNS are given with the topic arn as the queue url, and
+// deletes without a tenant in their context, see ContextWithTenant, with only the queue url of the delete.
+type TenantExtractor func(params *sqs.SendMessageInput) string
+
+type tenantContextKey struct{}
+
+// ContextWithTenant returns a context that makes DeleteHeftyMessage only delete the hefty message when it belongs to
+// `tenant`, for tenants that cannot be extracted from the queue url alone, e.g. tenants taken from message attributes.
+// It has no effect without WithTenantExtractor.
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// requestTenant returns the tenant a delete of a message of `queueUrl` is made for: the tenant of the context, or the
+// tenant `extractor` returns for the queue url
+func requestTenant(ctx context.Context, extractor TenantExtractor, queueUrl *string) string {
+	if tenant, ok := ctx.Value(tenantContextKey{}).(string); ok {
+		return tenant
+	}
+
+	return extractor(&sqs.SendMessageInput{QueueUrl: queueUrl})
+}
+
+// tenantKey prepends the tenant segment to the key of a hefty message
+func tenantKey(tenant, key string) (string, error) {
+	if err := validateTenant(tenant); err != nil {
+		return "", err
+	}
+
+	return tenant + "/" + key, nil
+}
+
+// validateTenantKey checks that the key of a hefty message starts with the segment of `tenant`
+func validateTenantKey(tenant, key string) error {
+	if err := validateTenant(tenant); err != nil {
+		return err
+	}
+
+	keyTenant, _, found := strings.Cut(key, "/")
+	if !found {
+		return fmt.Errorf("key %s does not have a tenant segment", key)
+	}
+	if keyTenant != tenant {
+		return fmt.Errorf("key %s does not belong to tenant %s", key, tenant)
+	}
+
+	return nil
+}
+
+func validateTenant(tenant string) error {
+	if tenant == "" || tenant == "." || tenant == ".." || strings.ContainsAny(tenant, "/|") {
+		return fmt.Errorf("invalid tenant '%s'; tenants must not be empty, '.' or '..', or contain '/' or '|'", tenant)
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package hefty
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantKey(t *testing.T) {
+	var tests = []struct {
+		desc   string
+		tenant string
+		expKey string
+		expErr bool
+	}{
+		{desc: "tenant", tenant: "acme", expKey: "acme/queue/id"},
+		{desc: "empty_tenant", tenant: "", expErr: true},
+		{desc: "tenant_with_slash", tenant: "acme/eu", expErr: true},
+		{desc: "tenant_with_pipe", tenant: "acme|eu", expErr: true},
+		{desc: "parent_dir_tenant", tenant: "..", expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			key, err := tenantKey(tt.tenant, "queue/id")
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expKey, key)
+			assert.Nil(t, validateTenantKey(tt.tenant, key))
+		})
+	}
+}
+
+func TestValidateTenantKey(t *testing.T) {
+	assert.Nil(t, validateTenantKey("acme", "acme/queue/id"))
+	assert.NotNil(t, validateTenantKey("acme", "id"))
+	assert.NotNil(t, validateTenantKey("acme", "/queue/id"))
+	assert.NotNil(t, validateTenantKey("acme", "other/queue/id"))
+	assert.NotNil(t, validateTenantKey("", "acme/queue/id"))
+}
+
+func TestPublishHeftyMessageOfTenant(t *testing.T) {
+	store := &memoryStore{payloads: map[string][]byte{}}
+	extractor := func(params *sqs.SendMessageInput) string {
+		return aws.ToString(params.MessageAttributes["tenant"].StringValue)
+	}
+	wrapper, err := NewSnsClientWrapperFromAPI(&fakeSnsAPI{}, &fakeS3API{}, "bucket", WithSkipBucketCheck(), AlwaysSendToS3(), WithPayloadStore(store, 1024), WithTenantExtractor(extractor))
+	assert.Nil(t, err)
+
+	attributes := map[string]snstypes.MessageAttributeValue{"tenant": {DataType: aws.String("String"), StringValue: aws.String("acme")}}
+	_, err = wrapper.PublishHeftyMessage(context.TODO(), &sns.PublishInput{TopicArn: aws.String("arn:aws:sns:us-west-2:765908583888:topic"), Message: aws.String("hefty message"), MessageAttributes: attributes})
+	assert.Nil(t, err)
+
+	assert.Len(t, store.payloads, 1)
+	for key := range store.payloads {
+		assert.True(t, strings.HasPrefix(key, "acme/"))
+	}
+
+	// publishes without a tenant fail
+	_, err = wrapper.PublishHeftyMessage(context.TODO(), &sns.PublishInput{TopicArn: aws.String("arn:aws:sns:us-west-2:765908583888:topic"), Message: aws.String("hefty message")})
+	assert.NotNil(t, err)
+}
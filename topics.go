@@ -0,0 +1,46 @@
+package hefty
+
+import (
+	"github.com/jo-parker/sqs-hefty/limits"
+)
+
+// TopicConfig overrides the settings of the AWS SNS client wrapper for messages published to a single topic
+type TopicConfig struct {
+	// Bucket is the bucket hefty messages published to the topic are stored in. The bucket of the client wrapper is
+	// used when empty.
+	Bucket string
+	// Prefix is prepended to the key of hefty messages published to the topic and is used as is.
+	Prefix string
+	// Threshold is the message size in bytes above which messages published to the topic are stored as hefty messages.
+	// The AWS SNS message size limit is used when 0 or greater than the limit.
+	Threshold int
+	// PreserveAttributes keeps the message attributes on the reference message published to the topic, so that
+	// subscription filter policies still apply to hefty messages. The message attributes are still stored in the hefty
+	// message, and count toward the AWS SNS message size limit of the reference message.
+	PreserveAttributes bool
+}
+
+// threshold returns the message size above which messages published to the topic are stored as hefty messages
+func (config TopicConfig) threshold() int {
+	limit := limits.MaxMessageLength(limits.SNS)
+	if config.Threshold <= 0 || config.Threshold > limit {
+		return limit
+	}
+
+	return config.Threshold
+}
+
+// topicBucketSelector returns a bucket selector that selects the bucket and prefix of the topic configuration of a topic
+// arn, falling back on `fallback` for topics without a bucket or prefix.
+func topicBucketSelector(topics map[string]TopicConfig, fallback BucketSelector) BucketSelector {
+	return func(topicArn string) (string, string) {
+		if config, ok := topics[topicArn]; ok && (config.Bucket != "" || config.Prefix != "") {
+			return config.Bucket, config.Prefix
+		}
+		if fallback != nil {
+			return fallback(topicArn)
+		}
+
+		return "", ""
+	}
+}
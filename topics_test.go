@@ -0,0 +1,42 @@
+package hefty
+
+import (
+	"testing"
+
+	"github.com/jo-parker/sqs-hefty/limits"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicConfigThreshold(t *testing.T) {
+	var tests = []struct {
+		desc         string
+		threshold    int
+		expThreshold int
+	}{
+		{desc: "default_limit", threshold: 0, expThreshold: limits.MaxMessageLength(limits.SNS)},
+		{desc: "below_limit", threshold: 1024, expThreshold: 1024},
+		{desc: "above_limit", threshold: limits.MaxMessageLength(limits.SNS) + 1, expThreshold: limits.MaxMessageLength(limits.SNS)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			assert.Equal(t, tt.expThreshold, TopicConfig{Threshold: tt.threshold}.threshold())
+		})
+	}
+}
+
+func TestTopicBucketSelector(t *testing.T) {
+	topics := map[string]TopicConfig{
+		"arn:aws:sns:us-west-2:765908583888:Orders":  {Bucket: "orders-bucket", Prefix: "orders/"},
+		"arn:aws:sns:us-west-2:765908583888:Metrics": {Threshold: 1024},
+	}
+	selector := topicBucketSelector(topics, func(string) (string, string) { return "fallback-bucket", "" })
+
+	bucket, prefix := selector("arn:aws:sns:us-west-2:765908583888:Orders")
+	assert.Equal(t, "orders-bucket", bucket)
+	assert.Equal(t, "orders/", prefix)
+
+	bucket, prefix = selector("arn:aws:sns:us-west-2:765908583888:Metrics")
+	assert.Equal(t, "fallback-bucket", bucket)
+	assert.Equal(t, "", prefix)
+}
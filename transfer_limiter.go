@@ -0,0 +1,60 @@
+package hefty
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// TransferLimiter limits the number of hefty messages uploaded to or downloaded from AWS S3 at the same time. A limiter
+// can be given to multiple wrappers, e.g. an AWS SQS and an AWS SNS client wrapper in the same process, so that they
+// share a single limit. Each upload or download of a hefty message counts as one transfer, regardless of the number of
+// parts it is transferred in. Transfers wait until the limiter has room or their context is done.
+type TransferLimiter struct {
+	slots   chan struct{}
+	waiting atomic.Int64
+}
+
+// NewTransferLimiter creates a transfer limiter allowing `maxTransfers` transfers at the same time. A `maxTransfers` below 1
+// allows a single transfer.
+func NewTransferLimiter(maxTransfers int) *TransferLimiter {
+	return &TransferLimiter{
+		slots: make(chan struct{}, max(maxTransfers, 1)),
+	}
+}
+
+// InFlight returns the number of transfers in progress.
+func (limiter *TransferLimiter) InFlight() int {
+	return len(limiter.slots)
+}
+
+// Waiting returns the number of transfers waiting for the limiter to have room.
+func (limiter *TransferLimiter) Waiting() int64 {
+	return limiter.waiting.Load()
+}
+
+// acquire waits for room for a transfer and returns the function releasing it. A nil limiter does not limit transfers.
+func (limiter *TransferLimiter) acquire(ctx context.Context) (func(), error) {
+	if limiter == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case limiter.slots <- struct{}{}:
+	default:
+		limiter.waiting.Add(1)
+		defer limiter.waiting.Add(-1)
+
+		select {
+		case limiter.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("unable to start s3 transfer. %v", ctx.Err())
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-limiter.slots })
+	}, nil
+}
@@ -0,0 +1,48 @@
+package hefty
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferLimiter(t *testing.T) {
+	limiter := NewTransferLimiter(2)
+
+	first, err := limiter.acquire(context.TODO())
+	assert.Nil(t, err)
+	second, err := limiter.acquire(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, limiter.InFlight())
+
+	// a transfer waits for room until its context is done
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	_, err = limiter.acquire(ctx)
+	assert.ErrorContains(t, err, context.DeadlineExceeded.Error())
+	assert.Equal(t, int64(0), limiter.Waiting())
+
+	// releasing twice frees a single transfer
+	first()
+	first()
+	assert.Equal(t, 1, limiter.InFlight())
+
+	third, err := limiter.acquire(context.TODO())
+	assert.Nil(t, err)
+	second()
+	third()
+	assert.Equal(t, 0, limiter.InFlight())
+}
+
+func TestTransferLimiterNil(t *testing.T) {
+	var limiter *TransferLimiter
+	release, err := limiter.acquire(context.TODO())
+	assert.Nil(t, err)
+	release()
+
+	opts := defaultOptions()
+	assert.NotNil(t, WithTransferLimiter(nil)(&opts))
+	assert.Equal(t, 1, cap(NewTransferLimiter(0).slots))
+}
@@ -0,0 +1,210 @@
+package hefty
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Transform is applied to serialized hefty messages before they are stored and reversed after they are retrieved, e.g.
+// to compress or redact them. Reverse must restore the exact bytes given to Apply. The names of the transforms applied
+// to a hefty message are recorded in its reference message, so the receiver must be configured with transforms of the
+// same names. Transforms are applied before client side encryption.
+type Transform interface {
+	// Name identifies the transform in reference messages. It must not be empty or contain ','.
+	Name() string
+	// Apply transforms a serialized hefty message.
+	Apply(ctx context.Context, payload io.Reader) (io.Reader, error)
+	// Reverse restores a serialized hefty message transformed by Apply.
+	Reverse(ctx context.Context, payload io.Reader) (io.Reader, error)
+}
+
+// transformChain applies transforms in order and reverses them in reverse order
+type transformChain struct {
+	transforms []Transform
+	byName     map[string]Transform
+}
+
+func newTransformChain(transforms []Transform) (*transformChain, error) {
+	chain := &transformChain{
+		transforms: transforms,
+		byName:     map[string]Transform{},
+	}
+	for _, transform := range transforms {
+		if transform == nil {
+			return nil, errors.New("transform must not be nil")
+		}
+
+		name := transform.Name()
+		if name == "" || strings.Contains(name, ",") {
+			return nil, fmt.Errorf("invalid transform name '%s'", name)
+		}
+		if _, ok := chain.byName[name]; ok {
+			return nil, fmt.Errorf("duplicate transform %s", name)
+		}
+		chain.byName[name] = transform
+	}
+
+	return chain, nil
+}
+
+// apply applies the chain to a serialized hefty message and records it in the reference message
+func (chain *transformChain) apply(ctx context.Context, refMsg *types.ReferenceMsg, serialized []byte) ([]byte, error) {
+	if chain == nil || len(chain.transforms) == 0 {
+		return serialized, nil
+	}
+
+	payload, err := chain.applyReader(ctx, refMsg, bytes.NewReader(serialized))
+	if err != nil {
+		return nil, err
+	}
+
+	transformed, err := io.ReadAll(payload)
+	if err != nil {
+		return nil, fmt.Errorf("unable to apply transforms. %v", err)
+	}
+
+	return transformed, nil
+}
+
+// applyReader applies the chain to a serialized hefty message read from `payload` and records it in the reference message
+func (chain *transformChain) applyReader(ctx context.Context, refMsg *types.ReferenceMsg, payload io.Reader) (io.Reader, error) {
+	if chain == nil {
+		return payload, nil
+	}
+
+	for _, transform := range chain.transforms {
+		var err error
+		payload, err = transform.Apply(ctx, payload)
+		if err != nil {
+			return nil, fmt.Errorf("unable to apply transform %s. %v", transform.Name(), err)
+		}
+		refMsg.Transforms = append(refMsg.Transforms, transform.Name())
+	}
+
+	return payload, nil
+}
+
+// reverse reverses the transforms recorded in the reference message
+func (chain *transformChain) reverse(ctx context.Context, refMsg *types.ReferenceMsg, payload []byte) ([]byte, error) {
+	if len(refMsg.Transforms) == 0 {
+		return payload, nil
+	}
+
+	var reader io.Reader = bytes.NewReader(payload)
+	for i := len(refMsg.Transforms) - 1; i >= 0; i-- {
+		name := refMsg.Transforms[i]
+
+		var transform Transform
+		if chain != nil {
+			transform = chain.byName[name]
+		}
+		if transform == nil {
+			return nil, fmt.Errorf("no transform configured for %s", name)
+		}
+
+		var err error
+		reader, err = transform.Reverse(ctx, reader)
+		if err != nil {
+			return nil, fmt.Errorf("unable to reverse transform %s. %v", name, err)
+		}
+	}
+
+	reversed, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reverse transforms. %v", err)
+	}
+
+	return reversed, nil
+}
+
+// Gzip returns a Transform that compresses hefty messages using gzip
+func Gzip() Transform {
+	return gzipTransform{}
+}
+
+type gzipTransform struct{}
+
+func (gzipTransform) Name() string {
+	return "gzip"
+}
+
+func (gzipTransform) Apply(_ context.Context, payload io.Reader) (io.Reader, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := io.Copy(writer, payload); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return &buf, nil
+}
+
+func (gzipTransform) Reverse(_ context.Context, payload io.Reader) (io.Reader, error) {
+	return gzip.NewReader(payload)
+}
+
+const (
+	ZstdMinLevel     = 1
+	ZstdDefaultLevel = 3
+	ZstdMaxLevel     = 22
+)
+
+// Zstd returns a Transform that compresses hefty messages using zstd at compression level `level`, which is clamped to
+// the range [ZstdMinLevel, ZstdMaxLevel]. Zstd is considerably faster than Gzip for large hefty messages. The level only
+// affects senders; receivers can decompress hefty messages of any level. The levels are mapped to the speeds of
+// github.com/klauspost/compress/zstd, so that the compressed hefty messages can be decompressed by any zstd decoder.
+func Zstd(level int) Transform {
+	return zstdTransform{
+		level: min(max(level, ZstdMinLevel), ZstdMaxLevel),
+	}
+}
+
+type zstdTransform struct {
+	level int
+}
+
+func (zstdTransform) Name() string {
+	return "zstd"
+}
+
+func (transform zstdTransform) Apply(_ context.Context, payload io.Reader) (io.Reader, error) {
+	var buf bytes.Buffer
+	writer, err := zstd.NewWriter(&buf, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(transform.level)), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(writer, payload); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return &buf, nil
+}
+
+func (zstdTransform) Reverse(_ context.Context, payload io.Reader) (io.Reader, error) {
+	reader, err := zstd.NewReader(payload, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var buf bytes.Buffer
+	if _, err = io.Copy(&buf, reader); err != nil {
+		return nil, err
+	}
+
+	return &buf, nil
+}
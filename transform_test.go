@@ -0,0 +1,136 @@
+package hefty
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+// reverseBytes is a reversible transform which makes the order of transforms observable
+type reverseBytes struct{}
+
+func (reverseBytes) Name() string { return "reverse" }
+
+func (reverseBytes) Apply(_ context.Context, payload io.Reader) (io.Reader, error) {
+	b, err := io.ReadAll(payload)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return bytes.NewReader(b), nil
+}
+
+func (transform reverseBytes) Reverse(ctx context.Context, payload io.Reader) (io.Reader, error) {
+	return transform.Apply(ctx, payload)
+}
+
+func TestTransformChain(t *testing.T) {
+	serialized := bytes.Repeat([]byte("hefty message "), 100)
+
+	var tests = []struct {
+		desc          string
+		send          []Transform
+		receive       []Transform
+		expTransforms []string
+		expErr        bool
+	}{
+		{desc: "no_transforms", expTransforms: nil},
+		{desc: "gzip", send: []Transform{Gzip()}, receive: []Transform{Gzip()}, expTransforms: []string{"gzip"}},
+		{desc: "gzip_then_reverse", send: []Transform{Gzip(), reverseBytes{}}, receive: []Transform{reverseBytes{}, Gzip()}, expTransforms: []string{"gzip", "reverse"}},
+		{desc: "zstd", send: []Transform{Zstd(ZstdDefaultLevel)}, receive: []Transform{Zstd(ZstdMinLevel)}, expTransforms: []string{"zstd"}},
+		{desc: "receiver_missing_transform", send: []Transform{Gzip()}, expTransforms: []string{"gzip"}, expErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			send, err := newTransformChain(tt.send)
+			assert.Nil(t, err)
+			receive, err := newTransformChain(tt.receive)
+			assert.Nil(t, err)
+
+			refMsg := &types.ReferenceMsg{}
+			transformed, err := send.apply(context.TODO(), refMsg, serialized)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expTransforms, refMsg.Transforms)
+
+			reversed, err := receive.reverse(context.TODO(), refMsg, transformed)
+			if tt.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, serialized, reversed)
+		})
+	}
+}
+
+func TestNewTransformChain(t *testing.T) {
+	_, err := newTransformChain([]Transform{Gzip(), Gzip()})
+	assert.NotNil(t, err)
+
+	_, err = newTransformChain([]Transform{nil})
+	assert.NotNil(t, err)
+}
+
+func TestZstdLevel(t *testing.T) {
+	var tests = []struct {
+		desc     string
+		level    int
+		expLevel int
+	}{
+		{desc: "default", level: ZstdDefaultLevel, expLevel: ZstdDefaultLevel},
+		{desc: "below_min", level: 0, expLevel: ZstdMinLevel},
+		{desc: "above_max", level: 30, expLevel: ZstdMaxLevel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			assert.Equal(t, tt.expLevel, Zstd(tt.level).(zstdTransform).level)
+		})
+	}
+}
+
+func TestZstdRoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte("hefty message "), 10000)
+	decoder, err := zstd.NewReader(nil)
+	assert.Nil(t, err)
+	defer decoder.Close()
+
+	for _, level := range []int{ZstdMinLevel, ZstdDefaultLevel, ZstdMaxLevel} {
+		compressed, err := Zstd(level).Apply(context.TODO(), bytes.NewReader(payload))
+		assert.Nil(t, err)
+		compressedBytes, err := io.ReadAll(compressed)
+		assert.Nil(t, err)
+		assert.Less(t, len(compressedBytes), len(payload)/10)
+
+		// the compressed hefty message is a zstd frame any decoder can decompress
+		decoded, err := decoder.DecodeAll(compressedBytes, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, payload, decoded)
+
+		reversed, err := Zstd(ZstdDefaultLevel).Reverse(context.TODO(), bytes.NewReader(compressedBytes))
+		assert.Nil(t, err)
+		reversedBytes, err := io.ReadAll(reversed)
+		assert.Nil(t, err)
+		assert.Equal(t, payload, reversedBytes)
+	}
+
+	// hefty messages compressed by another encoder are decompressed
+	encoder, err := zstd.NewWriter(nil)
+	assert.Nil(t, err)
+	reversed, err := Zstd(ZstdDefaultLevel).Reverse(context.TODO(), bytes.NewReader(encoder.EncodeAll(payload, nil)))
+	assert.Nil(t, err)
+	reversedBytes, err := io.ReadAll(reversed)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, reversedBytes)
+
+	_, err = Zstd(ZstdDefaultLevel).Reverse(context.TODO(), bytes.NewReader([]byte("not zstd")))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,67 @@
+package hefty
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// Codec decodes the bodies of messages handled by a TypedHandler
+type Codec interface {
+	Unmarshal(body []byte, v any) error
+}
+
+// jsonCodec decodes message bodies as json
+type jsonCodec struct{}
+
+// JSONCodec decodes message bodies as json. It is the default codec of typed consumers.
+func JSONCodec() Codec {
+	return jsonCodec{}
+}
+
+func (jsonCodec) Unmarshal(body []byte, v any) error {
+	return json.Unmarshal(body, v)
+}
+
+// MessageMeta describes the message a TypedHandler handles
+type MessageMeta struct {
+	MessageId         string
+	QueueUrl          string
+	Attributes        map[string]string
+	MessageAttributes map[string]sqstypes.MessageAttributeValue
+}
+
+// TypedHandler handles the body of a message decoded into T, see Consume
+type TypedHandler[T any] func(ctx context.Context, msg T, meta MessageMeta) error
+
+// Decode adapts a TypedHandler to a Handler that decodes message bodies into T with `codec`, or as json when `codec`
+// is nil. A message that cannot be decoded fails, so that it ends up in the dead-letter queue of its queue.
+func Decode[T any](codec Codec, handler TypedHandler[T]) Handler {
+	if codec == nil {
+		codec = JSONCodec()
+	}
+
+	return func(ctx context.Context, msg sqstypes.Message) error {
+		var decoded T
+		if err := codec.Unmarshal([]byte(aws.ToString(msg.Body)), &decoded); err != nil {
+			return fmt.Errorf("unable to decode message %s. %v", aws.ToString(msg.MessageId), err)
+		}
+
+		return handler(ctx, decoded, MessageMeta{
+			MessageId:         aws.ToString(msg.MessageId),
+			QueueUrl:          ConsumedQueueUrl(ctx),
+			Attributes:        msg.Attributes,
+			MessageAttributes: msg.MessageAttributes,
+		})
+	}
+}
+
+// Consume starts consuming the queue `queueUrl` like StartConsumer, with the message bodies decoded into T by the codec
+// of `config`, so that handlers do not deal with AWS SQS messages. Methods cannot have type parameters, so Consume is a
+// function taking the wrapper.
+func Consume[T any](ctx context.Context, wrapper *SqsClientWrapper, queueUrl string, handler TypedHandler[T], config ConsumerConfig) *Consumer {
+	return wrapper.StartConsumer(ctx, queueUrl, Decode(config.Codec, handler), config)
+}
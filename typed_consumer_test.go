@@ -0,0 +1,37 @@
+package hefty
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type order struct {
+	Id    string `json:"id"`
+	Total int    `json:"total"`
+}
+
+func TestDecode(t *testing.T) {
+	var decoded order
+	var meta MessageMeta
+	handler := Decode(nil, func(ctx context.Context, msg order, m MessageMeta) error {
+		decoded, meta = msg, m
+		return nil
+	})
+
+	ctx := context.WithValue(context.Background(), consumedQueueUrlKey{}, "orders")
+	err := handler(ctx, sqstypes.Message{
+		MessageId:  aws.String("message-id"),
+		Body:       aws.String(`{"id":"o-1","total":42}`),
+		Attributes: map[string]string{"ApproximateReceiveCount": "1"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, order{Id: "o-1", Total: 42}, decoded)
+	assert.Equal(t, MessageMeta{MessageId: "message-id", QueueUrl: "orders", Attributes: map[string]string{"ApproximateReceiveCount": "1"}}, meta)
+
+	err = handler(ctx, sqstypes.Message{MessageId: aws.String("message-id"), Body: aws.String("not json")})
+	assert.ErrorContains(t, err, "unable to decode message message-id")
+}
@@ -0,0 +1,41 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const inlineMsgIdentifierKey = "5e0c8d7f1b2a4c39a6f4e2d1b8c7a905"
+
+var jsonInlineMsgPrefix string
+
+func init() {
+	jsonInlineMsgPrefix = fmt.Sprintf("{\"identifier\":\"%s\",", inlineMsgIdentifierKey)
+}
+
+// InlineMsg is what is sent to AWS SQS or AWS SNS in place of a message whose body was transformed, e.g. compressed, to
+// fit within the message size limit.
+type InlineMsg struct {
+	Identifier string `json:"identifier"` // used to identify an inline message from other types of messages
+	Transform  string `json:"transform"`  // name of the transform applied to the message body
+	Body       []byte `json:"body"`
+}
+
+func NewInlineMsg(transform string, body []byte) *InlineMsg {
+	return &InlineMsg{
+		Identifier: inlineMsgIdentifierKey,
+		Transform:  transform,
+		Body:       body,
+	}
+}
+
+func ToInlineMsg(msg string) (*InlineMsg, error) {
+	var inlineMsg InlineMsg
+	err := json.Unmarshal([]byte(msg), &inlineMsg)
+	return &inlineMsg, err
+}
+
+func IsInlineMsg(msg string) bool {
+	return strings.HasPrefix(msg, jsonInlineMsgPrefix)
+}
@@ -0,0 +1,27 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInlineMessageSerialization(t *testing.T) {
+	expected := `{"identifier":"%s","transform":"gzip","body":"Y29tcHJlc3NlZA=="}`
+	expected = fmt.Sprintf(expected, inlineMsgIdentifierKey)
+	testInlineMsg := NewInlineMsg("gzip", []byte("compressed"))
+
+	j, err := json.Marshal(testInlineMsg)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, string(j))
+
+	assert.True(t, IsInlineMsg(string(j)))
+	assert.False(t, IsInlineMsg("foo"))
+	assert.False(t, IsReferenceMsg(string(j)))
+
+	inlineMsg2, err := ToInlineMsg(string(j))
+	assert.Nil(t, err)
+	assert.Equal(t, testInlineMsg, inlineMsg2)
+}
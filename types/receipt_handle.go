@@ -0,0 +1,13 @@
+package types
+
+// ReceiptHandle is the receipt handle returned by ReceiveHeftyMessage for a hefty message, holding the receipt handle of
+// the reference message and the location of the hefty message.
+type ReceiptHandle struct {
+	ReceiptHandle string // receipt handle of the reference message in AWS SQS
+	Bucket        string
+	Key           string
+	Backend       string // payload store holding the hefty message; empty for AWS S3
+	VersionId     string // version of the hefty message in a versioned AWS S3 bucket
+	Counted       bool   // reference to the hefty message is counted; see hefty.WithReferenceCounter
+	StoreId       string // id of the receipt handle in a receipt handle store; the other fields are empty when set
+}
@@ -16,12 +16,26 @@ func init() {
 
 // ReferenceMsg is what is sent to AWS SQS or AWS SNS in place of hefty message stored in AWS S3.
 type ReferenceMsg struct {
-	Identifier       string `json:"identifier"` // used to identify a reference message from other types of messages
-	S3Region         string `json:"s3_region"`
-	S3Bucket         string `json:"s3_bucket"`
-	S3Key            string `json:"s3_key"`
-	Md5DigestMsgBody string `json:"md5_digest_msg_body"`
-	Md5DigestMsgAttr string `json:"md5_digest_msg_attr"`
+	Identifier          string   `json:"identifier"` // used to identify a reference message from other types of messages
+	S3Region            string   `json:"s3_region"`
+	S3Bucket            string   `json:"s3_bucket"`
+	S3Key               string   `json:"s3_key"`
+	Md5DigestMsgBody    string   `json:"md5_digest_msg_body"`             // digest using DigestAlgorithm
+	Md5DigestMsgAttr    string   `json:"md5_digest_msg_attr"`             // digest using DigestAlgorithm
+	DigestAlgorithm     string   `json:"digest_algorithm,omitempty"`      // algorithm of the digests; empty for md5
+	Backend             string   `json:"backend,omitempty"`               // payload store holding the hefty message; empty for AWS S3
+	S3VersionId         string   `json:"s3_version_id,omitempty"`         // version of the hefty message in a versioned AWS S3 bucket
+	Transforms          []string `json:"transforms,omitempty"`            // names of the transforms applied to the hefty message in order
+	S3ChecksumAlgorithm string   `json:"s3_checksum_algorithm,omitempty"` // checksum stored by AWS S3 and validated on download
+	PresignedUrl        string   `json:"presigned_url,omitempty"`         // time-limited url to get the hefty message without AWS S3 credentials
+	Size                int64    `json:"size,omitempty"`                  // bytes of the serialized hefty message; 0 for reference messages of older versions
+	StoredSize          int64    `json:"stored_size,omitempty"`           // bytes stored when the hefty message was transformed or encrypted; 0 otherwise
+	Counted             bool     `json:"counted,omitempty"`               // reference to the hefty message is counted; see hefty.WithReferenceCounter
+
+	// client side encryption; see hefty.WithClientSideEncryption
+	EncryptedDataKey  []byte            `json:"encrypted_data_key,omitempty"`
+	KeyId             string            `json:"key_id,omitempty"`
+	EncryptionContext map[string]string `json:"encryption_context,omitempty"`
 }
 
 type SNSMessage struct {
@@ -37,3 +37,38 @@ func ErrorMsg(msgBody string) (*messages.ErrorMsg, bool) {
 
 	return ret, true
 }
+
+// ParseReceiptHandle determines if a receipt handle returned by ReceiveHeftyMessage belongs to a hefty message and
+// returns its components. Receipt handles that are not signed with `signingKey` are rejected when it is not empty; see
+// WithReceiptHandleSigningKey. Short receipt handles created with WithReceiptHandleStore only have a StoreId.
+func ParseReceiptHandle(receiptHandle string, signingKey []byte) (*types.ReceiptHandle, bool, error) {
+	handle, ok, err := decodeHeftyReceiptHandle(receiptHandle, signingKey)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+
+	return &types.ReceiptHandle{
+		ReceiptHandle: handle.receiptHandle,
+		Bucket:        handle.bucket,
+		Key:           handle.key,
+		Backend:       handle.backend,
+		VersionId:     handle.versionId,
+		Counted:       handle.counted,
+		StoreId:       handle.ref,
+	}, true, nil
+}
+
+// ComposeReceiptHandle creates the receipt handle of a hefty message from its components, which can be used with
+// DeleteHeftyMessage and ChangeHeftyMessageVisibility. The receipt handle is signed with `signingKey` when it is not
+// empty.
+func ComposeReceiptHandle(handle *types.ReceiptHandle, signingKey []byte) string {
+	return heftyReceiptHandle{
+		receiptHandle: handle.ReceiptHandle,
+		bucket:        handle.Bucket,
+		key:           handle.Key,
+		backend:       handle.Backend,
+		versionId:     handle.VersionId,
+		counted:       handle.Counted,
+		ref:           handle.StoreId,
+	}.encode(signingKey)
+}
@@ -0,0 +1,39 @@
+package hefty
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/jo-parker/sqs-hefty/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAndComposeReceiptHandle(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	var tests = []struct {
+		desc       string
+		handle     *types.ReceiptHandle
+		signingKey []byte
+	}{
+		{desc: "bucket", handle: &types.ReceiptHandle{ReceiptHandle: "AQEB", Bucket: "my-bucket", Key: "queue/id"}},
+		{desc: "versioned_bucket", handle: &types.ReceiptHandle{ReceiptHandle: "AQEB", Bucket: "my-bucket", Key: "queue/id", VersionId: "3HL4kqtJlcpXroDTDmJ.rmSpXd3dIbrHY"}},
+		{desc: "payload_store", handle: &types.ReceiptHandle{ReceiptHandle: "AQEB", Key: "queue/id", Backend: "dynamodb"}},
+		{desc: "receipt_handle_store", handle: &types.ReceiptHandle{StoreId: "f47ac10b-58cc-4372-a567-0e02b2c3d479"}},
+		{desc: "signed", handle: &types.ReceiptHandle{ReceiptHandle: "AQEB", Bucket: "my-bucket", Key: "queue/id"}, signingKey: key},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			handle, ok, err := ParseReceiptHandle(ComposeReceiptHandle(tt.handle, tt.signingKey), tt.signingKey)
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, tt.handle, handle)
+		})
+	}
+
+	handle, ok, err := ParseReceiptHandle(base64.StdEncoding.EncodeToString([]byte("AQEB")), nil)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, handle)
+}